@@ -10,11 +10,18 @@ package checks
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,11 +30,11 @@ import (
 	"github.com/maruel/pre-commit-go/scm"
 )
 
-// CheckPrerequisite describe a Go package that is needed to run a Check.
+// CheckPrerequisite describe a tool that is needed to run a Check.
 //
 // It must list a command that is to be executed and the expected exit code to
 // verify that the custom tool is properly installed. If the executable is not
-// detected, "go get $URL" will be executed.
+// detected, InstallCommand is executed, or "go get $URL" if it is not set.
 type CheckPrerequisite struct {
 	// HelpCommand is the help command to run to detect if this prerequisite is
 	// installed or not. This command should have no adverse effect and must be
@@ -37,15 +44,40 @@ type CheckPrerequisite struct {
 	ExpectedExitCode int `yaml:"expected_exit_code"`
 	// URL is the url to fetch as `go get URL`.
 	URL string
+	// InstallCommand is the command to run instead of `go get URL` to install
+	// a tool that is not a Go package, e.g. ["npm", "install", "-g", "foo"].
+	InstallCommand []string `yaml:"install_command,omitempty"`
+	// Timeout is the maximum number of seconds HelpCommand may take to run. If
+	// it takes longer, the prerequisite is assumed to not be present. If 0,
+	// DefaultPrerequisiteTimeout is used.
+	Timeout int `yaml:"timeout,omitempty"`
 }
 
+// DefaultPrerequisiteTimeout is the maximum time HelpCommand may take to run
+// when CheckPrerequisite.Timeout is not set.
+const DefaultPrerequisiteTimeout = 5 * time.Second
+
 // IsPresent returns true if the prerequisite is present on the system.
 func (c *CheckPrerequisite) IsPresent() bool {
-	_, exitCode, _ := internal.Capture(cwd, nil, c.HelpCommand...)
+	_, exitCode, err := internal.CaptureTimeout(cwd, nil, c.GetTimeout(), c.HelpCommand...)
+	if err == internal.ErrTimeout {
+		log.Printf("warning: %s took more than %s; assuming it is not present", strings.Join(c.HelpCommand, " "), c.GetTimeout())
+		return false
+	}
 	return exitCode == c.ExpectedExitCode
 }
 
+// GetTimeout returns the maximum duration HelpCommand may take to run.
+func (c *CheckPrerequisite) GetTimeout() time.Duration {
+	if c.Timeout > 0 {
+		return time.Duration(c.Timeout) * time.Second
+	}
+	return DefaultPrerequisiteTimeout
+}
+
 // Check describes an check to be executed on the code base.
+//
+// Third party checks implement it and are added with Register().
 type Check interface {
 	// GetDescription returns the check description.
 	GetDescription() string
@@ -58,12 +90,79 @@ type Check interface {
 	Run(change scm.Change, options *Options) error
 }
 
+// Trigger is embedded in the expensive checks, to only run them when the
+// change touches some files. It is applied by IsTriggered().
+type Trigger struct {
+	// TriggerPaths are the glob patterns, as matched by path.Match(), of the
+	// files that trigger the check, e.g. "proto/*.proto". A pattern without "/"
+	// matches the base name. When none of the modified files match, the check
+	// is skipped as not triggered. If empty, the check always runs.
+	TriggerPaths []string `yaml:"trigger_paths,omitempty"`
+}
+
+// IsTriggered returns false if check has a Trigger and none of the files
+// modified in change match its TriggerPaths.
+func IsTriggered(check Check, change scm.Change) (bool, error) {
+	t, ok := check.(interface {
+		trigger() *Trigger
+	})
+	if !ok || len(t.trigger().TriggerPaths) == 0 {
+		return true, nil
+	}
+	patterns := t.trigger().TriggerPaths
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return false, fmt.Errorf("invalid trigger path %q: %s", p, err)
+		}
+	}
+	for _, f := range change.Changed().Files() {
+		if matchPatterns(patterns, f) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ExplainFile returns why check skips the file p, as per the options shared by the checks, i.e. trigger_paths and
+// skip_test_files. p is relative to the root of the change. Returns nil when
+// p is processed like any other file.
+func ExplainFile(check Check, p string) []string {
+	var out []string
+	if t, ok := check.(interface {
+		trigger() *Trigger
+	}); ok {
+		if patterns := t.trigger().TriggerPaths; len(patterns) != 0 && !matchPatterns(patterns, p) {
+			out = append(out, fmt.Sprintf("not triggered by it, trigger_paths is %s", strings.Join(patterns, ", ")))
+		}
+	}
+	if f, ok := check.(interface {
+		fileFilter() *FileFilter
+	}); ok && f.fileFilter().SkipTestFiles && isTestFile(p) {
+		out = append(out, "skipped as per skip_test_files")
+	}
+	return out
+}
+
 // Native checks.
 
 // Build builds packages without tests via 'go build'.
 type Build struct {
-	BuildAll  bool     `yaml:"build_all"`
+	// BuildAll forces building every packages. By default, only the packages
+	// without tests are built; packages with tests are built by check test.
+	BuildAll bool `yaml:"build_all"`
+	// ExtraArgs are additional arguments to go build, e.g. "-tags foo".
 	ExtraArgs []string `yaml:"extra_args"`
+	// CGODisabled builds with CGO_ENABLED=0 to ensure the packages can be
+	// statically linked. On failure, the packages using cgo are listed.
+	CGODisabled bool `yaml:"cgo_disabled"`
+	// GCFlags are passed to the compiler via -gcflags, e.g. "-m" to print the
+	// escape analysis decisions or "-d=checkptr".
+	GCFlags []string `yaml:"gcflags"`
+	// GCFlagsBaseline is the path, relative to the repository root, of a file
+	// listing the expected compiler diagnostics printed because of GCFlags. When
+	// set, the diagnostics not in this file are reported as regressions.
+	GCFlagsBaseline string `yaml:"gcflags_baseline"`
+	Trigger         `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -104,9 +203,26 @@ func (b *Build) Run(change scm.Change, options *Options) error {
 		return nil
 	}
 
+	var env []string
+	if b.CGODisabled {
+		env = []string{"CGO_ENABLED=0"}
+	}
 	args := append([]string{"go", "build"}, b.ExtraArgs...)
-	out, _, _, err := options.Capture(change.Repo(), append(args, pkgs...)...)
+	if len(b.GCFlags) != 0 {
+		args = append(args, "-gcflags="+strings.Join(b.GCFlags, " "))
+	}
+	out, exitCode, _, err := options.CaptureEnv(change.Repo(), env, append(args, pkgs...)...)
+	if len(b.GCFlags) != 0 && exitCode == 0 && err == nil {
+		// The output is the compiler diagnostics.
+		return b.checkDiagnostics(change, out)
+	}
 	if len(out) != 0 {
+		if b.CGODisabled {
+			if cgo := cgoPackages(change, options, pkgs); len(cgo) != 0 {
+				out += "\npackages using cgo:\n  " + strings.Join(cgo, "\n  ")
+			}
+			return fmt.Errorf("CGO_ENABLED=0 %s failed: %s", strings.Join(args, " "), out)
+		}
 		return fmt.Errorf("%s failed: %s", strings.Join(args, " "), out)
 	}
 	if err != nil {
@@ -115,9 +231,86 @@ func (b *Build) Run(change scm.Change, options *Options) error {
 	return nil
 }
 
+// checkDiagnostics compares the compiler diagnostics printed because of
+// GCFlags with the baseline, if any.
+func (b *Build) checkDiagnostics(change scm.Change, out string) error {
+	diagnostics := compilerDiagnostics(out)
+	log.Printf("%d compiler diagnostics:\n%s", len(diagnostics), strings.Join(diagnostics, "\n"))
+	if b.GCFlagsBaseline == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(change.Repo().Root(), b.GCFlagsBaseline))
+	if err != nil {
+		return fmt.Errorf("failed to read gcflags_baseline: %s", err)
+	}
+	expected := map[string]int{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			expected[line]++
+		}
+	}
+	var regressions []string
+	for _, d := range diagnostics {
+		if expected[d] > 0 {
+			expected[d]--
+		} else {
+			regressions = append(regressions, d)
+		}
+	}
+	if len(regressions) != 0 {
+		return fmt.Errorf("compiler diagnostics not in %s:\n%s", b.GCFlagsBaseline, strings.Join(regressions, "\n"))
+	}
+	return nil
+}
+
+// compilerDiagnostics returns the sorted compiler diagnostics in out as
+// "file: message", without the line numbers so they are stable across
+// unrelated edits.
+func compilerDiagnostics(out string) []string {
+	var diagnostics []string
+	for _, line := range strings.Split(out, "\n") {
+		if m := reDiagnostic.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			diagnostics = append(diagnostics, filepath.ToSlash(m[1])+": "+m[2])
+		}
+	}
+	sort.Strings(diagnostics)
+	return diagnostics
+}
+
+// cgoPackages returns the non standard packages using cgo that pkgs depend
+// on, including themselves.
+func cgoPackages(change scm.Change, options *Options, pkgs []string) []string {
+	out, exitCode, _, _ := options.Capture(change.Repo(), append([]string{"go", "list", "-f", "{{.ImportPath}}{{range .Deps}}\n{{.}}{{end}}"}, pkgs...)...)
+	if exitCode != 0 {
+		return nil
+	}
+	deps := []string{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" && !seen[line] {
+			seen[line] = true
+			deps = append(deps, line)
+		}
+	}
+	out, exitCode, _, _ = options.Capture(change.Repo(), append([]string{"go", "list", "-f", "{{if and .CgoFiles (not .Standard)}}{{.ImportPath}}{{end}}"}, deps...)...)
+	if exitCode != 0 {
+		return nil
+	}
+	var cgo []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			cgo = append(cgo, line)
+		}
+	}
+	sort.Strings(cgo)
+	return cgo
+}
+
 // Copyright looks for copyright headers in all files.
 type Copyright struct {
-	Header string
+	// Header is the text that all files must start with.
+	Header     string
+	FileFilter `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -137,29 +330,84 @@ func (c *Copyright) GetPrerequisites() []CheckPrerequisite {
 
 // Run implements Check.
 func (c *Copyright) Run(change scm.Change, options *Options) error {
-	var badFiles []string
+	var issues Issues
 	prefix := []byte(c.Header)
 	// This this serially since it's I/O bound and will compete with process
 	// startup of other checks.
 	for _, f := range change.Changed().GoFiles() {
-		if !change.IsIgnored(f) {
-			if content := change.Content(f); content != nil {
-				if !bytes.HasPrefix(content, prefix) {
-					badFiles = append(badFiles, f)
-				}
-			} else {
-				badFiles = append(badFiles, f)
+		if !change.IsIgnored(f) && !c.skip(f) {
+			if content := change.Content(f); content == nil || !bytes.HasPrefix(content, prefix) {
+				issues = append(issues, fileIssue(f, "invalid copyright header"))
 			}
 		}
 	}
-	if len(badFiles) != 0 {
-		return fmt.Errorf("files have invalid copyright header:\n  %s", strings.Join(badFiles, "\n  "))
-	}
+	return issuesError(c.GetName(), issues)
+}
+
+// FileSize flags the modified files larger than a maximum size.
+//
+// It catches the binaries and the huge generated files committed by accident.
+// All the files are checked, not only the Go source files; the files matching
+// ignore_patterns are skipped.
+type FileSize struct {
+	// MaxBytes is the maximum size of a file in bytes.
+	MaxBytes int64 `yaml:"max_bytes"`
+	// PackagesOnly only checks the files in the directories containing Go
+	// source files.
+	PackagesOnly bool `yaml:"packages_only"`
+	FileFilter   `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (f *FileSize) GetDescription() string {
+	return "enforces a maximum file size"
+}
+
+// GetName implements Check.
+func (f *FileSize) GetName() string {
+	return "filesize"
+}
+
+// GetPrerequisites implements Check.
+func (f *FileSize) GetPrerequisites() []CheckPrerequisite {
 	return nil
 }
 
+// Run implements Check.
+func (f *FileSize) Run(change scm.Change, options *Options) error {
+	if f.MaxBytes <= 0 {
+		return errors.New("filesize: max_bytes is required")
+	}
+	var pkgDirs map[string]bool
+	if f.PackagesOnly {
+		pkgDirs = map[string]bool{}
+		for _, p := range change.All().GoFiles() {
+			pkgDirs[filepath.Dir(p)] = true
+		}
+	}
+	var issues Issues
+	root := change.Repo().Root()
+	for _, p := range change.Changed().Files() {
+		if change.IsIgnored(p) || f.skip(p) || (pkgDirs != nil && !pkgDirs[filepath.Dir(p)]) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(root, p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if size := fi.Size(); size > f.MaxBytes {
+			issues = append(issues, fileIssue(p, "%d bytes, max is %d", size, f.MaxBytes))
+		}
+	}
+	return issuesError(f.GetName(), issues)
+}
+
 // Gofmt runs gofmt in check mode with code simplification enabled.
 type Gofmt struct {
+	FileFilter `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -186,14 +434,16 @@ func (g *Gofmt) Run(change scm.Change, options *Options) error {
 	// modified files is already in memory.
 	out, _, _, err := options.Capture(change.Repo(), "gofmt", "-l", "-s", ".")
 	// Split the files to ignore as needed.
-	files := []string{}
+	var issues Issues
 	for _, line := range strings.Split(string(out), "\n") {
-		if len(line) != 0 && !change.IsIgnored(line) {
-			files = append(files, line)
+		// gofmt prints OS specific paths but the config uses POSIX paths.
+		line = filepath.ToSlash(line)
+		if len(line) != 0 && !change.IsIgnored(line) && !g.skip(line) {
+			issues = append(issues, fileIssue(line, "improperly formatted, please run: gofmt -w -s %s", line))
 		}
 	}
-	if len(files) != 0 {
-		return fmt.Errorf("these files are improperly formmatted, please run: gofmt -w -s .\n%s", strings.Join(files, "\n"))
+	if len(issues) != 0 {
+		return issuesError(g.GetName(), issues)
 	}
 	if err != nil {
 		return fmt.Errorf("gofmt -l -s . failed: %s", err)
@@ -203,7 +453,38 @@ func (g *Gofmt) Run(change scm.Change, options *Options) error {
 
 // Test runs all tests via go test.
 type Test struct {
+	// ExtraArgs are additional arguments to go test, e.g. "-short" or "-race".
 	ExtraArgs []string `yaml:"extra_args"`
+	// RaceAffectedOnly, when ExtraArgs contains "-race" and the checks are run
+	// on a subset of the repository, e.g. with -r, only uses the race detector
+	// on the packages affected by the change: the modified packages and the
+	// ones importing them. The other packages are tested without -race. When
+	// the imports can't be resolved, e.g. outside of GOPATH without go.mod,
+	// every package is tested with -race.
+	RaceAffectedOnly bool `yaml:"race_affected_only"`
+	// JSONOutput runs go test with -json and only reports the output of the
+	// failing tests and subtests, instead of the whole output of the failing
+	// packages. The output not related to a test, like a build error, is
+	// reported as is when no test failed.
+	JSONOutput bool `yaml:"json_output,omitempty"`
+	// ResourceLimits limits the memory and the CPU time of go test and of the
+	// processes it starts, including the test executable, so a runaway test
+	// fails instead of taking down the machine. Only supported on linux.
+	ResourceLimits ResourceLimits `yaml:"resource_limits,omitempty"`
+	Trigger        `yaml:",inline"`
+}
+
+// ResourceLimits are the limits applied to each process.
+type ResourceLimits struct {
+	// MaxMemoryMB is the maximum virtual memory of each process in MiB, set
+	// with "ulimit -v". It applies to each process separately, not to the test
+	// run as a whole. If 0, it is not limited. Keep it generous, the compiler
+	// is limited too.
+	MaxMemoryMB int `yaml:"max_memory_mb"`
+	// MaxCPUSeconds is the maximum CPU time of each process in seconds, set
+	// with "ulimit -t". It applies to each process separately, not to the test
+	// run as a whole. If 0, it is not limited.
+	MaxCPUSeconds int `yaml:"max_cpu_seconds"`
 }
 
 // GetDescription implements Check.
@@ -225,23 +506,64 @@ func (t *Test) GetPrerequisites() []CheckPrerequisite {
 func (t *Test) Run(change scm.Change, options *Options) error {
 	// go test accepts packages, not files.
 	var wg sync.WaitGroup
-	testPkgs := change.Indirect().TestPackages()
+	testPkgs, noRace := t.testPackages(change)
 	errs := make(chan error, len(testPkgs))
+	limited := t.ResourceLimits != ResourceLimits{}
+	if limited && !internal.LimitsSupported {
+		options.Notice("%s", Message(MsgWarning, fmt.Sprintf("resource_limits is not supported on %s, ignoring", runtime.GOOS)))
+		limited = false
+	}
 	for _, tp := range testPkgs {
 		wg.Add(1)
 		go func(testPkg string) {
 			defer wg.Done()
-			args := append(
-				[]string{
-					"go", "test",
-					"-timeout", fmt.Sprintf("%ds", options.MaxDuration),
-				},
-				t.ExtraArgs...)
+			args := []string{
+				"go", "test",
+				"-timeout", fmt.Sprintf("%ds", options.MaxDuration),
+			}
+			for _, arg := range t.ExtraArgs {
+				if arg != "-race" || !noRace[testPkg] {
+					args = append(args, arg)
+				}
+			}
+			if t.JSONOutput {
+				args = append(args, "-json")
+			} else if options.tests != nil && !hasArg(args, "-v") {
+				// Individual test durations are only printed in verbose mode.
+				args = append(args, "-v")
+			}
 			args = append(args, testPkg)
-			out, exitCode, duration, _ := options.Capture(change.Repo(), args...)
+			run := args
+			if limited {
+				run = internal.WithLimits(args, t.ResourceLimits.MaxMemoryMB, t.ResourceLimits.MaxCPUSeconds)
+			}
+			out, exitCode, duration, _ := options.Capture(change.Repo(), run...)
 			if duration > time.Second {
 				log.Printf("%s was slow: %s", args, round(duration, time.Millisecond))
 			}
+			if limited && exitCode != 0 && exceededLimits(out) {
+				errs <- fmt.Errorf("%s failed: exceeded resource_limits (max_memory_mb: %d, max_cpu_seconds: %d):\n%s", strings.Join(args, " "), t.ResourceLimits.MaxMemoryMB, t.ResourceLimits.MaxCPUSeconds, processStackTrace(out))
+				return
+			}
+			if t.JSONOutput {
+				summary, timings := parseTestJSON(out)
+				if options.tests != nil {
+					for _, timing := range timings {
+						options.tests.record(testPkg+" "+timing.Name, timing.Duration)
+					}
+				}
+				if exitCode != 0 {
+					errs <- fmt.Errorf("%s failed:\n%s", strings.Join(args, " "), processStackTrace(summary))
+				}
+				return
+			}
+			if options.tests != nil {
+				for _, m := range reTestResult.FindAllStringSubmatch(out, -1) {
+					if d, err := time.ParseDuration(m[2] + "s"); err == nil {
+						options.tests.record(testPkg+" "+m[1], d)
+					}
+				}
+			}
 			if exitCode != 0 {
 				errs <- fmt.Errorf("%s failed:\n%s", strings.Join(args, " "), processStackTrace(out))
 			}
@@ -256,9 +578,258 @@ func (t *Test) Run(change scm.Change, options *Options) error {
 	return nil
 }
 
+// testPackages returns the packages to test and the ones to test without
+// -race as per RaceAffectedOnly.
+func (t *Test) testPackages(change scm.Change) ([]string, map[string]bool) {
+	affected := change.Indirect().TestPackages()
+	all := change.All().TestPackages()
+	if !t.RaceAffectedOnly || !hasArg(t.ExtraArgs, "-race") || len(affected) == len(all) {
+		return affected, nil
+	}
+	if change.Package() == "" {
+		// The importers of the modified packages are unknown.
+		log.Printf("the packages affected by the change are unknown; using -race on all of them")
+		return all, nil
+	}
+	noRace := map[string]bool{}
+	for _, p := range all {
+		noRace[p] = true
+	}
+	for _, p := range affected {
+		delete(noRace, p)
+	}
+	return all, noRace
+}
+
+// IsBuildFailure returns true if err, as returned by check.Run(), means that
+// the code doesn't compile. It is the case for any failure of check build and
+// for the failures of check test to build a package.
+func IsBuildFailure(check Check, err error) bool {
+	if err == nil {
+		return false
+	}
+	switch check.(type) {
+	case *Build:
+		return true
+	case *Test:
+		s := err.Error()
+		return strings.Contains(s, " [build failed]") || strings.Contains(s, " [setup failed]")
+	}
+	return false
+}
+
+// Golden runs all tests with flags to regenerate golden files in a scratch
+// copy of the checkout and fails if any file would change.
+//
+// The checkout is never modified.
+type Golden struct {
+	// UpdateArgs are the arguments passed to 'go test' to regenerate the golden
+	// files, e.g. "-update", required.
+	UpdateArgs []string `yaml:"update_args"`
+	Trigger    `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (g *Golden) GetDescription() string {
+	return "enforces golden test files are up to date"
+}
+
+// GetName implements Check.
+func (g *Golden) GetName() string {
+	return "golden"
+}
+
+// GetPrerequisites implements Check.
+func (g *Golden) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (g *Golden) Run(change scm.Change, options *Options) (err error) {
+	if len(g.UpdateArgs) == 0 {
+		return errors.New("golden: update_args is required")
+	}
+	testPkgs := change.Indirect().TestPackages()
+	if len(testPkgs) == 0 {
+		return nil
+	}
+	if change.Package() == "" {
+		return errors.New("golden: the repository must be inside GOPATH")
+	}
+	tmpDir, err2 := ioutil.TempDir("", "pre-commit-go")
+	if err2 != nil {
+		return err2
+	}
+	defer func() {
+		err2 := internal.RemoveAll(tmpDir)
+		if err == nil {
+			err = err2
+		}
+	}()
+	root := change.Repo().Root()
+	scratch := filepath.Join(tmpDir, "src", filepath.FromSlash(change.Package()))
+	original, err := copyTree(root, scratch)
+	if err != nil {
+		return err
+	}
+
+	// The temporary directory is first in GOPATH so the scratch copy is used
+	// instead of the checkout.
+	env := []string{"GOPATH=" + tmpDir + string(os.PathListSeparator) + change.Repo().GOPATH()}
+	args := append(append([]string{"go", "test"}, g.UpdateArgs...), testPkgs...)
+	options.LeaseRunToken()
+	out, exitCode, err := internal.Capture(scratch, env, args...)
+	options.ReturnRunToken()
+	if exitCode != 0 {
+		return fmt.Errorf("%s failed:\n%s", strings.Join(args, " "), processStackTrace(out))
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", strings.Join(args, " "), err)
+	}
+	stale, err := diffTree(root, scratch, original)
+	if err != nil {
+		return err
+	}
+	if len(stale) != 0 {
+		return fmt.Errorf("golden files are stale, please run: go test %s ./...\n%s", strings.Join(g.UpdateArgs, " "), strings.Join(stale, "\n"))
+	}
+	return nil
+}
+
+// DocExamples compiles the Go code blocks of markdown files so the
+// documentation doesn't rot.
+//
+// Each code block marked as "go" is compiled as its own program in a scratch
+// directory. A block without package clause is put in package main and a
+// block of statements, optionally preceded by imports, is wrapped in func
+// main(). The blocks can import the packages of the repository.
+type DocExamples struct {
+	// Files are the glob patterns of the markdown files, relative to the
+	// repository root, e.g. "*.md" or "docs/*.md", required.
+	Files   []string `yaml:"files"`
+	Trigger `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (d *DocExamples) GetDescription() string {
+	return "enforces the Go code blocks of markdown files compile"
+}
+
+// GetName implements Check.
+func (d *DocExamples) GetName() string {
+	return "docexamples"
+}
+
+// GetPrerequisites implements Check.
+func (d *DocExamples) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (d *DocExamples) Run(change scm.Change, options *Options) (err error) {
+	if len(d.Files) == 0 {
+		return errors.New("docexamples: files is required")
+	}
+	root := change.Repo().Root()
+	var blocks []codeBlock
+	seen := map[string]bool{}
+	for _, pattern := range d.Files {
+		matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		if err != nil {
+			return fmt.Errorf("docexamples: invalid pattern %q: %s", pattern, err)
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(root, m)
+			if err != nil || seen[m] || change.IsIgnored(filepath.ToSlash(rel)) {
+				continue
+			}
+			seen[m] = true
+			content, err := ioutil.ReadFile(m)
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, goCodeBlocks(m, content)...)
+		}
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	tmpDir, err2 := ioutil.TempDir("", "pre-commit-go")
+	if err2 != nil {
+		return err2
+	}
+	defer func() {
+		err2 := internal.RemoveAll(tmpDir)
+		if err == nil {
+			err = err2
+		}
+	}()
+	env := []string{"GOPATH=" + change.Repo().GOPATH()}
+	if goMod, err := ioutil.ReadFile(filepath.Join(root, "go.mod")); err == nil && bytes.Contains(goMod, []byte("module ")) {
+		// Make the packages of the repository importable from the scratch
+		// module.
+		mod := fmt.Sprintf("module docexamples\n\nrequire %s v0.0.0\n\nreplace %s => %s\n", change.Package(), change.Package(), root)
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(mod), 0600); err != nil {
+			return err
+		}
+		if sum, err := ioutil.ReadFile(filepath.Join(root, "go.sum")); err == nil {
+			if err := ioutil.WriteFile(filepath.Join(tmpDir, "go.sum"), sum, 0600); err != nil {
+				return err
+			}
+		}
+		env = append(env, "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	} else {
+		env = append(env, "GO111MODULE=off")
+	}
+	for i, b := range blocks {
+		dir := filepath.Join(tmpDir, "blocks", fmt.Sprintf("block%d", i))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(b.source()), 0600); err != nil {
+			return err
+		}
+	}
+	// The binary of a single block is written in tmpDir.
+	args := []string{"go", "build", "./blocks/..."}
+	options.LeaseRunToken()
+	out, exitCode, err := internal.Capture(tmpDir, env, args...)
+	options.ReturnRunToken()
+	if exitCode != 0 {
+		// go build prints the paths relative to tmpDir when it is shorter.
+		prefixes := []string{root + string(filepath.Separator)}
+		if rel, err := filepath.Rel(tmpDir, root); err == nil {
+			prefixes = append(prefixes, rel+string(filepath.Separator))
+		}
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			// Skip the scratch package names, the positions are in the markdown
+			// files.
+			if strings.HasPrefix(line, "# ") {
+				continue
+			}
+			for _, p := range prefixes {
+				if strings.HasPrefix(line, p) {
+					line = filepath.ToSlash(line[len(p):])
+					break
+				}
+			}
+			lines = append(lines, line)
+		}
+		return fmt.Errorf("code blocks don't compile:\n%s", strings.Join(lines, "\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
 // Errcheck runs errcheck on packages.
 type Errcheck struct {
+	// Ignores is passed to errcheck -ignore.
 	Ignores string
+	Trigger `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -274,7 +845,7 @@ func (e *Errcheck) GetName() string {
 // GetPrerequisites implements Check.
 func (e *Errcheck) GetPrerequisites() []CheckPrerequisite {
 	return []CheckPrerequisite{
-		{[]string{"errcheck", "-h"}, 2, "github.com/kisielk/errcheck"},
+		{HelpCommand: []string{"errcheck", "-h"}, ExpectedExitCode: 2, URL: "github.com/kisielk/errcheck"},
 	}
 }
 
@@ -296,8 +867,64 @@ func (e *Errcheck) Run(change scm.Change, options *Options) error {
 	return nil
 }
 
+// Dupl runs dupl to find duplicated code.
+//
+// All the packages are searched so copies of unmodified code are found, but
+// only the duplicates involving a modified file are reported. A file
+// containing intentionally similar code can be ignored by adding its name to
+// Blacklist.
+type Dupl struct {
+	// Threshold is the minimum size in tokens of a duplicated code block to be
+	// reported. It is passed to dupl -threshold. dupl's default is used when
+	// 0.
+	Threshold   int `yaml:"threshold"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+	Trigger     `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (d *Dupl) GetDescription() string {
+	return "flags duplicated code blocks using tool 'dupl'"
+}
+
+// GetName implements Check.
+func (d *Dupl) GetName() string {
+	return "dupl"
+}
+
+// GetPrerequisites implements Check.
+func (d *Dupl) GetPrerequisites() []CheckPrerequisite {
+	return []CheckPrerequisite{
+		{HelpCommand: []string{"dupl", "-h"}, ExpectedExitCode: 2, URL: "github.com/mibk/dupl"},
+	}
+}
+
+// Run implements Check.
+func (d *Dupl) Run(change scm.Change, options *Options) error {
+	// dupl accepts files and directories, directories are recursive and don't
+	// honor ignore_patterns so pass the files.
+	args := []string{"dupl", "-plumbing"}
+	if d.Threshold > 0 {
+		args = append(args, "-threshold", strconv.Itoa(d.Threshold))
+	}
+	out, _, _, err := options.Capture(change.Repo(), append(args, change.All().GoFiles()...)...)
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", strings.Join(args, " "), err)
+	}
+	changed := map[string]bool{}
+	for _, f := range change.Changed().GoFiles() {
+		if !d.skip(f) {
+			changed[f] = true
+		}
+	}
+	return issuesError(d.GetName(), d.filterIssues(duplIssues(out, changed)))
+}
+
 // Goimports runs goimports in check mode.
 type Goimports struct {
+	FileFilter `yaml:",inline"`
+	Trigger    `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -313,7 +940,7 @@ func (g *Goimports) GetName() string {
 // GetPrerequisites implements Check.
 func (g *Goimports) GetPrerequisites() []CheckPrerequisite {
 	return []CheckPrerequisite{
-		{[]string{"goimports", "-h"}, 2, "golang.org/x/tools/cmd/goimports"},
+		{HelpCommand: []string{"goimports", "-h"}, ExpectedExitCode: 2, URL: "golang.org/x/tools/cmd/goimports"},
 	}
 }
 
@@ -321,9 +948,25 @@ func (g *Goimports) GetPrerequisites() []CheckPrerequisite {
 func (g *Goimports) Run(change scm.Change, options *Options) error {
 	// goimports accepts files, not packages.
 	// goimports doesn't return non-zero even if some files need to be updated.
-	out, _, _, err := options.Capture(change.Repo(), append([]string{"goimports", "-l"}, change.Changed().GoFiles()...)...)
-	if len(out) != 0 {
-		return fmt.Errorf("these files are improperly formmatted, please run: goimports -w <files>\n%s", out)
+	args := []string{"goimports", "-l"}
+	for _, f := range change.Changed().GoFiles() {
+		if !g.skip(f) {
+			args = append(args, f)
+		}
+	}
+	if len(args) == 2 {
+		// Without files, goimports would read stdin.
+		return nil
+	}
+	out, _, _, err := options.Capture(change.Repo(), args...)
+	var issues Issues
+	for _, line := range strings.Split(out, "\n") {
+		if line = filepath.ToSlash(strings.TrimSpace(line)); line != "" {
+			issues = append(issues, fileIssue(line, "improperly formatted, please run: goimports -w %s", line))
+		}
+	}
+	if len(issues) != 0 {
+		return issuesError(g.GetName(), issues)
 	}
 	if err != nil {
 		return fmt.Errorf("goimports -w . failed: %s", err)
@@ -333,7 +976,11 @@ func (g *Goimports) Run(change scm.Change, options *Options) error {
 
 // Golint runs golint.
 type Golint struct {
-	Blacklist []string
+	// Blacklist causes this check to ignore the messages containing one of
+	// these strings.
+	Blacklist  []string
+	FileFilter `yaml:",inline"`
+	Trigger    `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -349,7 +996,7 @@ func (g *Golint) GetName() string {
 // GetPrerequisites implements Check.
 func (g *Golint) GetPrerequisites() []CheckPrerequisite {
 	return []CheckPrerequisite{
-		{[]string{"golint", "-h"}, 2, "github.com/golang/lint/golint"},
+		{HelpCommand: []string{"golint", "-h"}, ExpectedExitCode: 2, URL: "github.com/golang/lint/golint"},
 	}
 }
 
@@ -360,14 +1007,17 @@ func (g *Golint) Run(change scm.Change, options *Options) error {
 	// - doesn't like multiple packages per call.
 	// - "." is not recursive.
 	pkgs := change.Changed().Packages()
-	resultsC := make(chan []string, len(pkgs))
+	resultsC := make(chan Issues, len(pkgs))
 	files := map[string]bool{}
 	for _, f := range change.Changed().GoFiles() {
-		files[f] = true
+		if !g.skip(f) {
+			files[f] = true
+		}
 	}
 	for _, pkg := range pkgs {
 		go func(p string) {
-			r := []string{}
+			var r Issues
+			var issue Issue
 			out, _, _, _ := options.Capture(change.Repo(), "golint", p)
 			for _, line := range strings.Split(string(out), "\n") {
 				if len(line) == 0 {
@@ -375,6 +1025,7 @@ func (g *Golint) Run(change scm.Change, options *Options) error {
 				}
 				// TODO(maruel): Will fail with files with ':' in their name.
 				items := strings.SplitN(line, ":", 2)
+				items[0] = filepath.ToSlash(items[0])
 				if change.IsIgnored(items[0]) {
 					continue
 				}
@@ -386,27 +1037,41 @@ func (g *Golint) Run(change scm.Change, options *Options) error {
 						goto skip
 					}
 				}
-				r = append(r, line)
+				// golint's suggestions are about style, not correctness.
+				issue = parseIssue(g.GetName(), line)
+				issue.Severity = SeverityWarning
+				r = append(r, issue)
 			skip:
 			}
 			resultsC <- r
 		}(pkg)
 	}
 
-	results := []string{}
+	var results Issues
 	for i := 0; i < len(pkgs); i++ {
 		results = append(results, <-resultsC...)
 	}
-	if len(results) != 0 {
-		sort.Strings(results)
-		return errors.New("golint failed:\n" + strings.Join(results, "\n"))
-	}
-	return nil
+	return issuesError(g.GetName(), results)
 }
 
 // Govet runs "go tool vet".
+//
+// The findings are errors by default. ErrorAnalyzers and WarnAnalyzers set the
+// severity per analyzer, so some findings fail the check while the others are
+// only reported, depending on fail_on. Blacklist is applied first: a
+// blacklisted message is dropped whatever its analyzer.
 type Govet struct {
+	// Blacklist causes this check to ignore the messages containing one of
+	// these strings.
 	Blacklist []string
+	// ErrorAnalyzers are the analyzers, like printf, whose findings are
+	// errors. When set, the findings of the other analyzers are warnings.
+	ErrorAnalyzers []string `yaml:"error_analyzers,omitempty"`
+	// WarnAnalyzers are the analyzers, like composites, whose findings are
+	// warnings. ErrorAnalyzers has precedence when an analyzer is in both.
+	WarnAnalyzers []string `yaml:"warn_analyzers,omitempty"`
+	FileFilter    `yaml:",inline"`
+	Trigger       `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -422,22 +1087,112 @@ func (g *Govet) GetName() string {
 // GetPrerequisites implements Check.
 func (g *Govet) GetPrerequisites() []CheckPrerequisite {
 	return []CheckPrerequisite{
-		{[]string{"go", "tool", "vet", "-h"}, 1, "golang.org/x/tools/cmd/vet"},
+		{HelpCommand: []string{"go", "tool", "vet", "-h"}, ExpectedExitCode: 1, URL: "golang.org/x/tools/cmd/vet"},
 	}
 }
 
 // Run implements Check.
 func (g *Govet) Run(change scm.Change, options *Options) error {
+	lines, err := g.vet(change, options, "-all")
+	if err != nil {
+		return err
+	}
+	// Each analyzer is run on its own to know which findings it reported.
+	severities := map[string]Severity{}
+	for _, analyzers := range []struct {
+		names    []string
+		severity Severity
+	}{{g.WarnAnalyzers, SeverityWarning}, {g.ErrorAnalyzers, SeverityError}} {
+		for _, name := range analyzers.names {
+			found, err := g.vet(change, options, "-"+name)
+			if err != nil {
+				return err
+			}
+			for _, line := range found {
+				severities[line] = analyzers.severity
+			}
+		}
+	}
+	def := SeverityError
+	if len(g.ErrorAnalyzers) != 0 {
+		def = SeverityWarning
+	}
+	var result Issues
+	for _, line := range lines {
+		issue := parseIssue(g.GetName(), line)
+		issue.Severity = def
+		if s, ok := severities[line]; ok {
+			issue.Severity = s
+		}
+		result = append(result, issue)
+	}
+	return issuesError(g.GetName(), result)
+}
+
+// vet runs go tool vet with flags and returns the findings in the modified
+// files that are not blacklisted.
+func (g *Govet) vet(change scm.Change, options *Options, flags ...string) ([]string, error) {
 	// - accepts packages, not files.
 	// - returns non-zero on report.
 	// - accepts multiple packages per call.
 	// - "." is recursive.
+	return vetFindings(change, options, &g.FileFilter, g.Blacklist, append(append([]string{"go", "tool", "vet"}, flags...), ".")...)
+}
+
+// CopyLocks runs the copylocks analyzer of go vet on its own.
+//
+// Copying a value containing a sync.Mutex, e.g. by passing a struct by value,
+// copies the lock state; the copy is not protected by the original lock. It
+// is one of the go vet analyzers, so it can be enforced in pre-commit without
+// enabling all of govet.
+type CopyLocks struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+	Trigger     `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (c *CopyLocks) GetDescription() string {
+	return "flags the values containing a lock that are copied"
+}
+
+// GetName implements Check.
+func (c *CopyLocks) GetName() string {
+	return "copylocks"
+}
+
+// GetPrerequisites implements Check.
+func (c *CopyLocks) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (c *CopyLocks) Run(change scm.Change, options *Options) error {
+	lines, err := vetFindings(change, options, &c.FileFilter, c.Blacklist, "go", "vet", "-copylocks", "./...")
+	if err != nil {
+		return err
+	}
+	var result Issues
+	for _, line := range lines {
+		result = append(result, parseIssue(c.GetName(), line))
+	}
+	return issuesError(c.GetName(), result)
+}
+
+// vetFindings runs the go vet command args and returns the findings in the
+// modified files, not excluded by filter, that are not blacklisted.
+func vetFindings(change scm.Change, options *Options, filter *FileFilter, blacklist []string, args ...string) ([]string, error) {
 	// Ignore the return code since we ignore many errors.
-	out, _, _, _ := options.Capture(change.Repo(), "go", "tool", "vet", "-all", ".")
-	result := []string{}
+	out, _, _, _ := options.Capture(change.Repo(), args...)
+	if strings.Contains(out, "flag provided but not defined") {
+		return nil, fmt.Errorf("%s failed: unknown analyzer", strings.Join(args, " "))
+	}
+	var result []string
 	files := map[string]bool{}
 	for _, f := range change.Changed().GoFiles() {
-		files[f] = true
+		if !filter.skip(f) {
+			files[f] = true
+		}
 	}
 	for _, line := range strings.Split(string(out), "\n") {
 		if len(line) == 0 {
@@ -445,13 +1200,14 @@ func (g *Govet) Run(change scm.Change, options *Options) error {
 		}
 		// TODO(maruel): Will fail with files with ':' in their name.
 		items := strings.SplitN(line, ":", 2)
+		items[0] = filepath.ToSlash(items[0])
 		if change.IsIgnored(items[0]) {
 			continue
 		}
 		if _, ok := files[items[0]]; !ok {
 			continue
 		}
-		for _, b := range g.Blacklist {
+		for _, b := range blacklist {
 			if strings.Contains(line, b) {
 				goto skip
 			}
@@ -459,10 +1215,7 @@ func (g *Govet) Run(change scm.Change, options *Options) error {
 		result = append(result, line)
 	skip:
 	}
-	if len(result) != 0 {
-		return errors.New("go tool vet failed:\n" + strings.Join(result, "\n"))
-	}
-	return nil
+	return result, nil
 }
 
 // Extensibility.
@@ -483,6 +1236,7 @@ type Custom struct {
 	// Prerequisites are check's prerequisite packages to install first before
 	// running the check, optional.
 	Prerequisites []CheckPrerequisite `yaml:"prerequisites"`
+	Trigger       `yaml:",inline"`
 }
 
 // GetDescription implements Check.
@@ -518,23 +1272,218 @@ func (c *Custom) Run(change scm.Change, options *Options) error {
 
 // KnownChecks is the map of all known checks per check name.
 var KnownChecks = map[string]func() Check{
-	(&Build{}).GetName():     func() Check { return &Build{} },
-	(&Copyright{}).GetName(): func() Check { return &Copyright{} },
-	(&Coverage{}).GetName():  func() Check { return &Coverage{} },
-	(&Custom{}).GetName():    func() Check { return &Custom{} },
-	(&Errcheck{}).GetName():  func() Check { return &Errcheck{} },
-	(&Gofmt{}).GetName():     func() Check { return &Gofmt{} },
-	(&Goimports{}).GetName(): func() Check { return &Goimports{} },
-	(&Golint{}).GetName():    func() Check { return &Golint{} },
-	(&Govet{}).GetName():     func() Check { return &Govet{} },
-	(&Test{}).GetName():      func() Check { return &Test{} },
+	(&Build{}).GetName():            func() Check { return &Build{} },
+	(&BuildConstraints{}).GetName(): func() Check { return &BuildConstraints{} },
+	(&ContextCancel{}).GetName():    func() Check { return &ContextCancel{} },
+	(&ContextFirst{}).GetName():     func() Check { return &ContextFirst{} },
+	(&Copyright{}).GetName():        func() Check { return &Copyright{} },
+	(&CopyLocks{}).GetName():        func() Check { return &CopyLocks{} },
+	(&Coverage{}).GetName():         func() Check { return &Coverage{} },
+	(&Custom{}).GetName():           func() Check { return &Custom{} },
+	(&DeferInLoop{}).GetName():      func() Check { return &DeferInLoop{} },
+	(&DocExamples{}).GetName():      func() Check { return &DocExamples{} },
+	(&Dupl{}).GetName():             func() Check { return &Dupl{} },
+	(&Embed{}).GetName():            func() Check { return &Embed{} },
+	(&Errcheck{}).GetName():         func() Check { return &Errcheck{} },
+	(&ErrorComparison{}).GetName():  func() Check { return &ErrorComparison{} },
+	(&ErrorDocs{}).GetName():        func() Check { return &ErrorDocs{} },
+	(&ErrorNaming{}).GetName():      func() Check { return &ErrorNaming{} },
+	(&ErrorWrap{}).GetName():        func() Check { return &ErrorWrap{} },
+	(&ExampleOutput{}).GetName():    func() Check { return &ExampleOutput{} },
+	(&FileSize{}).GetName():         func() Check { return &FileSize{} },
+	(&Gofmt{}).GetName():            func() Check { return &Gofmt{} },
+	(&Golden{}).GetName():           func() Check { return &Golden{} },
+	(&Goimports{}).GetName():        func() Check { return &Goimports{} },
+	(&Golint{}).GetName():           func() Check { return &Golint{} },
+	(&GoroutineSafety{}).GetName():  func() Check { return &GoroutineSafety{} },
+	(&Govet{}).GetName():            func() Check { return &Govet{} },
+	(&HandlerContext{}).GetName():   func() Check { return &HandlerContext{} },
+	(&ImportCount{}).GetName():      func() Check { return &ImportCount{} },
+	(&InitFuncs{}).GetName():        func() Check { return &InitFuncs{} },
+	(&JSONNaming{}).GetName():       func() Check { return &JSONNaming{} },
+	(&LargeParam{}).GetName():       func() Check { return &LargeParam{} },
+	(&Logging{}).GetName():          func() Check { return &Logging{} },
+	(&MagicNumbers{}).GetName():     func() Check { return &MagicNumbers{} },
+	(&MustCheck{}).GetName():        func() Check { return &MustCheck{} },
+	(&NilInterface{}).GetName():     func() Check { return &NilInterface{} },
+	(&NoPanic{}).GetName():          func() Check { return &NoPanic{} },
+	(&OsExit{}).GetName():           func() Check { return &OsExit{} },
+	(&PackageName{}).GetName():      func() Check { return &PackageName{} },
+	(&PublicSurface{}).GetName():    func() Check { return &PublicSurface{} },
+	(&ReceiverNames{}).GetName():    func() Check { return &ReceiverNames{} },
+	(&RequireTests{}).GetName():     func() Check { return &RequireTests{} },
+	(&SignatureLimits{}).GetName():  func() Check { return &SignatureLimits{} },
+	(&SortLess{}).GetName():         func() Check { return &SortLess{} },
+	(&StructTags{}).GetName():       func() Check { return &StructTags{} },
+	(&Subtests{}).GetName():         func() Check { return &Subtests{} },
+	(&TagConsistency{}).GetName():   func() Check { return &TagConsistency{} },
+	(&Test{}).GetName():             func() Check { return &Test{} },
+	(&TestInternals{}).GetName():    func() Check { return &TestInternals{} },
+	(&TestMainUsage{}).GetName():    func() Check { return &TestMainUsage{} },
+	(&TestNaming{}).GetName():       func() Check { return &TestNaming{} },
+	(&TestingImport{}).GetName():    func() Check { return &TestingImport{} },
+	(&TimeNow{}).GetName():          func() Check { return &TimeNow{} },
+	(&TypeSwitch{}).GetName():       func() Check { return &TypeSwitch{} },
+	(&WaitGroupUsage{}).GetName():   func() Check { return &WaitGroupUsage{} },
+}
+
+// Register adds a third party check to KnownChecks, so it can be used in
+// pre-commit-go.yml like the checks of this package.
+//
+// It is meant to be called from an init() function of the package
+// implementing the check, which is compiled in pcg by importing it in
+// cmd/pcg/plugins.go. The check runs in-process, concurrently with the other
+// checks. Register panics if the check has no name or if a check with the same
+// name is already registered.
+func Register(factory func() Check) {
+	name := factory().GetName()
+	if name == "" {
+		panic("checks: Register called with an unnamed check")
+	}
+	if _, ok := KnownChecks[name]; ok {
+		panic("checks: Register called twice for check " + name)
+	}
+	KnownChecks[name] = factory
 }
 
 // Private stuff.
 
+func (t *Trigger) trigger() *Trigger {
+	return t
+}
+
 // See build.Run() for information.
 var buildLock sync.Mutex
 
+// reTestResult matches the result line of a single test printed by
+// 'go test -v'.
+var reTestResult = regexp.MustCompile(`(?m)^\s*--- (?:PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s\)`)
+
+// exceededLimits returns true if the output of a process run with
+// internal.WithLimits shows it failed because of the limits.
+func exceededLimits(out string) bool {
+	for _, s := range []string{"CPU time limit exceeded", "out of memory", "cannot allocate memory"} {
+		if strings.Contains(out, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// reTestProgress matches the lines printed by 'go test -v' to report the
+// progress of a test, which are noise in the output of a failing test.
+var reTestProgress = regexp.MustCompile(`^\s*(?:=== (?:RUN|PAUSE|CONT|NAME)\s|--- (?:PASS|FAIL|SKIP): )`)
+
+// testEvent is an event printed by 'go test -json'. See 'go doc test2json'.
+type testEvent struct {
+	Action  string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// parseTestJSON parses the output of 'go test -json' and returns the output
+// of the failing tests, or the whole output if no test failed, and the
+// duration of each test.
+//
+// A test failing only because of its subtests isn't reported, as its subtests
+// are.
+func parseTestJSON(out string) (string, []Timing) {
+	var timings []Timing
+	var failed []string
+	var other []string
+	outputs := map[string][]string{}
+	elapsed := map[string]float64{}
+	for _, line := range strings.SplitAfter(out, "\n") {
+		e := testEvent{}
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &e) != nil {
+			// Not an event, e.g. a build error on an old toolchain.
+			if line != "" {
+				other = append(other, line)
+			}
+			continue
+		}
+		switch e.Action {
+		case "output", "build-output":
+			if e.Test == "" {
+				other = append(other, e.Output)
+			} else if !reTestProgress.MatchString(e.Output) {
+				outputs[e.Test] = append(outputs[e.Test], e.Output)
+			}
+		case "pass", "fail", "skip":
+			if e.Test == "" {
+				continue
+			}
+			timings = append(timings, Timing{e.Test, time.Duration(e.Elapsed * float64(time.Second))})
+			if e.Action == "fail" {
+				failed = append(failed, e.Test)
+				elapsed[e.Test] = e.Elapsed
+			}
+		}
+	}
+	var summary []string
+	for _, name := range failed {
+		leaf := true
+		for _, other := range failed {
+			if strings.HasPrefix(other, name+"/") {
+				leaf = false
+				break
+			}
+		}
+		if leaf {
+			summary = append(summary, fmt.Sprintf("--- FAIL: %s (%.2fs)\n%s", name, elapsed[name], strings.Join(outputs[name], "")))
+		}
+	}
+	if len(summary) == 0 {
+		return strings.Join(other, ""), timings
+	}
+	return strings.Join(summary, ""), timings
+}
+
+// reDupl matches a line printed by 'dupl -plumbing', e.g.
+// "foo.go:12-20: duplicate of bar.go:30-38".
+var reDupl = regexp.MustCompile(`^(.+?\.go):(\d+)-(\d+): duplicate of (.+?\.go):(\d+)-(\d+)$`)
+
+// duplIssues returns one issue per pair of duplicated code blocks printed by
+// 'dupl -plumbing' where at least one of the blocks is in a changed file.
+//
+// dupl prints each pair twice, once from each side. The issue is reported on
+// the first changed block of the pair.
+func duplIssues(out string, changed map[string]bool) Issues {
+	var issues Issues
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		m := reDupl.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		a := filepath.ToSlash(m[1]) + ":" + m[2] + "-" + m[3]
+		b := filepath.ToSlash(m[4]) + ":" + m[5] + "-" + m[6]
+		if !changed[filepath.ToSlash(m[1])] {
+			if !changed[filepath.ToSlash(m[4])] {
+				continue
+			}
+			a, b = b, a
+			m[1], m[2], m[3] = m[4], m[5], m[6]
+		}
+		key := a + " " + b
+		if b < a {
+			key = b + " " + a
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		l, _ := strconv.Atoi(m[2])
+		issues = append(issues, Issue{File: filepath.ToSlash(m[1]), Line: l, Severity: SeverityError, Message: fmt.Sprintf("lines %s-%s duplicate %s", m[2], m[3], b)})
+	}
+	return issues
+}
+
+// reDiagnostic matches a compiler diagnostic, e.g.
+// "./foo.go:12:6: can inline Foo".
+var reDiagnostic = regexp.MustCompile(`^(?:\./)?(.+?\.go):\d+(?::\d+)?: (.+)$`)
+
 // cwd provides a valid path to CheckPrerequisite.IsPresent().
 var cwd string
 
@@ -5,10 +5,12 @@
 package checks
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -23,6 +25,8 @@ func TestCheckPrerequisite(t *testing.T) {
 	t.Parallel()
 	ut.AssertEqual(t, true, (&CheckPrerequisite{HelpCommand: []string{"go", "version"}, ExpectedExitCode: 0}).IsPresent())
 	ut.AssertEqual(t, false, (&CheckPrerequisite{HelpCommand: []string{"go", "version"}, ExpectedExitCode: 1}).IsPresent())
+	ut.AssertEqual(t, DefaultPrerequisiteTimeout, (&CheckPrerequisite{}).GetTimeout())
+	ut.AssertEqual(t, 2*time.Second, (&CheckPrerequisite{Timeout: 2}).GetTimeout())
 }
 
 func TestChecksSuccess(t *testing.T) {
@@ -64,6 +68,12 @@ func TestChecksSuccess(t *testing.T) {
 			cov.Global.MaxCoverage = 100
 			cov.PerDirDefault.MinCoverage = 100
 			cov.PerDirDefault.MaxCoverage = 100
+		case "docexamples":
+			c.(*DocExamples).Files = []string{"*.md"}
+		case "filesize":
+			c.(*FileSize).MaxBytes = 1024
+		case "golden":
+			c.(*Golden).UpdateArgs = []string{"-short"}
 		}
 		if l, ok := c.(sync.Locker); ok {
 			l.Lock()
@@ -114,6 +124,26 @@ func TestChecksFailure(t *testing.T) {
 			cov.Global.MaxCoverage = 100
 			cov.PerDirDefault.MinCoverage = 100
 			cov.PerDirDefault.MaxCoverage = 100
+		case "docexamples":
+			c.(*DocExamples).Files = []string{"*.md"}
+		case "golden":
+			c.(*Golden).UpdateArgs = []string{"-short"}
+		case "filesize":
+			c.(*FileSize).MaxBytes = 1024
+		case "importcount":
+			c.(*ImportCount).MaxImports = 1
+		case "initfuncs":
+			c.(*InitFuncs).Disallowed = []string{"os.Exit"}
+		case "largeparam":
+			c.(*LargeParam).MaxParamBytes = 1
+		case "logging":
+			c.(*Logging).Forbidden = []string{"log.Print"}
+		case "mustcheck":
+			c.(*MustCheck).Functions = []string{"os.Remove"}
+		case "publicsurface":
+			c.(*PublicSurface).MaxExported = 1
+		case "signaturelimits":
+			c.(*SignatureLimits).MaxParams = 1
 		}
 		if err := c.Run(change, &Options{MaxDuration: 1}); err == nil {
 			t.Errorf("%s didn't fail but was expected to", c.GetName())
@@ -148,10 +178,273 @@ func TestCustom(t *testing.T) {
 	ut.AssertEqual(t, p, c.GetPrerequisites())
 }
 
+func TestBuildCGODisabled(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	change := setup(t, td, cgoFiles)
+	b := &Build{CGODisabled: true}
+	err = b.Run(change, &Options{MaxDuration: 1})
+	ut.AssertEqual(t, true, err != nil)
+	ut.AssertEqual(t, true, strings.Contains(err.Error(), "packages using cgo:\n  foo/bar"))
+	ut.AssertEqual(t, nil, (&Build{CGODisabled: true}).Run(setup(t, filepath.Join(td, "good"), goodFiles), &Options{MaxDuration: 1}))
+}
+
+func TestBuildGCFlags(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	files := map[string]string{
+		"foo.go":       "package foo\n\n// Foo is inlinable.\nfunc Foo() int {\n\treturn 1\n}\n",
+		"baseline.txt": "foo.go: can inline Foo\n",
+		"empty.txt":    "",
+	}
+	ut.AssertEqual(t, nil, runCheck(t, &Build{GCFlags: []string{"-m"}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &Build{GCFlags: []string{"-m"}, GCFlagsBaseline: "baseline.txt"}, files))
+	expected := errors.New("compiler diagnostics not in empty.txt:\nfoo.go: can inline Foo")
+	ut.AssertEqual(t, expected, runCheck(t, &Build{GCFlags: []string{"-m"}, GCFlagsBaseline: "empty.txt"}, files))
+}
+
+func TestCompilerDiagnostics(t *testing.T) {
+	t.Parallel()
+	out := "# foo\n./foo.go:4:6: can inline Foo\nbar/bar.go:10:2: x escapes to heap\n"
+	ut.AssertEqual(t, []string{"bar/bar.go: x escapes to heap", "foo.go: can inline Foo"}, compilerDiagnostics(out))
+}
+
+func TestDuplIssues(t *testing.T) {
+	t.Parallel()
+	out := "a.go:3-10: duplicate of b.go:20-27\nb.go:20-27: duplicate of a.go:3-10\n" +
+		"c.go:1-5: duplicate of d.go:1-5\nd.go:1-5: duplicate of c.go:1-5\n" +
+		"c.go:8-12: duplicate of a.go:30-34\n"
+	expected := Issues{
+		{File: "a.go", Line: 3, Severity: SeverityError, Message: "lines 3-10 duplicate b.go:20-27"},
+		{File: "a.go", Line: 30, Severity: SeverityError, Message: "lines 30-34 duplicate c.go:8-12"},
+	}
+	ut.AssertEqual(t, expected, duplIssues(out, map[string]bool{"a.go": true, "b.go": true}))
+}
+
+func TestIsBuildFailure(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, false, IsBuildFailure(&Build{}, nil))
+	ut.AssertEqual(t, true, IsBuildFailure(&Build{}, errors.New("go build failed")))
+	ut.AssertEqual(t, true, IsBuildFailure(&Test{}, errors.New("go test ./foo failed:\nFAIL\tfoo [build failed]")))
+	ut.AssertEqual(t, false, IsBuildFailure(&Test{}, errors.New("go test ./foo failed:\n--- FAIL: TestFoo")))
+	ut.AssertEqual(t, false, IsBuildFailure(&Gofmt{}, errors.New("gofmt failed")))
+}
+
+func TestIsTriggered(t *testing.T) {
+	t.Parallel()
+	c := &fakeChange{changed: []string{"README.md", "api/v1/foo.proto"}}
+	data := []struct {
+		check    Check
+		expected bool
+	}{
+		{&Gofmt{}, true},
+		{&Custom{}, true},
+		{&Custom{Trigger: Trigger{TriggerPaths: []string{"*.proto"}}}, true},
+		{&Custom{Trigger: Trigger{TriggerPaths: []string{"api/*/*.proto"}}}, true},
+		{&Custom{Trigger: Trigger{TriggerPaths: []string{"api/*.proto", "*.go"}}}, false},
+		{&Test{Trigger: Trigger{TriggerPaths: []string{"README.md"}}}, true},
+	}
+	for i, line := range data {
+		triggered, err := IsTriggered(line.check, c)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, triggered)
+	}
+	_, err := IsTriggered(&Custom{Trigger: Trigger{TriggerPaths: []string{"["}}}, c)
+	ut.AssertEqual(t, errors.New("invalid trigger path \"[\": syntax error in pattern"), err)
+}
+
+func TestExplainFile(t *testing.T) {
+	t.Parallel()
+	vet := &Govet{FileFilter: FileFilter{SkipTestFiles: true}, Trigger: Trigger{TriggerPaths: []string{"*.go", "api/*.proto"}}}
+	ut.AssertEqual(t, []string(nil), ExplainFile(&Gofmt{}, "foo_test.go"))
+	ut.AssertEqual(t, []string(nil), ExplainFile(vet, "foo/bar.go"))
+	ut.AssertEqual(t, []string{"skipped as per skip_test_files"}, ExplainFile(vet, "foo/bar_test.go"))
+	ut.AssertEqual(t, []string{"not triggered by it, trigger_paths is *.go, api/*.proto"}, ExplainFile(vet, "README.md"))
+}
+
+func TestTestRaceAffectedOnly(t *testing.T) {
+	t.Parallel()
+	c := &fakeChange{pkg: "foo", indirect: []string{"./a", "./b"}, all: []string{"./a", "./b", "./c"}}
+	test := &Test{ExtraArgs: []string{"-race"}}
+	pkgs, noRace := test.testPackages(c)
+	ut.AssertEqual(t, []string{"./a", "./b"}, pkgs)
+	ut.AssertEqual(t, map[string]bool(nil), noRace)
+
+	test.RaceAffectedOnly = true
+	pkgs, noRace = test.testPackages(c)
+	ut.AssertEqual(t, []string{"./a", "./b", "./c"}, pkgs)
+	ut.AssertEqual(t, map[string]bool{"./c": true}, noRace)
+
+	// The importers are unknown.
+	c.pkg = ""
+	pkgs, noRace = test.testPackages(c)
+	ut.AssertEqual(t, []string{"./a", "./b", "./c"}, pkgs)
+	ut.AssertEqual(t, map[string]bool(nil), noRace)
+
+	// Everything is affected.
+	c.pkg = "foo"
+	c.indirect = c.all
+	pkgs, noRace = test.testPackages(c)
+	ut.AssertEqual(t, []string{"./a", "./b", "./c"}, pkgs)
+	ut.AssertEqual(t, map[string]bool(nil), noRace)
+}
+
+func TestParseTestJSON(t *testing.T) {
+	t.Parallel()
+	out := `{"Action":"run","Package":"foo","Test":"TestFoo"}
+{"Action":"output","Package":"foo","Test":"TestFoo","Output":"=== RUN   TestFoo\n"}
+{"Action":"run","Package":"foo","Test":"TestFoo/a"}
+{"Action":"output","Package":"foo","Test":"TestFoo/a","Output":"=== RUN   TestFoo/a\n"}
+{"Action":"output","Package":"foo","Test":"TestFoo/a","Output":"    foo_test.go:12: oh no\n"}
+{"Action":"output","Package":"foo","Test":"TestFoo/a","Output":"    --- FAIL: TestFoo/a (0.01s)\n"}
+{"Action":"fail","Package":"foo","Test":"TestFoo/a","Elapsed":0.01}
+{"Action":"output","Package":"foo","Test":"TestFoo","Output":"--- FAIL: TestFoo (0.02s)\n"}
+{"Action":"fail","Package":"foo","Test":"TestFoo","Elapsed":0.02}
+{"Action":"output","Package":"foo","Test":"TestBar","Output":"--- PASS: TestBar (1.50s)\n"}
+{"Action":"pass","Package":"foo","Test":"TestBar","Elapsed":1.5}
+{"Action":"output","Package":"foo","Output":"FAIL\n"}
+{"Action":"fail","Package":"foo","Elapsed":1.6}
+`
+	summary, timings := parseTestJSON(out)
+	ut.AssertEqual(t, "--- FAIL: TestFoo/a (0.01s)\n    foo_test.go:12: oh no\n", summary)
+	expected := []Timing{
+		{"TestFoo/a", 10 * time.Millisecond},
+		{"TestFoo", 20 * time.Millisecond},
+		{"TestBar", 1500 * time.Millisecond},
+	}
+	ut.AssertEqual(t, expected, timings)
+
+	// Build failure.
+	out = `{"Action":"output","Package":"foo","Output":"# foo\n"}
+{"Action":"output","Package":"foo","Output":"./foo.go:3:1: syntax error\n"}
+{"Action":"output","Package":"foo","Output":"FAIL\tfoo [build failed]\n"}
+{"Action":"fail","Package":"foo","Elapsed":0}
+`
+	summary, timings = parseTestJSON(out)
+	ut.AssertEqual(t, "# foo\n./foo.go:3:1: syntax error\nFAIL\tfoo [build failed]\n", summary)
+	ut.AssertEqual(t, []Timing(nil), timings)
+}
+
+func TestTestResourceLimits(t *testing.T) {
+	t.Parallel()
+	if !internal.LimitsSupported {
+		t.Skip("resource limits are not supported")
+	}
+	files := map[string]string{
+		"foo_test.go": "package foo\n\nimport \"testing\"\n\nvar sink []byte\n\nfunc TestAlloc(t *testing.T) {\n\tsink = make([]byte, 4<<30)\n\tsink[0] = 1\n}\n",
+	}
+	err := runCheck(t, &Test{ResourceLimits: ResourceLimits{MaxMemoryMB: 1024}}, files)
+	ut.AssertEqual(t, true, err != nil)
+	ut.AssertEqual(t, true, strings.Contains(err.Error(), "exceeded resource_limits (max_memory_mb: 1024, max_cpu_seconds: 0)"))
+	ut.AssertEqual(t, true, exceededLimits("signal: CPU time limit exceeded"))
+	ut.AssertEqual(t, false, exceededLimits("--- FAIL: TestFoo"))
+}
+
+func TestRegister(t *testing.T) {
+	// Not parallel; it must not run concurrently with the tests iterating over
+	// KnownChecks in case Register() doesn't panic.
+	for _, c := range []Check{&Build{}, &unnamed{}} {
+		func() {
+			defer func() {
+				ut.AssertEqual(t, true, recover() != nil)
+			}()
+			Register(func() Check { return c })
+		}()
+	}
+}
+
+func TestGoldenStale(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	change := setup(t, td, goldenFiles)
+	g := &Golden{UpdateArgs: []string{"-update"}}
+	err = g.Run(change, &Options{MaxDuration: 1})
+	ut.AssertEqual(t, true, err != nil)
+	ut.AssertEqual(t, true, strings.HasSuffix(err.Error(), "\nmodified: testdata/golden.txt"))
+	// The checkout wasn't touched.
+	content, err := ioutil.ReadFile(filepath.Join(td, "src", "foo", "testdata", "golden.txt"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "old\n", string(content))
+}
+
+func TestDocExamples(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	files := map[string]string{
+		"foo.go":       "package foo\n\n// Foo returns 1.\nfunc Foo() int {\n\treturn 1\n}\n",
+		"README.md":    "# Foo\n\n```go\nimport \"foo\"\n\nprintln(foo.Foo())\n```\n",
+		"docs/bad.md":  "```go\nfunc A() {\n\treturn 1\n}\n```\n\n```go\nx := 1\n```\n",
+		"docs/text.md": "```\nnot go\n```\n",
+	}
+	err := runCheck(t, &DocExamples{Files: []string{"*.md", "docs/*.md"}}, files)
+	ut.AssertEqual(t, true, err != nil)
+	// The messages depend on the compiler version.
+	ut.AssertEqual(t, true, strings.HasPrefix(err.Error(), "code blocks don't compile:\ndocs/bad.md:3:9: "))
+	ut.AssertEqual(t, true, strings.Contains(err.Error(), "\ndocs/bad.md:8:1: "))
+	ut.AssertEqual(t, errors.New("docexamples: files is required"), runCheck(t, &DocExamples{}, files))
+}
+
+func TestCopyLocks(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": "package foo\n\nimport \"sync\"\n\ntype T struct {\n\tmu sync.Mutex\n}\n\nfunc Copy(t *T) T {\n\treturn *t\n}\n\nfunc (t T) Get() {\n}\n",
+	}
+	expected := errors.New("copylocks failed:\n" +
+		"foo.go:10:9: return copies lock value: foo.T contains sync.Mutex\n" +
+		"foo.go:13:9: Get passes lock by value: foo.T contains sync.Mutex")
+	ut.AssertEqual(t, expected, runCheck(t, &CopyLocks{}, files))
+	expected = errors.New("copylocks failed:\n" +
+		"foo.go:10:9: return copies lock value: foo.T contains sync.Mutex")
+	ut.AssertEqual(t, expected, runCheck(t, &CopyLocks{IssueFilter: IssueFilter{Blacklist: []string{"passes lock by value"}}}, files))
+}
+
+func TestFileSize(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go":          "package foo\n",
+		"big.bin":         strings.Repeat("x", 101),
+		"small.bin":       strings.Repeat("x", 100),
+		"assets/logo.png": strings.Repeat("x", 200),
+		"vendor/big.bin":  strings.Repeat("x", 200),
+	}
+	expected := errors.New("filesize failed:\n" +
+		"assets/logo.png: 200 bytes, max is 100\n" +
+		"big.bin: 101 bytes, max is 100\n" +
+		"vendor/big.bin: 200 bytes, max is 100")
+	ut.AssertEqual(t, expected, runCheck(t, &FileSize{MaxBytes: 100}, files))
+	expected = errors.New("filesize failed:\n" +
+		"big.bin: 101 bytes, max is 100")
+	ut.AssertEqual(t, expected, runCheck(t, &FileSize{MaxBytes: 100, PackagesOnly: true}, files))
+	ut.AssertEqual(t, errors.New("filesize: max_bytes is required"), runCheck(t, &FileSize{}, files))
+}
+
 // Private stuff.
 
 // This set of files passes all the tests.
 var goodFiles = map[string]string{
+	"README.md": "# Foo\n\n```go\nimport \"foo\"\n\nprintln(foo.Foo())\n```\n",
 	"foo.go": `// Foo
 
 package foo
@@ -177,6 +470,141 @@ func TestSuccess(t *testing.T) {
 
 // This set of files fails all the tests.
 var badFiles = map[string]string{
+	"README.md": "# Foo\n\n```go\nprintln(foo.Bar())\n```\n",
+	"blob.bin":  strings.Repeat("x", 2048),
+	"context.go": `// Foo
+
+package foo
+
+import "context"
+
+// Late takes the context last.
+func Late(a int, ctx context.Context) {
+}
+`,
+	"errorwrap.go": `// Foo
+
+package foo
+
+import "fmt"
+
+// Failure is a sentinel error.
+var Failure = fmt.Errorf("failure")
+
+// Wrap returns an error.
+func Wrap(err error) error {
+	return fmt.Errorf("failed: %v", err)
+}
+
+// MyError is an error.
+type MyError struct{}
+
+func (m *MyError) Error() string {
+	return "my error"
+}
+
+// Typed returns a typed nil.
+func Typed() error {
+	var e *MyError
+	return e
+}
+
+// Pair returns its arguments.
+func Pair(a, b int) (int, int) {
+	return a, b
+}
+`,
+	"bar/bar_test.go": `// Foo
+
+package bar
+
+import "testing"
+
+func TestMain(m *testing.M) {
+}
+`,
+	"baz/baz.go": `// Foo
+
+// Package baz has no test.
+package baz
+`,
+	"copied/copied.go": `// Foo
+
+// Package original was copied.
+package original
+`,
+	"example_test.go": "// Foo\n\npackage foo\n\nfunc ExampleFoo() {\n}\n",
+	"foo_linux.go":    "// Foo\n\n//go:build linux\n\npackage foo\n",
+	"dupl.go": `// Foo
+
+package foo
+
+// Sum1 is copy-pasted.
+func Sum1(v []int) int {
+	t := 0
+	for _, i := range v {
+		if i > 0 {
+			t += i * 2
+		}
+	}
+	return t
+}
+
+// Sum2 is copy-pasted.
+func Sum2(v []int) int {
+	t := 0
+	for _, i := range v {
+		if i > 0 {
+			t += i * 2
+		}
+	}
+	return t
+}
+`,
+	"receiver.go": `// Foo
+
+package foo
+
+// Receiver has a method.
+type Receiver struct{}
+
+// Self has a receiver named self.
+func (self *Receiver) Self() {
+}
+`,
+	"embed.go":         "// Foo\n\npackage foo\n\nimport _ \"embed\"\n\n// Data is missing.\n//go:embed missing.txt\nvar Data string\n",
+	"goroutine.go":     "// Foo\n\npackage foo\n\n// Spawn doesn't recover.\nfunc Spawn() {\n\tgo func() {}()\n}\n",
+	"errcmp.go":        "// Foo\n\npackage foo\n\nimport \"os\"\n\n// Missing compares directly.\nfunc Missing(err error) bool {\n\treturn err == os.ErrNotExist\n}\n",
+	"handler.go":       "// Foo\n\npackage foo\n\nimport (\n\t\"net/http\"\n\t\"time\"\n)\n\n// Slow ignores the client.\nfunc Slow(w http.ResponseWriter, r *http.Request) {\n\ttime.Sleep(time.Second)\n}\n",
+	"table_test.go":    "package foo\n\nimport \"testing\"\n\nfunc TestTable(t *testing.T) {\n\tfor _, c := range []int{1} {\n\t\tif c != 1 {\n\t\t\tt.Fail()\n\t\t}\n\t}\n}\n",
+	"panic.go":         "// Foo\n\npackage foo\n\n// Boom panics.\nfunc Boom() {\n\tpanic(\"boom\")\n}\n",
+	"print.go":         "// Foo\n\npackage foo\n\nimport \"log\"\n\n// Print logs.\nfunc Print() {\n\tlog.Print(\"hi\")\n}\n",
+	"open.go":          "// Foo\n\npackage foo\n\n// Open opens.\nfunc Open() error {\n\treturn nil\n}\n",
+	"magic.go":         "// Foo\n\npackage foo\n\n// Answer answers.\nfunc Answer() int {\n\treturn 42\n}\n",
+	"api.go":           "// Foo\n\npackage foo\n\n// Reply is marshaled.\ntype Reply struct {\n\tUserID int `json:\"userID\"`\n}\n",
+	"timeout.go":       "// Foo\n\npackage foo\n\nimport (\n\t\"context\"\n\t\"time\"\n)\n\n// Wait leaks.\nfunc Wait(ctx context.Context) {\n\tctx, _ = context.WithTimeout(ctx, time.Second)\n\t<-ctx.Done()\n}\n",
+	"visitor.go":       "// Foo\n\npackage foo\n\n// Node is a node.\ntype Node interface {\n\tPos() int\n}\n\n// Leaf is a node.\ntype Leaf struct{}\n\n// Pos implements Node.\nfunc (l Leaf) Pos() int {\n\treturn 0\n}\n\n// Tree is a node.\ntype Tree struct{}\n\n// Pos implements Node.\nfunc (t *Tree) Pos() int {\n\treturn 0\n}\n\n// Visit misses Tree.\nfunc Visit(n Node) bool {\n\tswitch n.(type) {\n\tcase Leaf:\n\t\treturn true\n\t}\n\treturn false\n}\n",
+	"export_test.go":   "package foo\n\n// Parse is exported for the tests.\nvar Parse = Answer\n",
+	"external_test.go": "package foo_test\n\nimport (\n\t\"testing\"\n\n\t\"foo\"\n)\n\nfunc TestParse(t *testing.T) {\n\tif foo.Parse() != 42 {\n\t\tt.Fail()\n\t}\n}\n",
+	"sorted.go":        "// Foo\n\npackage foo\n\nimport \"sort\"\n\n// Sorted sorts.\nfunc Sorted(s []int) {\n\tsort.Slice(s, func(i, j int) bool {\n\t\treturn s[i] <= s[j]\n\t})\n}\n",
+	"files.go":         "// Foo\n\npackage foo\n\nimport \"os\"\n\n// Open leaks.\nfunc Open(names []string) {\n\tfor _, n := range names {\n\t\tf, _ := os.Open(n)\n\t\tdefer f.Close()\n\t}\n}\n",
+	"clock.go":         "// Foo\n\npackage foo\n\nimport \"time\"\n\n// Elapsed is the time since t.\nfunc Elapsed(t time.Time) time.Duration {\n\treturn time.Now().Sub(t)\n}\n",
+	"counter.go":       "// Foo\n\npackage foo\n\nimport \"sync\"\n\n// Counter is a counter.\ntype Counter struct {\n\tmu sync.Mutex\n\tn  int\n}\n\n// Value returns the count.\nfunc (c Counter) Value() int {\n\tc.mu.Lock()\n\tdefer c.mu.Unlock()\n\treturn c.n\n}\n",
+	"workers.go":       "// Foo\n\npackage foo\n\nimport \"sync\"\n\n// Run runs f n times concurrently.\nfunc Run(n int, f func()) {\n\tvar wg sync.WaitGroup\n\tfor i := 0; i < n; i++ {\n\t\tgo func() {\n\t\t\twg.Add(1)\n\t\t\tdefer wg.Done()\n\t\t\tf()\n\t\t}()\n\t}\n\twg.Wait()\n}\n",
+	"must.go":          "// Foo\n\npackage foo\n\nimport \"log\"\n\n// Must fails hard on error.\nfunc Must(err error) {\n\tif err != nil {\n\t\tlog.Fatal(err)\n\t}\n}\n",
+	"exit.go":          "// Foo\n\npackage foo\n\nimport \"os\"\n\nfunc init() {\n\tif os.Getenv(\"FOO\") != \"\" {\n\t\tos.Exit(1)\n\t}\n}\n",
+	"remove.go":        "// Foo\n\npackage foo\n\nimport \"os\"\n\n// Clean ignores the error.\nfunc Clean() {\n\tos.Remove(\"foo\")\n}\n",
+	"tags.go":          "// Foo\n\npackage foo\n\n// Tagged has a malformed tag.\ntype Tagged struct {\n\tA int `json:\"a`\n}\n",
+	"helper.go": `// Foo
+
+package foo
+
+import "testing"
+
+// Helper is a test helper.
+func Helper(t *testing.T) {
+}
+`,
 	"foo.go": "// Foo\n\n// +build: incorrect\n\npackage foo\n" + `
 import "errors"
 
@@ -198,9 +626,59 @@ import "testing"
 func TestFail(t *testing.T) {
 t.Fail()
 }
+
+func testMisnamed(t *testing.T) {
+}
 `,
 }
 
+// This set of files uses cgo in a subpackage.
+var cgoFiles = map[string]string{
+	"foo.go": `// Foo
+
+package foo
+
+import _ "foo/bar"
+`,
+	"bar/bar.go": `// Foo
+
+package bar
+
+// #include <stdlib.h>
+import "C"
+
+// Bar returns 1.
+func Bar() int {
+	return int(C.abs(-1))
+}
+`,
+}
+
+// This set of files has a stale golden file.
+var goldenFiles = map[string]string{
+	"foo_test.go": `// Foo
+
+package foo
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGolden(t *testing.T) {
+	if *update {
+		if err := ioutil.WriteFile("testdata/golden.txt", []byte("new\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+`,
+	"testdata/golden.txt": "old\n",
+}
+
 func init() {
 	if IsContinuousIntegration() {
 		// The reason it's being done is that "go test" starts before prerequisites
@@ -247,6 +725,91 @@ func setup(t *testing.T, td string, files map[string]string) scm.Change {
 	return change
 }
 
+// runCheck runs a single check on files and returns its result. Structured
+// issues are returned as a plain error with the same text, to be compared
+// with errors.New().
+func runCheck(t *testing.T, c Check, files map[string]string) error {
+	return runCheckChanged(t, c, files, nil)
+}
+
+// runCheckChanged is runCheck where only the files in changed are modified,
+// the other ones are only part of their package. All the files are modified
+// if changed is nil.
+func runCheckChanged(t *testing.T, c Check, files map[string]string, changed []string) error {
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	change := setup(t, td, files)
+	if changed != nil {
+		change = &changedOnly{change, changed}
+	}
+	err = c.Run(change, &Options{MaxDuration: 1})
+	if issues, ok := err.(Issues); ok {
+		return errors.New(issues.Error())
+	}
+	return err
+}
+
+// changedOnly is a scm.Change where only the files listed are modified, the
+// other files of the change are only part of All().
+type changedOnly struct {
+	scm.Change
+	changed goFiles
+}
+
+func (c *changedOnly) Changed() scm.Set { return c.changed }
+
+// goFiles is a scm.Set of Go files.
+type goFiles []string
+
+func (f goFiles) Files() []string        { return f }
+func (f goFiles) GoFiles() []string      { return f }
+func (f goFiles) Packages() []string     { return nil }
+func (f goFiles) TestPackages() []string { return nil }
+
+// fakeChange is a scm.Change that only implements what is needed to select
+// the test packages and the triggered checks.
+type fakeChange struct {
+	scm.Change
+	pkg           string
+	changed       []string
+	indirect, all []string
+}
+
+func (f *fakeChange) Package() string   { return f.pkg }
+func (f *fakeChange) Changed() scm.Set  { return fakeFiles(f.changed) }
+func (f *fakeChange) Indirect() scm.Set { return fakeSet(f.indirect) }
+func (f *fakeChange) All() scm.Set      { return fakeSet(f.all) }
+
+// fakeSet is a scm.Set of test packages.
+type fakeSet []string
+
+func (f fakeSet) Files() []string        { return nil }
+func (f fakeSet) GoFiles() []string      { return nil }
+func (f fakeSet) Packages() []string     { return f }
+func (f fakeSet) TestPackages() []string { return f }
+
+// fakeFiles is a scm.Set of files.
+type fakeFiles []string
+
+func (f fakeFiles) Files() []string        { return f }
+func (f fakeFiles) GoFiles() []string      { return nil }
+func (f fakeFiles) Packages() []string     { return nil }
+func (f fakeFiles) TestPackages() []string { return nil }
+
+// unnamed is a Check without a name.
+type unnamed struct {
+	Custom
+}
+
+func (u *unnamed) GetName() string {
+	return ""
+}
+
 func getKnownChecks() []string {
 	names := make([]string, 0, len(KnownChecks))
 	for name := range KnownChecks {
@@ -8,6 +8,13 @@ package checks
 
 import (
 	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
@@ -28,9 +35,27 @@ const (
 	Lint                  Mode = "lint"
 )
 
-// AllModes are all known valid modes that can be used in pre-commit-go.yml.
+// AllModes are all predefined modes. Other modes can be defined in
+// pre-commit-go.yml; they are only run when explicitly selected.
 var AllModes = []Mode{PreCommit, PrePush, ContinuousIntegration, Lint}
 
+// ReservedModes are the names that can't be used to define a mode as they
+// are shortcuts used on the command line.
+var ReservedModes = []string{"all", "fast", "pc", "slow", "pp", "full", "ci"}
+
+// reModeName is the valid format for a mode name.
+var reModeName = regexp.MustCompile("^[a-z0-9][a-z0-9_-]*$")
+
+// IsPredefined returns true if the mode is one of AllModes.
+func (m Mode) IsPredefined() bool {
+	for _, known := range AllModes {
+		if m == known {
+			return true
+		}
+	}
+	return false
+}
+
 // UnmarshalYAML implements yaml.Unmarshaler.
 func (m *Mode) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s := ""
@@ -38,13 +63,16 @@ func (m *Mode) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		return err
 	}
 	val := Mode(s)
-	for _, known := range AllModes {
-		if val == known {
-			*m = val
-			return nil
+	if !reModeName.MatchString(s) {
+		return fmt.Errorf("invalid mode \"%s\"", val)
+	}
+	for _, reserved := range ReservedModes {
+		if s == reserved {
+			return fmt.Errorf("mode \"%s\" is reserved", val)
 		}
 	}
-	return fmt.Errorf("invalid mode \"%s\"", val)
+	*m = val
+	return nil
 }
 
 // Config is the serialized form of pre-commit-go.yml.
@@ -60,20 +88,153 @@ type Config struct {
 	// []string{".*", "_*"}.  This is a glob that is applied to each path
 	// component of each file.
 	IgnorePatterns []string `yaml:"ignore_patterns"`
+	// WarnUntracked prints a warning when untracked Go files are present, as
+	// they are not checked. It is easy to forget to "git add" a new file.
+	WarnUntracked bool `yaml:"warn_untracked"`
+	// StashUnstaged runs the pre-commit checks in the checkout after stashing
+	// the unstaged changes, instead of running them on a copy of the staging
+	// area. The unstaged changes are restored afterward.
+	StashUnstaged bool `yaml:"stash_unstaged"`
+	// Isolate runs the checks in a temporary git worktree of the staging area,
+	// so the checks writing files have no side effect on the checkout. The
+	// unstaged changes and the untracked files are not checked.
+	Isolate bool `yaml:"isolate"`
+	// FilesCommand is the command listing the files to check, one per line,
+	// instead of the files modified as per git. It is run from the root of the
+	// repository by "pcg run" when neither -a nor -r is specified, e.g. to use
+	// the change detection of a build system.
+	FilesCommand []string `yaml:"files_command,omitempty"`
+	// Modules is the list of Go modules in which the checks are run, for
+	// repositories containing multiple modules. When empty, the checks are run
+	// once at the root of the repository.
+	Modules Modules `yaml:"modules"`
+	// FailOn is the minimum severity of the issues that fail the run, one of
+	// "error", "warning" or "info". The issues of a lower severity are printed
+	// but don't fail the run. Defaults to "error".
+	FailOn Severity `yaml:"fail_on"`
+	// GoCache is the directory to use as GOCACHE, the go build cache, for all
+	// the processes started, including the prerequisites installation. It is
+	// relative to the repository root unless absolute and environment
+	// variables are expanded, e.g. "$HOME/.cache/go-build". It is meant to
+	// point at a directory persisted across continuous integration runs. When
+	// empty, GOCACHE is left untouched.
+	GoCache string `yaml:"go_cache"`
+	// GoModCache is the directory to use as GOMODCACHE, the Go module download
+	// cache. It is handled like GoCache.
+	GoModCache string `yaml:"go_mod_cache"`
 
 	// MaxConcurrent, if not zero, is the maximum number of concurrent processes
 	// to run. If zero, there is no maximum.
 	MaxConcurrent int `yaml:"-"`
+	// RecordTests, if true, records the duration of each individual test run by
+	// check test. They are retrieved via Options.TestTimings().
+	RecordTests bool `yaml:"-"`
+}
+
+// Overlay merges the configuration content on top of c, e.g. a personal
+// pre-commit-go.local.yml.
+//
+// The root keys set in content replace the ones of c. Within a mode, each
+// check type listed replaces all the checks of this type and an empty list
+// disables it; max_duration and fail_fast_on_build replace the ones of the
+// mode when set. It returns a warning for each setting stricter than the one
+// it replaces, so it is clear the stricter behavior is personal.
+func (c *Config) Overlay(content []byte) ([]string, error) {
+	modes := c.Modes
+	failOn := c.FailOn
+	c.Modes = nil
+	err := yaml.Unmarshal(content, c)
+	local := c.Modes
+	c.Modes = modes
+	if err != nil {
+		return nil, err
+	}
+	// Keep track of the keys set, as an empty list of checks is not
+	// distinguishable from a missing one once parsed.
+	raw := struct {
+		Modes map[Mode]map[string]interface{} `yaml:"modes"`
+	}{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	var warnings []string
+	if !c.FailOn.AtLeast(failOn) {
+		warnings = append(warnings, fmt.Sprintf("fail_on is %s instead of %s", c.FailOn, failOn))
+	}
+	if len(raw.Modes) != 0 && c.Modes == nil {
+		c.Modes = map[Mode]Settings{}
+	}
+	for mode, keys := range raw.Modes {
+		settings := c.Modes[mode]
+		l := local[mode]
+		if _, ok := keys["max_duration"]; ok {
+			if l.Options.MaxDuration > 0 && (settings.Options.MaxDuration == 0 || l.Options.MaxDuration < settings.Options.MaxDuration) {
+				warnings = append(warnings, fmt.Sprintf("mode %s: max_duration is %d instead of %d", mode, l.Options.MaxDuration, settings.Options.MaxDuration))
+			}
+			settings.Options.MaxDuration = l.Options.MaxDuration
+		}
+		if _, ok := keys["fail_fast_on_build"]; ok {
+			settings.Options.FailFastOnBuild = l.Options.FailFastOnBuild
+		}
+		if rawChecks, ok := keys["checks"].(map[interface{}]interface{}); ok {
+			merged := Checks{}
+			for name, checks := range settings.Checks {
+				merged[name] = checks
+			}
+			for key := range rawChecks {
+				name, _ := key.(string)
+				if len(l.Checks[name]) == 0 {
+					delete(merged, name)
+					continue
+				}
+				if _, ok := merged[name]; !ok {
+					warnings = append(warnings, fmt.Sprintf("mode %s: check %s is added", mode, name))
+				}
+				merged[name] = l.Checks[name]
+			}
+			settings.Checks = merged
+		}
+		c.Modes[mode] = settings
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
+
+// UserModes returns the modes defined in the configuration that are not
+// predefined, sorted by name.
+func (c *Config) UserModes() []Mode {
+	var out []Mode
+	for mode := range c.Modes {
+		if !mode.IsPredefined() {
+			out = append(out, mode)
+		}
+	}
+	sort.Sort(modes(out))
+	return out
 }
 
 // EnabledChecks returns all the checks enabled.
+//
+// A check enabled in multiple modes with the same options is returned once.
+// The checks are in a stable order: per mode, sorted by check type, then in
+// the order they are listed.
 func (c *Config) EnabledChecks(modes []Mode) ([]Check, *Options) {
 	out := []Check{}
 	options := &Options{}
 
 	for _, mode := range modes {
-		for _, checks := range c.Modes[mode].Checks {
-			out = append(out, checks...)
+		checks := c.Modes[mode].Checks
+		names := make([]string, 0, len(checks))
+		for name := range checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, check := range checks[name] {
+				if !containsCheck(out, check) {
+					out = append(out, check)
+				}
+			}
 		}
 		options = options.merge(c.Modes[mode].Options)
 	}
@@ -82,9 +243,52 @@ func (c *Config) EnabledChecks(modes []Mode) ([]Check, *Options) {
 		// Allocate and populate a run token semaphore.
 		options.runTokens = make(chan struct{}, c.MaxConcurrent)
 	}
+	if c.RecordTests {
+		options.tests = &timingRecorder{}
+	}
+	options.notices = &noticeRecorder{}
 	return out, options
 }
 
+// AutoModules is the Modules value to discover all the go.mod files in the
+// repository.
+const AutoModules = "auto"
+
+// Modules is the list of the Go module directories relative to the repository
+// root, or "auto".
+type Modules []string
+
+// IsAuto returns true if the modules are discovered automatically.
+func (m Modules) IsAuto() bool {
+	return len(m) == 1 && m[0] == AutoModules
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (m *Modules) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	s := ""
+	if err := unmarshal(&s); err == nil {
+		if s != AutoModules {
+			return fmt.Errorf("invalid modules \"%s\"; expected \"%s\" or a list of directories", s, AutoModules)
+		}
+		*m = Modules{AutoModules}
+		return nil
+	}
+	var l []string
+	if err := unmarshal(&l); err != nil {
+		return err
+	}
+	*m = Modules(l)
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m Modules) MarshalYAML() (interface{}, error) {
+	if m.IsAuto() {
+		return AutoModules, nil
+	}
+	return []string(m), nil
+}
+
 // Settings is the settings used for a mode.
 type Settings struct {
 	// Checks is a map of all checks enabled for this mode, with the key being
@@ -98,11 +302,25 @@ type Options struct {
 	// MaxDuration is the maximum allowed duration to run all the checks in
 	// seconds. If it takes more time than that, it is marked as failed.
 	MaxDuration int `yaml:"max_duration"`
+	// FailFastOnBuild runs the build checks first and skips the other checks if
+	// the code doesn't compile. If no build check is enabled, the test checks
+	// are run first instead.
+	FailFastOnBuild bool `yaml:"fail_fast_on_build"`
 
 	// runTokens is a fixed-capacity semaphore channel.
 	//
 	// If nil, run token operations are no-ops.
 	runTokens chan struct{}
+
+	// tests records the duration of individual tests.
+	//
+	// If nil, tests are not recorded.
+	tests *timingRecorder
+
+	// notices records the messages of the checks for the user.
+	//
+	// If nil, the messages are logged instead.
+	notices *noticeRecorder
 }
 
 // LeaseRunToken returns a leased run token.
@@ -125,26 +343,118 @@ func (o *Options) ReturnRunToken() {
 	<-o.runTokens
 }
 
+// TestTimings returns the duration of all the individual tests run so far,
+// slowest first. Returns nil if Config.RecordTests was not set.
+func (o *Options) TestTimings() Timings {
+	if o.tests == nil {
+		return nil
+	}
+	o.tests.lock.Lock()
+	defer o.tests.lock.Unlock()
+	out := make(Timings, len(o.tests.timings))
+	copy(out, o.tests.timings)
+	sort.Sort(out)
+	return out
+}
+
+// Notice records a message for the user, e.g. a suggestion about the
+// configuration. Unlike the log, which is only printed with -v, the notices
+// are printed with the report of the checks.
+func (o *Options) Notice(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if o.notices == nil {
+		log.Print(msg)
+		return
+	}
+	o.notices.lock.Lock()
+	defer o.notices.lock.Unlock()
+	o.notices.messages = append(o.notices.messages, msg)
+}
+
+// Notices returns the messages recorded via Notice so far, in order.
+func (o *Options) Notices() []string {
+	if o.notices == nil {
+		return nil
+	}
+	o.notices.lock.Lock()
+	defer o.notices.lock.Unlock()
+	return append([]string(nil), o.notices.messages...)
+}
+
 // Capture sets GOPATH and executes a subprocess.
 func (o *Options) Capture(r scm.ReadOnlyRepo, args ...string) (string, int, time.Duration, error) {
+	return o.CaptureEnv(r, nil, args...)
+}
+
+// CaptureEnv sets GOPATH and the additional environment variables env then
+// executes a subprocess.
+func (o *Options) CaptureEnv(r scm.ReadOnlyRepo, env []string, args ...string) (string, int, time.Duration, error) {
 	o.LeaseRunToken()
 	defer o.ReturnRunToken()
 
 	start := time.Now()
-	out, exitCode, err := internal.Capture(r.Root(), []string{"GOPATH=" + r.GOPATH()}, args...)
+	out, exitCode, err := internal.Capture(r.Root(), append([]string{"GOPATH=" + r.GOPATH()}, env...), args...)
 	return out, exitCode, time.Since(start), err
 }
 
 // merge merges two options and returns a result.
 // This is used for multimode runs.
 func (o *Options) merge(r Options) *Options {
-	out := &Options{MaxDuration: o.MaxDuration}
+	out := &Options{MaxDuration: o.MaxDuration, FailFastOnBuild: o.FailFastOnBuild || r.FailFastOnBuild}
 	if out.MaxDuration < r.MaxDuration {
 		out.MaxDuration = r.MaxDuration
 	}
 	return out
 }
 
+// containsCheck returns true if checks contains a check of the same type as
+// check with the same options.
+func containsCheck(checks []Check, check Check) bool {
+	for _, c := range checks {
+		if c.GetName() == check.GetName() && reflect.DeepEqual(c, check) {
+			return true
+		}
+	}
+	return false
+}
+
+type modes []Mode
+
+func (m modes) Len() int           { return len(m) }
+func (m modes) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m modes) Less(i, j int) bool { return m[i] < m[j] }
+
+// Timing is the duration of a named item, e.g. a check or a test.
+type Timing struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Timings is a list of Timing sorted from the slowest to the fastest.
+type Timings []Timing
+
+func (t Timings) Len() int           { return len(t) }
+func (t Timings) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t Timings) Less(i, j int) bool { return t[i].Duration > t[j].Duration }
+
+// timingRecorder is a thread safe Timings accumulator.
+type timingRecorder struct {
+	lock    sync.Mutex
+	timings Timings
+}
+
+func (t *timingRecorder) record(name string, d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timings = append(t.timings, Timing{name, d})
+}
+
+// noticeRecorder is a thread safe accumulator of the notices.
+type noticeRecorder struct {
+	lock     sync.Mutex
+	messages []string
+}
+
 // Checks helps with Check serialization.
 type Checks map[string][]Check
 
@@ -161,6 +471,25 @@ func (c *Checks) UnmarshalYAML(unmarshal func(interface{}) error) error {
 			return fmt.Errorf("unknown check \"%s\"", checkTypeName)
 		}
 		for _, checkData := range checks {
+			// The condition is evaluated once, when loading, against the
+			// process environment. A check whose condition is false is dropped.
+			if when, ok := checkData[WhenKey]; ok {
+				delete(checkData, WhenKey)
+				cond, ok := when.(string)
+				if !ok {
+					return fmt.Errorf("%s: invalid when condition %v; expected a string", checkTypeName, when)
+				}
+				enabled, err := evalCondition(cond, os.LookupEnv)
+				if err != nil {
+					return fmt.Errorf("%s: %v", checkTypeName, err)
+				}
+				if !enabled {
+					continue
+				}
+			}
+			// Round trip each check through its own document. This expands the
+			// YAML aliases so no memory, e.g. a *CoverageSettings, is ever shared
+			// between two aliased values.
 			rawCheckData, err := yaml.Marshal(checkData)
 			if err != nil {
 				return err
@@ -175,6 +504,36 @@ func (c *Checks) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// WhenKey is the key of the optional condition of a check, e.g.
+// `when: "${CI} == true"`. The check is only loaded when the condition holds.
+const WhenKey = "when"
+
+// reCondition is the format of a when condition: ${VAR}, ${VAR} == value or
+// ${VAR} != value.
+var reCondition = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}\s*(?:(==|!=)\s*(.*))?$`)
+
+// evalCondition returns if the when condition cond holds with the environment
+// variables returned by lookup.
+//
+// ${VAR} holds when VAR is set and not empty. ${VAR} == value and
+// ${VAR} != value compare VAR, unset being the empty string, to value which
+// may be quoted.
+func evalCondition(cond string, lookup func(string) (string, bool)) (bool, error) {
+	m := reCondition.FindStringSubmatch(strings.TrimSpace(cond))
+	if m == nil {
+		return false, fmt.Errorf("invalid when condition %q; expected ${VAR}, ${VAR} == value or ${VAR} != value", cond)
+	}
+	v, _ := lookup(m[1])
+	if m[2] == "" {
+		return v != "", nil
+	}
+	value := strings.TrimSpace(m[3])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return (v == value) == (m[2] == "=="), nil
+}
+
 // New returns a default initialized Config instance.
 func New(v string) *Config {
 	return &Config{
@@ -187,6 +546,7 @@ func New(v string) *Config {
 						&Build{
 							BuildAll:  false,
 							ExtraArgs: []string{},
+							GCFlags:   []string{},
 						},
 					},
 					"gofmt": {
@@ -233,6 +593,7 @@ func New(v string) *Config {
 						&Build{
 							BuildAll:  false,
 							ExtraArgs: []string{},
+							GCFlags:   []string{},
 						},
 					},
 					"gofmt": {
@@ -290,5 +651,114 @@ func New(v string) *Config {
 			"*.pb.go",     // protobuf
 			"*_string.go", // stringer
 		},
+		Modules: Modules{},
+		FailOn:  SeverityError,
+	}
+}
+
+// Presets are curated configurations to bootstrap pre-commit-go.yml.
+const (
+	// PresetRelaxed only runs the basic checks, with low coverage bands, to
+	// adopt pre-commit-go on an existing project.
+	PresetRelaxed = "relaxed"
+	// PresetStrict runs every native check that doesn't need project specific
+	// options, with high coverage bands and failing on warnings.
+	PresetStrict = "strict"
+)
+
+// AllPresets is all the known presets, from the most lenient.
+var AllPresets = []string{PresetRelaxed, PresetStrict}
+
+// NewPreset returns the Config of a preset, one of AllPresets.
+func NewPreset(v, name string) (*Config, error) {
+	c := New(v)
+	switch name {
+	case PresetRelaxed:
+		coverage := func(coveralls bool) *Coverage {
+			return &Coverage{
+				UseCoveralls:  coveralls,
+				Global:        CoverageSettings{MinCoverage: 20, MaxCoverage: 100},
+				PerDirDefault: CoverageSettings{MinCoverage: 0, MaxCoverage: 100},
+				PerDir:        map[string]*CoverageSettings{},
+			}
+		}
+		delete(c.Modes[PreCommit].Checks, "test")
+		delete(c.Modes[PrePush].Checks, "goimports")
+		c.Modes[PrePush].Checks["coverage"] = []Check{coverage(false)}
+		c.Modes[PrePush].Checks["test"] = []Check{&Test{ExtraArgs: []string{"-short"}}}
+		delete(c.Modes[ContinuousIntegration].Checks, "goimports")
+		c.Modes[ContinuousIntegration].Checks["coverage"] = []Check{coverage(true)}
+		c.Modes[Lint].Checks["errcheck"] = []Check{&Errcheck{Ignores: "Close|Write.*|Flush|Seek|Read.*"}}
+	case PresetStrict:
+		coverage := func(coveralls bool) *Coverage {
+			return &Coverage{
+				UseCoveralls:  coveralls,
+				Global:        CoverageSettings{MinCoverage: 80, MaxCoverage: 100},
+				PerDirDefault: CoverageSettings{MinCoverage: 60, MaxCoverage: 100},
+				PerDir:        map[string]*CoverageSettings{},
+			}
+		}
+		// The in-process checks, and copylocks which runs a single go vet
+		// analyzer, are fast enough for pre-commit.
+		source := func() Checks {
+			return Checks{
+				"buildconstraints": {&BuildConstraints{}},
+				"contextcancel":    {&ContextCancel{}},
+				"contextfirst":     {&ContextFirst{IncludeUnexported: true}},
+				"copylocks":        {&CopyLocks{}},
+				"deferinloop":      {&DeferInLoop{}},
+				"errorcomparison":  {&ErrorComparison{}},
+				"errornaming":      {&ErrorNaming{}},
+				"errorwrap":        {&ErrorWrap{}},
+				"exampleoutput":    {&ExampleOutput{}},
+				"importcount":      {&ImportCount{MaxImports: 20, ExcludeStdlib: true}},
+				"nilinterface":     {&NilInterface{}},
+				"nopanic":          {&NoPanic{}},
+				"osexit":           {&OsExit{}},
+				"packagename":      {&PackageName{}},
+				"receivernames":    {&ReceiverNames{MaxLength: 3}},
+				"sortless":         {&SortLess{}},
+				"structtags":       {&StructTags{RequireSnakeCase: true}},
+				"subtests":         {&Subtests{}},
+				"tagconsistency":   {&TagConsistency{}},
+				"testmain":         {&TestMainUsage{}},
+				"testnaming":       {&TestNaming{}},
+				"testingimport":    {&TestingImport{}},
+				"waitgroupusage":   {&WaitGroupUsage{}},
+			}
+		}
+		repository := func() Checks {
+			return Checks{
+				"embed":           {&Embed{}},
+				"filesize":        {&FileSize{MaxBytes: 1024 * 1024}},
+				"goroutinesafety": {&GoroutineSafety{FileFilter: FileFilter{SkipTestFiles: true}}},
+				"handlercontext":  {&HandlerContext{}},
+				"initfuncs":       {&InitFuncs{MaxStatements: 20, Disallowed: []string{"log.Fatal", "log.Fatalf", "log.Fatalln", "os.Exit"}}},
+				"requiretests":    {&RequireTests{}},
+				"signaturelimits": {&SignatureLimits{MaxParams: 6, MaxResults: 3, FileFilter: FileFilter{SkipTestFiles: true}}},
+			}
+		}
+		for _, m := range []Mode{PreCommit, ContinuousIntegration} {
+			for name, checks := range source() {
+				c.Modes[m].Checks[name] = checks
+			}
+		}
+		for _, m := range []Mode{PrePush, ContinuousIntegration} {
+			for name, checks := range repository() {
+				c.Modes[m].Checks[name] = checks
+			}
+		}
+		c.Modes[PrePush].Checks["coverage"] = []Check{coverage(false)}
+		c.Modes[ContinuousIntegration].Checks["coverage"] = []Check{coverage(true)}
+		c.Modes[Lint].Checks["dupl"] = []Check{&Dupl{}}
+		c.Modes[Lint].Checks["errcheck"] = []Check{&Errcheck{}}
+		c.Modes[Lint].Checks["errordocs"] = []Check{&ErrorDocs{}}
+		c.Modes[Lint].Checks["magicnumbers"] = []Check{&MagicNumbers{Allow: []float64{2, 10, 100}, FileFilter: FileFilter{SkipTestFiles: true}}}
+		c.Modes[Lint].Checks["govet"] = []Check{&Govet{Blacklist: []string{}}}
+		c.Modes[Lint].Checks["typeswitch"] = []Check{&TypeSwitch{}}
+		c.FailOn = SeverityWarning
+	default:
+		return nil, fmt.Errorf("unknown preset %q; expected one of %s", name, strings.Join(AllPresets, ", "))
 	}
+	return c, nil
 }
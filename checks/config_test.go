@@ -6,7 +6,10 @@ package checks
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
@@ -19,8 +22,140 @@ func TestConfigNew(t *testing.T) {
 	ut.AssertEqual(t, 5, len(config.Modes[ContinuousIntegration].Checks))
 	ut.AssertEqual(t, 3, len(config.Modes[Lint].Checks))
 	checks, options := config.EnabledChecks([]Mode{PreCommit, PrePush, ContinuousIntegration, Lint})
-	ut.AssertEqual(t, Options{MaxDuration: 120}, *options)
-	ut.AssertEqual(t, 2+4+5+3, len(checks))
+	ut.AssertEqual(t, Options{MaxDuration: 120, notices: &noticeRecorder{}}, *options)
+	// continuous-integration only adds its coverage check, the other ones are
+	// the same as in pre-commit and pre-push.
+	ut.AssertEqual(t, 3+3+1+3, len(checks))
+}
+
+func TestConfigNewPreset(t *testing.T) {
+	for _, name := range AllPresets {
+		config, err := NewPreset("0.1", name)
+		ut.AssertEqual(t, nil, err)
+		for _, s := range config.Modes {
+			for checkName, checks := range s.Checks {
+				ut.AssertEqual(t, true, KnownChecks[checkName] != nil)
+				ut.AssertEqual(t, checkName, checks[0].GetName())
+			}
+		}
+		// It is stable when written by writeconfig then loaded.
+		data, err := yaml.Marshal(config)
+		ut.AssertEqual(t, nil, err)
+		actual := &Config{}
+		ut.AssertEqual(t, nil, yaml.Unmarshal(data, actual))
+		data2, err := yaml.Marshal(actual)
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, string(data), string(data2))
+	}
+	relaxed, _ := NewPreset("0.1", PresetRelaxed)
+	ut.AssertEqual(t, 2, len(relaxed.Modes[PreCommit].Checks))
+	// The strict preset enables every native check that doesn't require project
+	// specific options.
+	strict, _ := NewPreset("0.1", PresetStrict)
+	enabled := map[string]bool{}
+	for _, s := range strict.Modes {
+		for name := range s.Checks {
+			enabled[name] = true
+		}
+	}
+	for name, factory := range KnownChecks {
+		switch name {
+		case "copyright", "custom", "docexamples", "golden", "jsonnaming", "largeparam", "logging", "mustcheck", "publicsurface", "testinternals", "timenow":
+			continue
+		}
+		if factory().GetPrerequisites() == nil {
+			ut.AssertEqualf(t, true, enabled[name], "%s", name)
+		}
+	}
+	ut.AssertEqual(t, SeverityWarning, strict.FailOn)
+	_, err := NewPreset("0.1", "foo")
+	ut.AssertEqual(t, errors.New("unknown preset \"foo\"; expected one of relaxed, strict"), err)
+}
+
+func TestConfigEnabledChecksDedup(t *testing.T) {
+	data := []byte(`modes:
+  pre-commit:
+    checks:
+      gofmt:
+      - {}
+      test:
+      - extra_args: [-short]
+    max_duration: 10
+  lint:
+    checks:
+      gofmt:
+      - {}
+      test:
+      - extra_args: [-v]
+    max_duration: 30
+`)
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, config))
+	checks, options := config.EnabledChecks([]Mode{PreCommit, Lint})
+	ut.AssertEqual(t, 3, len(checks))
+	ut.AssertEqual(t, 30, options.MaxDuration)
+	var args [][]string
+	for _, c := range checks {
+		if test, ok := c.(*Test); ok {
+			args = append(args, test.ExtraArgs)
+		}
+	}
+	ut.AssertEqual(t, 2, len(args))
+}
+
+func TestConfigEnabledChecksOrder(t *testing.T) {
+	data := []byte("modes:\n  pre-commit:\n    checks:\n      test:\n      - extra_args: [-a]\n      - extra_args: [-b]\n      build:\n      - {}\n      gofmt:\n      - {}\n  lint:\n    checks:\n      errcheck:\n      - {}\n      deferinloop:\n      - {}\n")
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, config))
+	for i := 0; i < 10; i++ {
+		checks, _ := config.EnabledChecks([]Mode{PreCommit, Lint})
+		var names []string
+		for _, c := range checks {
+			names = append(names, c.GetName())
+		}
+		ut.AssertEqualIndex(t, i, []string{"build", "gofmt", "test", "test", "deferinloop", "errcheck"}, names)
+		ut.AssertEqualIndex(t, i, []string{"-a"}, checks[2].(*Test).ExtraArgs)
+	}
+}
+
+func TestConfigOverlay(t *testing.T) {
+	config := New("0.1")
+	data := []byte(`fail_on: warning
+modes:
+  pre-commit:
+    max_duration: 2
+    checks:
+      test: []
+      testnaming:
+      - {}
+  pre-push:
+    max_duration: 600
+    checks:
+      coverage:
+      - use_coveralls: false
+`)
+	warnings, err := config.Overlay(data)
+	ut.AssertEqual(t, nil, err)
+	expected := []string{
+		"fail_on is warning instead of error",
+		"mode pre-commit: check testnaming is added",
+		"mode pre-commit: max_duration is 2 instead of 5",
+	}
+	ut.AssertEqual(t, expected, warnings)
+	ut.AssertEqual(t, SeverityWarning, config.FailOn)
+	ut.AssertEqual(t, "0.1", config.MinVersion)
+	ut.AssertEqual(t, 2, config.Modes[PreCommit].Options.MaxDuration)
+	ut.AssertEqual(t, 3, len(config.Modes[PreCommit].Checks))
+	ut.AssertEqual(t, 0, len(config.Modes[PreCommit].Checks["test"]))
+	ut.AssertEqual(t, 1, len(config.Modes[PreCommit].Checks["testnaming"]))
+	ut.AssertEqual(t, 600, config.Modes[PrePush].Options.MaxDuration)
+	ut.AssertEqual(t, 3, len(config.Modes[PrePush].Checks))
+	ut.AssertEqual(t, false, config.Modes[PrePush].Checks["coverage"][0].(*Coverage).UseCoveralls)
+	// The other modes are untouched.
+	ut.AssertEqual(t, New("0.1").Modes[Lint], config.Modes[Lint])
+
+	_, err = config.Overlay([]byte("modes:\n  pre-commit:\n    checks:\n      unknown: []\n"))
+	ut.AssertEqual(t, errors.New("unknown check \"unknown\""), err)
 }
 
 func TestConfigYAML(t *testing.T) {
@@ -33,9 +168,173 @@ func TestConfigYAML(t *testing.T) {
 }
 
 func TestConfigYAMLBadMode(t *testing.T) {
-	data, err := yaml.Marshal("foo")
+	data := []struct {
+		in       string
+		expected error
+	}{
+		{"foo bar", errors.New("invalid mode \"foo bar\"")},
+		{"Foo", errors.New("invalid mode \"Foo\"")},
+		{"all", errors.New("mode \"all\" is reserved")},
+		{"pc", errors.New("mode \"pc\" is reserved")},
+	}
+	for i, line := range data {
+		d, err := yaml.Marshal(line.in)
+		ut.AssertEqualIndex(t, i, nil, err)
+		v := PreCommit
+		ut.AssertEqualIndex(t, i, line.expected, yaml.Unmarshal(d, &v))
+		ut.AssertEqualIndex(t, i, PreCommit, v)
+	}
+}
+
+func TestConfigWhen(t *testing.T) {
+	env := map[string]string{"CI": "true", "EMPTY": ""}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	data := []struct {
+		cond     string
+		expected bool
+	}{
+		{"${CI}", true},
+		{"${EMPTY}", false},
+		{"${UNSET}", false},
+		{"${CI} == true", true},
+		{"${CI}==true", true},
+		{"${CI} == \"true\"", true},
+		{"${CI} == 'true'", true},
+		{"${CI} == false", false},
+		{"${CI} != true", false},
+		{"${UNSET} == \"\"", true},
+		{"${UNSET} != true", true},
+	}
+	for i, line := range data {
+		actual, err := evalCondition(line.cond, lookup)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, actual)
+	}
+	for i, cond := range []string{"", "CI == true", "${CI} = true", "${CI} > 1", "$CI"} {
+		_, err := evalCondition(cond, lookup)
+		ut.AssertEqualIndex(t, i, fmt.Errorf("invalid when condition %q; expected ${VAR}, ${VAR} == value or ${VAR} != value", cond), err)
+	}
+}
+
+func TestConfigWhenLoad(t *testing.T) {
+	old, ok := os.LookupEnv("PCG_TEST_WHEN")
+	defer func() {
+		if ok {
+			os.Setenv("PCG_TEST_WHEN", old)
+		} else {
+			os.Unsetenv("PCG_TEST_WHEN")
+		}
+	}()
+	os.Setenv("PCG_TEST_WHEN", "1")
+	data := []byte("modes:\n  pre-commit:\n    checks:\n      gofmt:\n      - when: ${PCG_TEST_WHEN} == 1\n      govet:\n      - when: ${PCG_TEST_WHEN} != 1\n      - blacklist: [foo]\n")
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, config))
+	checks := config.Modes[PreCommit].Checks
+	ut.AssertEqual(t, 1, len(checks["gofmt"]))
+	ut.AssertEqual(t, 1, len(checks["govet"]))
+	ut.AssertEqual(t, []string{"foo"}, checks["govet"][0].(*Govet).Blacklist)
+
+	err := yaml.Unmarshal([]byte("modes:\n  pre-commit:\n    checks:\n      gofmt:\n      - when: true\n"), config)
+	ut.AssertEqual(t, errors.New("gofmt: invalid when condition true; expected a string"), err)
+	err = yaml.Unmarshal([]byte("modes:\n  pre-commit:\n    checks:\n      gofmt:\n      - when: CI\n"), config)
+	ut.AssertEqual(t, errors.New("gofmt: invalid when condition \"CI\"; expected ${VAR}, ${VAR} == value or ${VAR} != value"), err)
+}
+
+func TestConfigUserModes(t *testing.T) {
+	data := []byte("modes:\n  nightly:\n    checks:\n      gofmt:\n      - {}\n  security:\n    max_duration: 60\n  pre-commit:\n    checks: {}\n")
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, config))
+	ut.AssertEqual(t, []Mode{"nightly", "security"}, config.UserModes())
+	ut.AssertEqual(t, false, Mode("nightly").IsPredefined())
+	ut.AssertEqual(t, true, PreCommit.IsPredefined())
+	checks, options := config.EnabledChecks([]Mode{"nightly", "security"})
+	ut.AssertEqual(t, 1, len(checks))
+	ut.AssertEqual(t, "gofmt", checks[0].GetName())
+	ut.AssertEqual(t, 60, options.MaxDuration)
+}
+
+func TestConfigModules(t *testing.T) {
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal([]byte("modules: auto\n"), config))
+	ut.AssertEqual(t, Modules{AutoModules}, config.Modules)
+	ut.AssertEqual(t, true, config.Modules.IsAuto())
+	data, err := yaml.Marshal(config.Modules)
 	ut.AssertEqual(t, nil, err)
-	v := PreCommit
-	ut.AssertEqual(t, errors.New("invalid mode \"foo\""), yaml.Unmarshal(data, &v))
-	ut.AssertEqual(t, PreCommit, v)
+	ut.AssertEqual(t, "auto\n", string(data))
+
+	ut.AssertEqual(t, nil, yaml.Unmarshal([]byte("modules:\n- .\n- tools\n"), config))
+	ut.AssertEqual(t, Modules{".", "tools"}, config.Modules)
+	ut.AssertEqual(t, false, config.Modules.IsAuto())
+
+	err = yaml.Unmarshal([]byte("modules: all\n"), config)
+	ut.AssertEqual(t, errors.New("invalid modules \"all\"; expected \"auto\" or a list of directories"), err)
+}
+
+func TestConfigFailOn(t *testing.T) {
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal([]byte("fail_on: warning\n"), config))
+	ut.AssertEqual(t, SeverityWarning, config.FailOn)
+	err := yaml.Unmarshal([]byte("fail_on: fatal\n"), config)
+	ut.AssertEqual(t, errors.New("invalid severity \"fatal\""), err)
+	ut.AssertEqual(t, SeverityError, New("0.1").FailOn)
+}
+
+func TestConfigRecordTests(t *testing.T) {
+	config := New("0.1")
+	_, options := config.EnabledChecks([]Mode{PreCommit})
+	ut.AssertEqual(t, Timings(nil), options.TestTimings())
+	config.RecordTests = true
+	_, options = config.EnabledChecks([]Mode{PreCommit})
+	options.tests.record("a", time.Second)
+	options.tests.record("b", 2*time.Second)
+	ut.AssertEqual(t, Timings{{"b", 2 * time.Second}, {"a", time.Second}}, options.TestTimings())
+}
+
+func TestOptionsNotices(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, []string(nil), (&Options{}).Notices())
+	_, options := New("0.1").EnabledChecks([]Mode{PreCommit})
+	options.Notice("a %d", 1)
+	options.Notice("b")
+	ut.AssertEqual(t, []string{"a 1", "b"}, options.Notices())
+}
+
+func TestConfigYAMLAnchors(t *testing.T) {
+	data := []byte(`min_version: "0.1"
+coverage_settings: &cov
+  min_coverage: 50
+  max_coverage: 100
+modes:
+  pre-commit:
+    checks:
+      coverage:
+      - per_dir_default: *cov
+        per_dir:
+          a: *cov
+          b: *cov
+          c:
+            <<: *cov
+            min_coverage: 10
+  pre-push:
+    checks:
+      coverage:
+      - global: *cov
+`)
+	config := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, config))
+	expected := CoverageSettings{MinCoverage: 50, MaxCoverage: 100}
+	c := config.Modes[PreCommit].Checks["coverage"][0].(*Coverage)
+	ut.AssertEqual(t, expected, c.PerDirDefault)
+	ut.AssertEqual(t, expected, *c.PerDir["a"])
+	ut.AssertEqual(t, expected, *c.PerDir["b"])
+	ut.AssertEqual(t, CoverageSettings{MinCoverage: 10, MaxCoverage: 100}, *c.PerDir["c"])
+	ut.AssertEqual(t, expected, config.Modes[PrePush].Checks["coverage"][0].(*Coverage).Global)
+
+	// Each alias must be independent.
+	c.PerDir["a"].MinCoverage = 1
+	ut.AssertEqual(t, expected, *c.PerDir["b"])
+	ut.AssertEqual(t, expected, c.PerDirDefault)
 }
@@ -0,0 +1,527 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Parsing and evaluation of build constraints for checks buildconstraints and
+// tagconsistency.
+//
+// go/build only exposes whether a file matches the current context, so both
+// the current and the legacy syntaxes are parsed here to be able to evaluate
+// them against every known target.
+
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// buildExpr is a parsed build constraint. tag returns true if a build tag is
+// satisfied.
+type buildExpr func(tag func(string) bool) bool
+
+// constraintIssue is a problem found in the build constraints of a file.
+type constraintIssue struct {
+	line int
+	msg  string
+}
+
+// fileConstraints is the build constraints of a Go source file.
+type fileConstraints struct {
+	// goBuild is the //go:build line and plus the // +build lines AND'ed
+	// together. They are nil when absent.
+	goBuild buildExpr
+	plus    buildExpr
+	// tags is the tags referenced.
+	tags []string
+	// line is the line of the first constraint.
+	line int
+	// issues is the syntax errors.
+	issues []constraintIssue
+}
+
+// effective returns the constraint used by the go tool, or nil if there is
+// none.
+func (f *fileConstraints) effective() buildExpr {
+	if f.goBuild != nil {
+		return f.goBuild
+	}
+	return f.plus
+}
+
+// parseConstraints parses the build constraints of a Go source file. Only the
+// header of the file, before the package clause, is processed.
+func parseConstraints(content []byte) *fileConstraints {
+	var issues []constraintIssue
+	var plusBuild []buildExpr
+	var goBuild buildExpr
+	var tags []string
+	first := 0
+	// Constraints in the current block of line comments. They are ignored if
+	// the block is not followed by a blank line.
+	var block []int
+	for i, line := range strings.Split(string(content), "\n") {
+		n := i + 1
+		line = strings.TrimSpace(line)
+		if line == "" {
+			block = nil
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			// Reached the package clause.
+			for _, l := range block {
+				issues = append(issues, constraintIssue{l, "build constraint must be followed by a blank line, it is ignored"})
+			}
+			break
+		}
+		text := line[2:]
+		kind := ""
+		if strings.HasPrefix(text, "go:build") {
+			kind = "//go:build"
+		} else if t := strings.TrimSpace(text); strings.HasPrefix(t, "+build") || strings.HasPrefix(t, "go:build") {
+			kind = "// +build"
+			if strings.HasPrefix(t, "go:build") {
+				kind = "// go:build"
+			}
+		}
+		if kind == "" {
+			continue
+		}
+		if first == 0 {
+			first = n
+		}
+		switch kind {
+		case "//go:build":
+			expr := strings.TrimPrefix(text, "go:build")
+			if expr != "" && expr[0] != ' ' && expr[0] != '\t' {
+				issues = append(issues, constraintIssue{n, "malformed //go:build line"})
+				continue
+			}
+			if goBuild != nil {
+				issues = append(issues, constraintIssue{n, "multiple //go:build lines"})
+				continue
+			}
+			e, t, err := parseGoBuild(expr)
+			if err != nil {
+				issues = append(issues, constraintIssue{n, "invalid //go:build line: " + err.Error()})
+				continue
+			}
+			goBuild = e
+			tags = append(tags, t...)
+		case "// go:build":
+			issues = append(issues, constraintIssue{n, "malformed //go:build line, remove the space after //"})
+			continue
+		default:
+			e, t, err := parsePlusBuild(strings.TrimSpace(text))
+			if err != nil {
+				issues = append(issues, constraintIssue{n, "invalid // +build line: " + err.Error()})
+				continue
+			}
+			plusBuild = append(plusBuild, e)
+			tags = append(tags, t...)
+		}
+		block = append(block, n)
+	}
+
+	var plus buildExpr
+	if len(plusBuild) != 0 {
+		plus = func(tag func(string) bool) bool {
+			for _, e := range plusBuild {
+				if !e(tag) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return &fileConstraints{goBuild, plus, tags, first, issues}
+}
+
+// checkConstraints returns the issues found in the build constraints of a Go
+// source file.
+func checkConstraints(name string, content []byte) []constraintIssue {
+	c := parseConstraints(content)
+	issues := c.issues
+	effective := c.effective()
+	if effective == nil {
+		return issues
+	}
+	goBuild, plus := c.goBuild, c.plus
+	fileOS, fileArch := fileNameTarget(name)
+	satisfiable := false
+	disagree := false
+	checked := forEachTarget(c.tags, func(tag func(string) bool) bool {
+		if (fileOS == "" || tag(fileOS)) && (fileArch == "" || tag(fileArch)) && effective(tag) {
+			satisfiable = true
+		}
+		if goBuild != nil && plus != nil && goBuild(tag) != plus(tag) {
+			disagree = true
+		}
+		return !satisfiable || (goBuild != nil && plus != nil && !disagree)
+	})
+	if checked && !satisfiable {
+		issues = append(issues, constraintIssue{c.line, "build constraints never match any target"})
+	}
+	if disagree {
+		issues = append(issues, constraintIssue{c.line, "//go:build and // +build lines disagree"})
+	}
+	return issues
+}
+
+// checkTagConsistency returns the issues found in the build constraints of a
+// Go source file whose name implies a GOOS or a GOARCH, e.g. "foo_linux.go".
+// The syntax errors are left to checkConstraints.
+func checkTagConsistency(name string, content []byte) []constraintIssue {
+	fileOS, fileArch := fileNameTarget(name)
+	if fileOS == "" && fileArch == "" {
+		return nil
+	}
+	c := parseConstraints(content)
+	effective := c.effective()
+	if effective == nil || len(c.issues) != 0 {
+		return nil
+	}
+	suffix := strings.Trim(fileOS+"_"+fileArch, "_")
+	// The file name matches the target.
+	implied := func(tag func(string) bool) bool {
+		return (fileOS == "" || tag(fileOS)) && (fileArch == "" || tag(fileArch))
+	}
+	satisfiable, redundant := false, true
+	checked := forEachTarget(c.tags, func(tag func(string) bool) bool {
+		if implied(tag) {
+			if effective(tag) {
+				satisfiable = true
+			} else {
+				redundant = false
+			}
+		}
+		return !satisfiable || redundant
+	})
+	if !checked {
+		return nil
+	}
+	if !satisfiable {
+		return []constraintIssue{{c.line, fmt.Sprintf("build constraints exclude %s, implied by the _%s file name suffix", strings.Replace(suffix, "_", "/", -1), suffix)}}
+	}
+	if redundant {
+		return []constraintIssue{{c.line, fmt.Sprintf("build constraints are redundant with the _%s file name suffix", suffix)}}
+	}
+	var issues []constraintIssue
+	var seen []string
+	for _, t := range c.tags {
+		if contains(seen, t) {
+			continue
+		}
+		seen = append(seen, t)
+		if (fileOS != "" && (contains(knownOS, t) || t == "unix") && !osOverlap(fileOS, t)) || (fileArch != "" && contains(knownArch, t) && t != fileArch) {
+			issues = append(issues, constraintIssue{c.line, fmt.Sprintf("build constraints mention %s but the _%s file name suffix already restricts the file to %s", t, suffix, strings.Replace(suffix, "_", "/", -1))})
+		}
+	}
+	return issues
+}
+
+// parsePlusBuild parses a "+build" line. The options separated by spaces are
+// OR'ed, the terms separated by commas are AND'ed.
+func parsePlusBuild(line string) (buildExpr, []string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "+build" {
+		return nil, nil, fmt.Errorf("expected \"+build\", got %q", strings.SplitN(line, " ", 2)[0])
+	}
+	if len(fields) == 1 {
+		return nil, nil, errors.New("no tag")
+	}
+	var options [][]string
+	var tags []string
+	for _, option := range fields[1:] {
+		terms := strings.Split(option, ",")
+		for _, term := range terms {
+			tag := strings.TrimPrefix(term, "!")
+			if !isBuildTag(tag) {
+				return nil, nil, fmt.Errorf("invalid tag %q", term)
+			}
+			tags = append(tags, tag)
+		}
+		options = append(options, terms)
+	}
+	return func(tag func(string) bool) bool {
+		for _, terms := range options {
+			ok := true
+			for _, term := range terms {
+				if strings.HasPrefix(term, "!") == tag(strings.TrimPrefix(term, "!")) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}, tags, nil
+}
+
+// parseGoBuild parses the expression of a "//go:build" line.
+func parseGoBuild(s string) (buildExpr, []string, error) {
+	p := &exprParser{s: s}
+	p.next()
+	e := p.or()
+	if p.err == nil && p.tok != "" {
+		p.err = fmt.Errorf("unexpected %q", p.tok)
+	}
+	if p.err != nil {
+		return nil, nil, p.err
+	}
+	return e, p.tags, nil
+}
+
+// exprParser is a recursive descent parser for "//go:build" expressions.
+type exprParser struct {
+	s    string
+	tok  string
+	tags []string
+	err  error
+}
+
+// next reads the next token in p.tok. It is "" at the end.
+func (p *exprParser) next() {
+	p.s = strings.TrimLeft(p.s, " \t")
+	p.tok = ""
+	if p.s == "" {
+		return
+	}
+	if strings.HasPrefix(p.s, "&&") || strings.HasPrefix(p.s, "||") {
+		p.tok, p.s = p.s[:2], p.s[2:]
+		return
+	}
+	if c := p.s[0]; c == '(' || c == ')' || c == '!' {
+		p.tok, p.s = p.s[:1], p.s[1:]
+		return
+	}
+	i := 0
+	for i < len(p.s) && isBuildTagChar(p.s[i]) {
+		i++
+	}
+	if i == 0 {
+		if p.err == nil {
+			p.err = fmt.Errorf("unexpected %q", p.s[:1])
+		}
+		p.s = ""
+		return
+	}
+	p.tok, p.s = p.s[:i], p.s[i:]
+}
+
+func (p *exprParser) or() buildExpr {
+	x := p.and()
+	for p.tok == "||" {
+		p.next()
+		x = orExpr(x, p.and())
+	}
+	return x
+}
+
+func (p *exprParser) and() buildExpr {
+	x := p.not()
+	for p.tok == "&&" {
+		p.next()
+		x = andExpr(x, p.not())
+	}
+	return x
+}
+
+func (p *exprParser) not() buildExpr {
+	if p.tok == "!" {
+		p.next()
+		x := p.not()
+		return func(tag func(string) bool) bool { return !x(tag) }
+	}
+	return p.atom()
+}
+
+func (p *exprParser) atom() buildExpr {
+	never := func(tag func(string) bool) bool { return false }
+	switch {
+	case p.tok == "(":
+		p.next()
+		x := p.or()
+		if p.tok != ")" {
+			if p.err == nil {
+				p.err = errors.New("missing )")
+			}
+			return never
+		}
+		p.next()
+		return x
+	case p.tok != "" && isBuildTagChar(p.tok[0]):
+		t := p.tok
+		p.tags = append(p.tags, t)
+		p.next()
+		return func(tag func(string) bool) bool { return tag(t) }
+	default:
+		if p.err == nil {
+			if p.tok == "" {
+				p.err = errors.New("unexpected end of expression")
+			} else {
+				p.err = fmt.Errorf("unexpected %q", p.tok)
+			}
+		}
+		return never
+	}
+}
+
+func orExpr(x, y buildExpr) buildExpr {
+	return func(tag func(string) bool) bool { return x(tag) || y(tag) }
+}
+
+func andExpr(x, y buildExpr) buildExpr {
+	return func(tag func(string) bool) bool { return x(tag) && y(tag) }
+}
+
+func isBuildTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isBuildTagChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBuildTagChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// knownOS is the list of GOOS values recognized by go/build.
+var knownOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios",
+	"js", "linux", "nacl", "netbsd", "openbsd", "plan9", "solaris", "wasip1",
+	"windows", "zos",
+}
+
+// knownArch is the list of GOARCH values recognized by go/build.
+var knownArch = []string{
+	"386", "amd64", "amd64p32", "arm", "armbe", "arm64", "arm64be", "loong64",
+	"mips", "mipsle", "mips64", "mips64le", "mips64p32", "mips64p32le", "ppc",
+	"ppc64", "ppc64le", "riscv", "riscv64", "s390", "s390x", "sparc", "sparc64",
+	"wasm",
+}
+
+// unixOS is the list of GOOS values matched by tag "unix".
+var unixOS = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios",
+	"linux", "netbsd", "openbsd", "solaris",
+}
+
+// maxFreeTags is the maximum number of tags that are not a GOOS or a GOARCH
+// for which all the combinations are evaluated.
+const maxFreeTags = 10
+
+// forEachTarget calls f with the tag matcher of each combination of known
+// GOOS, known GOARCH and values of the other tags, until f returns false.
+//
+// Returns false if there are too many tags to evaluate all the combinations.
+func forEachTarget(tags []string, f func(tag func(string) bool) bool) bool {
+	var free []string
+	for _, t := range tags {
+		if t != "unix" && !contains(knownOS, t) && !contains(knownArch, t) && !contains(free, t) {
+			free = append(free, t)
+		}
+	}
+	if len(free) > maxFreeTags {
+		return false
+	}
+	for _, goos := range knownOS {
+		for _, goarch := range knownArch {
+			for mask := 0; mask < 1<<uint(len(free)); mask++ {
+				tag := func(t string) bool {
+					if t == "unix" {
+						return contains(unixOS, goos)
+					}
+					if contains(knownOS, t) {
+						return matchOS(goos, t)
+					}
+					if contains(knownArch, t) {
+						return t == goarch
+					}
+					for i, f := range free {
+						if f == t {
+							return mask&(1<<uint(i)) != 0
+						}
+					}
+					return false
+				}
+				if !f(tag) {
+					return true
+				}
+			}
+		}
+	}
+	return true
+}
+
+// matchOS returns true if tag t is satisfied when building for goos.
+func matchOS(goos, t string) bool {
+	switch {
+	case t == goos:
+		return true
+	case goos == "android":
+		return t == "linux"
+	case goos == "illumos":
+		return t == "solaris"
+	case goos == "ios":
+		return t == "darwin"
+	}
+	return false
+}
+
+// osOverlap returns true if a GOOS satisfies both the file name GOOS fileOS
+// and the tag t, a GOOS or "unix". For example "linux" and "android" overlap.
+func osOverlap(fileOS, t string) bool {
+	for _, goos := range knownOS {
+		if matchOS(goos, fileOS) && (matchOS(goos, t) || (t == "unix" && contains(unixOS, goos))) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileNameTarget returns the GOOS and GOARCH implied by a file name, e.g.
+// "foo_linux_arm64_test.go", like go/build does.
+func fileNameTarget(name string) (string, string) {
+	name = filepath.Base(name)
+	if i := strings.Index(name, "."); i != -1 {
+		name = name[:i]
+	}
+	i := strings.Index(name, "_")
+	if i == -1 {
+		return "", ""
+	}
+	l := strings.Split(name[i:], "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	if n >= 2 && contains(knownOS, l[n-2]) && contains(knownArch, l[n-1]) {
+		return l[n-2], l[n-1]
+	}
+	if n >= 1 && contains(knownOS, l[n-1]) {
+		return l[n-1], ""
+	}
+	if n >= 1 && contains(knownArch, l[n-1]) {
+		return "", l[n-1]
+	}
+	return "", ""
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestParseGoBuild(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		expr     string
+		tags     []string
+		expected bool
+	}{
+		{"linux", []string{"linux"}, true},
+		{"linux", nil, false},
+		{"!linux", nil, true},
+		{"linux && amd64", []string{"linux"}, false},
+		{"linux && amd64", []string{"linux", "amd64"}, true},
+		{"linux || darwin && cgo", []string{"linux"}, true},
+		{"(linux || darwin) && cgo", []string{"linux"}, false},
+		{"!(linux || darwin)", []string{"windows"}, true},
+		{"go1.7 && !ignore", []string{"go1.7"}, true},
+	}
+	for i, line := range data {
+		e, _, err := parseGoBuild(line.expr)
+		ut.AssertEqualIndex(t, i, nil, err)
+		ut.AssertEqualIndex(t, i, line.expected, e(func(tag string) bool { return contains(line.tags, tag) }))
+	}
+}
+
+func TestParseGoBuildErrors(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		expr     string
+		expected error
+	}{
+		{"", errors.New("unexpected end of expression")},
+		{"linux &&", errors.New("unexpected end of expression")},
+		{"(linux", errors.New("missing )")},
+		{"linux)", errors.New("unexpected \")\"")},
+		{"linux, darwin", errors.New("unexpected \",\"")},
+	}
+	for i, line := range data {
+		_, _, err := parseGoBuild(line.expr)
+		ut.AssertEqualIndex(t, i, line.expected, err)
+	}
+}
+
+func TestParsePlusBuild(t *testing.T) {
+	t.Parallel()
+	e, tags, err := parsePlusBuild("+build linux,!cgo darwin")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"linux", "cgo", "darwin"}, tags)
+	ut.AssertEqual(t, true, e(func(tag string) bool { return tag == "linux" }))
+	ut.AssertEqual(t, false, e(func(tag string) bool { return tag == "linux" || tag == "cgo" }))
+	ut.AssertEqual(t, true, e(func(tag string) bool { return tag == "darwin" || tag == "cgo" }))
+
+	_, _, err = parsePlusBuild("+build")
+	ut.AssertEqual(t, errors.New("no tag"), err)
+	_, _, err = parsePlusBuild("+build linux,")
+	ut.AssertEqual(t, errors.New("invalid tag \"\""), err)
+}
+
+func TestFileNameTarget(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		name   string
+		goos   string
+		goarch string
+	}{
+		{"foo.go", "", ""},
+		{"linux.go", "", ""},
+		{"foo_linux.go", "linux", ""},
+		{"foo_linux_test.go", "linux", ""},
+		{"dir/foo_linux_arm64.go", "linux", "arm64"},
+		{"foo_amd64_test.go", "", "amd64"},
+		{"foo_bar.go", "", ""},
+	}
+	for i, line := range data {
+		goos, goarch := fileNameTarget(line.name)
+		ut.AssertEqualIndex(t, i, line.goos, goos)
+		ut.AssertEqualIndex(t, i, line.goarch, goarch)
+	}
+}
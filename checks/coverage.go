@@ -11,11 +11,13 @@ package checks
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -30,19 +32,114 @@ import (
 
 // Coverage runs all tests with coverage.
 type Coverage struct {
-	UseGlobalInference bool                         `yaml:"use_global_inference"`
-	UseCoveralls       bool                         `yaml:"use_coveralls"`
-	Global             CoverageSettings             `yaml:"global"`
-	PerDirDefault      CoverageSettings             `yaml:"per_dir_default"`
-	PerDir             map[string]*CoverageSettings `yaml:"per_dir"`
+	// UseGlobalInference runs all the test packages and merges their coverage,
+	// so a package may be covered by the tests of another package. Otherwise
+	// only the package's own tests are used.
+	UseGlobalInference bool `yaml:"use_global_inference"`
+	// InferenceScope selects the tests whose coverage is credited to a
+	// package. When empty, it is InferenceGlobal if UseGlobalInference is true
+	// and InferencePackage otherwise.
+	InferenceScope InferenceScope `yaml:"inference_scope,omitempty"`
+	// IntegrationPackages are the directories of test packages, in POSIX format
+	// relative to the repository root, that are also run in the package and
+	// module scopes so their coverage is credited to the modified packages.
+	IntegrationPackages []string `yaml:"integration_packages,omitempty"`
+	// UseCoveralls sends the coverage data to https://coveralls.io when run on
+	// a CI.
+	UseCoveralls bool `yaml:"use_coveralls"`
+	// CoverallsTokenFile is the file containing the coveralls.io repository
+	// token, relative to the repository root. The token is passed to goveralls
+	// as $COVERALLS_TOKEN. When empty, goveralls finds the token in the
+	// environment as usual.
+	CoverallsTokenFile string `yaml:"coveralls_token_file,omitempty"`
+	// Global is the coverage the whole code must have, used with
+	// InferenceGlobal.
+	Global CoverageSettings `yaml:"global"`
+	// PerDirDefault is the coverage each package must have, unless overridden
+	// in PerDir.
+	PerDirDefault CoverageSettings `yaml:"per_dir_default"`
+	// PerDir overrides PerDirDefault for some directories, in POSIX format
+	// relative to the repository root. A nil value disables the coverage check
+	// for the directory.
+	PerDir map[string]*CoverageSettings `yaml:"per_dir"`
+	// QuietOnSuccess doesn't log the coverage summary of the packages that
+	// pass, nor the slow ones, to keep the verbose logs focused on the
+	// failures.
+	QuietOnSuccess bool `yaml:"quiet_on_success"`
+	// BaselineFile is the file storing the coverage of each package, relative
+	// to the repository root. When set, the check fails if the coverage of a
+	// package decreased by more than MaxDecreasePercent versus this baseline.
+	// 'pcg update-coverage' refreshes it.
+	BaselineFile string `yaml:"baseline_file,omitempty"`
+	// BaselineRef is the git notes ref, e.g. "refs/notes/coverage", storing the
+	// coverage of each package instead of BaselineFile, so the baseline is
+	// versioned with the commits without being in the tree. The note of the
+	// most recent commit having one is used. BaselineFile is used when the git
+	// notes can't be read. 'pcg update-coverage' stores it on HEAD.
+	BaselineRef string `yaml:"baseline_ref,omitempty"`
+	// MaxDecreasePercent is the coverage decrease in percentage points
+	// tolerated versus the baseline.
+	MaxDecreasePercent float64 `yaml:"max_decrease_percent,omitempty"`
+	// InferenceGainThreshold, when set with InferenceGlobal, also runs the
+	// tests with each package only instrumented for itself, to report the time
+	// and the coverage global inference adds. It suggests InferencePackage
+	// when the coverage gained is below this threshold, in percentage points.
+	// It roughly doubles the duration of the check, so it is meant to be
+	// enabled once to make a decision.
+	InferenceGainThreshold float64 `yaml:"inference_gain_threshold,omitempty"`
+	Trigger                `yaml:",inline"`
 }
 
 // CoverageSettings specifies coverage settings.
 type CoverageSettings struct {
+	// MinCoverage is the minimum coverage in percent.
 	MinCoverage float64 `yaml:"min_coverage"`
+	// MaxCoverage is the maximum coverage in percent, to detect when the
+	// coverage increased enough that the values should be updated, which
+	// 'pcg update-coverage' does. If 0, it is not enforced.
 	MaxCoverage float64 `yaml:"max_coverage"`
 }
 
+// InferenceScope is the set of tests whose coverage is credited to a package.
+type InferenceScope string
+
+const (
+	// InferencePackage only credits a package with its own tests. It is the
+	// fastest scope.
+	InferencePackage InferenceScope = "package"
+	// InferenceModule credits each modified package with the tests of all the
+	// modified packages of the module. Only the modified packages' tests are
+	// run but each of them is instrumented for all these packages, which is
+	// slower than InferencePackage.
+	InferenceModule InferenceScope = "module"
+	// InferenceGlobal runs all the tests of the repository, each instrumented
+	// for every package, and checks the merged coverage against
+	// Coverage.Global. It is the slowest and most memory hungry scope.
+	InferenceGlobal InferenceScope = "global"
+)
+
+// AllInferenceScopes is all the known inference scopes, from the narrowest.
+var AllInferenceScopes = []InferenceScope{InferencePackage, InferenceModule, InferenceGlobal}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (i *InferenceScope) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	str := ""
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	if str == "" {
+		*i = ""
+		return nil
+	}
+	for _, known := range AllInferenceScopes {
+		if InferenceScope(str) == known {
+			*i = known
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid inference scope \"%s\"", str)
+}
+
 // GetDescription implements Check.
 func (c *Coverage) GetDescription() string {
 	return "enforces minimum test coverage on all packages"
@@ -56,21 +153,31 @@ func (c *Coverage) GetName() string {
 // GetPrerequisites implements Check.
 func (c *Coverage) GetPrerequisites() []CheckPrerequisite {
 	if c.isGoverallsEnabled() {
-		return []CheckPrerequisite{{[]string{"goveralls", "-h"}, 2, "github.com/mattn/goveralls"}}
+		return []CheckPrerequisite{{HelpCommand: []string{"goveralls", "-h"}, ExpectedExitCode: 2, URL: "github.com/mattn/goveralls"}}
 	}
 	return nil
 }
 
 // Run implements Check.
 func (c *Coverage) Run(change scm.Change, options *Options) error {
+	start := time.Now()
 	profile, err := c.RunProfile(change, options)
 	if err != nil {
 		return err
 	}
 
-	if c.UseGlobalInference {
+	if c.Scope() == InferenceGlobal {
+		if c.InferenceGainThreshold > 0 && profile != nil {
+			duration := time.Since(start)
+			start = time.Now()
+			local, err := c.RunPerPackage(change, options)
+			if err != nil {
+				return err
+			}
+			options.Notice("coverage: %s", inferenceGain(profile, local, duration, time.Since(start), c.InferenceGainThreshold))
+		}
 		out, err := ProcessProfile(profile, &c.Global)
-		if out != "" {
+		if out != "" && (err != nil || !c.QuietOnSuccess) {
 			log.Printf("coverage for %s:\n%s\n", change.Repo().Root(), out)
 		}
 		if err != nil {
@@ -84,7 +191,7 @@ func (c *Coverage) Run(change scm.Change, options *Options) error {
 				continue
 			}
 			out, err := ProcessProfile(p, settings)
-			if out != "" {
+			if out != "" && (err != nil || !c.QuietOnSuccess) {
 				log.Printf("%s:\n%s\n", testPkg, out)
 			}
 			if err != nil {
@@ -92,14 +199,80 @@ func (c *Coverage) Run(change scm.Change, options *Options) error {
 			}
 		}
 	}
+	old, source, err := c.loadBaseline(change.Repo())
+	if old == nil || err != nil {
+		return err
+	}
+	if r := regressions(old, c.baseline(change, profile), c.MaxDecreasePercent); len(r) != 0 {
+		return fmt.Errorf("coverage decreased by more than %g%% versus %s:\n  %s", c.MaxDecreasePercent, source, strings.Join(r, "\n  "))
+	}
 	return nil
 }
 
+// loadBaseline returns the baseline from the git note under BaselineRef,
+// falling back to BaselineFile, and where it was read from. Returns nil if
+// there's no baseline.
+func (c *Coverage) loadBaseline(repo scm.ReadOnlyRepo) (CoverageBaseline, string, error) {
+	if c.BaselineRef != "" {
+		note, commit, err := repo.Note(c.BaselineRef)
+		if err == nil {
+			if commit == scm.Invalid {
+				log.Printf("coverage: no note in %s; run 'pcg update-coverage'", c.BaselineRef)
+				return nil, "", nil
+			}
+			source := fmt.Sprintf("the note of %s in %s", commit, c.BaselineRef)
+			out, err := ParseCoverageBaseline(source, []byte(note))
+			return out, source, err
+		}
+		if c.BaselineFile == "" {
+			return nil, "", err
+		}
+		log.Printf("coverage: %s; using %s", err, c.BaselineFile)
+	}
+	if c.BaselineFile == "" {
+		return nil, "", nil
+	}
+	out, err := LoadCoverageBaseline(filepath.Join(repo.Root(), c.BaselineFile))
+	if os.IsNotExist(err) {
+		log.Printf("coverage: %s doesn't exist; run 'pcg update-coverage'", c.BaselineFile)
+		return nil, "", nil
+	}
+	return out, c.BaselineFile, err
+}
+
+// ExceededBands runs the tests with coverage and returns the coverage bands
+// whose MaxCoverage is exceeded, with the band ratcheted up to the achieved
+// coverage, and the coverage of each package to refresh BaselineFile.
+func (c *Coverage) ExceededBands(change scm.Change, options *Options) ([]CoverageBand, CoverageBaseline, error) {
+	profile, err := c.RunProfile(change, options)
+	if err != nil || profile == nil {
+		return nil, nil, err
+	}
+	var out []CoverageBand
+	if c.Scope() == InferenceGlobal {
+		if percent := profile.CoveragePercent(); exceeds(&c.Global, percent) {
+			out = append(out, CoverageBand{"", percent, c.Global, ratchet(c.Global, percent)})
+		}
+		return out, c.baseline(change, profile), nil
+	}
+	for _, testPkg := range change.Indirect().TestPackages() {
+		p := profile.Subset(pkgToDir(testPkg))
+		settings := c.SettingsForPkg(testPkg)
+		if settings.MinCoverage == 0 || p.TotalLines() == 0 {
+			continue
+		}
+		if percent := p.CoveragePercent(); exceeds(settings, percent) {
+			out = append(out, CoverageBand{pkgToDir(testPkg), percent, *settings, ratchet(*settings, percent)})
+		}
+	}
+	return out, c.baseline(change, profile), nil
+}
+
 // RunProfile runs a coverage run according to the settings and return results.
 func (c *Coverage) RunProfile(change scm.Change, options *Options) (profile CoverageProfile, err error) {
 	// go test accepts packages, not files.
 	var testPkgs []string
-	if c.UseGlobalInference {
+	if c.Scope() == InferenceGlobal {
 		testPkgs = change.All().TestPackages()
 	} else {
 		testPkgs = change.Indirect().TestPackages()
@@ -120,9 +293,12 @@ func (c *Coverage) RunProfile(change scm.Change, options *Options) (profile Cove
 		}
 	}()
 
-	if c.UseGlobalInference {
+	switch c.Scope() {
+	case InferenceGlobal:
 		profile, err = c.RunGlobal(change, options, tmpDir)
-	} else {
+	case InferenceModule:
+		profile, err = c.RunModule(change, options, tmpDir)
+	default:
 		profile, err = c.RunLocal(change, options, tmpDir)
 	}
 	if err != nil {
@@ -132,7 +308,13 @@ func (c *Coverage) RunProfile(change scm.Change, options *Options) (profile Cove
 	if c.isGoverallsEnabled() {
 		// Please send a pull request if the following doesn't work for you on your
 		// favorite CI system.
-		out, _, _, err2 := options.Capture(change.Repo(), "goveralls", "-coverprofile", filepath.Join(tmpDir, "profile.cov"))
+		env, err2 := c.coverallsEnv(change.Repo().Root())
+		if err2 != nil {
+			// Don't fail the build.
+			fmt.Printf("goveralls: %s\n", err2)
+			return profile, nil
+		}
+		out, _, _, err2 := options.CaptureEnv(change.Repo(), env, "goveralls", "-coverprofile", filepath.Join(tmpDir, "profile.cov"))
 		// Don't fail the build.
 		if err2 != nil {
 			fmt.Printf("%s", out)
@@ -146,117 +328,195 @@ func (c *Coverage) RunProfile(change scm.Change, options *Options) (profile Cove
 // This means that test can contribute coverage in any other package, even
 // outside their own package.
 func (c *Coverage) RunGlobal(change scm.Change, options *Options, tmpDir string) (CoverageProfile, error) {
-	coverPkg := ""
-	for i, p := range change.All().Packages() {
-		if s := c.SettingsForPkg(p); s.MinCoverage != 0 {
-			if i != 0 {
-				coverPkg += ","
-			}
-			coverPkg += p
+	coverPkg := c.coverPkg(change.All().Packages())
+	var runs []coverRun
+	for _, tp := range change.All().TestPackages() {
+		runs = append(runs, coverRun{tp, coverPkg})
+	}
+	return c.runCoverage(change, options, tmpDir, runs)
+}
+
+// RunPerPackage runs all the test packages under coverage, each only
+// instrumented for its own package, to compare with RunGlobal.
+func (c *Coverage) RunPerPackage(change scm.Change, options *Options) (profile CoverageProfile, err error) {
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := internal.RemoveAll(tmpDir)
+		if err == nil {
+			err = err2
+		}
+	}()
+	var runs []coverRun
+	for _, tp := range change.All().TestPackages() {
+		if c.SettingsForPkg(tp).MinCoverage != 0 {
+			runs = append(runs, coverRun{tp, ""})
 		}
 	}
+	return c.runCoverage(change, options, tmpDir, runs)
+}
 
-	// This part is similar to Test.Run() except that it passes a unique
-	// -coverprofile file name, so that all the files can later be merged into a
-	// single file.
-	testPkgs := change.All().TestPackages()
-	type result struct {
-		file string
-		err  error
+// RunModule runs the tests of the modified packages and the integration
+// packages under coverage, each instrumented for all the modified packages.
+//
+// This means that the tests of a modified package contribute coverage in the
+// other modified packages, without running the whole repository's tests.
+func (c *Coverage) RunModule(change scm.Change, options *Options, tmpDir string) (CoverageProfile, error) {
+	coverPkg := c.coverPkg(change.Indirect().Packages())
+	if coverPkg == "" {
+		return c.runCoverage(change, options, tmpDir, nil)
 	}
-	results := make(chan *result)
-	for index, tp := range testPkgs {
-		f := filepath.Join(tmpDir, fmt.Sprintf("test%d.cov", index))
-		go func(f string, testPkg string) {
-			// Maybe fallback to 'pkg + "/..."' and post process to remove
-			// uninteresting directories. The rationale is that it will eventually
-			// blow up the OS specific command argument length.
-			args := []string{
-				"go", "test", "-v", "-covermode=count", "-coverpkg", coverPkg,
-				"-coverprofile", f,
-				"-timeout", fmt.Sprintf("%ds", options.MaxDuration),
-				testPkg,
-			}
-			out, exitCode, duration, err := options.Capture(change.Repo(), args...)
-			if duration > time.Second {
-				log.Printf("%s was slow: %s", args, round(duration, time.Millisecond))
-			}
-			if exitCode != 0 {
-				err = fmt.Errorf("%s %s failed:\n%s", strings.Join(args, " "), testPkg, processStackTrace(out))
-			}
-			results <- &result{f, err}
-		}(f, tp)
+	var runs []coverRun
+	for _, tp := range change.Indirect().TestPackages() {
+		runs = append(runs, coverRun{tp, coverPkg})
 	}
+	return c.runCoverage(change, options, tmpDir, c.integrationRuns(runs, coverPkg))
+}
 
-	// Sends to coveralls.io if applicable. Do not write to disk unless needed.
-	var f readWriteSeekCloser
-	var err error
-	if c.isGoverallsEnabled() {
-		if f, err = os.Create(filepath.Join(tmpDir, "profile.cov")); err != nil {
-			return nil, err
+// RunLocal runs all tests and reports the merged coverage of each individual
+// covered package.
+//
+// The integration packages' tests are also run, instrumented for all the
+// modified packages.
+func (c *Coverage) RunLocal(change scm.Change, options *Options, tmpDir string) (CoverageProfile, error) {
+	var runs []coverRun
+	for _, tp := range change.Indirect().TestPackages() {
+		// Skip coverage if disabled for this directory.
+		if c.SettingsForPkg(tp).MinCoverage != 0 {
+			runs = append(runs, coverRun{tp, ""})
 		}
-	} else {
-		f = &buffer{}
 	}
+	if coverPkg := c.coverPkg(change.Indirect().Packages()); coverPkg != "" {
+		runs = c.integrationRuns(runs, coverPkg)
+	}
+	return c.runCoverage(change, options, tmpDir, runs)
+}
 
-	// Aggregate all results.
-	counts := map[string]int{}
-	for i := 0; i < len(testPkgs); i++ {
-		result := <-results
-		if err != nil {
-			continue
-		}
-		if result.err != nil {
-			err = result.err
-			continue
-		}
-		if err2 := loadRawCoverage(result.file, counts); err == nil {
-			// Wait for all tests to complete before returning.
-			err = err2
+// Scope returns the effective inference scope.
+func (c *Coverage) Scope() InferenceScope {
+	if c.InferenceScope != "" {
+		return c.InferenceScope
+	}
+	if c.UseGlobalInference {
+		return InferenceGlobal
+	}
+	return InferencePackage
+}
+
+// SettingsForPkg returns the settings for a particular package.
+//
+// If the PerDir value is set to a null pointer, returns empty coverage.
+// Otherwise returns PerDirDefault.
+func (c *Coverage) SettingsForPkg(testPkg string) *CoverageSettings {
+	testDir := pkgToDir(testPkg)
+	if settings, ok := c.PerDir[testDir]; ok {
+		if settings == nil {
+			settings = &CoverageSettings{}
 		}
+		return settings
 	}
+	return &c.PerDirDefault
+}
+
+func (c *Coverage) isGoverallsEnabled() bool {
+	return c.UseCoveralls && IsContinuousIntegration()
+}
+
+// coverallsEnv returns the environment variables to pass to goveralls.
+func (c *Coverage) coverallsEnv(root string) ([]string, error) {
+	if c.CoverallsTokenFile == "" {
+		return nil, nil
+	}
+	p := c.CoverallsTokenFile
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, filepath.FromSlash(p))
+	}
+	b, err := ioutil.ReadFile(p)
 	if err != nil {
-		f.Close()
-		return nil, err
+		return nil, fmt.Errorf("failed to read the coveralls token: %s", err)
 	}
-	return loadMergeAndClose(f, counts, change)
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("coveralls token file %s is empty", c.CoverallsTokenFile)
+	}
+	return []string{"COVERALLS_TOKEN=" + token}, nil
 }
 
-// RunLocal runs all tests and reports the merged coverage of each individual
-// covered package.
-func (c *Coverage) RunLocal(change scm.Change, options *Options, tmpDir string) (CoverageProfile, error) {
-	testPkgs := change.Indirect().TestPackages()
+// coverPkg returns the -coverpkg value for the packages pkgs whose coverage
+// check is enabled.
+func (c *Coverage) coverPkg(pkgs []string) string {
+	var out []string
+	for _, p := range pkgs {
+		if s := c.SettingsForPkg(p); s.MinCoverage != 0 {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// integrationRuns appends to runs the integration packages not already in it,
+// instrumented for coverPkg.
+func (c *Coverage) integrationRuns(runs []coverRun, coverPkg string) []coverRun {
+	for _, d := range c.IntegrationPackages {
+		tp := dirToPkg(d)
+		found := false
+		for i := range runs {
+			if runs[i].testPkg == tp {
+				runs[i].coverPkg = coverPkg
+				found = true
+				break
+			}
+		}
+		if !found {
+			runs = append(runs, coverRun{tp, coverPkg})
+		}
+	}
+	return runs
+}
+
+// coverRun is a test package to run under coverage.
+type coverRun struct {
+	testPkg string
+	// coverPkg is the value for -coverpkg, or "" to only instrument testPkg.
+	coverPkg string
+}
+
+// runCoverage runs runs concurrently and merges their coverage.
+func (c *Coverage) runCoverage(change scm.Change, options *Options, tmpDir string, runs []coverRun) (CoverageProfile, error) {
+	// This part is similar to Test.Run() except that it passes a unique
+	// -coverprofile file name, so that all the files can later be merged into a
+	// single file.
 	type result struct {
 		file string
 		err  error
 	}
 	results := make(chan *result)
-	for i, tp := range testPkgs {
-		go func(index int, testPkg string) {
-			settings := c.SettingsForPkg(testPkg)
-			// Skip coverage if disabled for this directory.
-			if settings.MinCoverage == 0 {
-				results <- nil
-				return
+	for index, r := range runs {
+		f := filepath.Join(tmpDir, fmt.Sprintf("test%d.cov", index))
+		go func(f string, r coverRun) {
+			// Maybe fallback to 'pkg + "/..."' and post process to remove
+			// uninteresting directories. The rationale is that it will eventually
+			// blow up the OS specific command argument length.
+			args := []string{"go", "test", "-v", "-covermode=count"}
+			if r.coverPkg != "" {
+				args = append(args, "-coverpkg", r.coverPkg)
 			}
-
-			p := filepath.Join(tmpDir, fmt.Sprintf("test%d.cov", index))
-			args := []string{
-				"go", "test", "-v", "-covermode=count",
-				"-coverprofile", p,
+			args = append(args,
+				"-coverprofile", f,
 				"-timeout", fmt.Sprintf("%ds", options.MaxDuration),
-				testPkg,
-			}
-			out, exitCode, duration, _ := options.Capture(change.Repo(), args...)
-			if duration > time.Second {
+				r.testPkg,
+			)
+			out, exitCode, duration, err := options.Capture(change.Repo(), args...)
+			if duration > time.Second && (exitCode != 0 || !c.QuietOnSuccess) {
 				log.Printf("%s was slow: %s", args, round(duration, time.Millisecond))
 			}
 			if exitCode != 0 {
-				results <- &result{err: fmt.Errorf("%s %s failed:\n%s", strings.Join(args, " "), testPkg, processStackTrace(out))}
-				return
+				err = fmt.Errorf("%s %s failed:\n%s", strings.Join(args, " "), r.testPkg, processStackTrace(out))
 			}
-			results <- &result{file: p}
-		}(i, tp)
+			results <- &result{f, err}
+		}(f, r)
 	}
 
 	// Sends to coveralls.io if applicable. Do not write to disk unless needed.
@@ -272,14 +532,11 @@ func (c *Coverage) RunLocal(change scm.Change, options *Options, tmpDir string)
 
 	// Aggregate all results.
 	counts := map[string]int{}
-	for i := 0; i < len(testPkgs); i++ {
+	for i := 0; i < len(runs); i++ {
 		result := <-results
 		if err != nil {
 			continue
 		}
-		if result == nil {
-			continue
-		}
 		if result.err != nil {
 			err = result.err
 			continue
@@ -296,25 +553,6 @@ func (c *Coverage) RunLocal(change scm.Change, options *Options, tmpDir string)
 	return loadMergeAndClose(f, counts, change)
 }
 
-// SettingsForPkg returns the settings for a particular package.
-//
-// If the PerDir value is set to a null pointer, returns empty coverage.
-// Otherwise returns PerDirDefault.
-func (c *Coverage) SettingsForPkg(testPkg string) *CoverageSettings {
-	testDir := pkgToDir(testPkg)
-	if settings, ok := c.PerDir[testDir]; ok {
-		if settings == nil {
-			settings = &CoverageSettings{}
-		}
-		return settings
-	}
-	return &c.PerDirDefault
-}
-
-func (c *Coverage) isGoverallsEnabled() bool {
-	return c.UseCoveralls && IsContinuousIntegration()
-}
-
 // ProcessProfile generates output that can be optionally printed and an error if the check failed.
 func ProcessProfile(profile CoverageProfile, settings *CoverageSettings) (string, error) {
 	out := ""
@@ -348,6 +586,66 @@ func ProcessProfile(profile CoverageProfile, settings *CoverageSettings) (string
 	return out, nil
 }
 
+// CoverageBand is a coverage band exceeded by the achieved coverage.
+type CoverageBand struct {
+	// Dir is the directory of the package in POSIX format, or "" for
+	// Coverage.Global.
+	Dir string
+	// Percent is the achieved coverage.
+	Percent float64
+	// Old is the band currently configured.
+	Old CoverageSettings
+	// New is the band raised to the achieved coverage, with the same width.
+	New CoverageSettings
+}
+
+// CoverageBaseline is the coverage in percent of each package, per directory
+// in POSIX format. It is stored as JSON in Coverage.BaselineFile or in a git
+// note under Coverage.BaselineRef.
+type CoverageBaseline map[string]float64
+
+// LoadCoverageBaseline loads a CoverageBaseline file.
+func LoadCoverageBaseline(path string) (CoverageBaseline, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCoverageBaseline(path, content)
+}
+
+// ParseCoverageBaseline decodes a CoverageBaseline from content, read from
+// source.
+func ParseCoverageBaseline(source string, content []byte) (CoverageBaseline, error) {
+	out := CoverageBaseline{}
+	if err := json.Unmarshal(content, &out); err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err)
+	}
+	return out, nil
+}
+
+// Marshal returns the CoverageBaseline as JSON, with the values rounded to
+// 0.1%.
+func (c CoverageBaseline) Marshal() ([]byte, error) {
+	rounded := CoverageBaseline{}
+	for dir, percent := range c {
+		rounded[dir] = math.Floor(percent*10) / 10
+	}
+	content, err := json.MarshalIndent(rounded, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+// Save writes the CoverageBaseline file, with the values rounded to 0.1%.
+func (c CoverageBaseline) Save(path string) error {
+	content, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0666)
+}
+
 // CoverageProfile is the processed results of a coverage run.
 type CoverageProfile []*FuncCovered
 
@@ -412,12 +710,12 @@ func (c CoverageProfile) Passes(s *CoverageSettings) (string, bool) {
 	prefix := fmt.Sprintf("%3.1f%% (%d/%d)", percent, c.TotalCoveredLines(), c.TotalLines())
 	suffix := fmt.Sprintf("; Functions: %d untested / %d partially / %d completely", c.NonCoveredFuncs(), c.PartiallyCoveredFuncs(), c.CoveredFuncs())
 	if percent < s.MinCoverage {
-		return fmt.Sprintf("%s < %.1f%% (min)%s", prefix, s.MinCoverage, suffix), false
+		return Message(MsgCoverageBelowMin, prefix, s.MinCoverage, suffix), false
 	}
 	if s.MaxCoverage > 0 && percent > s.MaxCoverage {
-		return fmt.Sprintf("%s > %.1f%% (max)%s", prefix, s.MaxCoverage, suffix), false
+		return Message(MsgCoverageAboveMax, prefix, s.MaxCoverage, suffix), false
 	}
-	return fmt.Sprintf("%s >= %.1f%%%s", prefix, s.MinCoverage, suffix), true
+	return Message(MsgCoveragePassed, prefix, s.MinCoverage, suffix), true
 }
 
 // CoveragePercent returns the coverage in % for this profile.
@@ -493,6 +791,76 @@ type FuncCovered struct {
 
 // Private stuff.
 
+// baseline returns the coverage of each package measured in profile.
+func (c *Coverage) baseline(change scm.Change, profile CoverageProfile) CoverageBaseline {
+	pkgs := change.Indirect().TestPackages()
+	if c.Scope() == InferenceGlobal {
+		pkgs = change.All().Packages()
+	}
+	out := CoverageBaseline{}
+	for _, pkg := range pkgs {
+		if p := profile.Subset(pkgToDir(pkg)); p.TotalLines() != 0 {
+			out[pkgToDir(pkg)] = p.CoveragePercent()
+		}
+	}
+	return out
+}
+
+// regressions returns the packages whose coverage decreased by more than max
+// percentage points from old to current. The packages not in old are
+// ignored.
+func regressions(old, current CoverageBaseline, max float64) []string {
+	var dirs []string
+	for dir := range current {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	var out []string
+	for _, dir := range dirs {
+		before, ok := old[dir]
+		if after := current[dir]; ok && before-after > max {
+			out = append(out, fmt.Sprintf("%s: %.1f%% -> %.1f%% (-%.1f%%)", dirToPkg(dir), before, after, before-after))
+		}
+	}
+	return out
+}
+
+// inferenceGain returns a summary of the time and the coverage that global
+// inference adds versus running each package with its own tests, with a
+// suggestion to disable it when the coverage gained is below threshold.
+func inferenceGain(global, local CoverageProfile, globalDuration, localDuration time.Duration, threshold float64) string {
+	gained := 0.
+	lines := global.TotalCoveredLines() - local.TotalCoveredLines()
+	if total := global.TotalLines(); total != 0 {
+		gained = 100. * float64(lines) / float64(total)
+	}
+	out := fmt.Sprintf("global inference took %s versus %s per package and covered %d more lines (+%.1f%%)", round(globalDuration, time.Millisecond), round(localDuration, time.Millisecond), lines, gained)
+	if gained < threshold {
+		out += fmt.Sprintf("; it gains less than %g%%, consider inference_scope: package", threshold)
+	}
+	return out
+}
+
+// exceeds returns true if percent is above the band s.
+func exceeds(s *CoverageSettings, percent float64) bool {
+	return s.MaxCoverage > 0 && percent > s.MaxCoverage
+}
+
+// ratchet returns the band s raised so its minimum is the achieved coverage,
+// rounded down, keeping the band width.
+func ratchet(s CoverageSettings, percent float64) CoverageSettings {
+	width := s.MaxCoverage - s.MinCoverage
+	out := CoverageSettings{MinCoverage: math.Floor(percent)}
+	if out.MinCoverage < s.MinCoverage {
+		out.MinCoverage = s.MinCoverage
+	}
+	out.MaxCoverage = math.Min(out.MinCoverage+width, 100)
+	if out.MaxCoverage < percent {
+		out.MaxCoverage = math.Min(math.Ceil(percent), 100)
+	}
+	return out
+}
+
 func pkgToDir(p string) string {
 	if p == "." {
 		return p
@@ -500,6 +868,13 @@ func pkgToDir(p string) string {
 	return p[2:]
 }
 
+func dirToPkg(d string) string {
+	if d == "." {
+		return d
+	}
+	return "./" + d
+}
+
 type readWriteSeekCloser interface {
 	io.Reader
 	io.Writer
@@ -5,12 +5,17 @@
 package checks
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
 	"github.com/maruel/pre-commit-go/internal"
+	"github.com/maruel/pre-commit-go/scm"
 )
 
 func TestCoverageGlobal(t *testing.T) {
@@ -115,6 +120,11 @@ func TestCoverageGlobal(t *testing.T) {
 		},
 	}
 	ut.AssertEqual(t, expected, profile.Subset("."))
+
+	// The packages don't test each other so global inference gains nothing.
+	local, err := c.RunPerPackage(change, &Options{MaxDuration: 1})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, profile.TotalCoveredLines(), local.TotalCoveredLines())
 }
 
 func TestCoverageLocal(t *testing.T) {
@@ -207,6 +217,25 @@ func TestCoverageLocal(t *testing.T) {
 	ut.AssertEqual(t, expected, profile.Subset("bar"))
 
 	ut.AssertEqual(t, nil, c.Run(change, &Options{MaxDuration: 1}))
+
+	ut.AssertEqual(t, CoverageBaseline{".": 100, "bar": 50}, c.baseline(change, profile))
+	c.BaselineFile = "coverage.json"
+	// The baseline file doesn't exist yet.
+	ut.AssertEqual(t, nil, c.Run(change, &Options{MaxDuration: 1}))
+	ut.AssertEqual(t, nil, CoverageBaseline{".": 100, "bar": 60}.Save(filepath.Join(td, "src", "foo", "coverage.json")))
+	c.MaxDecreasePercent = 5
+	expectedErr := errors.New("coverage decreased by more than 5% versus coverage.json:\n  ./bar: 60.0% -> 50.0% (-10.0%)")
+	ut.AssertEqual(t, expectedErr, c.Run(change, &Options{MaxDuration: 1}))
+	c.MaxDecreasePercent = 10
+	ut.AssertEqual(t, nil, c.Run(change, &Options{MaxDuration: 1}))
+}
+
+func TestInferenceGain(t *testing.T) {
+	t.Parallel()
+	global := CoverageProfile{{Source: "foo.go", Covered: 8, Total: 10}, {Source: "bar/bar.go", Covered: 5, Total: 10}}
+	local := CoverageProfile{{Source: "foo.go", Covered: 8, Total: 10}, {Source: "bar/bar.go", Covered: 4, Total: 10}}
+	ut.AssertEqual(t, "global inference took 3s versus 1.5s per package and covered 1 more lines (+5.0%)", inferenceGain(global, local, 3*time.Second, 1500*time.Millisecond, 5))
+	ut.AssertEqual(t, "global inference took 3s versus 1.5s per package and covered 1 more lines (+5.0%); it gains less than 10%, consider inference_scope: package", inferenceGain(global, local, 3*time.Second, 1500*time.Millisecond, 10))
 }
 
 var coverageFiles = map[string]string{
@@ -259,6 +288,77 @@ func TestSuccess(t *testing.T) {
 `,
 }
 
+func TestCoverageIntegration(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	files := map[string]string{
+		"bar/bar.go":      "package bar\nfunc Bar() int {\n\treturn 1\n}\n",
+		"bar/doc_test.go": "package bar\n",
+		"e2e/e2e_test.go": `package e2e
+import (
+	"testing"
+	"foo/bar"
+)
+func TestBar(t *testing.T) {
+	if bar.Bar() != 1 {
+		t.Fail()
+	}
+}
+`,
+	}
+	change := setup(t, td, files)
+
+	c := &Coverage{
+		InferenceScope:      InferenceModule,
+		IntegrationPackages: []string{"e2e"},
+		PerDirDefault:       CoverageSettings{MinCoverage: 100},
+		PerDir:              map[string]*CoverageSettings{"e2e": nil},
+	}
+	expected := CoverageProfile{
+		{
+			Source:    "bar/bar.go",
+			Line:      2,
+			SourceRef: "bar/bar.go:2",
+			Name:      "Bar",
+			Covered:   1,
+			Missing:   []int{},
+			Total:     1,
+			Percent:   100,
+		},
+	}
+	profile, err := c.RunProfile(change, &Options{MaxDuration: 1})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, profile)
+	ut.AssertEqual(t, nil, c.Run(change, &Options{MaxDuration: 1}))
+
+	// Without the integration package, bar is not covered.
+	c.IntegrationPackages = nil
+	c.InferenceScope = InferencePackage
+	profile, err = c.RunProfile(change, &Options{MaxDuration: 1})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0., profile.CoveragePercent())
+}
+
+func TestCoverageScope(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, InferencePackage, (&Coverage{}).Scope())
+	ut.AssertEqual(t, InferenceGlobal, (&Coverage{UseGlobalInference: true}).Scope())
+	ut.AssertEqual(t, InferenceModule, (&Coverage{UseGlobalInference: true, InferenceScope: InferenceModule}).Scope())
+	c := &Coverage{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal([]byte("inference_scope: module\n"), c))
+	ut.AssertEqual(t, InferenceModule, c.InferenceScope)
+	ut.AssertEqual(t, errors.New("invalid inference scope \"repo\""), yaml.Unmarshal([]byte("inference_scope: repo\n"), c))
+}
+
 func TestCoveragePrerequisites(t *testing.T) {
 	// This test can't be parallel.
 	if !IsContinuousIntegration() {
@@ -280,6 +380,30 @@ func TestCoverageEmpty(t *testing.T) {
 	ut.AssertEqual(t, &CoverageSettings{}, c.SettingsForPkg("foo"))
 }
 
+func TestCoverageCoverallsEnv(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(td, "token"), []byte("secret\n"), 0600))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(td, "empty"), nil, 0600))
+
+	env, err := (&Coverage{}).coverallsEnv(td)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string(nil), env)
+	env, err = (&Coverage{CoverallsTokenFile: "token"}).coverallsEnv(td)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"COVERALLS_TOKEN=secret"}, env)
+	_, err = (&Coverage{CoverallsTokenFile: "empty"}).coverallsEnv(td)
+	ut.AssertEqual(t, errors.New("coveralls token file empty is empty"), err)
+	_, err = (&Coverage{CoverallsTokenFile: "missing"}).coverallsEnv(td)
+	ut.AssertEqual(t, true, err != nil)
+}
+
 func TestRangeToString(t *testing.T) {
 	t.Parallel()
 	ut.AssertEqual(t, "", rangeToString(nil))
@@ -289,3 +413,92 @@ func TestRangeToString(t *testing.T) {
 	ut.AssertEqual(t, "1,3-4,6-8", rangeToString([]int{1, 3, 4, 6, 7, 8}))
 	ut.AssertEqual(t, "1,3-4,6", rangeToString([]int{1, 3, 4, 6}))
 }
+
+func TestCoverageBaseline(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	p := filepath.Join(td, "coverage.json")
+	_, err = LoadCoverageBaseline(p)
+	ut.AssertEqual(t, true, os.IsNotExist(err))
+	ut.AssertEqual(t, nil, CoverageBaseline{".": 66.66, "a/b": 100}.Save(p))
+	content, err := ioutil.ReadFile(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "{\n  \".\": 66.6,\n  \"a/b\": 100\n}\n", string(content))
+	b, err := LoadCoverageBaseline(p)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, CoverageBaseline{".": 66.6, "a/b": 100}, b)
+
+	old := CoverageBaseline{".": 80, "a": 50, "b": 90}
+	current := CoverageBaseline{".": 79.5, "a": 40, "b": 95, "new": 10}
+	ut.AssertEqual(t, []string{"./a: 50.0% -> 40.0% (-10.0%)"}, regressions(old, current, 1))
+	ut.AssertEqual(t, []string{".: 80.0% -> 79.5% (-0.5%)", "./a: 50.0% -> 40.0% (-10.0%)"}, regressions(old, current, 0))
+}
+
+func TestCoverageLoadBaseline(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		if err := internal.RemoveAll(td); err != nil {
+			t.Fail()
+		}
+	}()
+	ut.AssertEqual(t, nil, CoverageBaseline{"a": 50}.Save(filepath.Join(td, "coverage.json")))
+	repo := &notesRepo{root: td, note: "{\"b\": 60}", commit: "abc"}
+	c := &Coverage{BaselineRef: "refs/notes/coverage"}
+	b, source, err := c.loadBaseline(repo)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, CoverageBaseline{"b": 60}, b)
+	ut.AssertEqual(t, "the note of abc in refs/notes/coverage", source)
+
+	// No note yet.
+	b, _, err = c.loadBaseline(&notesRepo{root: td, commit: scm.Invalid})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, CoverageBaseline(nil), b)
+
+	// The git notes are unavailable.
+	repo = &notesRepo{root: td, commit: scm.Invalid, err: errors.New("failed to list the notes")}
+	_, _, err = c.loadBaseline(repo)
+	ut.AssertEqual(t, repo.err, err)
+	c.BaselineFile = "coverage.json"
+	b, source, err = c.loadBaseline(repo)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, CoverageBaseline{"a": 50}, b)
+	ut.AssertEqual(t, "coverage.json", source)
+
+	_, _, err = c.loadBaseline(&notesRepo{root: td, note: "{", commit: "abc"})
+	ut.AssertEqual(t, errors.New("the note of abc in refs/notes/coverage: unexpected end of JSON input"), err)
+}
+
+func TestRatchet(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, false, exceeds(&CoverageSettings{50, 0}, 90))
+	ut.AssertEqual(t, false, exceeds(&CoverageSettings{50, 90}, 90))
+	ut.AssertEqual(t, true, exceeds(&CoverageSettings{50, 90}, 90.1))
+	ut.AssertEqual(t, CoverageSettings{85, 95}, ratchet(CoverageSettings{50, 60}, 85.3))
+	ut.AssertEqual(t, CoverageSettings{99, 100}, ratchet(CoverageSettings{80, 90}, 99.5))
+	ut.AssertEqual(t, CoverageSettings{70, 71}, ratchet(CoverageSettings{70, 70}, 70.5))
+}
+
+// notesRepo is a repository with a single git note.
+type notesRepo struct {
+	scm.ReadOnlyRepo
+	root   string
+	note   string
+	commit scm.Commit
+	err    error
+}
+
+func (n *notesRepo) Root() string {
+	return n.root
+}
+
+func (n *notesRepo) Note(ref string) (string, scm.Commit, error) {
+	return n.note, n.commit, n.err
+}
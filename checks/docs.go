@@ -0,0 +1,281 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Self documentation of the checks.
+
+//go:generate go test -run TestDocsUpToDate -update-docs
+
+package checks
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+// CheckDoc is the documentation of a check type.
+type CheckDoc struct {
+	// Name is the check type name, e.g. "coverage".
+	Name string
+	// Description is the one line description returned by GetDescription().
+	Description string
+	// Doc is the doc comment of the check struct.
+	Doc string
+	// Fields is the list of configurable fields, in declaration order.
+	Fields []FieldDoc
+}
+
+// FieldDoc is the documentation of a configurable field of a check.
+type FieldDoc struct {
+	// Name is the YAML key. The fields of a nested struct are named
+	// "parent.child".
+	Name string
+	// Type is the Go type of the field.
+	Type string
+	// Default is the YAML representation of the value used when the field is
+	// omitted.
+	Default string
+	// Doc is the doc comment of the field.
+	Doc string
+}
+
+// Document returns the documentation of the check type name, as found in
+// KnownChecks.
+//
+// The doc comments are extracted from the source by go generate.
+func Document(name string) (*CheckDoc, error) {
+	factory, ok := KnownChecks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown check \"%s\"", name)
+	}
+	c := factory()
+	v := reflect.ValueOf(c).Elem()
+	return &CheckDoc{
+		Name:        name,
+		Description: c.GetDescription(),
+		Doc:         typeDocs[v.Type().Name()],
+		Fields:      documentFields(v, ""),
+	}, nil
+}
+
+// MarshalDocumented returns the YAML representation of c, with the doc
+// comment of each field and of each check type as YAML comments.
+func MarshalDocumented(c *Config) ([]byte, error) {
+	b := &bytes.Buffer{}
+	if err := writeStruct(b, reflect.ValueOf(c).Elem(), ""); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// MarshalDocumentedCheck returns the YAML representation of check c as a one
+// item list under its check type name, prefixed with its doc comments.
+func MarshalDocumentedCheck(c Check) ([]byte, error) {
+	b := &bytes.Buffer{}
+	v := reflect.ValueOf(c).Elem()
+	writeComment(b, typeDocs[v.Type().Name()], "")
+	fmt.Fprintf(b, "%s:\n", c.GetName())
+	if err := writeListItem(b, v, ""); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Private stuff.
+
+// writeComment writes doc as a YAML comment.
+func writeComment(b *bytes.Buffer, doc, indent string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			fmt.Fprintf(b, "%s#\n", indent)
+		} else {
+			fmt.Fprintf(b, "%s# %s\n", indent, line)
+		}
+	}
+}
+
+// writeStruct writes the serialized fields of struct v, each preceded by its
+// doc comment.
+func writeStruct(b *bytes.Buffer, v reflect.Value, indent string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		key := tag[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		fv := v.Field(i)
+		inline, omitEmpty := false, false
+		for _, flag := range tag[1:] {
+			inline = inline || flag == "inline"
+			omitEmpty = omitEmpty || flag == "omitempty"
+		}
+		if inline {
+			if err := writeStruct(b, fv, indent); err != nil {
+				return err
+			}
+			continue
+		}
+		if omitEmpty && reflect.DeepEqual(fv.Interface(), reflect.Zero(f.Type).Interface()) {
+			continue
+		}
+		writeComment(b, fieldDocs[t.Name()+"."+f.Name], indent)
+		fmt.Fprintf(b, "%s%s:", indent, key)
+		if err := writeValue(b, fv, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeValue writes v as the value of a key written just before.
+func writeValue(b *bytes.Buffer, v reflect.Value, indent string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		b.WriteString("\n")
+		return writeStruct(b, v, indent+"  ")
+	case reflect.Ptr:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			b.WriteString("\n")
+			return writeStruct(b, v.Elem(), indent+"  ")
+		}
+	case reflect.Map:
+		if v.Len() != 0 && hasStruct(v.Type().Elem()) {
+			b.WriteString("\n")
+			var keys []string
+			values := map[string]reflect.Value{}
+			for _, k := range v.MapKeys() {
+				name := fmt.Sprint(k.Interface())
+				keys = append(keys, name)
+				values[name] = v.MapIndex(k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				value := values[k]
+				if value.Kind() == reflect.Slice && value.Len() != 0 {
+					if c, ok := value.Index(0).Interface().(Check); ok {
+						writeComment(b, typeDocs[reflect.ValueOf(c).Elem().Type().Name()], indent+"  ")
+					}
+				}
+				fmt.Fprintf(b, "%s  %s:", indent, k)
+				if err := writeValue(b, value, indent+"  "); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Slice:
+		if v.Len() != 0 && hasStruct(v.Type().Elem()) {
+			b.WriteString("\n")
+			for i := 0; i < v.Len(); i++ {
+				if err := writeListItem(b, v.Index(i), indent); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	// Leave the scalars and the lists of scalars to yaml.v2.
+	d, err := yaml.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(d), "\n"), "\n")
+	if len(lines) == 1 && !strings.HasPrefix(lines[0], "- ") && (v.Kind() != reflect.Map || v.Len() == 0) {
+		fmt.Fprintf(b, " %s\n", lines[0])
+		return nil
+	}
+	b.WriteString("\n")
+	for _, line := range lines {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+	return nil
+}
+
+// writeListItem writes v as an item of a list. The fields of a struct are
+// indented under the "- " marker.
+func writeListItem(b *bytes.Buffer, v reflect.Value, indent string) error {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		fmt.Fprintf(b, "%s-", indent)
+		return writeValue(b, v, indent+"  ")
+	}
+	item := &bytes.Buffer{}
+	if err := writeStruct(item, v, indent+"  "); err != nil {
+		return err
+	}
+	if item.Len() == 0 {
+		fmt.Fprintf(b, "%s- {}\n", indent)
+		return nil
+	}
+	// Replace the indentation of the first line with the list marker.
+	fmt.Fprintf(b, "%s- %s", indent, item.Bytes()[len(indent)+2:])
+	return nil
+}
+
+// hasStruct returns true if the values of type t are written field by field.
+func hasStruct(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Interface
+}
+
+// documentFields returns the documentation of the serialized fields of struct
+// v. The nested structs are flattened.
+func documentFields(v reflect.Value, prefix string) []FieldDoc {
+	var out []FieldDoc
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		key := tag[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			// Same default as yaml.v2.
+			key = strings.ToLower(f.Name)
+		}
+		if f.Type.Kind() == reflect.Struct {
+			if len(tag) > 1 && tag[1] == "inline" {
+				out = append(out, documentFields(v.Field(i), prefix)...)
+			} else {
+				out = append(out, documentFields(v.Field(i), prefix+key+".")...)
+			}
+			continue
+		}
+		def := "null"
+		if d, err := yaml.Marshal(v.Field(i).Interface()); err == nil {
+			def = strings.TrimSpace(string(d))
+		}
+		out = append(out, FieldDoc{
+			Name:    prefix + key,
+			Type:    strings.Replace(f.Type.String(), "checks.", "", -1),
+			Default: def,
+			Doc:     fieldDocs[t.Name()+"."+f.Name],
+		})
+	}
+	return out
+}
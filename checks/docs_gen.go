@@ -0,0 +1,209 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Code generated by go generate; DO NOT EDIT.
+
+package checks
+
+// typeDocs is the doc comment of the exported types, keyed by type name.
+var typeDocs = map[string]string{
+	"Build":             "Build builds packages without tests via 'go build'.",
+	"BuildConstraints":  "BuildConstraints enforces that the build constraints are valid and\nconsistent.\n\nMalformed or misplaced constraints are silently ignored by the go tool, and\ncontradictory ones silently exclude the file from every build.",
+	"Check":             "Check describes an check to be executed on the code base.\n\nThird party checks implement it and are added with Register().",
+	"CheckDoc":          "CheckDoc is the documentation of a check type.",
+	"CheckPrerequisite": "CheckPrerequisite describe a tool that is needed to run a Check.\n\nIt must list a command that is to be executed and the expected exit code to\nverify that the custom tool is properly installed. If the executable is not\ndetected, InstallCommand is executed, or \"go get $URL\" if it is not set.",
+	"Checks":            "Checks helps with Check serialization.",
+	"Config":            "Config is the serialized form of pre-commit-go.yml.",
+	"ContextCancel":     "ContextCancel enforces that the cancel function returned by\ncontext.WithCancel, context.WithTimeout and context.WithDeadline is called,\notherwise the context and its timer leak until the parent context is\ncanceled.\n\nIt is similar to go vet's lostcancel but without type analysis: the cancel\nfunction is considered handled when it is deferred, including in a deferred\nfunction literal, or when it escapes, e.g. when it is returned or stored.\nOtherwise it must be called before the first return statement following\nthe assignment. Both \"context\" and \"golang.org/x/net/context\" are\nrecognized. Generated files are ignored.",
+	"ContextFirst":      "ContextFirst enforces that a context.Context parameter is the first\nparameter of the functions and methods.\n\nBoth \"context\" and \"golang.org/x/net/context\" are recognized. Generated\nfiles are ignored. A legacy function that can't be changed is ignored by\nadding its name to Blacklist.",
+	"CopyLocks":         "CopyLocks runs the copylocks analyzer of go vet on its own.\n\nCopying a value containing a sync.Mutex, e.g. by passing a struct by value,\ncopies the lock state; the copy is not protected by the original lock. It\nis one of the go vet analyzers, so it can be enforced in pre-commit without\nenabling all of govet.",
+	"Copyright":         "Copyright looks for copyright headers in all files.",
+	"Coverage":          "Coverage runs all tests with coverage.",
+	"CoverageBand":      "CoverageBand is a coverage band exceeded by the achieved coverage.",
+	"CoverageBaseline":  "CoverageBaseline is the coverage in percent of each package, per directory\nin POSIX format. It is stored as JSON in Coverage.BaselineFile or in a git\nnote under Coverage.BaselineRef.",
+	"CoverageProfile":   "CoverageProfile is the processed results of a coverage run.",
+	"CoverageSettings":  "CoverageSettings specifies coverage settings.",
+	"Custom":            "Custom represents a user configured check running an external program.\n\nIt can be used multiple times to run multiple external checks.",
+	"DeferInLoop":       "DeferInLoop flags the defer statements inside the body of a for loop.\n\nA deferred call runs when the function returns, not at the end of the\niteration, so the resources released by the deferred calls, e.g. open files,\naccumulate until then. A defer in a function literal declared in the loop,\ne.g. called once per iteration, is fine. Generated files are ignored.",
+	"DocExamples":       "DocExamples compiles the Go code blocks of markdown files so the\ndocumentation doesn't rot.\n\nEach code block marked as \"go\" is compiled as its own program in a scratch\ndirectory. A block without package clause is put in package main and a\nblock of statements, optionally preceded by imports, is wrapped in func\nmain(). The blocks can import the packages of the repository.",
+	"Dupl":              "Dupl runs dupl to find duplicated code.\n\nAll the packages are searched so copies of unmodified code are found, but\nonly the duplicates involving a modified file are reported. A file\ncontaining intentionally similar code can be ignored by adding its name to\nBlacklist.",
+	"Embed":             "Embed enforces that the //go:embed directives reference existing files.\n\nAn invalid directive only fails the build of its package, which may not be\nbuilt when only some packages are checked. All the directives of the\nrepository are verified against the files tracked by the repository, so\ndeleting an embedded file is caught too.",
+	"Errcheck":          "Errcheck runs errcheck on packages.",
+	"ErrorComparison":   "ErrorComparison enforces that errors are compared with errors.Is and\nerrors.As, so the comparisons still work when the errors are wrapped.\n\nIt flags the == and != comparisons and the switch cases against a sentinel\nerror, except in Is methods, the type assertions of an error, and the error\ntypes with a field of type error but no Unwrap method. Sentinel errors are recognized by name,\ne.g. \"ErrNotFound\", \"errClosed\" or \"io.ErrUnexpectedEOF\", since the check\ndoesn't do type analysis. Generated files are ignored.",
+	"ErrorDocs":         "ErrorDocs flags the exported functions returning an error whose doc comment\ndoesn't describe the error conditions.\n\nIt is a heuristic: the doc comment must match RequirePattern, by default a\nmention of an error, a failure or what is returned. The methods of the\nunexported types, test and generated files are ignored. The methods of well\nknown interfaces, e.g. \"Close\", are usually added to Blacklist.",
+	"ErrorNaming":       "ErrorNaming enforces the naming conventions of the exported errors: the\nsentinel errors are variables named ErrXxx and the error types are named\nXxxError.\n\nSentinel errors are recognized as the package level variables of type error\nor initialized with errors.New() or fmt.Errorf(). Error types are the types\nwith an Error() string method. Test and generated files are ignored. The\nlegacy names kept for compatibility can be added to Blacklist.",
+	"ErrorWrap":         "ErrorWrap enforces that errors are wrapped with %w when formatted with\nfmt.Errorf.\n\nErrors are detected by name since the check doesn't do type analysis, e.g.\n\"err\", \"err2\" or \"readErr\".",
+	"ExampleOutput":     "ExampleOutput enforces that the example functions have an output comment.\n\nAn example without \"// Output:\" or \"// Unordered output:\" comment is\ncompiled but never run by go test, so it silently passes whatever it does.\nThe examples without output on purpose can be added by name to Blacklist.",
+	"FieldDoc":          "FieldDoc is the documentation of a configurable field of a check.",
+	"FileFilter":        "FileFilter is embedded in the checks reporting issues in the Go source\nfiles, to exclude some files from the ones they check with the same options\nfor all of them. The files are excluded when they are enumerated, so they\nare not even parsed.",
+	"FileSize":          "FileSize flags the modified files larger than a maximum size.\n\nIt catches the binaries and the huge generated files committed by accident.\nAll the files are checked, not only the Go source files; the files matching\nignore_patterns are skipped.",
+	"FuncCovered":       "FuncCovered is the summary of a function covered.",
+	"Gofmt":             "Gofmt runs gofmt in check mode with code simplification enabled.",
+	"Goimports":         "Goimports runs goimports in check mode.",
+	"Golden":            "Golden runs all tests with flags to regenerate golden files in a scratch\ncopy of the checkout and fails if any file would change.\n\nThe checkout is never modified.",
+	"Golint":            "Golint runs golint.",
+	"GoroutineSafety":   "GoroutineSafety enforces that the goroutines recover from panics.\n\nA panic in a goroutine without recovery crashes the whole process. A go\nstatement is accepted when the function launched defers a function calling\nrecover() or one of SafeLaunchers. Only the functions declared in the\nmodified files of the package are known. Generated files are ignored.",
+	"Govet":             "Govet runs \"go tool vet\".\n\nThe findings are errors by default. ErrorAnalyzers and WarnAnalyzers set the\nseverity per analyzer, so some findings fail the check while the others are\nonly reported, depending on fail_on. Blacklist is applied first: a\nblacklisted message is dropped whatever its analyzer.",
+	"HandlerContext":    "HandlerContext flags the HTTP handlers that block without referencing the\ncontext of the request.\n\nA handler that ignores r.Context() keeps working after the client\ndisconnected. The handlers are the functions, methods and function literals\nwith the signature (http.ResponseWriter, *http.Request), including\nServeHTTP methods. They block when they contain an infinite for loop, a\nselect statement, a channel receive, a call to time.Sleep or a call to one\nof BlockingCalls. This is a heuristic since the check doesn't do type\nanalysis.",
+	"ImportCount":       "ImportCount enforces a maximum number of imports per file.\n\nIt is a coarse proxy for the coupling of a file: a file importing many\npackages is likely doing too much and is a candidate to be split. Blank\nimports are counted. Generated files are ignored.",
+	"InferenceScope":    "InferenceScope is the set of tests whose coverage is credited to a package.",
+	"InitFuncs":         "InitFuncs flags the init() functions doing heavy work.\n\nAn init() function runs at the startup of every program importing the\npackage, including its tests, and can't be skipped or mocked. The work is\nbetter done explicitly or lazily. The function literals declared in an\ninit() function are ignored, as they are likely called later. Generated\nfiles are ignored.",
+	"Issue":             "Issue is a problem found by a check.",
+	"IssueFilter":       "IssueFilter is embedded in the checks reporting issues, to ignore some of\nthe issues they report with the same option for all of them. The issues are\nignored after the check ran, so they are matched against their text as\nprinted, e.g. \"foo.go:12: message\".",
+	"Issues":            "Issues is the error returned by Check.Run() by the checks reporting\nstructured issues.\n\nThe other checks return a plain error; use AsIssues() to handle both.",
+	"JSONNaming":        "JSONNaming enforces a naming convention for the json names of the fields\nof the structs marshaled to JSON, e.g. in the packages of an external API.\n\nA struct is considered marshaled to JSON if at least one of its fields has\na json tag. Its exported fields must then all have a json name following\nConvention, or \"-\". The embedded fields without tag are inlined so they are\nignored. Generated files are ignored.",
+	"LargeParam":        "LargeParam flags the function parameters passed by value whose type is\nlarger than a maximum size, as copying them on each call is slow.\n\nUnlike the other source checks, it type checks the modified packages to\ncompute the sizes, for the architecture pcg runs on. The imports are loaded\nfrom source. The parameters whose type can't be resolved, the external test\npackages and the generated files are ignored.",
+	"Logging":           "Logging enforces the use of the logger chosen by the project, by flagging\nthe calls to the other logging functions, e.g. log.Printf or fmt.Println.\n\nThe test files, where printing is often the point, e.g. in examples, and\nthe generated files are ignored.",
+	"MagicNumbers":      "MagicNumbers flags the unnamed numeric literals in the functions, which are\nbetter declared as named constants documenting their unit and meaning.\n\n0, 1 and -1 are always allowed. The literals of the constant declarations\nand the array lengths are ignored, as are the package level declarations as\nthey already name their value. Generated files are ignored.",
+	"Mode":              "Mode is one of the check mode. When running checks, the mode determine what\nchecks are executed.",
+	"Modules":           "Modules is the list of the Go module directories relative to the repository\nroot, or \"auto\".",
+	"MustCheck":         "MustCheck enforces that the errors returned by specific risky functions are\nalways handled: not discarded, not assigned to \"_\" and not deferred.\n\nThe check doesn't do type analysis. A method of a type, e.g.\n\"(*os.File).Close\", is recognized when called on a variable declared with\nthis type or assigned from a function of the type's package, e.g.\n\"f, err := os.Open(p)\".",
+	"NilInterface":      "NilInterface flags the functions returning a concrete pointer as an error.\n\nA nil pointer stored in an interface is not a nil interface, so the caller\nsees a non-nil error. The check doesn't do type analysis so it only\nrecognizes the pointers declared locally, e.g. \"var err *MyError\", and the\ncalls to the functions of the same package returning a pointer, including\nthe ones declared in files that were not modified.",
+	"NoPanic":           "NoPanic flags the panic() calls used for ordinary control flow.\n\nA library panicking takes down the whole program of its user; it should\nreturn an error instead. The init() functions, the main() function of\npackage main and the generated files are ignored. The test files are\nignored unless IncludeTests is set.",
+	"Options":           "Options hold the settings for a mode shared by all checks.",
+	"OsExit":            "OsExit flags the os.Exit() and log.Fatal*() calls outside of the\nentry points.\n\nThey exit without running the deferred calls, and the code calling them\ncan't be tested. The init() functions, the main() function of package main,\nthe TestMain() functions and the generated files are ignored.",
+	"PackageName":       "PackageName enforces that the package clauses match the name of their\ndirectory.\n\nIt catches the packages copied from another one that kept its name. The\nusual conventions are accepted: package main, the external test packages\nnamed xxx_test, and the directories named like \"go-foo\", \"foo-go\", \"foo.v2\"\nor \"foo/v2\" for package foo. The directory of a package that is named\ndifferently on purpose can be added to Blacklist.",
+	"PublicSurface":     "PublicSurface enforces a maximum number of exported symbols per package.\n\nA package exporting too many types, functions, variables and constants is\nlikely doing too much and is a candidate to be split. Methods and struct\nfields are not counted. Only the modified packages are checked, main\npackages are ignored.",
+	"ReceiverNames":     "ReceiverNames enforces that the methods of a type use the same receiver\nname and that it is short.\n\nThe consistency is verified among the modified files of each package, the\nmost common name being the expected one. Receivers named \"this\" or \"self\"\nare always reported. Generated files are ignored.",
+	"RequireTests":      "RequireTests enforces that every package has at least one _test.go file.\n\nA package without test is invisible to check coverage when it doesn't use\nglobal inference, so its coverage percentage hides it. Main packages and\ngenerated packages are ignored. A package legitimately without tests can be\nadded to Blacklist, e.g. \"./cmd/tool\".",
+	"ResourceLimits":    "ResourceLimits are the limits applied to each process.",
+	"Settings":          "Settings is the settings used for a mode.",
+	"Severity":          "Severity is the importance of an Issue.",
+	"SignatureLimits":   "SignatureLimits enforces a maximum number of parameters and results for\nthe functions and methods.\n\nA long signature is hard to call correctly; the arguments are better\ngrouped in a struct. Generated files are ignored.",
+	"SortLess":          "SortLess flags the less functions that are likely not a strict weak\nordering, which sorts inconsistently.\n\nThe less functions are the function literals passed to sort.Slice and\nsort.SliceStable and the Less(i, j int) bool methods used by sort.Sort. It\nis a heuristic: a less function must use both its parameters, must not\ncompare the two indices with <= or >=, and must not compare two values\nindexed by the same parameter. Generated files are ignored.",
+	"StructTags":        "StructTags enforces that struct field tags are well-formed.\n\nMalformed tags compile but are silently ignored by reflect.StructTag.Get,\nbreaking the marshaling of the field. Generated files are ignored.",
+	"Subtests":          "Subtests enforces that the table-driven tests run each case as a subtest\nwith t.Run().\n\nA failure in a named subtest reports the case that failed, and a single\ncase can be run with -run. A table-driven test is recognized as a for range\nloop, over a slice or map literal or a variable initialized with one, that\nreports failures with t.Error(), t.Fatal() and the likes, or by passing t to\na helper, without calling t.Run().",
+	"TagConsistency":    "TagConsistency enforces that the build constraints of the files whose name\nimplies a GOOS or a GOARCH, like \"foo_linux.go\", are consistent with it.\n\nIt reports the constraints excluding the target implied by the file name,\nthe ones that are redundant with it and the ones mentioning another GOOS or\nGOARCH, which can never be satisfied.",
+	"Test":              "Test runs all tests via go test.",
+	"TestInternals":     "TestInternals polices the boundary between a package and its external\ntests, in package foo_test.\n\nThe symbols exported by the internal test files of package foo, e.g. the\n\"export_test.go\" hack, are only visible to the external tests, which then\ntest the internals instead of the public API. The uses of these symbols by\nthe external tests are flagged, unless allowed. Only the package level\nsymbols are tracked, not the methods. Generated files are ignored.",
+	"TestMainUsage":     "TestMainUsage enforces that the TestMain functions have the signature\nfunc(*testing.M), call m.Run() and parse the flags before using them.\n\nA TestMain that doesn't call m.Run() silently runs no test at all, so the\npackage appears to pass.",
+	"TestNaming":        "TestNaming enforces that test, benchmark and example functions follow the\nnaming and signature conventions of go test.\n\nFunctions that do not follow them are silently not run by go test.",
+	"TestingImport":     "TestingImport enforces that non-test files do not import package testing.\n\nImporting testing from non-test code registers its flags and bloats the\nbinaries. A helper package meant to be imported by tests can be ignored by\nadding its directory to Blacklist.",
+	"TimeNow":           "TimeNow flags the direct time.Now() calls.\n\nTime dependent logic calling time.Now() can't be tested deterministically;\nthe current time should come from an injected clock instead. The test\nfiles, the files of package main and the generated files are ignored.",
+	"Timing":            "Timing is the duration of a named item, e.g. a check or a test.",
+	"Timings":           "Timings is a list of Timing sorted from the slowest to the fastest.",
+	"Trigger":           "Trigger is embedded in the expensive checks, to only run them when the\nchange touches some files. It is applied by IsTriggered().",
+	"TypeSwitch":        "TypeSwitch flags the type switches over an interface without default case\nthat don't handle all its implementers, as a value of an unhandled type\nsilently falls through, e.g. when a node type is added to a visitor.\n\nThis is a heuristic since the check doesn't do type analysis. Only the\ninterfaces declared in the package of the switch are considered, with their\nimplementers declared in the same package; an interface embedding an\ninterface of another package is ignored. The interface switched on is the\ndeclared type of the variable, otherwise the only interface implemented by\nall the types of the cases. Generated files are ignored. An interface whose\nswitches are not meant to be exhaustive is ignored by adding its name to\nBlacklist.",
+	"WaitGroupUsage":    "WaitGroupUsage flags the sync.WaitGroup Add() calls done inside the\ngoroutine they guard.\n\nThe goroutine may not have started when Wait() is called, so Wait() can\nreturn before it is done. An Add() call is flagged when it is lexically in\nthe function literal launched by a go statement that also calls Done() on\nthe same WaitGroup expression, e.g. \"wg\" or \"s.wg\". The functions launched\nby name are not inspected. Generated files are ignored.",
+}
+
+// fieldDocs is the doc comment of the exported struct fields, keyed by
+// "Type.Field".
+var fieldDocs = map[string]string{
+	"Build.BuildAll":                     "BuildAll forces building every packages. By default, only the packages\nwithout tests are built; packages with tests are built by check test.",
+	"Build.CGODisabled":                  "CGODisabled builds with CGO_ENABLED=0 to ensure the packages can be\nstatically linked. On failure, the packages using cgo are listed.",
+	"Build.ExtraArgs":                    "ExtraArgs are additional arguments to go build, e.g. \"-tags foo\".",
+	"Build.GCFlags":                      "GCFlags are passed to the compiler via -gcflags, e.g. \"-m\" to print the\nescape analysis decisions or \"-d=checkptr\".",
+	"Build.GCFlagsBaseline":              "GCFlagsBaseline is the path, relative to the repository root, of a file\nlisting the expected compiler diagnostics printed because of GCFlags. When\nset, the diagnostics not in this file are reported as regressions.",
+	"CheckDoc.Description":               "Description is the one line description returned by GetDescription().",
+	"CheckDoc.Doc":                       "Doc is the doc comment of the check struct.",
+	"CheckDoc.Fields":                    "Fields is the list of configurable fields, in declaration order.",
+	"CheckDoc.Name":                      "Name is the check type name, e.g. \"coverage\".",
+	"CheckPrerequisite.ExpectedExitCode": "ExpectedExitCode is the exit code expected when HelpCommand is executed.",
+	"CheckPrerequisite.HelpCommand":      "HelpCommand is the help command to run to detect if this prerequisite is\ninstalled or not. This command should have no adverse effect and must be\nfast to execute.",
+	"CheckPrerequisite.InstallCommand":   "InstallCommand is the command to run instead of `go get URL` to install\na tool that is not a Go package, e.g. [\"npm\", \"install\", \"-g\", \"foo\"].",
+	"CheckPrerequisite.Timeout":          "Timeout is the maximum number of seconds HelpCommand may take to run. If\nit takes longer, the prerequisite is assumed to not be present. If 0,\nDefaultPrerequisiteTimeout is used.",
+	"CheckPrerequisite.URL":              "URL is the url to fetch as `go get URL`.",
+	"Config.FailOn":                      "FailOn is the minimum severity of the issues that fail the run, one of\n\"error\", \"warning\" or \"info\". The issues of a lower severity are printed\nbut don't fail the run. Defaults to \"error\".",
+	"Config.FilesCommand":                "FilesCommand is the command listing the files to check, one per line,\ninstead of the files modified as per git. It is run from the root of the\nrepository by \"pcg run\" when neither -a nor -r is specified, e.g. to use\nthe change detection of a build system.",
+	"Config.GoCache":                     "GoCache is the directory to use as GOCACHE, the go build cache, for all\nthe processes started, including the prerequisites installation. It is\nrelative to the repository root unless absolute and environment\nvariables are expanded, e.g. \"$HOME/.cache/go-build\". It is meant to\npoint at a directory persisted across continuous integration runs. When\nempty, GOCACHE is left untouched.",
+	"Config.GoModCache":                  "GoModCache is the directory to use as GOMODCACHE, the Go module download\ncache. It is handled like GoCache.",
+	"Config.IgnorePatterns":              "IgnorePatterns is all paths glob patterns that should be ignored. By\ndefault, this include any file or directory starting with \".\" or \"_\", i.e.\n[]string{\".*\", \"_*\"}.  This is a glob that is applied to each path\ncomponent of each file.",
+	"Config.Isolate":                     "Isolate runs the checks in a temporary git worktree of the staging area,\nso the checks writing files have no side effect on the checkout. The\nunstaged changes and the untracked files are not checked.",
+	"Config.MaxConcurrent":               "MaxConcurrent, if not zero, is the maximum number of concurrent processes\nto run. If zero, there is no maximum.",
+	"Config.MinVersion":                  "MinVersion is set to the current pcg version. Earlier version will refuse\nto load this file.",
+	"Config.Modes":                       "Settings per mode. Settings includes the checks and the maximum allowed\ntime spent to run them.",
+	"Config.Modules":                     "Modules is the list of Go modules in which the checks are run, for\nrepositories containing multiple modules. When empty, the checks are run\nonce at the root of the repository.",
+	"Config.RecordTests":                 "RecordTests, if true, records the duration of each individual test run by\ncheck test. They are retrieved via Options.TestTimings().",
+	"Config.StashUnstaged":               "StashUnstaged runs the pre-commit checks in the checkout after stashing\nthe unstaged changes, instead of running them on a copy of the staging\narea. The unstaged changes are restored afterward.",
+	"Config.WarnUntracked":               "WarnUntracked prints a warning when untracked Go files are present, as\nthey are not checked. It is easy to forget to \"git add\" a new file.",
+	"ContextFirst.IncludeUnexported":     "IncludeUnexported also checks the unexported functions and methods.",
+	"Copyright.Header":                   "Header is the text that all files must start with.",
+	"Coverage.BaselineFile":              "BaselineFile is the file storing the coverage of each package, relative\nto the repository root. When set, the check fails if the coverage of a\npackage decreased by more than MaxDecreasePercent versus this baseline.\n'pcg update-coverage' refreshes it.",
+	"Coverage.BaselineRef":               "BaselineRef is the git notes ref, e.g. \"refs/notes/coverage\", storing the\ncoverage of each package instead of BaselineFile, so the baseline is\nversioned with the commits without being in the tree. The note of the\nmost recent commit having one is used. BaselineFile is used when the git\nnotes can't be read. 'pcg update-coverage' stores it on HEAD.",
+	"Coverage.CoverallsTokenFile":        "CoverallsTokenFile is the file containing the coveralls.io repository\ntoken, relative to the repository root. The token is passed to goveralls\nas $COVERALLS_TOKEN. When empty, goveralls finds the token in the\nenvironment as usual.",
+	"Coverage.Global":                    "Global is the coverage the whole code must have, used with\nInferenceGlobal.",
+	"Coverage.InferenceGainThreshold":    "InferenceGainThreshold, when set with InferenceGlobal, also runs the\ntests with each package only instrumented for itself, to report the time\nand the coverage global inference adds. It suggests InferencePackage\nwhen the coverage gained is below this threshold, in percentage points.\nIt roughly doubles the duration of the check, so it is meant to be\nenabled once to make a decision.",
+	"Coverage.InferenceScope":            "InferenceScope selects the tests whose coverage is credited to a\npackage. When empty, it is InferenceGlobal if UseGlobalInference is true\nand InferencePackage otherwise.",
+	"Coverage.IntegrationPackages":       "IntegrationPackages are the directories of test packages, in POSIX format\nrelative to the repository root, that are also run in the package and\nmodule scopes so their coverage is credited to the modified packages.",
+	"Coverage.MaxDecreasePercent":        "MaxDecreasePercent is the coverage decrease in percentage points\ntolerated versus the baseline.",
+	"Coverage.PerDir":                    "PerDir overrides PerDirDefault for some directories, in POSIX format\nrelative to the repository root. A nil value disables the coverage check\nfor the directory.",
+	"Coverage.PerDirDefault":             "PerDirDefault is the coverage each package must have, unless overridden\nin PerDir.",
+	"Coverage.QuietOnSuccess":            "QuietOnSuccess doesn't log the coverage summary of the packages that\npass, nor the slow ones, to keep the verbose logs focused on the\nfailures.",
+	"Coverage.UseCoveralls":              "UseCoveralls sends the coverage data to https://coveralls.io when run on\na CI.",
+	"Coverage.UseGlobalInference":        "UseGlobalInference runs all the test packages and merges their coverage,\nso a package may be covered by the tests of another package. Otherwise\nonly the package's own tests are used.",
+	"CoverageBand.Dir":                   "Dir is the directory of the package in POSIX format, or \"\" for\nCoverage.Global.",
+	"CoverageBand.New":                   "New is the band raised to the achieved coverage, with the same width.",
+	"CoverageBand.Old":                   "Old is the band currently configured.",
+	"CoverageBand.Percent":               "Percent is the achieved coverage.",
+	"CoverageSettings.MaxCoverage":       "MaxCoverage is the maximum coverage in percent, to detect when the\ncoverage increased enough that the values should be updated, which\n'pcg update-coverage' does. If 0, it is not enforced.",
+	"CoverageSettings.MinCoverage":       "MinCoverage is the minimum coverage in percent.",
+	"Custom.CheckExitCode":               "CheckExitCode specifies if the check is declared to fail when exit code is\nnon-zero.",
+	"Custom.Command":                     "Command is check's command line, required.",
+	"Custom.Description":                 "Description is check's description, optional.",
+	"Custom.DisplayName":                 "DisplayName is check's display name, required.",
+	"Custom.Prerequisites":               "Prerequisites are check's prerequisite packages to install first before\nrunning the check, optional.",
+	"DocExamples.Files":                  "Files are the glob patterns of the markdown files, relative to the\nrepository root, e.g. \"*.md\" or \"docs/*.md\", required.",
+	"Dupl.Threshold":                     "Threshold is the minimum size in tokens of a duplicated code block to be\nreported. It is passed to dupl -threshold. dupl's default is used when\n0.",
+	"Errcheck.Ignores":                   "Ignores is passed to errcheck -ignore.",
+	"ErrorComparison.Sentinels":          "Sentinels are the other sentinel errors, as referenced, e.g. \"io.EOF\".",
+	"ErrorDocs.RequirePattern":           "RequirePattern is the regular expression the doc comment must match. If\nempty, DefaultErrorDocsPattern is used.",
+	"ErrorWrap.RequireContext":           "RequireContext also flags errors returned as-is, e.g. \"return err\",\ninstead of being wrapped with context.",
+	"FieldDoc.Default":                   "Default is the YAML representation of the value used when the field is\nomitted.",
+	"FieldDoc.Doc":                       "Doc is the doc comment of the field.",
+	"FieldDoc.Name":                      "Name is the YAML key. The fields of a nested struct are named\n\"parent.child\".",
+	"FieldDoc.Type":                      "Type is the Go type of the field.",
+	"FileFilter.SkipTestFiles":           "SkipTestFiles doesn't check the _test.go files.",
+	"FileSize.MaxBytes":                  "MaxBytes is the maximum size of a file in bytes.",
+	"FileSize.PackagesOnly":              "PackagesOnly only checks the files in the directories containing Go\nsource files.",
+	"Golden.UpdateArgs":                  "UpdateArgs are the arguments passed to 'go test' to regenerate the golden\nfiles, e.g. \"-update\", required.",
+	"Golint.Blacklist":                   "Blacklist causes this check to ignore the messages containing one of\nthese strings.",
+	"GoroutineSafety.SafeLaunchers":      "SafeLaunchers are the functions that are safe to launch as a goroutine\nor to defer as they recover, as called, e.g. \"safe.Go\" or\n\"logPanic\".",
+	"Govet.Blacklist":                    "Blacklist causes this check to ignore the messages containing one of\nthese strings.",
+	"Govet.ErrorAnalyzers":               "ErrorAnalyzers are the analyzers, like printf, whose findings are\nerrors. When set, the findings of the other analyzers are warnings.",
+	"Govet.WarnAnalyzers":                "WarnAnalyzers are the analyzers, like composites, whose findings are\nwarnings. ErrorAnalyzers has precedence when an analyzer is in both.",
+	"HandlerContext.BlockingCalls":       "BlockingCalls are the other functions that block, as called, e.g.\n\"db.Query\" or \"exec.Command\".",
+	"ImportCount.ExcludeStdlib":          "ExcludeStdlib doesn't count the packages of the standard library, i.e.\nthe ones whose import path's first element doesn't contain a dot and\nisn't in the repository's package.",
+	"ImportCount.MaxImports":             "MaxImports is the maximum number of packages a file imports, unless\noverridden in PerDir. If 0, it is not enforced.",
+	"ImportCount.PerDir":                 "PerDir overrides MaxImports for the files of some directories, in POSIX\nformat relative to the repository root. A value of 0 disables the check\nfor the directory.",
+	"InitFuncs.Disallowed":               "Disallowed are the functions that must not be called from an init()\nfunction, e.g. \"os.Exit\", \"log.Fatal\", or \"net/http.*\" for all the\nfunctions of a package. The package is designated by its name or its\nimport path.",
+	"InitFuncs.MaxStatements":            "MaxStatements is the maximum number of statements of an init()\nfunction, including the nested ones. If 0, it is not enforced.",
+	"Issue.Check":                        "Check is the name of the check that found the issue.",
+	"Issue.Col":                          "Col is the 1-based column number, or 0 if unknown.",
+	"Issue.File":                         "File is the path of the file in POSIX format, relative to the repository\nroot. It is empty when the issue is not about a specific file.",
+	"Issue.Line":                         "Line is the 1-based line number, or 0 if unknown.",
+	"Issue.Message":                      "Message describes the issue.",
+	"Issue.Severity":                     "Severity is the importance of the issue.",
+	"IssueFilter.Blacklist":              "Blacklist causes the check to ignore the issues containing one of these\nstrings.",
+	"JSONNaming.Convention":              "Convention is the naming convention of the json names: \"snake_case\" or\n\"camelCase\". If empty, \"snake_case\" is used.",
+	"JSONNaming.Packages":                "Packages are the glob patterns, as matched by path.Match(), of the\ndirectories of the packages checked, e.g. \"api/*\". A pattern without \"/\"\nmatches the base name. If empty, all the packages are checked.",
+	"LargeParam.MaxParamBytes":           "MaxParamBytes is the maximum size in bytes of a parameter passed by\nvalue. Nothing is checked when it is 0.",
+	"Logging.Allow":                      "Allow are the glob patterns, as matched by path.Match(), of the files\nallowed to call them, e.g. \"main.go\" or \"cmd/*/*.go\". A pattern without\n\"/\" matches the base name.",
+	"Logging.Forbidden":                  "Forbidden are the functions that must not be called, e.g. \"log.Println\",\n\"fmt.Println\", or \"log.*\" for all the functions of a package. The package\nis designated by its name or its import path.",
+	"Logging.Logger":                     "Logger is the logger to use instead, e.g. \"log/slog\". It is only used in\nthe messages.",
+	"MagicNumbers.Allow":                 "Allow are the other numbers allowed, e.g. 2 or 100.",
+	"MustCheck.Functions":                "Functions are the functions whose error must be handled, one of:\n\"os.Remove\" for a function of an imported package, by its name or its\nimport path; \"(*os.File).Close\" for a method of a type; \"tx.Rollback\"\nfor a method called on a variable named \"tx\".",
+	"NoPanic.Allow":                      "Allow are the glob patterns, as matched by path.Match(), of the files or\nthe functions allowed to panic, e.g. \"internal/*.go\", \"Must*\" or\n\"*.Must*\" for the methods. A file pattern without \"/\" matches the base\nname. The functions are designated as \"Func\" or \"Type.Method\".",
+	"NoPanic.IncludeTests":               "IncludeTests also checks the _test.go files.",
+	"Options.FailFastOnBuild":            "FailFastOnBuild runs the build checks first and skips the other checks if\nthe code doesn't compile. If no build check is enabled, the test checks\nare run first instead.",
+	"Options.MaxDuration":                "MaxDuration is the maximum allowed duration to run all the checks in\nseconds. If it takes more time than that, it is marked as failed.",
+	"OsExit.Allow":                       "Allow are the glob patterns, as matched by path.Match(), of the files or\nthe functions allowed to exit, e.g. \"cmd/*/*.go\" or \"Must*\". A file\npattern without \"/\" matches the base name. The functions are designated\nas \"Func\" or \"Type.Method\".",
+	"PublicSurface.MaxExported":          "MaxExported is the maximum number of exported symbols of a package,\nunless overridden in PerDir. If 0, it is not enforced.",
+	"PublicSurface.PerDir":               "PerDir overrides MaxExported for some directories, in POSIX format\nrelative to the repository root. A value of 0 disables the check for the\ndirectory.",
+	"ReceiverNames.MaxLength":            "MaxLength is the maximum length of a receiver name. If 0, it is not\nenforced.",
+	"ResourceLimits.MaxCPUSeconds":       "MaxCPUSeconds is the maximum CPU time of each process in seconds, set\nwith \"ulimit -t\". It applies to each process separately, not to the test\nrun as a whole. If 0, it is not limited.",
+	"ResourceLimits.MaxMemoryMB":         "MaxMemoryMB is the maximum virtual memory of each process in MiB, set\nwith \"ulimit -v\". It applies to each process separately, not to the test\nrun as a whole. If 0, it is not limited. Keep it generous, the compiler\nis limited too.",
+	"Settings.Checks":                    "Checks is a map of all checks enabled for this mode, with the key being\nthe check type.",
+	"SignatureLimits.MaxParams":          "MaxParams is the maximum number of parameters, including the variadic\none but not the receiver. If 0, it is not enforced.",
+	"SignatureLimits.MaxResults":         "MaxResults is the maximum number of results. If 0, it is not enforced.",
+	"StructTags.RequireSnakeCase":        "RequireSnakeCase enforces that the keys of the json and yaml tags are\nsnake_case.",
+	"Test.ExtraArgs":                     "ExtraArgs are additional arguments to go test, e.g. \"-short\" or \"-race\".",
+	"Test.JSONOutput":                    "JSONOutput runs go test with -json and only reports the output of the\nfailing tests and subtests, instead of the whole output of the failing\npackages. The output not related to a test, like a build error, is\nreported as is when no test failed.",
+	"Test.RaceAffectedOnly":              "RaceAffectedOnly, when ExtraArgs contains \"-race\" and the checks are run\non a subset of the repository, e.g. with -r, only uses the race detector\non the packages affected by the change: the modified packages and the\nones importing them. The other packages are tested without -race. When\nthe imports can't be resolved, e.g. outside of GOPATH without go.mod,\nevery package is tested with -race.",
+	"Test.ResourceLimits":                "ResourceLimits limits the memory and the CPU time of go test and of the\nprocesses it starts, including the test executable, so a runaway test\nfails instead of taking down the machine. Only supported on linux.",
+	"TestInternals.AliasesOnly":          "AliasesOnly also flags the functions exported for the tests, as they\nlikely duplicate production logic; the exported symbols must be aliases\nof production ones, e.g. \"var Parse = parse\".",
+	"TestInternals.Allow":                "Allow are the glob patterns, as matched by path.Match(), of the symbols\nexported for the tests the external tests may use, e.g. \"SetClock\".",
+	"TimeNow.Allow":                      "Allow are the glob patterns, as matched by path.Match(), of the files\nallowed to call time.Now(), e.g. the clock implementation in\n\"internal/clock/*.go\". A pattern without \"/\" matches the base name.",
+	"Trigger.TriggerPaths":               "TriggerPaths are the glob patterns, as matched by path.Match(), of the\nfiles that trigger the check, e.g. \"proto/*.proto\". A pattern without \"/\"\nmatches the base name. When none of the modified files match, the check\nis skipped as not triggered. If empty, the check always runs.",
+}
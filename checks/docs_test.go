@@ -0,0 +1,181 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+var updateDocs = flag.Bool("update-docs", false, "regenerates docs_gen.go")
+
+func TestDocsUpToDate(t *testing.T) {
+	t.Parallel()
+	expected, err := generateDocs()
+	ut.AssertEqual(t, nil, err)
+	if *updateDocs {
+		ut.AssertEqual(t, nil, ioutil.WriteFile("docs_gen.go", expected, 0666))
+		return
+	}
+	actual, err := ioutil.ReadFile("docs_gen.go")
+	ut.AssertEqual(t, nil, err)
+	if !bytes.Equal(expected, actual) {
+		t.Fatal("docs_gen.go is stale, run: go generate ./checks")
+	}
+}
+
+func TestDocument(t *testing.T) {
+	t.Parallel()
+	d, err := Document("build")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "build", d.Name)
+	ut.AssertEqual(t, (&Build{}).GetDescription(), d.Description)
+	ut.AssertEqual(t, true, strings.HasPrefix(d.Doc, "Build builds"))
+	ut.AssertEqual(t, FieldDoc{"build_all", "bool", "false", fieldDocs["Build.BuildAll"]}, d.Fields[0])
+	ut.AssertEqual(t, "extra_args", d.Fields[1].Name)
+	ut.AssertEqual(t, "[]string", d.Fields[1].Type)
+	ut.AssertEqual(t, "[]", d.Fields[1].Default)
+
+	d, err = Document("coverage")
+	ut.AssertEqual(t, nil, err)
+	var names []string
+	for _, f := range d.Fields {
+		names = append(names, f.Name)
+	}
+	ut.AssertEqual(t, true, strings.Contains(strings.Join(names, " "), " global.min_coverage global.max_coverage "))
+
+	for name := range KnownChecks {
+		_, err = Document(name)
+		ut.AssertEqual(t, nil, err)
+	}
+	_, err = Document("foo")
+	ut.AssertEqual(t, errors.New("unknown check \"foo\""), err)
+}
+
+func TestMarshalDocumented(t *testing.T) {
+	t.Parallel()
+	config := New("0.1")
+	config.Modes[Lint].Checks["custom"] = []Check{&Custom{
+		DisplayName:   "foo",
+		Command:       []string{"foo", "-v"},
+		Prerequisites: []CheckPrerequisite{{HelpCommand: []string{"foo", "-h"}, URL: "example.com/foo"}},
+	}}
+	config.Modes[Lint].Checks["coverage"] = []Check{&Coverage{PerDir: map[string]*CoverageSettings{"a": {MinCoverage: 10}, "b": nil}}}
+	data, err := MarshalDocumented(config)
+	ut.AssertEqual(t, nil, err)
+	s := string(data)
+	ut.AssertEqual(t, true, strings.Contains(s, "\n# IgnorePatterns is all paths glob patterns"))
+	ut.AssertEqual(t, true, strings.Contains(s, "      # Build builds packages without tests via 'go build'.\n      build:\n      - # BuildAll forces"))
+	actual := &Config{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(data, actual))
+	ut.AssertEqual(t, config, actual)
+
+	data, err = MarshalDocumentedCheck(&Gofmt{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "# Gofmt runs gofmt in check mode with code simplification enabled.\ngofmt:\n- {}\n", string(data))
+}
+
+// generateDocs returns the content of docs_gen.go, extracted from the doc
+// comments of the exported types of this package.
+func generateDocs() ([]byte, error) {
+	fset := token.NewFileSet()
+	filter := func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != "docs_gen.go"
+	}
+	pkgs, err := parser.ParseDir(fset, ".", filter, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]string{}
+	fields := map[string]string{}
+	for _, f := range pkgs["checks"].Files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				s := spec.(*ast.TypeSpec)
+				if !ast.IsExported(s.Name.Name) {
+					continue
+				}
+				doc := s.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+				if text := strings.TrimSpace(doc.Text()); text != "" {
+					types[s.Name.Name] = text
+				}
+				st, ok := s.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				for _, field := range st.Fields.List {
+					doc := field.Doc
+					if doc == nil {
+						doc = field.Comment
+					}
+					text := strings.TrimSpace(doc.Text())
+					if text == "" {
+						continue
+					}
+					for _, name := range field.Names {
+						if ast.IsExported(name.Name) {
+							fields[s.Name.Name+"."+name.Name] = text
+						}
+					}
+				}
+			}
+		}
+	}
+	b := &bytes.Buffer{}
+	b.WriteString(`// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Code generated by go generate; DO NOT EDIT.
+
+package checks
+
+// typeDocs is the doc comment of the exported types, keyed by type name.
+var typeDocs = map[string]string{
+`)
+	writeDocsMap(b, types)
+	b.WriteString(`}
+
+// fieldDocs is the doc comment of the exported struct fields, keyed by
+// "Type.Field".
+var fieldDocs = map[string]string{
+`)
+	writeDocsMap(b, fields)
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+func writeDocsMap(b *bytes.Buffer, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s: %s,\n", strconv.Quote(k), strconv.Quote(m[k]))
+	}
+}
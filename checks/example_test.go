@@ -0,0 +1,68 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks_test
+
+import (
+	"strings"
+
+	"github.com/maruel/pre-commit-go/checks"
+	"github.com/maruel/pre-commit-go/scm"
+)
+
+// Todo enforces that the TODO comments have an owner, e.g. "TODO(joe): ...".
+type Todo struct {
+	// Blacklist causes this check to ignore the reports containing one of these
+	// strings.
+	Blacklist []string `yaml:"blacklist"`
+}
+
+// GetDescription implements checks.Check.
+func (t *Todo) GetDescription() string {
+	return "enforces TODO comments have an owner"
+}
+
+// GetName implements checks.Check.
+func (t *Todo) GetName() string {
+	return "todo"
+}
+
+// GetPrerequisites implements checks.Check.
+func (t *Todo) GetPrerequisites() []checks.CheckPrerequisite {
+	return nil
+}
+
+// Run implements checks.Check.
+func (t *Todo) Run(change scm.Change, options *checks.Options) error {
+	// Returning checks.Issues instead of a plain error lets pcg process each
+	// issue.
+	var issues checks.Issues
+	for _, f := range change.Changed().GoFiles() {
+		if change.IsIgnored(f) {
+			continue
+		}
+		for i, line := range strings.Split(string(change.Content(f)), "\n") {
+			if strings.Contains(line, "// TODO:") {
+				issues = append(issues, checks.Issue{Check: t.GetName(), File: f, Line: i + 1, Severity: checks.SeverityError, Message: "TODO without owner"})
+			}
+		}
+	}
+	if len(issues) != 0 {
+		return issues
+	}
+	return nil
+}
+
+// A third party check is a type implementing checks.Check, registered in an
+// init() function of its package. The check is then configured in
+// pre-commit-go.yml by its name like any other check:
+//
+//   modes:
+//     lint:
+//       checks:
+//         todo:
+//         - blacklist: []
+func ExampleRegister() {
+	checks.Register(func() checks.Check { return &Todo{} })
+}
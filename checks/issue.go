@@ -0,0 +1,246 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Structured reporting of the problems found by the checks.
+
+package checks
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity is the importance of an Issue.
+type Severity string
+
+// Known severities.
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// AllSeverities is all the known severities, from the most important.
+var AllSeverities = []Severity{SeverityError, SeverityWarning, SeverityInfo}
+
+// AtLeast returns true if s is as important as t or more. An empty Severity
+// is an error.
+func (s Severity) AtLeast(t Severity) bool {
+	return s.rank() >= t.rank()
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Severity) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	str := ""
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	for _, known := range AllSeverities {
+		if Severity(str) == known {
+			*s = known
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid severity \"%s\"", str)
+}
+
+// Issue is a problem found by a check.
+type Issue struct {
+	// Check is the name of the check that found the issue.
+	Check string
+	// File is the path of the file in POSIX format, relative to the repository
+	// root. It is empty when the issue is not about a specific file.
+	File string
+	// Line is the 1-based line number, or 0 if unknown.
+	Line int
+	// Col is the 1-based column number, or 0 if unknown.
+	Col int
+	// Severity is the importance of the issue.
+	Severity Severity
+	// Message describes the issue.
+	Message string
+}
+
+// String returns the issue formatted like a compiler error, e.g.
+// "foo.go:12:3: message".
+func (i *Issue) String() string {
+	if i.File == "" {
+		return i.Message
+	}
+	pos := i.File
+	if i.Line != 0 {
+		pos += ":" + strconv.Itoa(i.Line)
+		if i.Col != 0 {
+			pos += ":" + strconv.Itoa(i.Col)
+		}
+	}
+	return pos + ": " + i.Message
+}
+
+// Issues is the error returned by Check.Run() by the checks reporting
+// structured issues.
+//
+// The other checks return a plain error; use AsIssues() to handle both.
+type Issues []Issue
+
+func (i Issues) Len() int      { return len(i) }
+func (i Issues) Swap(x, y int) { i[x], i[y] = i[y], i[x] }
+func (i Issues) Less(x, y int) bool {
+	a, b := &i[x], &i[y]
+	if a.Check != b.Check {
+		return a.Check < b.Check
+	}
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	if a.Col != b.Col {
+		return a.Col < b.Col
+	}
+	return a.Message < b.Message
+}
+
+// Error implements error. It lists the issues of each check, one per line.
+func (i Issues) Error() string {
+	var lines []string
+	check := ""
+	for n, issue := range i {
+		if n == 0 || issue.Check != check {
+			check = issue.Check
+			lines = append(lines, check+" failed:")
+		}
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Tally returns the number of issues of each severity.
+func (i Issues) Tally() map[Severity]int {
+	out := map[Severity]int{}
+	for _, issue := range i {
+		s := issue.Severity
+		if s == "" {
+			s = SeverityError
+		}
+		out[s]++
+	}
+	return out
+}
+
+// AsIssues returns the issues reported by check as err, as returned by
+// check.Run().
+//
+// The error of a check that doesn't report structured issues is returned as a
+// single Issue without File, with the text of the error as Message.
+func AsIssues(check Check, err error) Issues {
+	if err == nil {
+		return nil
+	}
+	if issues, ok := err.(Issues); ok {
+		return issues
+	}
+	return Issues{{Check: check.GetName(), Severity: SeverityError, Message: err.Error()}}
+}
+
+// FileFilter is embedded in the checks reporting issues in the Go source
+// files, to exclude some files from the ones they check with the same options
+// for all of them. The files are excluded when they are enumerated, so they
+// are not even parsed.
+type FileFilter struct {
+	// SkipTestFiles doesn't check the _test.go files.
+	SkipTestFiles bool `yaml:"skip_test_files,omitempty"`
+}
+
+// IssueFilter is embedded in the checks reporting issues, to ignore some of
+// the issues they report with the same option for all of them. The issues are
+// ignored after the check ran, so they are matched against their text as
+// printed, e.g. "foo.go:12: message".
+type IssueFilter struct {
+	// Blacklist causes the check to ignore the issues containing one of these
+	// strings.
+	Blacklist []string `yaml:"blacklist"`
+}
+
+// Private stuff.
+
+func (f *FileFilter) fileFilter() *FileFilter {
+	return f
+}
+
+// skip returns true if the file p is excluded by the filter. A nil filter
+// doesn't exclude anything.
+func (f *FileFilter) skip(p string) bool {
+	return f != nil && f.SkipTestFiles && isTestFile(p)
+}
+
+// filterIssues returns the issues whose text doesn't contain any of the
+// strings in Blacklist.
+func (f *IssueFilter) filterIssues(issues Issues) Issues {
+	out := make(Issues, 0, len(issues))
+	for _, issue := range issues {
+		ignored := false
+		line := issue.String()
+		for _, b := range f.Blacklist {
+			if strings.Contains(line, b) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			out = append(out, issue)
+		}
+	}
+	return out
+}
+
+func (s Severity) rank() int {
+	switch s {
+	case SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// reIssue matches a line formatted like a compiler error, e.g.
+// "foo.go:12:3: message" or "foo.go:12: message".
+var reIssue = regexp.MustCompile(`^(.+?\.go):(\d+):(?:(\d+):)? ?(.*)$`)
+
+// parseIssue parses a line printed by a tool like a compiler error. Returns
+// an Issue without File if the line doesn't have a position.
+func parseIssue(check, line string) Issue {
+	m := reIssue.FindStringSubmatch(line)
+	if m == nil {
+		return Issue{Check: check, Severity: SeverityError, Message: line}
+	}
+	l, _ := strconv.Atoi(m[2])
+	c, _ := strconv.Atoi(m[3])
+	return Issue{check, filepath.ToSlash(m[1]), l, c, SeverityError, m[4]}
+}
+
+// issuesError returns the issues of check as an error, sorted, or nil if there
+// is none.
+func issuesError(check string, issues Issues) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	for i := range issues {
+		issues[i].Check = check
+	}
+	sort.Sort(issues)
+	return issues
+}
+
+// fileIssue returns an Issue about file f as a whole.
+func fileIssue(f string, format string, a ...interface{}) Issue {
+	return Issue{File: filepath.ToSlash(f), Severity: SeverityError, Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestIssueString(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "foo.go:1:2: bar", (&Issue{File: "foo.go", Line: 1, Col: 2, Message: "bar"}).String())
+	ut.AssertEqual(t, "foo.go:1: bar", (&Issue{File: "foo.go", Line: 1, Message: "bar"}).String())
+	ut.AssertEqual(t, "foo.go: bar", (&Issue{File: "foo.go", Message: "bar"}).String())
+	ut.AssertEqual(t, "bar", (&Issue{Message: "bar"}).String())
+}
+
+func TestIssues(t *testing.T) {
+	t.Parallel()
+	issues := Issues{
+		{Check: "b", File: "a.go", Line: 10, Message: "x"},
+		{Check: "b", File: "a.go", Line: 9, Message: "y"},
+		{Check: "a", File: "b.go", Line: 1, Col: 2, Message: "z"},
+	}
+	sort.Sort(issues)
+	ut.AssertEqual(t, "a failed:\nb.go:1:2: z\nb failed:\na.go:9: y\na.go:10: x", issues.Error())
+	ut.AssertEqual(t, Issues(nil), AsIssues(&Build{}, nil))
+	ut.AssertEqual(t, issues, AsIssues(&Build{}, issues))
+	ut.AssertEqual(t, Issues{{Check: "build", Severity: SeverityError, Message: "foo"}}, AsIssues(&Build{}, errors.New("foo")))
+	ut.AssertEqual(t, nil, issuesError("a", nil))
+	issues[0].Severity = SeverityWarning
+	ut.AssertEqual(t, map[Severity]int{SeverityError: 2, SeverityWarning: 1}, issues.Tally())
+}
+
+func TestSeverityAtLeast(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, true, SeverityError.AtLeast(SeverityWarning))
+	ut.AssertEqual(t, true, SeverityWarning.AtLeast(SeverityWarning))
+	ut.AssertEqual(t, false, SeverityInfo.AtLeast(SeverityWarning))
+	ut.AssertEqual(t, true, Severity("").AtLeast(SeverityError))
+}
+
+func TestFileFilter(t *testing.T) {
+	t.Parallel()
+	f := &FileFilter{}
+	ut.AssertEqual(t, false, f.skip("a/foo_test.go"))
+	f.SkipTestFiles = true
+	ut.AssertEqual(t, true, f.skip("a/foo_test.go"))
+	ut.AssertEqual(t, false, f.skip("foo.go"))
+	f = nil
+	ut.AssertEqual(t, false, f.skip("a/foo_test.go"))
+}
+
+func TestParseIssue(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, Issue{"golint", "a/b.go", 12, 3, SeverityError, "exported X should have comment"}, parseIssue("golint", "a/b.go:12:3: exported X should have comment"))
+	ut.AssertEqual(t, Issue{"govet", "b.go", 4, 0, SeverityError, "unreachable code"}, parseIssue("govet", "b.go:4: unreachable code"))
+	ut.AssertEqual(t, Issue{Check: "govet", Severity: SeverityError, Message: "exit status 1"}, parseIssue("govet", "exit status 1"))
+}
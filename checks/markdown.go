@@ -0,0 +1,100 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Extraction of the Go code blocks of markdown files for check docexamples.
+
+package checks
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// codeBlock is a fenced Go code block in a markdown file.
+type codeBlock struct {
+	// path is the absolute path of the markdown file.
+	path string
+	// line is the line number of the first line of code.
+	line int
+	code string
+}
+
+// goCodeBlocks returns the code blocks of markdown content whose info string
+// is "go" or "golang".
+func goCodeBlocks(path string, content []byte) []codeBlock {
+	var out []codeBlock
+	var fence string
+	indent := 0
+	isGo := false
+	var block []string
+	start := 0
+	for i, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence == "" {
+			if len(line)-len(trimmed) > 3 || (!strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~")) {
+				continue
+			}
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+			info := strings.Fields(trimmed[len(fence):])
+			isGo = len(info) != 0 && (info[0] == "go" || info[0] == "golang")
+			indent = len(line) - len(trimmed)
+			block = nil
+			start = i + 2
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1])) == "" {
+			if isGo {
+				out = append(out, codeBlock{path, start, strings.Join(block, "\n")})
+			}
+			fence = ""
+			continue
+		}
+		// Remove the indentation of the fence from the content.
+		for j := 0; j < indent && strings.HasPrefix(line, " "); j++ {
+			line = line[1:]
+		}
+		block = append(block, line)
+	}
+	return out
+}
+
+// source returns the block as a Go source file of package main. "//line"
+// directives are used so the compiler reports the positions in the markdown
+// file.
+//
+// A block without package clause is put in package main. A block of statements,
+// optionally preceded by imports, is wrapped in func main().
+func (c *codeBlock) source() string {
+	directive := func(line int) string {
+		return fmt.Sprintf("//line %s:%d:1\n", c.path, line)
+	}
+	if f, err := parser.ParseFile(token.NewFileSet(), "", c.code, parser.PackageClauseOnly); err == nil && f.Name != nil {
+		return directive(c.line) + c.code + "\n"
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+c.code, 0); err == nil {
+		return "package main\n" + directive(c.line) + c.code + "\n"
+	}
+	// Split the leading imports from the statements.
+	lines := strings.Split(c.code, "\n")
+	n := 0
+	inImport := false
+	for ; n < len(lines); n++ {
+		t := strings.TrimSpace(lines[n])
+		if inImport {
+			inImport = t != ")"
+			continue
+		}
+		if t == "" || strings.HasPrefix(t, "//") {
+			continue
+		}
+		if !strings.HasPrefix(t, "import") {
+			break
+		}
+		inImport = strings.HasSuffix(t, "(")
+	}
+	return "package main\n" + directive(c.line) + strings.Join(lines[:n], "\n") + "\nfunc main() {\n" +
+		directive(c.line+n) + strings.Join(lines[n:], "\n") + "\n}\n"
+}
@@ -0,0 +1,31 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestGoCodeBlocks(t *testing.T) {
+	t.Parallel()
+	content := "# Title\n\n```go\nx := 1\n```\n\n```\nnot go\n```\n\n  ~~~~ golang foo\n  func A() {}\n  ```\n  ~~~~\n"
+	expected := []codeBlock{
+		{"a.md", 4, "x := 1"},
+		{"a.md", 12, "func A() {}\n```"},
+	}
+	ut.AssertEqual(t, expected, goCodeBlocks("a.md", []byte(content)))
+}
+
+func TestCodeBlockSource(t *testing.T) {
+	t.Parallel()
+	c := codeBlock{"/a.md", 3, "package foo\n\nfunc A() {}"}
+	ut.AssertEqual(t, "//line /a.md:3:1\npackage foo\n\nfunc A() {}\n", c.source())
+	c = codeBlock{"/a.md", 3, "func A() {}"}
+	ut.AssertEqual(t, "package main\n//line /a.md:3:1\nfunc A() {}\n", c.source())
+	c = codeBlock{"/a.md", 3, "import (\n\t\"fmt\"\n)\n\nfmt.Println()"}
+	ut.AssertEqual(t, "package main\n//line /a.md:3:1\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n//line /a.md:7:1\nfmt.Println()\n}\n", c.source())
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Replaceable status and summary messages.
+
+package checks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+// Keys of the status and summary messages. They are stable, so a tool parsing
+// the output or overriding the messages can rely on them.
+const (
+	MsgBelowFailOn      = "below_fail_on"
+	MsgBudgetUsed       = "budget_used"
+	MsgBuildFailed      = "build_failed"
+	MsgChecksFailed     = "checks_failed"
+	MsgCoverageAboveMax = "coverage_above_max"
+	MsgCoverageBelowMin = "coverage_below_min"
+	MsgCoveragePassed   = "coverage_passed"
+	MsgDeadlineExceeded = "deadline_exceeded"
+	MsgNotTriggered     = "not_triggered"
+	MsgTooSlow          = "too_slow"
+	MsgUntracked        = "untracked"
+	MsgWarning          = "warning"
+)
+
+// Messages are the fmt formats of the status and summary messages printed by
+// pcg and by the coverage check, per key.
+//
+// Use LoadMessages to override them, before running the checks.
+var Messages = map[string]string{
+	// The tally of the issues, then fail_on.
+	MsgBelowFailOn: "%s below fail_on: %s",
+	// The check, the seconds elapsed, max_duration and the percent of it used.
+	MsgBudgetUsed: "after check %s, %1.2fs of the %s budget is used (%d%%)",
+	// The checks skipped.
+	MsgBuildFailed: "the code doesn't build; skipped checks: %s",
+	// The seconds elapsed, then the tally of the issues.
+	MsgChecksFailed: "checks failed in %1.2fs: %s",
+	// The coverage, max_coverage then the functions coverage.
+	MsgCoverageAboveMax: "%s > %.1f%% (max)%s",
+	// The coverage, min_coverage then the functions coverage.
+	MsgCoverageBelowMin: "%s < %.1f%% (min)%s",
+	// The coverage, min_coverage then the functions coverage.
+	MsgCoveragePassed: "%s >= %.1f%%%s",
+	// The -deadline, then the checks that passed.
+	MsgDeadlineExceeded: "deadline of %s exceeded; checks that passed: %s",
+	// The checks skipped.
+	MsgNotTriggered: "skipped as not triggered: %s",
+	// The check, the seconds it took, then max_duration.
+	MsgTooSlow: "check %s took %1.2fs -> IT IS TOO SLOW (limit: %s)",
+	// The untracked files.
+	MsgUntracked: "warning: untracked Go files are not checked, did you forget to git add them?\n  %s",
+	// The warning.
+	MsgWarning: "warning: %s",
+}
+
+// Message returns the message key formatted with args.
+func Message(key string, args ...interface{}) string {
+	return fmt.Sprintf(Messages[key], args...)
+}
+
+// LoadMessages overrides Messages with the YAML map of key to format in
+// content, e.g. a file specified with pcg -messages.
+//
+// Each format must have the same verbs, in the same order, as the one it
+// replaces. Nothing is overridden on error.
+func LoadMessages(content []byte) error {
+	overrides := map[string]string{}
+	if err := yaml.Unmarshal(content, &overrides); err != nil {
+		return err
+	}
+	var keys []string
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		format, ok := Messages[key]
+		if !ok {
+			return fmt.Errorf("unknown message %q", key)
+		}
+		if expected := verbsString(format); verbsString(overrides[key]) != expected {
+			return fmt.Errorf("message %s: %q must have the verbs %q, like %q", key, overrides[key], expected, format)
+		}
+	}
+	for key, format := range overrides {
+		Messages[key] = format
+	}
+	return nil
+}
+
+// Private stuff.
+
+// verbsString returns the verbs of the printf style format, without their
+// flags, width and precision, e.g. "%s %f" for "%-10s took %1.2fs".
+func verbsString(format string) string {
+	var verbs []string
+	for _, v := range formatVerbs(format) {
+		verbs = append(verbs, "%"+string(v))
+	}
+	return strings.Join(verbs, " ")
+}
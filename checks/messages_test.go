@@ -0,0 +1,45 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestMessages(t *testing.T) {
+	// Not parallel as it modifies Messages.
+	old := map[string]string{}
+	for k, v := range Messages {
+		old[k] = v
+	}
+	defer func() {
+		Messages = old
+	}()
+	ut.AssertEqual(t, "check foo took 2.50s -> IT IS TOO SLOW (limit: 2s)", Message(MsgTooSlow, "foo", 2.5, "2s"))
+
+	err := LoadMessages([]byte("too_slow: \"SLOW %s %.1fs > %s\"\nwarning: \"W: %s\"\n"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "SLOW foo 2.5s > 2s", Message(MsgTooSlow, "foo", 2.5, "2s"))
+	ut.AssertEqual(t, "W: bar", Message(MsgWarning, "bar"))
+
+	// Nothing is overridden on error.
+	err = LoadMessages([]byte("warning: \"%s\"\nunknown: \"%s\"\n"))
+	ut.AssertEqual(t, errors.New("unknown message \"unknown\""), err)
+	ut.AssertEqual(t, "W: bar", Message(MsgWarning, "bar"))
+	err = LoadMessages([]byte("too_slow: \"%s took %s\"\n"))
+	ut.AssertEqual(t, errors.New("message too_slow: \"%s took %s\" must have the verbs \"%s %f %s\", like \"SLOW %s %.1fs > %s\""), err)
+	ut.AssertEqual(t, true, LoadMessages([]byte("- foo\n")) != nil)
+}
+
+func TestMessagesVerbs(t *testing.T) {
+	t.Parallel()
+	// The default messages are consistent with the arguments passed.
+	ut.AssertEqual(t, "%s %f %s %d", verbsString(Messages[MsgBudgetUsed]))
+	ut.AssertEqual(t, "%s %f %s", verbsString(Messages[MsgCoverageBelowMin]))
+	ut.AssertEqual(t, "", verbsString("100%% done"))
+}
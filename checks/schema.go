@@ -0,0 +1,154 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// JSON Schema of the configuration, for editor completion and validation.
+
+package checks
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Schema returns the JSON Schema of pre-commit-go.yml.
+//
+// It is derived from the Config struct and KnownChecks by reflection, with
+// the doc comments as descriptions, so it is never out of date. The unknown
+// root keys are allowed as they are ignored when loading, and can hold YAML
+// anchors. The unknown keys of a check are not, as they are likely typos.
+func Schema() ([]byte, error) {
+	s := schemaStruct(reflect.TypeOf(Config{}))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "pre-commit-go.yml"
+	delete(s, "additionalProperties")
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// Private stuff.
+
+type schemaNode map[string]interface{}
+
+var (
+	checksType   = reflect.TypeOf(Checks{})
+	modeType     = reflect.TypeOf(Mode(""))
+	modulesType  = reflect.TypeOf(Modules{})
+	scopeType    = reflect.TypeOf(InferenceScope(""))
+	severityType = reflect.TypeOf(Severity(""))
+)
+
+// schemaType returns the schema of the values of type t.
+func schemaType(t reflect.Type) schemaNode {
+	switch t {
+	case checksType:
+		return schemaChecks()
+	case modeType:
+		return schemaNode{"type": "string", "pattern": reModeName.String()}
+	case modulesType:
+		return schemaNode{"anyOf": []interface{}{
+			schemaNode{"enum": []string{AutoModules}},
+			schemaNode{"type": "array", "items": schemaNode{"type": "string"}},
+		}}
+	case scopeType:
+		var values []string
+		for _, s := range AllInferenceScopes {
+			values = append(values, string(s))
+		}
+		return schemaNode{"enum": values}
+	case severityType:
+		var values []string
+		for _, s := range AllSeverities {
+			values = append(values, string(s))
+		}
+		return schemaNode{"enum": values}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return schemaNode{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schemaNode{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schemaNode{"type": "number"}
+	case reflect.String:
+		return schemaNode{"type": "string"}
+	case reflect.Ptr:
+		// A null pointer has a meaning of its own, e.g. in Coverage.PerDir.
+		return schemaNode{"anyOf": []interface{}{schemaType(t.Elem()), schemaNode{"type": "null"}}}
+	case reflect.Slice:
+		return schemaNode{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		out := schemaNode{"type": "object", "additionalProperties": schemaType(t.Elem())}
+		if t.Key() == modeType {
+			out["propertyNames"] = schemaType(modeType)
+		}
+		return out
+	case reflect.Struct:
+		return schemaStruct(t)
+	}
+	return schemaNode{}
+}
+
+// schemaStruct returns the schema of the serialized fields of struct t, with
+// their doc comment as description.
+func schemaStruct(t reflect.Type) schemaNode {
+	properties := schemaNode{}
+	addStructProperties(properties, t)
+	out := schemaNode{"type": "object", "properties": properties, "additionalProperties": false}
+	if doc := typeDocs[t.Name()]; doc != "" {
+		out["description"] = doc
+	}
+	return out
+}
+
+// addStructProperties adds the serialized fields of struct t to properties.
+// The inline structs are flattened.
+func addStructProperties(properties schemaNode, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		key := tag[0]
+		if key == "-" {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "inline" {
+			addStructProperties(properties, f.Type)
+			continue
+		}
+		if key == "" {
+			// Same default as yaml.v2.
+			key = strings.ToLower(f.Name)
+		}
+		s := schemaType(f.Type)
+		if doc := fieldDocs[t.Name()+"."+f.Name]; doc != "" {
+			s["description"] = doc
+		}
+		properties[key] = s
+	}
+}
+
+// schemaChecks returns the schema of Checks: a list of check per check type
+// name.
+func schemaChecks() schemaNode {
+	properties := schemaNode{}
+	for name, factory := range KnownChecks {
+		c := factory()
+		item := schemaStruct(reflect.TypeOf(c).Elem())
+		item["properties"].(schemaNode)[WhenKey] = schemaNode{
+			"type":        "string",
+			"pattern":     reCondition.String(),
+			"description": "Only loads the check when the environment matches, e.g. ${CI} == true.",
+		}
+		// An empty value is an empty list.
+		properties[name] = schemaNode{
+			"type":        []string{"array", "null"},
+			"description": c.GetDescription(),
+			"items":       item,
+		}
+	}
+	return schemaNode{"type": "object", "properties": properties, "additionalProperties": false}
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
+)
+
+func TestSchema(t *testing.T) {
+	t.Parallel()
+	data, err := Schema()
+	ut.AssertEqual(t, nil, err)
+	var schema map[string]interface{}
+	ut.AssertEqual(t, nil, json.Unmarshal(data, &schema))
+	properties := schema["properties"].(map[string]interface{})
+
+	// Every root key of the config is described.
+	config, err := yaml.Marshal(New("0.1"))
+	ut.AssertEqual(t, nil, err)
+	var keys map[string]interface{}
+	ut.AssertEqual(t, nil, yaml.Unmarshal(config, &keys))
+	for key := range keys {
+		if _, ok := properties[key]; !ok {
+			t.Errorf("root key %s is missing", key)
+		}
+	}
+	_, ok := schema["additionalProperties"]
+	ut.AssertEqual(t, false, ok)
+
+	// Every known check is described, with its options.
+	modes := properties["modes"].(map[string]interface{})
+	settings := modes["additionalProperties"].(map[string]interface{})["properties"].(map[string]interface{})
+	ut.AssertEqual(t, "integer", settings["max_duration"].(map[string]interface{})["type"])
+	checks := settings["checks"].(map[string]interface{})["properties"].(map[string]interface{})
+	ut.AssertEqual(t, len(KnownChecks), len(checks))
+	coverage := checks["coverage"].(map[string]interface{})["items"].(map[string]interface{})
+	ut.AssertEqual(t, false, coverage["additionalProperties"])
+	coverageProperties := coverage["properties"].(map[string]interface{})
+	ut.AssertEqual(t, []interface{}{"package", "module", "global"}, coverageProperties["inference_scope"].(map[string]interface{})["enum"])
+	ut.AssertEqual(t, "string", coverageProperties["when"].(map[string]interface{})["type"])
+	ut.AssertEqual(t, fieldDocs["Coverage.UseCoveralls"], coverageProperties["use_coveralls"].(map[string]interface{})["description"])
+}
@@ -0,0 +1,4354 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Checks that parse the Go source files in-process. They share the parsing
+// logic so they are in their own file.
+
+package checks
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/maruel/pre-commit-go/scm"
+)
+
+// TestingImport enforces that non-test files do not import package testing.
+//
+// Importing testing from non-test code registers its flags and bloats the
+// binaries. A helper package meant to be imported by tests can be ignored by
+// adding its directory to Blacklist.
+type TestingImport struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TestingImport) GetDescription() string {
+	return "enforces non-test .go sources do not import package testing"
+}
+
+// GetName implements Check.
+func (t *TestingImport) GetName() string {
+	return "testingimport"
+}
+
+// GetPrerequisites implements Check.
+func (t *TestingImport) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TestingImport) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ImportsOnly, &t.FileFilter, isNotTestFile) {
+		for _, imp := range s.file.Imports {
+			p, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			for _, forbidden := range testingPackages {
+				if p == forbidden {
+					issues = append(issues, s.issue(imp.Pos(), "imports %s from non-test code", p))
+				}
+			}
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// ErrorWrap enforces that errors are wrapped with %w when formatted with
+// fmt.Errorf.
+//
+// Errors are detected by name since the check doesn't do type analysis, e.g.
+// "err", "err2" or "readErr".
+type ErrorWrap struct {
+	// RequireContext also flags errors returned as-is, e.g. "return err",
+	// instead of being wrapped with context.
+	RequireContext bool `yaml:"require_context"`
+	IssueFilter    `yaml:",inline"`
+	FileFilter     `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (e *ErrorWrap) GetDescription() string {
+	return "enforces errors are wrapped with %w in fmt.Errorf"
+}
+
+// GetName implements Check.
+func (e *ErrorWrap) GetName() string {
+	return "errorwrap"
+}
+
+// GetPrerequisites implements Check.
+func (e *ErrorWrap) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *ErrorWrap) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, 0, &e.FileFilter, nil) {
+		fmtName := importName(s.file, "fmt")
+		ast.Inspect(s.file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				if fmtName == "" || !isPkgCall(n, fmtName, "Errorf") || len(n.Args) < 2 {
+					return true
+				}
+				lit, ok := n.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+				format, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					return true
+				}
+				verbs := formatVerbs(format)
+				for i, arg := range n.Args[1:] {
+					if i >= len(verbs) {
+						break
+					}
+					if name := errorExprName(arg); name != "" && verbs[i] != 'w' {
+						issues = append(issues, s.issue(arg.Pos(), "fmt.Errorf formats error %s with %%%c, use %%w to wrap it", name, verbs[i]))
+					}
+				}
+			case *ast.ReturnStmt:
+				if !e.RequireContext || len(n.Results) == 0 {
+					return true
+				}
+				last := n.Results[len(n.Results)-1]
+				if name := errorExprName(last); name != "" {
+					if _, ok := last.(*ast.Ident); ok {
+						issues = append(issues, s.issue(last.Pos(), "error %s is returned without context, wrap it with fmt.Errorf(\"...: %%w\", %s)", name, name))
+					}
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// ErrorComparison enforces that errors are compared with errors.Is and
+// errors.As, so the comparisons still work when the errors are wrapped.
+//
+// It flags the == and != comparisons and the switch cases against a sentinel
+// error, except in Is methods, the type assertions of an error, and the error
+// types with a field of type error but no Unwrap method. Sentinel errors are recognized by name,
+// e.g. "ErrNotFound", "errClosed" or "io.ErrUnexpectedEOF", since the check
+// doesn't do type analysis. Generated files are ignored.
+type ErrorComparison struct {
+	// Sentinels are the other sentinel errors, as referenced, e.g. "io.EOF".
+	Sentinels   []string `yaml:"sentinels"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (e *ErrorComparison) GetDescription() string {
+	return "enforces errors are compared with errors.Is and errors.As"
+}
+
+// GetName implements Check.
+func (e *ErrorComparison) GetName() string {
+	return "errorcomparison"
+}
+
+// GetPrerequisites implements Check.
+func (e *ErrorComparison) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *ErrorComparison) Run(change scm.Change, options *Options) error {
+	sentinels := map[string]bool{}
+	for _, n := range e.Sentinels {
+		sentinels[n] = true
+	}
+	// sentinel returns the name of the sentinel error x, or "".
+	sentinel := func(s *sourceFile, x ast.Expr) string {
+		name := ""
+		switch x := x.(type) {
+		case *ast.Ident:
+			name = x.Name
+		case *ast.SelectorExpr:
+			name = x.Sel.Name
+		default:
+			return ""
+		}
+		if str := s.nodeString(x); sentinels[str] || reSentinelError.MatchString(name) {
+			return str
+		}
+		return ""
+	}
+	var files []*sourceFile
+	for _, s := range parseGoFiles(change, parser.ParseComments, &e.FileFilter, nil) {
+		if !isGenerated(s.file) {
+			files = append(files, s)
+		}
+	}
+	// Types with an Unwrap method, per directory.
+	unwrap := map[string]map[string]bool{}
+	for _, s := range files {
+		dir := path.Dir(filepath.ToSlash(s.name))
+		if unwrap[dir] == nil {
+			unwrap[dir] = map[string]bool{}
+		}
+		for _, decl := range s.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil && len(fn.Recv.List) == 1 && fn.Name.Name == "Unwrap" {
+				unwrap[dir][receiverType(fn)] = true
+			}
+		}
+	}
+	var issues Issues
+	for _, s := range files {
+		dir := path.Dir(filepath.ToSlash(s.name))
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Name.Name != "Error" || !isErrorMethod(fn) {
+				continue
+			}
+			name := receiverType(fn)
+			if field := errorField(s.file, name); field != "" && !unwrap[dir][name] {
+				issues = append(issues, s.issue(fn.Name.Pos(), "%s wraps an error in field %s but has no Unwrap method; errors.Is and errors.As can't see it", name, field))
+			}
+		}
+		ast.Inspect(s.file, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.FuncDecl:
+				// An Is method is what errors.Is calls.
+				return node.Recv == nil || node.Name.Name != "Is"
+			case *ast.BinaryExpr:
+				if node.Op != token.EQL && node.Op != token.NEQ {
+					break
+				}
+				x, y := node.X, node.Y
+				if sentinel(s, x) != "" {
+					x, y = y, x
+				}
+				if name := sentinel(s, y); name != "" {
+					not := ""
+					if node.Op == token.NEQ {
+						not = "!"
+					}
+					issues = append(issues, s.issue(node.Pos(), "%s fails on wrapped errors; use %serrors.Is(%s, %s)", s.nodeString(node), not, s.nodeString(x), name))
+				}
+			case *ast.SwitchStmt:
+				if node.Tag == nil || errorExprName(node.Tag) == "" {
+					break
+				}
+				for _, stmt := range node.Body.List {
+					for _, c := range stmt.(*ast.CaseClause).List {
+						if name := sentinel(s, c); name != "" {
+							issues = append(issues, s.issue(c.Pos(), "case %s fails on wrapped errors; use errors.Is(%s, %s)", name, s.nodeString(node.Tag), name))
+						}
+					}
+				}
+			case *ast.TypeAssertExpr:
+				if node.Type != nil && errorExprName(node.X) != "" {
+					issues = append(issues, s.issue(node.Pos(), "%s fails on wrapped errors; use errors.As", s.nodeString(node)))
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// TestNaming enforces that test, benchmark and example functions follow the
+// naming and signature conventions of go test.
+//
+// Functions that do not follow them are silently not run by go test.
+type TestNaming struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TestNaming) GetDescription() string {
+	return "enforces test functions follow the go test naming conventions"
+}
+
+// GetName implements Check.
+func (t *TestNaming) GetName() string {
+	return "testnaming"
+}
+
+// GetPrerequisites implements Check.
+func (t *TestNaming) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TestNaming) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, 0, &t.FileFilter, isTestFile) {
+		testing := importName(s.file, "testing")
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			name := fn.Name.Name
+			pos := fn.Name.Pos()
+			for _, k := range testKinds {
+				if name == "TestMain" && hasTestSignature(fn, testing, "M") {
+					continue
+				}
+				if isTestName(name, k.prefix) {
+					if !hasTestSignature(fn, testing, k.param) {
+						issues = append(issues, s.issue(pos, "%s has signature %s, expected func(*testing.%s)", name, s.nodeString(fn.Type), k.param))
+					}
+				} else if strings.HasPrefix(strings.ToLower(name), strings.ToLower(k.prefix)) && hasTestSignature(fn, testing, k.param) {
+					issues = append(issues, s.issue(pos, "%s won't be run, it must be named %sXxx", name, k.prefix))
+				}
+			}
+			if isTestName(name, "Example") && (fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != 0) {
+				issues = append(issues, s.issue(pos, "%s has signature %s, expected func()", name, s.nodeString(fn.Type)))
+			}
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// BuildConstraints enforces that the build constraints are valid and
+// consistent.
+//
+// Malformed or misplaced constraints are silently ignored by the go tool, and
+// contradictory ones silently exclude the file from every build.
+type BuildConstraints struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (b *BuildConstraints) GetDescription() string {
+	return "enforces build constraints are valid and consistent"
+}
+
+// GetName implements Check.
+func (b *BuildConstraints) GetName() string {
+	return "buildconstraints"
+}
+
+// GetPrerequisites implements Check.
+func (b *BuildConstraints) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (b *BuildConstraints) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &b.FileFilter, nil) {
+		for _, issue := range checkConstraints(s.name, change.Content(s.name)) {
+			issues = append(issues, Issue{File: filepath.ToSlash(s.name), Line: issue.line, Severity: SeverityError, Message: issue.msg})
+		}
+		// Constraints after the package clause are ignored.
+		for _, group := range s.file.Comments {
+			if group.Pos() < s.file.Package {
+				continue
+			}
+			for _, c := range group.List {
+				if t := strings.TrimSpace(strings.TrimPrefix(c.Text, "//")); strings.HasPrefix(c.Text, "//") && (strings.HasPrefix(t, "+build") || strings.HasPrefix(t, "go:build")) {
+					issues = append(issues, Issue{File: filepath.ToSlash(s.name), Line: s.fset.Position(c.Pos()).Line, Severity: SeverityError, Message: "build constraint after the package clause is ignored"})
+				}
+			}
+		}
+	}
+	return issuesError(b.GetName(), b.filterIssues(issues))
+}
+
+// Embed enforces that the //go:embed directives reference existing files.
+//
+// An invalid directive only fails the build of its package, which may not be
+// built when only some packages are checked. All the directives of the
+// repository are verified against the files tracked by the repository, so
+// deleting an embedded file is caught too.
+type Embed struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (e *Embed) GetDescription() string {
+	return "enforces //go:embed directives match existing files"
+}
+
+// GetName implements Check.
+func (e *Embed) GetName() string {
+	return "embed"
+}
+
+// GetPrerequisites implements Check.
+func (e *Embed) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *Embed) Run(change scm.Change, options *Options) error {
+	var files []string
+	for _, f := range change.All().Files() {
+		files = append(files, filepath.ToSlash(f))
+	}
+	var issues Issues
+	for _, f := range change.All().GoFiles() {
+		content := change.Content(f)
+		if change.IsIgnored(f) || e.skip(f) || !bytes.Contains(content, []byte("//go:embed")) {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, f, content, parser.ParseComments)
+		if err != nil {
+			continue
+		}
+		s := &sourceFile{f, fset, file}
+		dir := path.Dir(filepath.ToSlash(f))
+		for _, group := range file.Comments {
+			for _, c := range group.List {
+				if !strings.HasPrefix(c.Text, "//go:embed ") && !strings.HasPrefix(c.Text, "//go:embed\t") {
+					continue
+				}
+				patterns, err := parseEmbedPatterns(c.Text[len("//go:embed"):])
+				if err != nil {
+					issues = append(issues, s.issue(c.Pos(), "invalid //go:embed directive: %s", err))
+					continue
+				}
+				for _, p := range patterns {
+					if ok, err := embedMatches(p, dir, files); err != nil {
+						issues = append(issues, s.issue(c.Pos(), "//go:embed %s: %s", p, err))
+					} else if !ok {
+						issues = append(issues, s.issue(c.Pos(), "//go:embed %s matches no file", p))
+					}
+				}
+			}
+		}
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// GoroutineSafety enforces that the goroutines recover from panics.
+//
+// A panic in a goroutine without recovery crashes the whole process. A go
+// statement is accepted when the function launched defers a function calling
+// recover() or one of SafeLaunchers. Only the functions declared in the
+// modified files of the package are known. Generated files are ignored.
+type GoroutineSafety struct {
+	// SafeLaunchers are the functions that are safe to launch as a goroutine
+	// or to defer as they recover, as called, e.g. "safe.Go" or
+	// "logPanic".
+	SafeLaunchers []string `yaml:"safe_launchers"`
+	IssueFilter   `yaml:",inline"`
+	FileFilter    `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (g *GoroutineSafety) GetDescription() string {
+	return "enforces goroutines recover from panics"
+}
+
+// GetName implements Check.
+func (g *GoroutineSafety) GetName() string {
+	return "goroutinesafety"
+}
+
+// GetPrerequisites implements Check.
+func (g *GoroutineSafety) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (g *GoroutineSafety) Run(change scm.Change, options *Options) error {
+	var files []*sourceFile
+	for _, s := range parseGoFiles(change, parser.ParseComments, &g.FileFilter, nil) {
+		if !isGenerated(s.file) {
+			files = append(files, s)
+		}
+	}
+	safe := map[string]bool{}
+	for _, l := range g.SafeLaunchers {
+		safe[l] = true
+	}
+	// Functions, per directory.
+	funcs := map[string]map[string]*ast.FuncDecl{}
+	for _, s := range files {
+		dir := path.Dir(filepath.ToSlash(s.name))
+		if funcs[dir] == nil {
+			funcs[dir] = map[string]*ast.FuncDecl{}
+		}
+		for _, decl := range s.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Body != nil {
+				funcs[dir][fn.Name.Name] = fn
+			}
+		}
+	}
+	var issues Issues
+	for _, s := range files {
+		local := funcs[path.Dir(filepath.ToSlash(s.name))]
+		// recovers returns true if body defers a function recovering.
+		recovers := func(body *ast.BlockStmt) bool {
+			for _, stmt := range body.List {
+				d, ok := stmt.(*ast.DeferStmt)
+				if !ok {
+					continue
+				}
+				switch fun := d.Call.Fun.(type) {
+				case *ast.FuncLit:
+					if callsRecover(fun.Body) {
+						return true
+					}
+				case *ast.Ident:
+					if fn := local[fun.Name]; fn != nil && callsRecover(fn.Body) {
+						return true
+					}
+				}
+				if safe[s.nodeString(d.Call.Fun)] {
+					return true
+				}
+			}
+			return false
+		}
+		ast.Inspect(s.file, func(node ast.Node) bool {
+			stmt, ok := node.(*ast.GoStmt)
+			if !ok {
+				return true
+			}
+			name := "func literal"
+			switch fun := stmt.Call.Fun.(type) {
+			case *ast.FuncLit:
+				if recovers(fun.Body) {
+					return true
+				}
+			case *ast.Ident:
+				if fn := local[fun.Name]; fn != nil && recovers(fn.Body) {
+					return true
+				}
+				name = fun.Name
+			default:
+				name = s.nodeString(fun)
+			}
+			if safe[name] {
+				return true
+			}
+			issues = append(issues, s.issue(stmt.Pos(), "goroutine %s doesn't recover from panics; defer a recover() or use a safe launcher", name))
+			return true
+		})
+	}
+	return issuesError(g.GetName(), g.filterIssues(issues))
+}
+
+// MagicNumbers flags the unnamed numeric literals in the functions, which are
+// better declared as named constants documenting their unit and meaning.
+//
+// 0, 1 and -1 are always allowed. The literals of the constant declarations
+// and the array lengths are ignored, as are the package level declarations as
+// they already name their value. Generated files are ignored.
+type MagicNumbers struct {
+	// Allow are the other numbers allowed, e.g. 2 or 100.
+	Allow       []float64 `yaml:"allow"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (m *MagicNumbers) GetDescription() string {
+	return "flags unnamed numeric literals that should be named constants"
+}
+
+// GetName implements Check.
+func (m *MagicNumbers) GetName() string {
+	return "magicnumbers"
+}
+
+// GetPrerequisites implements Check.
+func (m *MagicNumbers) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (m *MagicNumbers) Run(change scm.Change, options *Options) error {
+	allowed := map[float64]bool{0: true, 1: true, -1: true}
+	for _, a := range m.Allow {
+		allowed[a] = true
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &m.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		check := func(lit *ast.BasicLit, sign string) {
+			if lit.Kind != token.INT && lit.Kind != token.FLOAT && lit.Kind != token.IMAG {
+				return
+			}
+			v, ok := constant.Float64Val(constant.ToFloat(constant.MakeFromLiteral(sign+lit.Value, lit.Kind, 0)))
+			if !ok || !allowed[v] {
+				issues = append(issues, s.issue(lit.Pos(), "magic number %s%s; use a named constant", sign, lit.Value))
+			}
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.GenDecl:
+					return node.Tok != token.CONST
+				case *ast.ArrayType:
+					return false
+				case *ast.UnaryExpr:
+					if lit, ok := node.X.(*ast.BasicLit); ok && node.Op == token.SUB {
+						check(lit, "-")
+						return false
+					}
+				case *ast.BasicLit:
+					check(node, "")
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(m.GetName(), m.filterIssues(issues))
+}
+
+// MustCheck enforces that the errors returned by specific risky functions are
+// always handled: not discarded, not assigned to "_" and not deferred.
+//
+// The check doesn't do type analysis. A method of a type, e.g.
+// "(*os.File).Close", is recognized when called on a variable declared with
+// this type or assigned from a function of the type's package, e.g.
+// "f, err := os.Open(p)".
+type MustCheck struct {
+	// Functions are the functions whose error must be handled, one of:
+	// "os.Remove" for a function of an imported package, by its name or its
+	// import path; "(*os.File).Close" for a method of a type; "tx.Rollback"
+	// for a method called on a variable named "tx".
+	Functions   []string `yaml:"functions"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (m *MustCheck) GetDescription() string {
+	return "enforces the errors of the listed functions are handled"
+}
+
+// GetName implements Check.
+func (m *MustCheck) GetName() string {
+	return "mustcheck"
+}
+
+// GetPrerequisites implements Check.
+func (m *MustCheck) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (m *MustCheck) Run(change scm.Change, options *Options) error {
+	if len(m.Functions) == 0 {
+		return nil
+	}
+	var patterns []mustCheckPattern
+	for _, f := range m.Functions {
+		p, err := parseMustCheckPattern(f)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, p)
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, 0, &m.FileFilter, nil) {
+		imports := importPaths(s.file)
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			vars := varTypes(fn, imports)
+			report := func(call *ast.CallExpr, how string) {
+				if p := matchMustCheck(patterns, call, imports, vars); p != "" {
+					issues = append(issues, s.issue(call.Pos(), "error of %s (%s) is %s", s.nodeString(call.Fun), p, how))
+				}
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.ExprStmt:
+					if call, ok := node.X.(*ast.CallExpr); ok {
+						report(call, "not checked")
+					}
+				case *ast.DeferStmt:
+					report(node.Call, "discarded by defer")
+				case *ast.GoStmt:
+					report(node.Call, "discarded by go")
+				case *ast.AssignStmt:
+					if len(node.Rhs) != 1 {
+						break
+					}
+					if id, ok := node.Lhs[len(node.Lhs)-1].(*ast.Ident); ok && id.Name == "_" {
+						if call, ok := node.Rhs[0].(*ast.CallExpr); ok {
+							report(call, "assigned to _")
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(m.GetName(), m.filterIssues(issues))
+}
+
+// NilInterface flags the functions returning a concrete pointer as an error.
+//
+// A nil pointer stored in an interface is not a nil interface, so the caller
+// sees a non-nil error. The check doesn't do type analysis so it only
+// recognizes the pointers declared locally, e.g. "var err *MyError", and the
+// calls to the functions of the same package returning a pointer, including
+// the ones declared in files that were not modified.
+type NilInterface struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (n *NilInterface) GetDescription() string {
+	return "flags concrete pointers returned as error"
+}
+
+// GetName implements Check.
+func (n *NilInterface) GetName() string {
+	return "nilinterface"
+}
+
+// GetPrerequisites implements Check.
+func (n *NilInterface) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (n *NilInterface) Run(change scm.Change, options *Options) error {
+	files := parseGoFiles(change, 0, &n.FileFilter, nil)
+	// Only the modified files are checked but the functions of all the files
+	// of their package are needed.
+	parsed := map[string]*sourceFile{}
+	for _, s := range files {
+		parsed[s.name] = s
+	}
+	// Functions returning only a pointer, per directory.
+	ptrFuncs := map[string]map[string]string{}
+	for _, s := range files {
+		ptrFuncs[path.Dir(filepath.ToSlash(s.name))] = map[string]string{}
+	}
+	for _, f := range change.All().GoFiles() {
+		dir := path.Dir(filepath.ToSlash(f))
+		if ptrFuncs[dir] == nil || change.IsIgnored(f) {
+			continue
+		}
+		s := parsed[f]
+		if s == nil {
+			content := change.Content(f)
+			if content == nil {
+				continue
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, f, content, 0)
+			if err != nil {
+				log.Printf("failed to parse %s: %s", f, err)
+				continue
+			}
+			s = &sourceFile{f, fset, file}
+		}
+		for _, decl := range s.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Type.Results.NumFields() == 1 {
+				if star, ok := fn.Type.Results.List[0].Type.(*ast.StarExpr); ok {
+					ptrFuncs[dir][fn.Name.Name] = s.nodeString(star)
+				}
+			}
+		}
+	}
+	var issues Issues
+	for _, s := range files {
+		funcs := ptrFuncs[path.Dir(filepath.ToSlash(s.name))]
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			errIndexes := errorResults(fn.Type)
+			if len(errIndexes) == 0 {
+				continue
+			}
+			ptrVars := pointerVars(s, fn.Body, funcs)
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.FuncLit:
+					// Its return statements are not the ones of fn.
+					return false
+				case *ast.ReturnStmt:
+					for _, i := range errIndexes {
+						if i >= len(node.Results) {
+							break
+						}
+						typ := ""
+						switch r := node.Results[i].(type) {
+						case *ast.Ident:
+							typ = ptrVars[r.Name]
+						case *ast.CallExpr:
+							if id, ok := r.Fun.(*ast.Ident); ok {
+								typ = funcs[id.Name]
+							}
+						}
+						if typ != "" {
+							issues = append(issues, s.issue(node.Results[i].Pos(), "%s is returned as error; a nil %s is a non-nil error", typ, typ))
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(n.GetName(), n.filterIssues(issues))
+}
+
+// SignatureLimits enforces a maximum number of parameters and results for
+// the functions and methods.
+//
+// A long signature is hard to call correctly; the arguments are better
+// grouped in a struct. Generated files are ignored.
+type SignatureLimits struct {
+	// MaxParams is the maximum number of parameters, including the variadic
+	// one but not the receiver. If 0, it is not enforced.
+	MaxParams int `yaml:"max_params"`
+	// MaxResults is the maximum number of results. If 0, it is not enforced.
+	MaxResults  int `yaml:"max_results"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (s *SignatureLimits) GetDescription() string {
+	return "enforces a maximum number of function parameters and results"
+}
+
+// GetName implements Check.
+func (s *SignatureLimits) GetName() string {
+	return "signaturelimits"
+}
+
+// GetPrerequisites implements Check.
+func (s *SignatureLimits) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (s *SignatureLimits) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, f := range parseGoFiles(change, parser.ParseComments, &s.FileFilter, nil) {
+		if isGenerated(f.file) {
+			continue
+		}
+		for _, decl := range f.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if n := fn.Type.Params.NumFields(); s.MaxParams > 0 && n > s.MaxParams {
+				issues = append(issues, f.issue(fn.Name.Pos(), "%s has %d parameters, max is %d; group them in a struct", funcSignature(f, fn), n, s.MaxParams))
+			}
+			if n := fn.Type.Results.NumFields(); s.MaxResults > 0 && n > s.MaxResults {
+				issues = append(issues, f.issue(fn.Name.Pos(), "%s has %d results, max is %d; group them in a struct", funcSignature(f, fn), n, s.MaxResults))
+			}
+		}
+	}
+	return issuesError(s.GetName(), s.filterIssues(issues))
+}
+
+// ErrorNaming enforces the naming conventions of the exported errors: the
+// sentinel errors are variables named ErrXxx and the error types are named
+// XxxError.
+//
+// Sentinel errors are recognized as the package level variables of type error
+// or initialized with errors.New() or fmt.Errorf(). Error types are the types
+// with an Error() string method. Test and generated files are ignored. The
+// legacy names kept for compatibility can be added to Blacklist.
+type ErrorNaming struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (e *ErrorNaming) GetDescription() string {
+	return "enforces exported errors are named ErrXxx and error types XxxError"
+}
+
+// GetName implements Check.
+func (e *ErrorNaming) GetName() string {
+	return "errornaming"
+}
+
+// GetPrerequisites implements Check.
+func (e *ErrorNaming) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *ErrorNaming) Run(change scm.Change, options *Options) error {
+	var files []*sourceFile
+	for _, s := range parseGoFiles(change, parser.ParseComments, &e.FileFilter, isNotTestFile) {
+		if !isGenerated(s.file) {
+			files = append(files, s)
+		}
+	}
+	// Types with an Error() string method, per directory.
+	errorTypes := map[string]map[string]bool{}
+	for _, s := range files {
+		dir := path.Dir(filepath.ToSlash(s.name))
+		if errorTypes[dir] == nil {
+			errorTypes[dir] = map[string]bool{}
+		}
+		for _, decl := range s.file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Error" && isErrorMethod(fn) {
+				errorTypes[dir][receiverType(fn)] = true
+			}
+		}
+	}
+	var issues Issues
+	for _, s := range files {
+		types := errorTypes[path.Dir(filepath.ToSlash(s.name))]
+		errorsName := importName(s.file, "errors")
+		fmtName := importName(s.file, "fmt")
+		for _, decl := range s.file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					name := spec.Name.Name
+					if ast.IsExported(name) && types[name] && !strings.HasSuffix(name, "Error") {
+						issues = append(issues, s.issue(spec.Name.Pos(), "error type %s must be named %sError", name, strings.TrimSuffix(name, "Err")))
+					}
+				case *ast.ValueSpec:
+					if gen.Tok != token.VAR {
+						continue
+					}
+					for i, id := range spec.Names {
+						name := id.Name
+						if !ast.IsExported(name) || isTestName(name, "Err") {
+							continue
+						}
+						isError := false
+						if t, ok := spec.Type.(*ast.Ident); ok && t.Name == "error" {
+							isError = true
+						} else if i < len(spec.Values) {
+							if call, ok := spec.Values[i].(*ast.CallExpr); ok {
+								isError = (errorsName != "" && isPkgCall(call, errorsName, "New")) || (fmtName != "" && isPkgCall(call, fmtName, "Errorf"))
+							}
+						}
+						if isError {
+							issues = append(issues, s.issue(id.Pos(), "error variable %s must be named Err%s", name, strings.TrimPrefix(strings.TrimSuffix(name, "Error"), "Error")))
+						}
+					}
+				}
+			}
+		}
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// ErrorDocs flags the exported functions returning an error whose doc comment
+// doesn't describe the error conditions.
+//
+// It is a heuristic: the doc comment must match RequirePattern, by default a
+// mention of an error, a failure or what is returned. The methods of the
+// unexported types, test and generated files are ignored. The methods of well
+// known interfaces, e.g. "Close", are usually added to Blacklist.
+type ErrorDocs struct {
+	// RequirePattern is the regular expression the doc comment must match. If
+	// empty, DefaultErrorDocsPattern is used.
+	RequirePattern string `yaml:"require_pattern"`
+	IssueFilter    `yaml:",inline"`
+	FileFilter     `yaml:",inline"`
+}
+
+// DefaultErrorDocsPattern is the default ErrorDocs.RequirePattern.
+const DefaultErrorDocsPattern = `(?i)\b(errors?|fail(s|ed|ure)?|returns?)\b`
+
+// GetDescription implements Check.
+func (e *ErrorDocs) GetDescription() string {
+	return "flags exported functions returning an error without documenting when"
+}
+
+// GetName implements Check.
+func (e *ErrorDocs) GetName() string {
+	return "errordocs"
+}
+
+// GetPrerequisites implements Check.
+func (e *ErrorDocs) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *ErrorDocs) Run(change scm.Change, options *Options) error {
+	pattern := e.RequirePattern
+	if pattern == "" {
+		pattern = DefaultErrorDocsPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid require_pattern %q: %s", pattern, err)
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &e.FileFilter, isNotTestFile) {
+		if isGenerated(s.file) {
+			continue
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || !fn.Name.IsExported() || len(errorResults(fn.Type)) == 0 {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				recv := receiverType(fn)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				name = recv + "." + name
+			}
+			if fn.Doc == nil {
+				issues = append(issues, s.issue(fn.Name.Pos(), "%s returns an error but has no doc comment", name))
+			} else if !re.MatchString(fn.Doc.Text()) {
+				issues = append(issues, s.issue(fn.Name.Pos(), "%s returns an error but its doc comment doesn't describe when", name))
+			}
+		}
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// Subtests enforces that the table-driven tests run each case as a subtest
+// with t.Run().
+//
+// A failure in a named subtest reports the case that failed, and a single
+// case can be run with -run. A table-driven test is recognized as a for range
+// loop, over a slice or map literal or a variable initialized with one, that
+// reports failures with t.Error(), t.Fatal() and the likes, or by passing t to
+// a helper, without calling t.Run().
+type Subtests struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (s *Subtests) GetDescription() string {
+	return "enforces table-driven tests use t.Run subtests"
+}
+
+// GetName implements Check.
+func (s *Subtests) GetName() string {
+	return "subtests"
+}
+
+// GetPrerequisites implements Check.
+func (s *Subtests) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (s *Subtests) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, f := range parseGoFiles(change, 0, &s.FileFilter, isTestFile) {
+		testing := importName(f.file, "testing")
+		// Variables initialized with a composite literal.
+		tables := map[string]bool{}
+		addTables := func(node ast.Node) {
+			switch node := node.(type) {
+			case *ast.ValueSpec:
+				for i, v := range node.Values {
+					if _, ok := v.(*ast.CompositeLit); ok && i < len(node.Names) {
+						tables[node.Names[i].Name] = true
+					}
+				}
+			case *ast.AssignStmt:
+				for i, v := range node.Rhs {
+					if id, ok := node.Lhs[i].(*ast.Ident); ok && len(node.Lhs) == len(node.Rhs) {
+						_, ok := v.(*ast.CompositeLit)
+						tables[id.Name] = ok
+					}
+				}
+			}
+		}
+		for _, decl := range f.file.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+				for _, spec := range gen.Specs {
+					addTables(spec)
+				}
+			}
+		}
+		for _, decl := range f.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || fn.Recv != nil || !isTestName(fn.Name.Name, "Test") || !hasTestSignature(fn, testing, "T") {
+				continue
+			}
+			names := fn.Type.Params.List[0].Names
+			if len(names) == 0 || names[0].Name == "_" {
+				continue
+			}
+			t := names[0].Name
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				addTables(node)
+				loop, ok := node.(*ast.RangeStmt)
+				if !ok {
+					return true
+				}
+				switch x := loop.X.(type) {
+				case *ast.CompositeLit:
+				case *ast.Ident:
+					if !tables[x.Name] {
+						return true
+					}
+				default:
+					return true
+				}
+				if reports, subtest := testReports(loop.Body, t); reports && !subtest {
+					issues = append(issues, f.issue(loop.Pos(), "%s iterates over test cases without t.Run(); run each case as a named subtest", fn.Name.Name))
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(s.GetName(), s.filterIssues(issues))
+}
+
+// TestMainUsage enforces that the TestMain functions have the signature
+// func(*testing.M), call m.Run() and parse the flags before using them.
+//
+// A TestMain that doesn't call m.Run() silently runs no test at all, so the
+// package appears to pass.
+type TestMainUsage struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TestMainUsage) GetDescription() string {
+	return "enforces TestMain functions call m.Run()"
+}
+
+// GetName implements Check.
+func (t *TestMainUsage) GetName() string {
+	return "testmain"
+}
+
+// GetPrerequisites implements Check.
+func (t *TestMainUsage) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TestMainUsage) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, 0, &t.FileFilter, isTestFile) {
+		testing := importName(s.file, "testing")
+		flag := importName(s.file, "flag")
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Name.Name != "TestMain" || fn.Body == nil {
+				continue
+			}
+			if !hasTestSignature(fn, testing, "M") {
+				issues = append(issues, s.issue(fn.Name.Pos(), "TestMain has signature %s, expected func(*testing.M)", s.nodeString(fn.Type)))
+				continue
+			}
+			m := ""
+			if names := fn.Type.Params.List[0].Names; len(names) == 1 && names[0].Name != "_" {
+				m = names[0].Name
+			}
+			// The position of the first call to m.Run(), flag.Parse() and to a
+			// function reading the flags.
+			var run, parse, used token.Pos
+			var usedName string
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				switch {
+				case m != "" && isPkgCall(call, m, "Run") && len(call.Args) == 0:
+					if run == token.NoPos {
+						run = call.Pos()
+					}
+				case flag != "" && isPkgCall(call, flag, "Parse"):
+					if parse == token.NoPos {
+						parse = call.Pos()
+					}
+				default:
+					if used != token.NoPos {
+						break
+					}
+					for _, f := range flagReaders {
+						if pkg := importName(s.file, f.pkg); pkg != "" && isPkgCall(call, pkg, f.name) {
+							used = call.Pos()
+							usedName = f.pkg + "." + f.name
+							break
+						}
+					}
+				}
+				return true
+			})
+			if run == token.NoPos {
+				issues = append(issues, s.issue(fn.Name.Pos(), "TestMain doesn't call m.Run(), no test is run"))
+			}
+			if used != token.NoPos && (run == token.NoPos || used < run) && (parse == token.NoPos || parse > used) {
+				issues = append(issues, s.issue(used, "%s() is called before flag.Parse()", usedName))
+			}
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// PublicSurface enforces a maximum number of exported symbols per package.
+//
+// A package exporting too many types, functions, variables and constants is
+// likely doing too much and is a candidate to be split. Methods and struct
+// fields are not counted. Only the modified packages are checked, main
+// packages are ignored.
+type PublicSurface struct {
+	// MaxExported is the maximum number of exported symbols of a package,
+	// unless overridden in PerDir. If 0, it is not enforced.
+	MaxExported int `yaml:"max_exported"`
+	// PerDir overrides MaxExported for some directories, in POSIX format
+	// relative to the repository root. A value of 0 disables the check for the
+	// directory.
+	PerDir      map[string]int `yaml:"per_dir"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (p *PublicSurface) GetDescription() string {
+	return "enforces a maximum number of exported symbols per package"
+}
+
+// GetName implements Check.
+func (p *PublicSurface) GetName() string {
+	return "publicsurface"
+}
+
+// GetPrerequisites implements Check.
+func (p *PublicSurface) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (p *PublicSurface) Run(change scm.Change, options *Options) error {
+	// Only the modified packages are checked but all their files are needed.
+	files := map[string][]string{}
+	for _, f := range change.All().GoFiles() {
+		dir := path.Dir(filepath.ToSlash(f))
+		files[dir] = append(files[dir], f)
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, f := range change.Changed().GoFiles() {
+		if dir := path.Dir(filepath.ToSlash(f)); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	var issues Issues
+	for _, dir := range dirs {
+		max := p.MaxExported
+		if v, ok := p.PerDir[dir]; ok {
+			max = v
+		}
+		if max <= 0 {
+			continue
+		}
+		var first *sourceFile
+		count := 0
+		for _, f := range files[dir] {
+			if isTestFile(f) || change.IsIgnored(f) || p.skip(f) {
+				continue
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, f, change.Content(f), 0)
+			if err != nil || file.Name.Name == "main" {
+				continue
+			}
+			count += countExported(file)
+			if first == nil || f < first.name {
+				first = &sourceFile{f, fset, file}
+			}
+		}
+		if first == nil || count <= max {
+			continue
+		}
+		pkg := "./" + dir
+		if dir == "." {
+			pkg = "."
+		}
+		issues = append(issues, first.issue(first.file.Name.Pos(), "package %s (%s) exports %d symbols, more than %d; consider splitting it", first.file.Name.Name, pkg, count, max))
+	}
+	return issuesError(p.GetName(), p.filterIssues(issues))
+}
+
+// HandlerContext flags the HTTP handlers that block without referencing the
+// context of the request.
+//
+// A handler that ignores r.Context() keeps working after the client
+// disconnected. The handlers are the functions, methods and function literals
+// with the signature (http.ResponseWriter, *http.Request), including
+// ServeHTTP methods. They block when they contain an infinite for loop, a
+// select statement, a channel receive, a call to time.Sleep or a call to one
+// of BlockingCalls. This is a heuristic since the check doesn't do type
+// analysis.
+type HandlerContext struct {
+	// BlockingCalls are the other functions that block, as called, e.g.
+	// "db.Query" or "exec.Command".
+	BlockingCalls []string `yaml:"blocking_calls"`
+	IssueFilter   `yaml:",inline"`
+	FileFilter    `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (h *HandlerContext) GetDescription() string {
+	return "flags blocking HTTP handlers ignoring the request context"
+}
+
+// GetName implements Check.
+func (h *HandlerContext) GetName() string {
+	return "handlercontext"
+}
+
+// GetPrerequisites implements Check.
+func (h *HandlerContext) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (h *HandlerContext) Run(change scm.Change, options *Options) error {
+	blocking := map[string]bool{}
+	for _, b := range h.BlockingCalls {
+		blocking[b] = true
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, 0, &h.FileFilter, nil) {
+		httpName := importName(s.file, "net/http")
+		timeName := importName(s.file, "time")
+		if httpName == "" {
+			continue
+		}
+		check := func(name string, t *ast.FuncType, body *ast.BlockStmt) {
+			req := handlerRequest(t, httpName)
+			if req == nil || body == nil {
+				return
+			}
+			var block ast.Node
+			what := ""
+			usesContext := false
+			ast.Inspect(body, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.SelectorExpr:
+					if id, ok := node.X.(*ast.Ident); ok && id.Name == req.Name && node.Sel.Name == "Context" {
+						usesContext = true
+					}
+				}
+				if block != nil {
+					return true
+				}
+				switch node := node.(type) {
+				case *ast.ForStmt:
+					if node.Cond == nil {
+						block, what = node, "infinite for loop"
+					}
+				case *ast.SelectStmt:
+					block, what = node, "select"
+				case *ast.UnaryExpr:
+					if node.Op == token.ARROW {
+						block, what = node, "channel receive"
+					}
+				case *ast.CallExpr:
+					if fun := s.nodeString(node.Fun); blocking[fun] || (timeName != "" && isPkgCall(node, timeName, "Sleep")) {
+						block, what = node, fun
+					}
+				}
+				return true
+			})
+			if block != nil && !usesContext {
+				ctx := req.Name + ".Context()"
+				if req.Name == "_" {
+					ctx = "the request context"
+				}
+				issues = append(issues, s.issue(block.Pos(), "handler %s blocks (%s) without checking %s; it keeps running after the client disconnected", name, what, ctx))
+			}
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				name = receiverType(fn) + "." + name
+			}
+			check(name, fn.Type, fn.Body)
+			if fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				if lit, ok := node.(*ast.FuncLit); ok {
+					check("func literal in "+name, lit.Type, lit.Body)
+					return false
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(h.GetName(), h.filterIssues(issues))
+}
+
+// InitFuncs flags the init() functions doing heavy work.
+//
+// An init() function runs at the startup of every program importing the
+// package, including its tests, and can't be skipped or mocked. The work is
+// better done explicitly or lazily. The function literals declared in an
+// init() function are ignored, as they are likely called later. Generated
+// files are ignored.
+type InitFuncs struct {
+	// MaxStatements is the maximum number of statements of an init()
+	// function, including the nested ones. If 0, it is not enforced.
+	MaxStatements int `yaml:"max_statements"`
+	// Disallowed are the functions that must not be called from an init()
+	// function, e.g. "os.Exit", "log.Fatal", or "net/http.*" for all the
+	// functions of a package. The package is designated by its name or its
+	// import path.
+	Disallowed  []string `yaml:"disallowed"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (i *InitFuncs) GetDescription() string {
+	return "flags init() functions that are too long or call disallowed functions"
+}
+
+// GetName implements Check.
+func (i *InitFuncs) GetName() string {
+	return "initfuncs"
+}
+
+// GetPrerequisites implements Check.
+func (i *InitFuncs) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (i *InitFuncs) Run(change scm.Change, options *Options) error {
+	for _, d := range i.Disallowed {
+		if j := strings.LastIndex(d, "."); j <= 0 || j == len(d)-1 {
+			return fmt.Errorf("invalid disallowed function %q; expected \"pkg.Func\" or \"pkg.*\"", d)
+		}
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &i.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		imports := importPaths(s.file)
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Name.Name != "init" || fn.Body == nil {
+				continue
+			}
+			count := 0
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				switch node := node.(type) {
+				case *ast.FuncLit:
+					return false
+				case *ast.BlockStmt:
+				case ast.Stmt:
+					count++
+				case *ast.CallExpr:
+					if d := matchDisallowed(i.Disallowed, node, imports); d != "" {
+						issues = append(issues, s.issue(node.Pos(), "init() calls %s (%s); do it explicitly instead", s.nodeString(node.Fun), d))
+					}
+				}
+				return true
+			})
+			if i.MaxStatements > 0 && count > i.MaxStatements {
+				issues = append(issues, s.issue(fn.Name.Pos(), "init() has %d statements, max is %d; do the work explicitly or lazily", count, i.MaxStatements))
+			}
+		}
+	}
+	return issuesError(i.GetName(), i.filterIssues(issues))
+}
+
+// Logging enforces the use of the logger chosen by the project, by flagging
+// the calls to the other logging functions, e.g. log.Printf or fmt.Println.
+//
+// The test files, where printing is often the point, e.g. in examples, and
+// the generated files are ignored.
+type Logging struct {
+	// Forbidden are the functions that must not be called, e.g. "log.Println",
+	// "fmt.Println", or "log.*" for all the functions of a package. The package
+	// is designated by its name or its import path.
+	Forbidden []string `yaml:"forbidden"`
+	// Allow are the glob patterns, as matched by path.Match(), of the files
+	// allowed to call them, e.g. "main.go" or "cmd/*/*.go". A pattern without
+	// "/" matches the base name.
+	Allow []string `yaml:"allow"`
+	// Logger is the logger to use instead, e.g. "log/slog". It is only used in
+	// the messages.
+	Logger      string `yaml:"logger"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (l *Logging) GetDescription() string {
+	return "flags calls to the forbidden logging functions"
+}
+
+// GetName implements Check.
+func (l *Logging) GetName() string {
+	return "logging"
+}
+
+// GetPrerequisites implements Check.
+func (l *Logging) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (l *Logging) Run(change scm.Change, options *Options) error {
+	for _, f := range l.Forbidden {
+		if i := strings.LastIndex(f, "."); i <= 0 || i == len(f)-1 {
+			return fmt.Errorf("invalid forbidden function %q; expected \"pkg.Func\" or \"pkg.*\"", f)
+		}
+	}
+	for _, a := range l.Allow {
+		if _, err := path.Match(a, ""); err != nil {
+			return fmt.Errorf("invalid allow pattern %q: %s", a, err)
+		}
+	}
+	instead := ""
+	if l.Logger != "" {
+		instead = "; use " + l.Logger + " instead"
+	}
+	include := func(f string) bool {
+		return !strings.HasSuffix(f, "_test.go") && !matchPatterns(l.Allow, f)
+	}
+	var issues Issues
+	if len(l.Forbidden) != 0 {
+		for _, s := range parseGoFiles(change, parser.ParseComments, &l.FileFilter, include) {
+			if isGenerated(s.file) {
+				continue
+			}
+			imports := importPaths(s.file)
+			ast.Inspect(s.file, func(node ast.Node) bool {
+				if call, ok := node.(*ast.CallExpr); ok {
+					if f := matchDisallowed(l.Forbidden, call, imports); f != "" {
+						issues = append(issues, s.issue(call.Pos(), "%s is forbidden (%s)%s", s.nodeString(call.Fun), f, instead))
+					}
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(l.GetName(), l.filterIssues(issues))
+}
+
+// NoPanic flags the panic() calls used for ordinary control flow.
+//
+// A library panicking takes down the whole program of its user; it should
+// return an error instead. The init() functions, the main() function of
+// package main and the generated files are ignored. The test files are
+// ignored unless IncludeTests is set.
+type NoPanic struct {
+	// Allow are the glob patterns, as matched by path.Match(), of the files or
+	// the functions allowed to panic, e.g. "internal/*.go", "Must*" or
+	// "*.Must*" for the methods. A file pattern without "/" matches the base
+	// name. The functions are designated as "Func" or "Type.Method".
+	Allow []string `yaml:"allow"`
+	// IncludeTests also checks the _test.go files.
+	IncludeTests bool `yaml:"include_tests"`
+	IssueFilter  `yaml:",inline"`
+	FileFilter   `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (n *NoPanic) GetDescription() string {
+	return "flags panic() calls outside of init(), main() and allowed locations"
+}
+
+// GetName implements Check.
+func (n *NoPanic) GetName() string {
+	return "nopanic"
+}
+
+// GetPrerequisites implements Check.
+func (n *NoPanic) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (n *NoPanic) Run(change scm.Change, options *Options) error {
+	for _, a := range n.Allow {
+		if _, err := path.Match(a, ""); err != nil {
+			return fmt.Errorf("invalid allow pattern %q: %s", a, err)
+		}
+	}
+	include := func(f string) bool {
+		return n.IncludeTests || !strings.HasSuffix(f, "_test.go")
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &n.FileFilter, include) {
+		if isGenerated(s.file) || matchPatterns(n.Allow, s.name) {
+			continue
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				name = receiverType(fn) + "." + name
+			} else if name == "init" || (name == "main" && s.file.Name.Name == "main") {
+				continue
+			}
+			if matchPatterns(n.Allow, name) {
+				continue
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				// A local shadowing panic is resolved to its declaration.
+				if call, ok := node.(*ast.CallExpr); ok {
+					if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "panic" && id.Obj == nil {
+						issues = append(issues, s.issue(call.Pos(), "%s calls panic(); return an error instead", name))
+					}
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(n.GetName(), n.filterIssues(issues))
+}
+
+// OsExit flags the os.Exit() and log.Fatal*() calls outside of the
+// entry points.
+//
+// They exit without running the deferred calls, and the code calling them
+// can't be tested. The init() functions, the main() function of package main,
+// the TestMain() functions and the generated files are ignored.
+type OsExit struct {
+	// Allow are the glob patterns, as matched by path.Match(), of the files or
+	// the functions allowed to exit, e.g. "cmd/*/*.go" or "Must*". A file
+	// pattern without "/" matches the base name. The functions are designated
+	// as "Func" or "Type.Method".
+	Allow       []string `yaml:"allow"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (o *OsExit) GetDescription() string {
+	return "flags os.Exit() and log.Fatal() calls outside of main(), init() and TestMain()"
+}
+
+// GetName implements Check.
+func (o *OsExit) GetName() string {
+	return "osexit"
+}
+
+// GetPrerequisites implements Check.
+func (o *OsExit) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (o *OsExit) Run(change scm.Change, options *Options) error {
+	for _, a := range o.Allow {
+		if _, err := path.Match(a, ""); err != nil {
+			return fmt.Errorf("invalid allow pattern %q: %s", a, err)
+		}
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &o.FileFilter, nil) {
+		if isGenerated(s.file) || matchPatterns(o.Allow, s.name) {
+			continue
+		}
+		osName, logName := importName(s.file, "os"), importName(s.file, "log")
+		if osName == "" && logName == "" {
+			continue
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil {
+				name = receiverType(fn) + "." + name
+			} else if name == "init" || (name == "main" && s.file.Name.Name == "main") || (name == "TestMain" && isTestFile(s.name)) {
+				continue
+			}
+			if matchPatterns(o.Allow, name) {
+				continue
+			}
+			ast.Inspect(fn.Body, func(node ast.Node) bool {
+				call, ok := node.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				exit := ""
+				if osName != "" && isPkgCall(call, osName, "Exit") {
+					exit = "os.Exit"
+				}
+				for _, fatal := range []string{"Fatal", "Fatalf", "Fatalln"} {
+					if logName != "" && isPkgCall(call, logName, fatal) {
+						exit = "log." + fatal
+					}
+				}
+				if exit != "" {
+					issues = append(issues, s.issue(call.Pos(), "%s calls %s(), which skips the deferred calls; return an error instead", name, exit))
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(o.GetName(), o.filterIssues(issues))
+}
+
+// RequireTests enforces that every package has at least one _test.go file.
+//
+// A package without test is invisible to check coverage when it doesn't use
+// global inference, so its coverage percentage hides it. Main packages and
+// generated packages are ignored. A package legitimately without tests can be
+// added to Blacklist, e.g. "./cmd/tool".
+type RequireTests struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (r *RequireTests) GetDescription() string {
+	return "enforces every package has tests"
+}
+
+// GetName implements Check.
+func (r *RequireTests) GetName() string {
+	return "requiretests"
+}
+
+// GetPrerequisites implements Check.
+func (r *RequireTests) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (r *RequireTests) Run(change scm.Change, options *Options) error {
+	// Only the modified packages are checked but all their files are needed.
+	files := map[string][]string{}
+	for _, f := range change.All().GoFiles() {
+		dir := path.Dir(filepath.ToSlash(f))
+		files[dir] = append(files[dir], f)
+	}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, f := range change.Changed().GoFiles() {
+		if dir := path.Dir(filepath.ToSlash(f)); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	var issues Issues
+	for _, dir := range dirs {
+		var first *sourceFile
+		hasTest := false
+		for _, f := range files[dir] {
+			if isTestFile(f) {
+				hasTest = true
+				break
+			}
+			if change.IsIgnored(f) || r.skip(f) {
+				continue
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, f, change.Content(f), parser.PackageClauseOnly|parser.ParseComments)
+			if err != nil || file.Name.Name == "main" || isGenerated(file) {
+				continue
+			}
+			if first == nil || f < first.name {
+				first = &sourceFile{f, fset, file}
+			}
+		}
+		if hasTest || first == nil {
+			continue
+		}
+		pkg := "./" + dir
+		if dir == "." {
+			pkg = "."
+		}
+		issues = append(issues, first.issue(first.file.Name.Pos(), "package %s (%s) has no _test.go file", first.file.Name.Name, pkg))
+	}
+	return issuesError(r.GetName(), r.filterIssues(issues))
+}
+
+// TagConsistency enforces that the build constraints of the files whose name
+// implies a GOOS or a GOARCH, like "foo_linux.go", are consistent with it.
+//
+// It reports the constraints excluding the target implied by the file name,
+// the ones that are redundant with it and the ones mentioning another GOOS or
+// GOARCH, which can never be satisfied.
+type TagConsistency struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TagConsistency) GetDescription() string {
+	return "enforces build constraints are consistent with the _GOOS and _GOARCH file name suffixes"
+}
+
+// GetName implements Check.
+func (t *TagConsistency) GetName() string {
+	return "tagconsistency"
+}
+
+// GetPrerequisites implements Check.
+func (t *TagConsistency) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TagConsistency) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.PackageClauseOnly, &t.FileFilter, nil) {
+		for _, issue := range checkTagConsistency(s.name, change.Content(s.name)) {
+			issues = append(issues, Issue{File: filepath.ToSlash(s.name), Line: issue.line, Severity: SeverityError, Message: issue.msg})
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// PackageName enforces that the package clauses match the name of their
+// directory.
+//
+// It catches the packages copied from another one that kept its name. The
+// usual conventions are accepted: package main, the external test packages
+// named xxx_test, and the directories named like "go-foo", "foo-go", "foo.v2"
+// or "foo/v2" for package foo. The directory of a package that is named
+// differently on purpose can be added to Blacklist.
+type PackageName struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (p *PackageName) GetDescription() string {
+	return "enforces package names match their directory"
+}
+
+// GetName implements Check.
+func (p *PackageName) GetName() string {
+	return "packagename"
+}
+
+// GetPrerequisites implements Check.
+func (p *PackageName) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (p *PackageName) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	reported := map[string]bool{}
+	for _, s := range parseGoFiles(change, parser.PackageClauseOnly, &p.FileFilter, nil) {
+		dir := path.Dir(filepath.ToSlash(s.name))
+		importPath := path.Join(change.Package(), dir)
+		if reported[dir] || (dir == "." && change.Package() == "") {
+			continue
+		}
+		name := s.file.Name.Name
+		if name == "main" || (isTestFile(s.name) && strings.HasSuffix(name, "_test") && isPackageName(importPath, strings.TrimSuffix(name, "_test"))) {
+			continue
+		}
+		if !isPackageName(importPath, name) {
+			reported[dir] = true
+			issues = append(issues, s.issue(s.file.Name.Pos(), "package %s doesn't match its directory %s", name, path.Base(importPath)))
+		}
+	}
+	return issuesError(p.GetName(), p.filterIssues(issues))
+}
+
+// ContextFirst enforces that a context.Context parameter is the first
+// parameter of the functions and methods.
+//
+// Both "context" and "golang.org/x/net/context" are recognized. Generated
+// files are ignored. A legacy function that can't be changed is ignored by
+// adding its name to Blacklist.
+type ContextFirst struct {
+	// IncludeUnexported also checks the unexported functions and methods.
+	IncludeUnexported bool `yaml:"include_unexported"`
+	IssueFilter       `yaml:",inline"`
+	FileFilter        `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (c *ContextFirst) GetDescription() string {
+	return "enforces context.Context is the first parameter"
+}
+
+// GetName implements Check.
+func (c *ContextFirst) GetName() string {
+	return "contextfirst"
+}
+
+// GetPrerequisites implements Check.
+func (c *ContextFirst) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (c *ContextFirst) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, f := range parseGoFiles(change, parser.ParseComments, &c.FileFilter, nil) {
+		if isGenerated(f.file) {
+			continue
+		}
+		var pkgs []string
+		for _, path := range []string{"context", "golang.org/x/net/context"} {
+			if name := importName(f.file, path); name != "" {
+				pkgs = append(pkgs, name)
+			}
+		}
+		if len(pkgs) == 0 {
+			continue
+		}
+		for _, decl := range f.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || (!c.IncludeUnexported && !fn.Name.IsExported()) {
+				continue
+			}
+			if i := contextParam(fn.Type, pkgs); i > 0 {
+				issues = append(issues, f.issue(fn.Name.Pos(), "%s takes context.Context as parameter %d; it must be the first", funcSignature(f, fn), i+1))
+			}
+		}
+	}
+	return issuesError(c.GetName(), c.filterIssues(issues))
+}
+
+// ContextCancel enforces that the cancel function returned by
+// context.WithCancel, context.WithTimeout and context.WithDeadline is called,
+// otherwise the context and its timer leak until the parent context is
+// canceled.
+//
+// It is similar to go vet's lostcancel but without type analysis: the cancel
+// function is considered handled when it is deferred, including in a deferred
+// function literal, or when it escapes, e.g. when it is returned or stored.
+// Otherwise it must be called before the first return statement following
+// the assignment. Both "context" and "golang.org/x/net/context" are
+// recognized. Generated files are ignored.
+type ContextCancel struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (c *ContextCancel) GetDescription() string {
+	return "ensures the cancel function of a derived context is called"
+}
+
+// GetName implements Check.
+func (c *ContextCancel) GetName() string {
+	return "contextcancel"
+}
+
+// GetPrerequisites implements Check.
+func (c *ContextCancel) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (c *ContextCancel) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &c.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		var pkgs []string
+		for _, path := range []string{"context", "golang.org/x/net/context"} {
+			if name := importName(s.file, path); name != "" {
+				pkgs = append(pkgs, name)
+			}
+		}
+		if len(pkgs) == 0 {
+			continue
+		}
+		var bodies []*ast.BlockStmt
+		ast.Inspect(s.file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Body != nil {
+					bodies = append(bodies, n.Body)
+				}
+			case *ast.FuncLit:
+				bodies = append(bodies, n.Body)
+			}
+			return true
+		})
+		for _, body := range bodies {
+			issues = append(issues, lostCancels(s, body, pkgs)...)
+		}
+	}
+	return issuesError(c.GetName(), c.filterIssues(issues))
+}
+
+// ExampleOutput enforces that the example functions have an output comment.
+//
+// An example without "// Output:" or "// Unordered output:" comment is
+// compiled but never run by go test, so it silently passes whatever it does.
+// The examples without output on purpose can be added by name to Blacklist.
+type ExampleOutput struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (e *ExampleOutput) GetDescription() string {
+	return "enforces examples have an output comment"
+}
+
+// GetName implements Check.
+func (e *ExampleOutput) GetName() string {
+	return "exampleoutput"
+}
+
+// GetPrerequisites implements Check.
+func (e *ExampleOutput) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (e *ExampleOutput) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &e.FileFilter, isTestFile) {
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Body == nil || !isTestName(fn.Name.Name, "Example") {
+				continue
+			}
+			if !hasOutputComment(s.file, fn.Body) {
+				issues = append(issues, s.issue(fn.Name.Pos(), "%s has no output comment so it is never run", fn.Name.Name))
+			}
+		}
+	}
+	return issuesError(e.GetName(), e.filterIssues(issues))
+}
+
+// ReceiverNames enforces that the methods of a type use the same receiver
+// name and that it is short.
+//
+// The consistency is verified among the modified files of each package, the
+// most common name being the expected one. Receivers named "this" or "self"
+// are always reported. Generated files are ignored.
+type ReceiverNames struct {
+	// MaxLength is the maximum length of a receiver name. If 0, it is not
+	// enforced.
+	MaxLength   int `yaml:"max_length"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (r *ReceiverNames) GetDescription() string {
+	return "enforces consistent and short method receiver names"
+}
+
+// GetName implements Check.
+func (r *ReceiverNames) GetName() string {
+	return "receivernames"
+}
+
+// GetPrerequisites implements Check.
+func (r *ReceiverNames) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (r *ReceiverNames) Run(change scm.Change, options *Options) error {
+	type receiver struct {
+		s    *sourceFile
+		fn   *ast.FuncDecl
+		name string
+	}
+	// Map of <directory/type> : <receivers>, in the order found.
+	types := map[string][]receiver{}
+	var keys []string
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &r.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		for _, decl := range s.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || len(fn.Recv.List[0].Names) != 1 {
+				continue
+			}
+			name := fn.Recv.List[0].Names[0].Name
+			if name == "_" {
+				continue
+			}
+			pos := fn.Recv.List[0].Names[0].Pos()
+			if name == "this" || name == "self" {
+				issues = append(issues, s.issue(pos, "%s receiver is named %s; use a short name reflecting the type", funcSignature(s, fn), name))
+				continue
+			}
+			if r.MaxLength > 0 && len(name) > r.MaxLength {
+				issues = append(issues, s.issue(pos, "%s receiver name %s is longer than %d", funcSignature(s, fn), name, r.MaxLength))
+			}
+			if t := receiverType(fn); t != "" {
+				key := path.Join(path.Dir(filepath.ToSlash(s.name)), t)
+				if _, ok := types[key]; !ok {
+					keys = append(keys, key)
+				}
+				types[key] = append(types[key], receiver{s, fn, name})
+			}
+		}
+	}
+	for _, key := range keys {
+		counts := map[string]int{}
+		best := ""
+		for _, recv := range types[key] {
+			counts[recv.name]++
+			if c := counts[recv.name]; c > counts[best] || (c == counts[best] && recv.name < best) {
+				best = recv.name
+			}
+		}
+		if len(counts) == 1 {
+			continue
+		}
+		for _, recv := range types[key] {
+			if recv.name != best {
+				issues = append(issues, recv.s.issue(recv.fn.Recv.List[0].Names[0].Pos(), "%s receiver is named %s, the other methods of %s use %s", funcSignature(recv.s, recv.fn), recv.name, path.Base(key), best))
+			}
+		}
+	}
+	return issuesError(r.GetName(), r.filterIssues(issues))
+}
+
+// StructTags enforces that struct field tags are well-formed.
+//
+// Malformed tags compile but are silently ignored by reflect.StructTag.Get,
+// breaking the marshaling of the field. Generated files are ignored.
+type StructTags struct {
+	// RequireSnakeCase enforces that the keys of the json and yaml tags are
+	// snake_case.
+	RequireSnakeCase bool `yaml:"require_snake_case"`
+	IssueFilter      `yaml:",inline"`
+	FileFilter       `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (s *StructTags) GetDescription() string {
+	return "enforces struct field tags are well-formed"
+}
+
+// GetName implements Check.
+func (s *StructTags) GetName() string {
+	return "structtags"
+}
+
+// GetPrerequisites implements Check.
+func (s *StructTags) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (s *StructTags) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, src := range parseGoFiles(change, parser.ParseComments, &s.FileFilter, nil) {
+		if isGenerated(src.file) {
+			continue
+		}
+		ast.Inspect(src.file, func(n ast.Node) bool {
+			st, ok := n.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range st.Fields.List {
+				if field.Tag == nil {
+					continue
+				}
+				name := fieldName(src, field)
+				tag, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					continue
+				}
+				pairs, err := parseStructTag(tag)
+				if err != nil {
+					issues = append(issues, src.issue(field.Tag.Pos(), "field %s has a malformed tag: %s", name, err))
+					continue
+				}
+				seen := map[string]bool{}
+				for _, pair := range pairs {
+					key, value := pair[0], pair[1]
+					if seen[key] {
+						issues = append(issues, src.issue(field.Tag.Pos(), "field %s has tag key %s more than once", name, key))
+					}
+					seen[key] = true
+					for _, known := range knownTagKeys {
+						if key != known && strings.EqualFold(key, known) {
+							issues = append(issues, src.issue(field.Tag.Pos(), "field %s has tag key %s; did you mean %s?", name, key, known))
+						}
+					}
+					if s.RequireSnakeCase && (key == "json" || key == "yaml") {
+						if v := strings.SplitN(value, ",", 2)[0]; v != "" && v != "-" && !reSnakeCase.MatchString(v) {
+							issues = append(issues, src.issue(field.Tag.Pos(), "field %s has %s key %q; use snake_case", name, key, v))
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(s.GetName(), s.filterIssues(issues))
+}
+
+// JSONNaming enforces a naming convention for the json names of the fields
+// of the structs marshaled to JSON, e.g. in the packages of an external API.
+//
+// A struct is considered marshaled to JSON if at least one of its fields has
+// a json tag. Its exported fields must then all have a json name following
+// Convention, or "-". The embedded fields without tag are inlined so they are
+// ignored. Generated files are ignored.
+type JSONNaming struct {
+	// Convention is the naming convention of the json names: "snake_case" or
+	// "camelCase". If empty, "snake_case" is used.
+	Convention string `yaml:"convention"`
+	// Packages are the glob patterns, as matched by path.Match(), of the
+	// directories of the packages checked, e.g. "api/*". A pattern without "/"
+	// matches the base name. If empty, all the packages are checked.
+	Packages    []string `yaml:"packages"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (j *JSONNaming) GetDescription() string {
+	return "enforces a naming convention for the json names of the struct fields"
+}
+
+// GetName implements Check.
+func (j *JSONNaming) GetName() string {
+	return "jsonnaming"
+}
+
+// GetPrerequisites implements Check.
+func (j *JSONNaming) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (j *JSONNaming) Run(change scm.Change, options *Options) error {
+	convention := j.Convention
+	if convention == "" {
+		convention = "snake_case"
+	}
+	re := namingConventions[convention]
+	if re == nil {
+		return fmt.Errorf("invalid convention %q; expected snake_case or camelCase", j.Convention)
+	}
+	for _, p := range j.Packages {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid package pattern %q: %s", p, err)
+		}
+	}
+	include := func(f string) bool {
+		return len(j.Packages) == 0 || matchPatterns(j.Packages, path.Dir(filepath.ToSlash(f)))
+	}
+	var issues Issues
+	for _, src := range parseGoFiles(change, parser.ParseComments, &j.FileFilter, include) {
+		if isGenerated(src.file) {
+			continue
+		}
+		ast.Inspect(src.file, func(n ast.Node) bool {
+			st, ok := n.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			// The json name of each field, nil if the field has no json tag.
+			names := make([]*string, len(st.Fields.List))
+			marshaled := false
+			for i, field := range st.Fields.List {
+				if field.Tag == nil {
+					continue
+				}
+				tag, err := strconv.Unquote(field.Tag.Value)
+				if err != nil {
+					continue
+				}
+				// Malformed tags are reported by check structtags.
+				pairs, _ := parseStructTag(tag)
+				for _, pair := range pairs {
+					if pair[0] == "json" {
+						name := strings.SplitN(pair[1], ",", 2)[0]
+						names[i] = &name
+						marshaled = true
+					}
+				}
+			}
+			if !marshaled {
+				return true
+			}
+			for i, field := range st.Fields.List {
+				exported := len(field.Names) == 0
+				for _, n := range field.Names {
+					exported = exported || n.IsExported()
+				}
+				if !exported {
+					continue
+				}
+				name := fieldName(src, field)
+				switch {
+				case names[i] == nil:
+					if len(field.Names) != 0 {
+						issues = append(issues, src.issue(field.Pos(), "field %s has no json tag; use a %s name", name, convention))
+					}
+				case *names[i] == "":
+					issues = append(issues, src.issue(field.Tag.Pos(), "field %s has no json name; use a %s name", name, convention))
+				case *names[i] != "-" && !re.MatchString(*names[i]):
+					issues = append(issues, src.issue(field.Tag.Pos(), "field %s has json name %q; use %s", name, *names[i], convention))
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(j.GetName(), j.filterIssues(issues))
+}
+
+// TypeSwitch flags the type switches over an interface without default case
+// that don't handle all its implementers, as a value of an unhandled type
+// silently falls through, e.g. when a node type is added to a visitor.
+//
+// This is a heuristic since the check doesn't do type analysis. Only the
+// interfaces declared in the package of the switch are considered, with their
+// implementers declared in the same package; an interface embedding an
+// interface of another package is ignored. The interface switched on is the
+// declared type of the variable, otherwise the only interface implemented by
+// all the types of the cases. Generated files are ignored. An interface whose
+// switches are not meant to be exhaustive is ignored by adding its name to
+// Blacklist.
+type TypeSwitch struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TypeSwitch) GetDescription() string {
+	return "flags type switches missing implementers of the interface"
+}
+
+// GetName implements Check.
+func (t *TypeSwitch) GetName() string {
+	return "typeswitch"
+}
+
+// GetPrerequisites implements Check.
+func (t *TypeSwitch) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TypeSwitch) Run(change scm.Change, options *Options) error {
+	// Only the switches in the modified files are checked but all the files of
+	// their package are needed.
+	files := map[string][]string{}
+	for _, f := range change.All().GoFiles() {
+		dir := path.Dir(filepath.ToSlash(f))
+		files[dir] = append(files[dir], f)
+	}
+	changed := map[string]bool{}
+	for _, f := range change.Changed().GoFiles() {
+		changed[f] = true
+	}
+	var dirs []string
+	for dir := range files {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	var issues Issues
+	for _, dir := range dirs {
+		var srcs []*sourceFile
+		for _, f := range files[dir] {
+			if !changed[f] || t.skip(f) {
+				continue
+			}
+			if content := change.Content(f); content != nil {
+				fset := token.NewFileSet()
+				if file, err := parser.ParseFile(fset, f, content, parser.ParseComments); err == nil {
+					srcs = append(srcs, &sourceFile{f, fset, file})
+				}
+			}
+		}
+		if len(srcs) == 0 {
+			continue
+		}
+		// The declarations of each package of the directory, as the external
+		// tests are in another package.
+		types := map[string]*pkgTypes{}
+		for _, f := range files[dir] {
+			content := change.Content(f)
+			if content == nil {
+				continue
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), f, content, 0)
+			if err != nil {
+				continue
+			}
+			if types[file.Name.Name] == nil {
+				types[file.Name.Name] = newPkgTypes()
+			}
+			types[file.Name.Name].add(file)
+		}
+		for _, s := range srcs {
+			if change.IsIgnored(s.name) || isGenerated(s.file) {
+				continue
+			}
+			pkg := types[s.file.Name.Name]
+			ast.Inspect(s.file, func(n ast.Node) bool {
+				sw, ok := n.(*ast.TypeSwitchStmt)
+				if !ok {
+					return true
+				}
+				if iface, missing := pkg.unhandled(sw); len(missing) != 0 {
+					issues = append(issues, s.issue(sw.Pos(), "type switch on %s has no default case and doesn't handle %s", iface, strings.Join(missing, ", ")))
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// TestInternals polices the boundary between a package and its external
+// tests, in package foo_test.
+//
+// The symbols exported by the internal test files of package foo, e.g. the
+// "export_test.go" hack, are only visible to the external tests, which then
+// test the internals instead of the public API. The uses of these symbols by
+// the external tests are flagged, unless allowed. Only the package level
+// symbols are tracked, not the methods. Generated files are ignored.
+type TestInternals struct {
+	// Allow are the glob patterns, as matched by path.Match(), of the symbols
+	// exported for the tests the external tests may use, e.g. "SetClock".
+	Allow []string `yaml:"allow"`
+	// AliasesOnly also flags the functions exported for the tests, as they
+	// likely duplicate production logic; the exported symbols must be aliases
+	// of production ones, e.g. "var Parse = parse".
+	AliasesOnly bool `yaml:"aliases_only"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TestInternals) GetDescription() string {
+	return "flags external tests using symbols exported only for the tests"
+}
+
+// GetName implements Check.
+func (t *TestInternals) GetName() string {
+	return "testinternals"
+}
+
+// GetPrerequisites implements Check.
+func (t *TestInternals) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TestInternals) Run(change scm.Change, options *Options) error {
+	for _, a := range t.Allow {
+		if _, err := path.Match(a, ""); err != nil {
+			return fmt.Errorf("invalid allow pattern %q: %s", a, err)
+		}
+	}
+	// Only the modified test files are checked but all the test files of their
+	// package are needed.
+	files := map[string][]string{}
+	for _, f := range change.All().GoFiles() {
+		if isTestFile(f) && !change.IsIgnored(f) {
+			dir := path.Dir(filepath.ToSlash(f))
+			files[dir] = append(files[dir], f)
+		}
+	}
+	changed := map[string]bool{}
+	var dirs []string
+	for _, f := range change.Changed().GoFiles() {
+		if !isTestFile(f) || t.skip(f) {
+			continue
+		}
+		changed[f] = true
+		if dir := path.Dir(filepath.ToSlash(f)); !contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	var issues Issues
+	for _, dir := range dirs {
+		var internals, externals []*sourceFile
+		for _, f := range files[dir] {
+			content := change.Content(f)
+			if content == nil {
+				continue
+			}
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, f, content, parser.ParseComments)
+			if err != nil || isGenerated(file) {
+				continue
+			}
+			s := &sourceFile{f, fset, file}
+			if strings.HasSuffix(file.Name.Name, "_test") {
+				externals = append(externals, s)
+			} else {
+				internals = append(internals, s)
+			}
+		}
+		// The symbols exported for the tests and the file exporting them.
+		exported := map[string]string{}
+		pkgName := ""
+		for _, s := range internals {
+			pkgName = s.file.Name.Name
+			for _, d := range exportedForTests(s.file) {
+				exported[d.name] = path.Base(filepath.ToSlash(s.name))
+				if t.AliasesOnly && d.isFunc && changed[s.name] {
+					issues = append(issues, s.issue(d.pos, "%s is a function exported for the tests; alias the production code instead, e.g. var %s = ...", d.name, d.name))
+				}
+			}
+		}
+		if len(exported) == 0 {
+			continue
+		}
+		for _, s := range externals {
+			if !changed[s.name] || strings.TrimSuffix(s.file.Name.Name, "_test") != pkgName {
+				continue
+			}
+			name := ""
+			for _, imp := range s.file.Imports {
+				p, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					continue
+				}
+				if n := importName(s.file, p); n == pkgName && (path.Base(p) == pkgName || path.Base(p) == path.Base(dir)) {
+					name = n
+				}
+			}
+			if name == "" {
+				continue
+			}
+			ast.Inspect(s.file, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == name {
+					if from, ok := exported[sel.Sel.Name]; ok && !matchPatterns(t.Allow, sel.Sel.Name) {
+						issues = append(issues, s.issue(sel.Pos(), "uses %s.%s, exported for the tests by %s; test through the public API", name, sel.Sel.Name, from))
+					}
+				}
+				return true
+			})
+		}
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// SortLess flags the less functions that are likely not a strict weak
+// ordering, which sorts inconsistently.
+//
+// The less functions are the function literals passed to sort.Slice and
+// sort.SliceStable and the Less(i, j int) bool methods used by sort.Sort. It
+// is a heuristic: a less function must use both its parameters, must not
+// compare the two indices with <= or >=, and must not compare two values
+// indexed by the same parameter. Generated files are ignored.
+type SortLess struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (s *SortLess) GetDescription() string {
+	return "flags sort less functions that are not a strict ordering"
+}
+
+// GetName implements Check.
+func (s *SortLess) GetName() string {
+	return "sortless"
+}
+
+// GetPrerequisites implements Check.
+func (s *SortLess) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (s *SortLess) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, src := range parseGoFiles(change, parser.ParseComments, &s.FileFilter, nil) {
+		if isGenerated(src.file) {
+			continue
+		}
+		sortName := importName(src.file, "sort")
+		ast.Inspect(src.file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Recv != nil && n.Name.Name == "Less" && n.Body != nil && n.Type.Results != nil && len(n.Type.Results.List) == 1 {
+					issues = append(issues, lessIssues(src, receiverType(n)+".Less", n.Type, n.Body)...)
+				}
+			case *ast.CallExpr:
+				if sortName == "" || len(n.Args) != 2 || (!isPkgCall(n, sortName, "Slice") && !isPkgCall(n, sortName, "SliceStable")) {
+					break
+				}
+				if lit, ok := n.Args[1].(*ast.FuncLit); ok {
+					issues = append(issues, lessIssues(src, src.nodeString(n.Fun), lit.Type, lit.Body)...)
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(s.GetName(), s.filterIssues(issues))
+}
+
+// ImportCount enforces a maximum number of imports per file.
+//
+// It is a coarse proxy for the coupling of a file: a file importing many
+// packages is likely doing too much and is a candidate to be split. Blank
+// imports are counted. Generated files are ignored.
+type ImportCount struct {
+	// MaxImports is the maximum number of packages a file imports, unless
+	// overridden in PerDir. If 0, it is not enforced.
+	MaxImports int `yaml:"max_imports"`
+	// ExcludeStdlib doesn't count the packages of the standard library, i.e.
+	// the ones whose import path's first element doesn't contain a dot and
+	// isn't in the repository's package.
+	ExcludeStdlib bool `yaml:"exclude_stdlib"`
+	// PerDir overrides MaxImports for the files of some directories, in POSIX
+	// format relative to the repository root. A value of 0 disables the check
+	// for the directory.
+	PerDir      map[string]int `yaml:"per_dir"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (i *ImportCount) GetDescription() string {
+	return "enforces a maximum number of imports per file"
+}
+
+// GetName implements Check.
+func (i *ImportCount) GetName() string {
+	return "importcount"
+}
+
+// GetPrerequisites implements Check.
+func (i *ImportCount) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (i *ImportCount) Run(change scm.Change, options *Options) error {
+	max := func(f string) int {
+		if v, ok := i.PerDir[path.Dir(filepath.ToSlash(f))]; ok {
+			return v
+		}
+		return i.MaxImports
+	}
+	include := func(f string) bool {
+		return max(f) > 0
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ImportsOnly|parser.ParseComments, &i.FileFilter, include) {
+		if isGenerated(s.file) {
+			continue
+		}
+		count := 0
+		for _, imp := range s.file.Imports {
+			p, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || (i.ExcludeStdlib && isStdlibImport(p, change.Package())) {
+				continue
+			}
+			count++
+		}
+		if m := max(s.name); count > m {
+			what := "packages"
+			if i.ExcludeStdlib {
+				what = "non standard packages"
+			}
+			issues = append(issues, s.issue(s.file.Name.Pos(), "imports %d %s, more than %d; consider splitting it", count, what, m))
+		}
+	}
+	return issuesError(i.GetName(), i.filterIssues(issues))
+}
+
+// DeferInLoop flags the defer statements inside the body of a for loop.
+//
+// A deferred call runs when the function returns, not at the end of the
+// iteration, so the resources released by the deferred calls, e.g. open files,
+// accumulate until then. A defer in a function literal declared in the loop,
+// e.g. called once per iteration, is fine. Generated files are ignored.
+type DeferInLoop struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (d *DeferInLoop) GetDescription() string {
+	return "flags defer statements inside loops"
+}
+
+// GetName implements Check.
+func (d *DeferInLoop) GetName() string {
+	return "deferinloop"
+}
+
+// GetPrerequisites implements Check.
+func (d *DeferInLoop) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (d *DeferInLoop) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &d.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		var walk func(n ast.Node, loop string)
+		walk = func(n ast.Node, loop string) {
+			ast.Inspect(n, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncLit:
+					walk(n.Body, "")
+					return false
+				case *ast.ForStmt:
+					for _, c := range []ast.Node{n.Init, n.Cond, n.Post} {
+						if c != nil {
+							walk(c, loop)
+						}
+					}
+					walk(n.Body, "for")
+					return false
+				case *ast.RangeStmt:
+					walk(n.X, loop)
+					walk(n.Body, "for range")
+					return false
+				case *ast.DeferStmt:
+					if loop != "" {
+						issues = append(issues, s.issue(n.Pos(), "defer inside a %s loop runs when the function returns, not at the end of the iteration; the resources leak until then, move the loop body to a function", loop))
+					}
+				}
+				return true
+			})
+		}
+		walk(s.file, "")
+	}
+	return issuesError(d.GetName(), d.filterIssues(issues))
+}
+
+// TimeNow flags the direct time.Now() calls.
+//
+// Time dependent logic calling time.Now() can't be tested deterministically;
+// the current time should come from an injected clock instead. The test
+// files, the files of package main and the generated files are ignored.
+type TimeNow struct {
+	// Allow are the glob patterns, as matched by path.Match(), of the files
+	// allowed to call time.Now(), e.g. the clock implementation in
+	// "internal/clock/*.go". A pattern without "/" matches the base name.
+	Allow       []string `yaml:"allow"`
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (t *TimeNow) GetDescription() string {
+	return "flags direct time.Now() calls instead of an injected clock"
+}
+
+// GetName implements Check.
+func (t *TimeNow) GetName() string {
+	return "timenow"
+}
+
+// GetPrerequisites implements Check.
+func (t *TimeNow) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (t *TimeNow) Run(change scm.Change, options *Options) error {
+	for _, a := range t.Allow {
+		if _, err := path.Match(a, ""); err != nil {
+			return fmt.Errorf("invalid allow pattern %q: %s", a, err)
+		}
+	}
+	include := func(f string) bool {
+		return !strings.HasSuffix(f, "_test.go") && !matchPatterns(t.Allow, f)
+	}
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &t.FileFilter, include) {
+		if isGenerated(s.file) || s.file.Name.Name == "main" {
+			continue
+		}
+		pkg := importName(s.file, "time")
+		if pkg == "" {
+			continue
+		}
+		ast.Inspect(s.file, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok && isPkgCall(call, pkg, "Now") {
+				issues = append(issues, s.issue(call.Pos(), "%s() makes the code hard to test deterministically; use an injected clock instead", s.nodeString(call.Fun)))
+			}
+			return true
+		})
+	}
+	return issuesError(t.GetName(), t.filterIssues(issues))
+}
+
+// LargeParam flags the function parameters passed by value whose type is
+// larger than a maximum size, as copying them on each call is slow.
+//
+// Unlike the other source checks, it type checks the modified packages to
+// compute the sizes, for the architecture pcg runs on. The imports are loaded
+// from source. The parameters whose type can't be resolved, the external test
+// packages and the generated files are ignored.
+type LargeParam struct {
+	// MaxParamBytes is the maximum size in bytes of a parameter passed by
+	// value. Nothing is checked when it is 0.
+	MaxParamBytes int64 `yaml:"max_param_bytes"`
+	IssueFilter   `yaml:",inline"`
+	FileFilter    `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (l *LargeParam) GetDescription() string {
+	return "flags large function parameters passed by value"
+}
+
+// GetName implements Check.
+func (l *LargeParam) GetName() string {
+	return "largeparam"
+}
+
+// GetPrerequisites implements Check.
+func (l *LargeParam) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (l *LargeParam) Run(change scm.Change, options *Options) error {
+	if l.MaxParamBytes <= 0 {
+		return nil
+	}
+	include := func(f string) bool {
+		return !change.IsIgnored(f) && !l.skip(f)
+	}
+	// Only the modified packages are checked but all their files are needed to
+	// type check them.
+	files := map[string][]string{}
+	for _, f := range change.All().GoFiles() {
+		if include(f) {
+			dir := path.Dir(filepath.ToSlash(f))
+			files[dir] = append(files[dir], f)
+		}
+	}
+	changed := map[string]bool{}
+	var dirs []string
+	seen := map[string]bool{}
+	for _, f := range change.Changed().GoFiles() {
+		if !include(f) {
+			continue
+		}
+		changed[f] = true
+		if dir := path.Dir(filepath.ToSlash(f)); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	fset := token.NewFileSet()
+	// The importer caches the packages loaded, so it is shared by all the
+	// packages checked.
+	imp := importer.ForCompiler(fset, "source", nil)
+	sizes := types.SizesFor("gc", runtime.GOARCH)
+	var issues Issues
+	for _, dir := range dirs {
+		var sources []*sourceFile
+		var astFiles []*ast.File
+		pkgName := ""
+		for _, f := range files[dir] {
+			// The absolute path lets the importer resolve the imports relative to
+			// the package.
+			file, err := parser.ParseFile(fset, filepath.Join(change.Repo().Root(), f), change.Content(f), parser.ParseComments)
+			if err != nil {
+				continue
+			}
+			if !isTestFile(f) {
+				pkgName = file.Name.Name
+			}
+			sources = append(sources, &sourceFile{f, fset, file})
+		}
+		for _, s := range sources {
+			if pkgName == "" {
+				pkgName = strings.TrimSuffix(s.file.Name.Name, "_test")
+			}
+			if s.file.Name.Name == pkgName {
+				astFiles = append(astFiles, s.file)
+			}
+		}
+		info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+		// The errors are ignored; the types that can't be resolved are invalid.
+		conf := types.Config{Importer: imp, Sizes: sizes, Error: func(error) {}}
+		_, _ = conf.Check(dir, fset, astFiles, info)
+		for _, s := range sources {
+			if !changed[s.name] || s.file.Name.Name != pkgName || isGenerated(s.file) {
+				continue
+			}
+			for _, decl := range s.file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+				name := fn.Name.Name
+				if fn.Recv != nil && receiverType(fn) != "" {
+					name = receiverType(fn) + "." + name
+				}
+				for _, field := range fn.Type.Params.List {
+					size, ok := typeSize(sizes, info.TypeOf(field.Type))
+					if !ok || size <= l.MaxParamBytes {
+						continue
+					}
+					if len(field.Names) == 0 {
+						issues = append(issues, s.issue(field.Pos(), "parameter of type %s of %s is %d bytes, more than %d; pass a pointer instead", s.nodeString(field.Type), name, size, l.MaxParamBytes))
+					}
+					for _, n := range field.Names {
+						issues = append(issues, s.issue(n.Pos(), "parameter %s of %s is %d bytes, more than %d; pass a pointer instead", n.Name, name, size, l.MaxParamBytes))
+					}
+				}
+			}
+		}
+	}
+	return issuesError(l.GetName(), l.filterIssues(issues))
+}
+
+// WaitGroupUsage flags the sync.WaitGroup Add() calls done inside the
+// goroutine they guard.
+//
+// The goroutine may not have started when Wait() is called, so Wait() can
+// return before it is done. An Add() call is flagged when it is lexically in
+// the function literal launched by a go statement that also calls Done() on
+// the same WaitGroup expression, e.g. "wg" or "s.wg". The functions launched
+// by name are not inspected. Generated files are ignored.
+type WaitGroupUsage struct {
+	IssueFilter `yaml:",inline"`
+	FileFilter  `yaml:",inline"`
+}
+
+// GetDescription implements Check.
+func (w *WaitGroupUsage) GetDescription() string {
+	return "flags sync.WaitGroup Add() calls inside the goroutine they guard"
+}
+
+// GetName implements Check.
+func (w *WaitGroupUsage) GetName() string {
+	return "waitgroupusage"
+}
+
+// GetPrerequisites implements Check.
+func (w *WaitGroupUsage) GetPrerequisites() []CheckPrerequisite {
+	return nil
+}
+
+// Run implements Check.
+func (w *WaitGroupUsage) Run(change scm.Change, options *Options) error {
+	var issues Issues
+	for _, s := range parseGoFiles(change, parser.ParseComments, &w.FileFilter, nil) {
+		if isGenerated(s.file) {
+			continue
+		}
+		ast.Inspect(s.file, func(node ast.Node) bool {
+			stmt, ok := node.(*ast.GoStmt)
+			if !ok {
+				return true
+			}
+			lit, ok := stmt.Call.Fun.(*ast.FuncLit)
+			if !ok {
+				return true
+			}
+			var adds []*ast.SelectorExpr
+			dones := map[string]bool{}
+			ast.Inspect(lit.Body, func(node ast.Node) bool {
+				if g, ok := node.(*ast.GoStmt); ok {
+					// The nested goroutines are inspected on their own.
+					_, ok := g.Call.Fun.(*ast.FuncLit)
+					return !ok
+				}
+				call, ok := node.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+					switch {
+					case sel.Sel.Name == "Add" && len(call.Args) == 1:
+						adds = append(adds, sel)
+					case sel.Sel.Name == "Done" && len(call.Args) == 0:
+						dones[s.nodeString(sel.X)] = true
+					}
+				}
+				return true
+			})
+			for _, sel := range adds {
+				if wg := s.nodeString(sel.X); dones[wg] {
+					issues = append(issues, s.issue(sel.Pos(), "%s.Add() is called in the goroutine it guards, racing with %s.Wait(); call it before the go statement", wg, wg))
+				}
+			}
+			return true
+		})
+	}
+	return issuesError(w.GetName(), w.filterIssues(issues))
+}
+
+// Private stuff.
+
+// namingConventions are the naming conventions of JSONNaming.
+var namingConventions = map[string]*regexp.Regexp{
+	"camelCase":  regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`),
+	"snake_case": reSnakeCase,
+}
+
+// knownTagKeys are the struct tag keys commonly used by the standard library
+// and the popular encoding packages. A key differing only by its case is
+// likely a typo.
+var knownTagKeys = []string{"asn1", "bson", "db", "json", "protobuf", "toml", "xml", "yaml"}
+
+// reSnakeCase matches a snake_case identifier.
+var reSnakeCase = regexp.MustCompile(`^[a-z0-9]+(?:_[a-z0-9]+)*$`)
+
+// parseStructTag parses tag per the conventional format of
+// reflect.StructTag: space separated key:"value" pairs. It returns the pairs
+// in order.
+func parseStructTag(tag string) ([][2]string, error) {
+	var pairs [][2]string
+	for tag != "" {
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("expected a key at %q", tag)
+		}
+		if i+1 >= len(tag) || tag[i] != ':' {
+			return nil, fmt.Errorf("expected key:\"value\" at %q", tag)
+		}
+		if tag[i+1] != '"' {
+			return nil, fmt.Errorf("value of key %s is not quoted", tag[:i])
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return nil, fmt.Errorf("value of key %s is missing its closing quote", key)
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			return nil, fmt.Errorf("value of key %s is invalid: %s", key, err)
+		}
+		tag = tag[i+1:]
+		if tag != "" && tag[0] != ' ' {
+			return nil, fmt.Errorf("expected a space after the value of key %s", key)
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+// reMajorVersion matches the major version suffix of an import path.
+var reMajorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// isPackageName returns true if name is a conventional package name for the
+// import path importPath.
+func isPackageName(importPath, name string) bool {
+	base := path.Base(importPath)
+	if reMajorVersion.MatchString(base) && path.Dir(importPath) != "." {
+		base = path.Base(path.Dir(importPath))
+	}
+	if base == name {
+		return true
+	}
+	if i := strings.LastIndex(base, ".v"); i != -1 && reMajorVersion.MatchString(base[i+1:]) {
+		base = base[:i]
+	}
+	base = strings.TrimPrefix(base, "go-")
+	base = strings.TrimSuffix(strings.TrimSuffix(base, "-go"), ".go")
+	clean := strings.NewReplacer("-", "", "_", "", ".", "")
+	return strings.ToLower(clean.Replace(base)) == strings.ToLower(clean.Replace(name))
+}
+
+// flagReaders are the functions that return the value of the command line
+// flags, which are only set once they are parsed.
+var flagReaders = []struct {
+	pkg  string
+	name string
+}{
+	{"flag", "Arg"},
+	{"flag", "Args"},
+	{"flag", "NArg"},
+	{"testing", "Short"},
+	{"testing", "Verbose"},
+}
+
+// testingPackages are the packages that must only be imported from tests.
+var testingPackages = []string{"testing", "testing/quick"}
+
+// testKinds are the kinds of functions run by go test that take an argument.
+var testKinds = []struct {
+	prefix string
+	param  string
+}{
+	{"Test", "T"},
+	{"Benchmark", "B"},
+}
+
+// sourceFile is a Go source file parsed in-process.
+type sourceFile struct {
+	name string
+	fset *token.FileSet
+	file *ast.File
+}
+
+// issue returns an Issue at position p.
+func (s *sourceFile) issue(p token.Pos, format string, a ...interface{}) Issue {
+	pos := s.fset.Position(p)
+	return Issue{File: filepath.ToSlash(s.name), Line: pos.Line, Col: pos.Column, Severity: SeverityError, Message: fmt.Sprintf(format, a...)}
+}
+
+// nodeString returns the source representation of n.
+func (s *sourceFile) nodeString(n ast.Node) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, s.fset, n); err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return b.String()
+}
+
+// parseGoFiles parses the modified Go files that are not ignored, not excluded
+// by filter and for which include returns true.
+//
+// Files that fail to parse are skipped; check build reports them.
+func parseGoFiles(change scm.Change, mode parser.Mode, filter *FileFilter, include func(f string) bool) []*sourceFile {
+	var out []*sourceFile
+	// Do this serially since it's I/O bound and will compete with process
+	// startup of other checks.
+	for _, f := range change.Changed().GoFiles() {
+		if change.IsIgnored(f) || filter.skip(f) || (include != nil && !include(f)) {
+			continue
+		}
+		content := change.Content(f)
+		if content == nil {
+			continue
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, f, content, mode)
+		if err != nil {
+			log.Printf("failed to parse %s: %s", f, err)
+			continue
+		}
+		out = append(out, &sourceFile{f, fset, file})
+	}
+	return out
+}
+
+// parseEmbedPatterns returns the patterns of the arguments of a //go:embed
+// directive. They are separated by spaces and may be quoted as a Go string.
+func parseEmbedPatterns(args string) ([]string, error) {
+	var out []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		end := strings.IndexAny(args, " \t")
+		if args[0] == '"' || args[0] == '`' {
+			end = strings.IndexByte(args[1:], args[0]) + 2
+			if end == 1 {
+				return nil, fmt.Errorf("unterminated quoted pattern %s", args)
+			}
+			if end < len(args) && args[end] != ' ' && args[end] != '\t' {
+				return nil, fmt.Errorf("missing space after quoted pattern %s", args[:end])
+			}
+		}
+		if end == -1 {
+			end = len(args)
+		}
+		p := args[:end]
+		if p[0] == '"' || p[0] == '`' {
+			var err error
+			if p, err = strconv.Unquote(p); err != nil {
+				return nil, fmt.Errorf("invalid quoted pattern %s", args[:end])
+			}
+		}
+		out = append(out, p)
+		args = args[end:]
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no pattern")
+	}
+	return out, nil
+}
+
+// embedMatches returns true if the //go:embed pattern of a file in directory
+// dir matches at least one of files, all in POSIX format relative to the
+// repository root.
+//
+// As with the go tool, a pattern matching a directory matches the files in
+// it recursively, except the ones starting with "." or "_" unless the pattern
+// is prefixed with "all:".
+func embedMatches(pattern, dir string, files []string) (bool, error) {
+	all := strings.HasPrefix(pattern, "all:")
+	if all {
+		pattern = pattern[len("all:"):]
+	}
+	if pattern == "." || pattern == "" || strings.HasPrefix(pattern, "/") || strings.HasSuffix(pattern, "/") {
+		return false, fmt.Errorf("invalid pattern")
+	}
+	for _, e := range strings.Split(pattern, "/") {
+		if e == "" || e == "." || e == ".." {
+			return false, fmt.Errorf("invalid pattern")
+		}
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		rel := f
+		if dir != "." {
+			if !strings.HasPrefix(f, dir+"/") {
+				continue
+			}
+			rel = f[len(dir)+1:]
+		}
+		elems := strings.Split(rel, "/")
+		for i := 1; i <= len(elems); i++ {
+			if ok, _ := path.Match(pattern, strings.Join(elems[:i], "/")); !ok {
+				continue
+			}
+			if i == len(elems) {
+				return true, nil
+			}
+			hidden := false
+			for _, e := range elems[i:] {
+				if !all && (e[0] == '.' || e[0] == '_') {
+					hidden = true
+				}
+			}
+			if !hidden {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// callsRecover returns true if body calls the builtin recover() directly, not
+// from a function literal.
+func callsRecover(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if id, ok := node.Fun.(*ast.Ident); ok && id.Name == "recover" && len(node.Args) == 0 {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// reSentinelError matches the name of a sentinel error, e.g. "ErrNotFound" or
+// "errClosed".
+var reSentinelError = regexp.MustCompile(`^[Ee]rr[A-Z0-9]`)
+
+// errorField returns the name of the first field of type error of struct type
+// name declared in file, or "" if none.
+func errorField(file *ast.File, name string) string {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.Name.Name != name {
+				continue
+			}
+			for _, f := range st.Fields.List {
+				if id, ok := f.Type.(*ast.Ident); !ok || id.Name != "error" {
+					continue
+				}
+				if len(f.Names) == 0 {
+					return "error"
+				}
+				return f.Names[0].Name
+			}
+		}
+	}
+	return ""
+}
+
+// handlerRequest returns the name of the *http.Request parameter if t is the
+// signature of an HTTP handler, (http.ResponseWriter, *http.Request), where
+// package net/http is imported as httpName. Returns nil otherwise.
+func handlerRequest(t *ast.FuncType, httpName string) *ast.Ident {
+	isHTTP := func(e ast.Expr, name string) bool {
+		sel, ok := e.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != name {
+			return false
+		}
+		id, ok := sel.X.(*ast.Ident)
+		return ok && id.Name == httpName
+	}
+	var types []ast.Expr
+	var names []*ast.Ident
+	for _, f := range t.Params.List {
+		if len(f.Names) == 0 {
+			types = append(types, f.Type)
+			names = append(names, ast.NewIdent("_"))
+		}
+		for _, n := range f.Names {
+			types = append(types, f.Type)
+			names = append(names, n)
+		}
+	}
+	if len(types) != 2 || !isHTTP(types[0], "ResponseWriter") {
+		return nil
+	}
+	if star, ok := types[1].(*ast.StarExpr); ok && isHTTP(star.X, "Request") {
+		return names[1]
+	}
+	return nil
+}
+
+// testReports returns if body reports a failure via the *testing.T t, either
+// with one of its methods or by passing it to a helper, and if it calls
+// t.Run(). The function literals are skipped, as they have their own t.
+func testReports(body *ast.BlockStmt, t string) (reports, subtest bool) {
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == t {
+					switch sel.Sel.Name {
+					case "Run":
+						subtest = true
+					case "Error", "Errorf", "Fail", "FailNow", "Fatal", "Fatalf":
+						reports = true
+					}
+				}
+			}
+			if len(node.Args) != 0 {
+				if id, ok := node.Args[0].(*ast.Ident); ok && id.Name == t {
+					reports = true
+				}
+			}
+		}
+		return true
+	})
+	return
+}
+
+// mustCheckPattern is a parsed MustCheck.Functions item.
+type mustCheckPattern struct {
+	// s is the pattern as configured.
+	s string
+	// qual is the package, by name or import path, or the variable name. It is
+	// the package of the type for a method of a type.
+	qual string
+	// typ is the type name for a method of a type.
+	typ string
+	// name is the function or method name.
+	name string
+}
+
+// reMustCheckMethod matches a method of a type, e.g. "(*os.File).Close".
+var reMustCheckMethod = regexp.MustCompile(`^\(\*?(.+)\.(\w+)\)\.(\w+)$`)
+
+// parseMustCheckPattern parses a MustCheck.Functions item.
+func parseMustCheckPattern(s string) (mustCheckPattern, error) {
+	if m := reMustCheckMethod.FindStringSubmatch(s); m != nil {
+		return mustCheckPattern{s, m[1], m[2], m[3]}, nil
+	}
+	if i := strings.LastIndex(s, "."); i > 0 && i < len(s)-1 && !strings.ContainsAny(s, "()* ") {
+		return mustCheckPattern{s: s, qual: s[:i], name: s[i+1:]}, nil
+	}
+	return mustCheckPattern{}, fmt.Errorf("invalid function %q; expected \"pkg.Func\", \"(*pkg.Type).Method\" or \"variable.Method\"", s)
+}
+
+// isPackage returns true if qual designates the package imported as path,
+// either by its import path or its last element.
+func isPackage(qual, path string) bool {
+	return qual == path || qual == path[strings.LastIndex(path, "/")+1:]
+}
+
+// matchMustCheck returns the pattern matching call, or "" if none does.
+//
+// imports maps the names of the imported packages to their path and vars the
+// names of the variables to their type, as returned by varTypes.
+func matchMustCheck(patterns []mustCheckPattern, call *ast.CallExpr, imports, vars map[string]string) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	for _, p := range patterns {
+		if p.name != sel.Sel.Name {
+			continue
+		}
+		if path, ok := imports[id.Name]; ok {
+			if p.typ == "" && isPackage(p.qual, path) {
+				return p.s
+			}
+			continue
+		}
+		if p.typ == "" {
+			if p.qual == id.Name {
+				return p.s
+			}
+			continue
+		}
+		t := vars[id.Name]
+		if i := strings.LastIndex(t, "."); i != -1 && isPackage(p.qual, t[:i]) && (t[i+1:] == p.typ || t[i+1:] == "") {
+			return p.s
+		}
+	}
+	return ""
+}
+
+// matchDisallowed returns the item of disallowed matching call, or "" if none
+// does.
+//
+// imports maps the names of the imported packages to their path, as returned
+// by importPaths.
+func matchDisallowed(disallowed []string, call *ast.CallExpr, imports map[string]string) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	path, ok := imports[id.Name]
+	if !ok {
+		return ""
+	}
+	for _, d := range disallowed {
+		i := strings.LastIndex(d, ".")
+		if name := d[i+1:]; (name == "*" || name == sel.Sel.Name) && isPackage(d[:i], path) {
+			return d
+		}
+	}
+	return ""
+}
+
+// importPaths returns the import path of each package imported by file, per
+// the name used to reference it.
+func importPaths(file *ast.File) map[string]string {
+	out := map[string]string{}
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if name := importName(file, p); name != "" {
+			out[name] = p
+		}
+	}
+	return out
+}
+
+// varTypes returns the type of the variables of fn whose type is from an
+// imported package, as "<import path>.<type>", e.g. "os.File".
+//
+// The variables assigned from a call to a function of an imported package
+// have the type "<import path>.", as their type is unknown but likely from
+// this package, e.g. "f, err := os.Open(p)". Scopes are ignored.
+func varTypes(fn *ast.FuncDecl, imports map[string]string) map[string]string {
+	out := map[string]string{}
+	typeName := func(e ast.Expr) string {
+		if star, ok := e.(*ast.StarExpr); ok {
+			e = star.X
+		}
+		if sel, ok := e.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && imports[id.Name] != "" {
+				return imports[id.Name] + "." + sel.Sel.Name
+			}
+		}
+		return ""
+	}
+	addFields := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		for _, f := range fields.List {
+			if t := typeName(f.Type); t != "" {
+				for _, n := range f.Names {
+					out[n.Name] = t
+				}
+			}
+		}
+	}
+	addFields(fn.Recv)
+	addFields(fn.Type.Params)
+	addFields(fn.Type.Results)
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			addFields(node.Type.Params)
+			addFields(node.Type.Results)
+		case *ast.ValueSpec:
+			if t := typeName(node.Type); t != "" {
+				for _, n := range node.Names {
+					out[n.Name] = t
+				}
+			}
+		case *ast.AssignStmt:
+			if len(node.Rhs) != 1 {
+				break
+			}
+			call, ok := node.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				break
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				break
+			}
+			if id, ok := sel.X.(*ast.Ident); ok && imports[id.Name] != "" {
+				if v, ok := node.Lhs[0].(*ast.Ident); ok && v.Name != "_" {
+					out[v.Name] = imports[id.Name] + "."
+				}
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// lostCancels returns the issues of the cancel functions returned by the
+// context functions called in body, excluding its function literals, that are
+// not called on all paths. pkgs are the names of the context packages.
+func lostCancels(s *sourceFile, body *ast.BlockStmt, pkgs []string) Issues {
+	var issues Issues
+	inspectFunc(body, func(n ast.Node) {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Lhs) != 2 || len(assign.Rhs) != 1 {
+			return
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		fn := ""
+		for _, pkg := range pkgs {
+			for _, name := range []string{"WithCancel", "WithDeadline", "WithTimeout"} {
+				if isPkgCall(call, pkg, name) {
+					fn = "context." + name
+				}
+			}
+		}
+		if fn == "" {
+			return
+		}
+		cancel, ok := assign.Lhs[1].(*ast.Ident)
+		if !ok {
+			// Stored in a field or an element, so it escapes.
+			return
+		}
+		if cancel.Name == "_" {
+			issues = append(issues, s.issue(cancel.Pos(), "the cancel function returned by %s is discarded; the context leaks", fn))
+			return
+		}
+		same := func(id *ast.Ident) bool {
+			if id.Obj != nil && cancel.Obj != nil {
+				return id.Obj == cancel.Obj
+			}
+			return id.Name == cancel.Name
+		}
+		// Look at the uses of cancel following the assignment, including in the
+		// function literals.
+		var firstCall token.Pos
+		handled := false
+		var walk func(n ast.Node, deferred bool)
+		walk = func(n ast.Node, deferred bool) {
+			ast.Inspect(n, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.DeferStmt:
+					if !deferred {
+						walk(n.Call, true)
+						return false
+					}
+				case *ast.CallExpr:
+					if id, ok := n.Fun.(*ast.Ident); ok && same(id) {
+						if deferred {
+							handled = true
+						} else if firstCall == token.NoPos {
+							firstCall = n.Pos()
+						}
+						for _, arg := range n.Args {
+							walk(arg, deferred)
+						}
+						return false
+					}
+				case *ast.Ident:
+					if n != cancel && same(n) {
+						// Used as a value: returned, stored or passed.
+						handled = true
+					}
+				}
+				return true
+			})
+		}
+		for _, stmt := range body.List {
+			if stmt.End() > assign.End() {
+				walk(stmt, false)
+			}
+		}
+		if handled {
+			return
+		}
+		if firstCall == token.NoPos {
+			issues = append(issues, s.issue(cancel.Pos(), "%s returned by %s is never called; defer %s()", cancel.Name, fn, cancel.Name))
+			return
+		}
+		var early ast.Node
+		inspectFunc(body, func(n ast.Node) {
+			if ret, ok := n.(*ast.ReturnStmt); ok && early == nil && ret.Pos() > assign.End() && ret.Pos() < firstCall {
+				early = ret
+			}
+		})
+		if early != nil {
+			issues = append(issues, s.issue(cancel.Pos(), "%s returned by %s is not called on all paths, e.g. the return at line %d; defer %s()", cancel.Name, fn, s.fset.Position(early.Pos()).Line, cancel.Name))
+		}
+	})
+	return issues
+}
+
+// inspectFunc calls fn for each node of body, excluding the function
+// literals.
+func inspectFunc(body *ast.BlockStmt, fn func(n ast.Node)) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if n != nil {
+			fn(n)
+		}
+		return true
+	})
+}
+
+// pkgTypes are the interfaces and the methods of the named types declared in
+// a package.
+type pkgTypes struct {
+	// interfaces are the interface type declarations.
+	interfaces map[string]*ast.InterfaceType
+	// concrete are the names of the other named types.
+	concrete map[string]bool
+	// methods are the methods of each type, with a pointer receiver or not.
+	methods map[string]map[string]bool
+	// valueMethods are the methods of each type with a value receiver.
+	valueMethods map[string]map[string]bool
+}
+
+func newPkgTypes() *pkgTypes {
+	return &pkgTypes{
+		interfaces:   map[string]*ast.InterfaceType{},
+		concrete:     map[string]bool{},
+		methods:      map[string]map[string]bool{},
+		valueMethods: map[string]map[string]bool{},
+	}
+}
+
+// add adds the declarations of file.
+func (p *pkgTypes) add(file *ast.File) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if it, ok := ts.Type.(*ast.InterfaceType); ok {
+						p.interfaces[ts.Name.Name] = it
+					} else {
+						p.concrete[ts.Name.Name] = true
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				continue
+			}
+			t := receiverType(decl)
+			if p.methods[t] == nil {
+				p.methods[t] = map[string]bool{}
+				p.valueMethods[t] = map[string]bool{}
+			}
+			p.methods[t][decl.Name.Name] = true
+			if _, ok := decl.Recv.List[0].Type.(*ast.StarExpr); !ok {
+				p.valueMethods[t][decl.Name.Name] = true
+			}
+		}
+	}
+}
+
+// interfaceMethods returns the methods of the interface name, or nil if they
+// can't be resolved, e.g. when it embeds an interface of another package.
+func (p *pkgTypes) interfaceMethods(name string, depth int) []string {
+	it := p.interfaces[name]
+	if it == nil || depth > 10 {
+		return nil
+	}
+	var out []string
+	for _, m := range it.Methods.List {
+		if len(m.Names) != 0 {
+			for _, n := range m.Names {
+				out = append(out, n.Name)
+			}
+			continue
+		}
+		id, ok := m.Type.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		embedded := p.interfaceMethods(id.Name, depth+1)
+		if embedded == nil {
+			return nil
+		}
+		out = append(out, embedded...)
+	}
+	return out
+}
+
+// implementers returns the types implementing the interface name, as "T" or
+// "*T" when only the pointer implements it.
+func (p *pkgTypes) implementers(name string) []string {
+	methods := p.interfaceMethods(name, 0)
+	if len(methods) == 0 {
+		// Everything implements the empty interface.
+		return nil
+	}
+	var out []string
+	for t := range p.concrete {
+		value, ptr := true, true
+		for _, m := range methods {
+			value = value && p.valueMethods[t][m]
+			ptr = ptr && p.methods[t][m]
+		}
+		if value {
+			out = append(out, t)
+		} else if ptr {
+			out = append(out, "*"+t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// unhandled returns the interface switched on by sw and its implementers not
+// handled by the cases, if sw has no default case.
+func (p *pkgTypes) unhandled(sw *ast.TypeSwitchStmt) (string, []string) {
+	var x ast.Expr
+	switch a := sw.Assign.(type) {
+	case *ast.ExprStmt:
+		x = a.X
+	case *ast.AssignStmt:
+		x = a.Rhs[0]
+	}
+	assert, ok := x.(*ast.TypeAssertExpr)
+	if !ok {
+		return "", nil
+	}
+	// The named types of the cases, without the pointer.
+	var cases []string
+	for _, stmt := range sw.Body.List {
+		clause := stmt.(*ast.CaseClause)
+		if clause.List == nil {
+			return "", nil
+		}
+		for _, e := range clause.List {
+			if star, ok := e.(*ast.StarExpr); ok {
+				e = star.X
+			}
+			if id, ok := e.(*ast.Ident); ok && id.Name != "nil" {
+				cases = append(cases, id.Name)
+			}
+		}
+	}
+	iface := ""
+	if id, ok := assert.X.(*ast.Ident); ok && id.Obj != nil {
+		var t ast.Expr
+		switch decl := id.Obj.Decl.(type) {
+		case *ast.Field:
+			t = decl.Type
+		case *ast.ValueSpec:
+			t = decl.Type
+		}
+		if tid, ok := t.(*ast.Ident); ok && p.interfaces[tid.Name] != nil {
+			iface = tid.Name
+		}
+	}
+	if iface == "" {
+		// Look for the only interface implemented by all the concrete types of
+		// the cases.
+		var candidates []string
+		for name := range p.interfaces {
+			impl := p.implementers(name)
+			found := 0
+			for _, c := range cases {
+				if p.concrete[c] && (contains(impl, c) || contains(impl, "*"+c)) {
+					found++
+				}
+			}
+			if found != 0 && found == len(cases) {
+				candidates = append(candidates, name)
+			}
+		}
+		if len(candidates) != 1 {
+			return "", nil
+		}
+		iface = candidates[0]
+	}
+	handled := map[string]bool{}
+	for _, c := range cases {
+		handled[c] = true
+		for _, impl := range p.implementers(c) {
+			handled[strings.TrimPrefix(impl, "*")] = true
+		}
+	}
+	var missing []string
+	for _, impl := range p.implementers(iface) {
+		if !handled[strings.TrimPrefix(impl, "*")] {
+			missing = append(missing, impl)
+		}
+	}
+	return iface, missing
+}
+
+// lessIssues returns the issues of the less function fn, with parameters
+// (i, j) and body body.
+func lessIssues(s *sourceFile, fn string, t *ast.FuncType, body *ast.BlockStmt) Issues {
+	var params []*ast.Ident
+	for _, f := range t.Params.List {
+		params = append(params, f.Names...)
+	}
+	if len(params) != 2 {
+		return nil
+	}
+	// uses returns the parameters referenced by e.
+	uses := func(e ast.Node) map[string]bool {
+		out := map[string]bool{}
+		ast.Inspect(e, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				for _, p := range params {
+					if id.Name == p.Name && id.Name != "_" {
+						out[id.Name] = true
+					}
+				}
+			}
+			return true
+		})
+		return out
+	}
+	var issues Issues
+	used := uses(body)
+	for _, p := range params {
+		if !used[p.Name] {
+			issues = append(issues, s.issue(p.Pos(), "less function of %s doesn't use both indices", fn))
+		}
+	}
+	if len(issues) != 0 {
+		return issues
+	}
+	i, j := params[0].Name, params[1].Name
+	inspectFunc(body, func(n ast.Node) {
+		b, ok := n.(*ast.BinaryExpr)
+		if !ok {
+			return
+		}
+		switch b.Op {
+		case token.LEQ, token.GEQ:
+			x, y := uses(b.X), uses(b.Y)
+			if (x[i] && y[j]) || (x[j] && y[i]) {
+				strict := map[token.Token]string{token.LEQ: "<", token.GEQ: ">"}[b.Op]
+				issues = append(issues, s.issue(b.OpPos, "less function of %s compares with %s; use %s for a strict weak ordering", fn, b.Op, strict))
+			}
+		case token.LSS, token.GTR:
+			x, y := uses(b.X), uses(b.Y)
+			for _, p := range []string{i, j} {
+				if len(x) == 1 && len(y) == 1 && x[p] && y[p] {
+					issues = append(issues, s.issue(b.OpPos, "less function of %s compares %s with %s, both indexed by %s", fn, s.nodeString(b.X), s.nodeString(b.Y), p))
+				}
+			}
+		}
+	})
+	return issues
+}
+
+// isStdlibImport returns true if the import path p is likely from the standard
+// library, as its first element doesn't contain a dot, unless it is from the
+// repository's package pkg, e.g. in GOPATH mode.
+func isStdlibImport(p, pkg string) bool {
+	if pkg != "" && (p == pkg || strings.HasPrefix(p, pkg+"/")) {
+		return false
+	}
+	return !strings.Contains(strings.SplitN(p, "/", 2)[0], ".")
+}
+
+// testExport is a package level symbol exported by an internal test file.
+type testExport struct {
+	name   string
+	pos    token.Pos
+	isFunc bool
+}
+
+// exportedForTests returns the exported package level symbols declared in
+// the internal test file, excluding the test functions themselves.
+func exportedForTests(file *ast.File) []testExport {
+	var out []testExport
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name := decl.Name.Name
+			if decl.Recv != nil || !ast.IsExported(name) {
+				continue
+			}
+			if isTestName(name, "Test") || isTestName(name, "Benchmark") || isTestName(name, "Example") || isTestName(name, "Fuzz") {
+				continue
+			}
+			out = append(out, testExport{name, decl.Name.Pos(), true})
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						out = append(out, testExport{spec.Name.Name, spec.Name.Pos(), false})
+					}
+				case *ast.ValueSpec:
+					for i, n := range spec.Names {
+						if !n.IsExported() {
+							continue
+						}
+						isFunc := false
+						if i < len(spec.Values) {
+							_, isFunc = spec.Values[i].(*ast.FuncLit)
+						}
+						out = append(out, testExport{n.Name, n.Pos(), isFunc})
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// importName returns the name used to reference the package imported as path
+// in file. Returns "" if the package is not imported or is imported as "_" or
+// ".".
+func importName(file *ast.File, path string) string {
+	for _, imp := range file.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err != nil || p != path {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == "_" || imp.Name.Name == "." {
+				return ""
+			}
+			return imp.Name.Name
+		}
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+	return ""
+}
+
+// isPkgCall returns true if call is a call to function fn of the package
+// imported as pkg.
+func isPkgCall(call *ast.CallExpr, pkg, fn string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != fn {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == pkg
+}
+
+// errorExprName returns the name of the error referenced by e, or "" if e
+// doesn't look like an error.
+//
+// Without type analysis, it relies on naming conventions; "err", "err2",
+// "readErr", "x.err" or "err.Error()".
+func errorExprName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if isErrorName(e.Name) {
+			return e.Name
+		}
+	case *ast.SelectorExpr:
+		if isErrorName(e.Sel.Name) {
+			return e.Sel.Name
+		}
+	case *ast.CallExpr:
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Error" && len(e.Args) == 0 {
+			if name := errorExprName(sel.X); name != "" {
+				return name + ".Error()"
+			}
+		}
+	}
+	return ""
+}
+
+func isErrorName(name string) bool {
+	if strings.HasSuffix(name, "Err") {
+		return true
+	}
+	return strings.HasPrefix(name, "err") && strings.Trim(name[3:], "0123456789") == ""
+}
+
+// formatVerbs returns the verb used for each argument of a printf style format
+// string. '*' is used for arguments consumed by a width or a precision.
+func formatVerbs(format string) []rune {
+	var verbs []rune
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// Skip the flags, width and precision.
+		for i++; i < len(format); i++ {
+			c := format[i]
+			if c == '*' {
+				verbs = append(verbs, '*')
+			} else if strings.IndexByte("+-# 0123456789.[]", c) == -1 {
+				break
+			}
+		}
+		if i < len(format) && format[i] != '%' {
+			verbs = append(verbs, rune(format[i]))
+		}
+	}
+	return verbs
+}
+
+// errorResults returns the indexes of the results of type error.
+func errorResults(t *ast.FuncType) []int {
+	var out []int
+	if t.Results == nil {
+		return out
+	}
+	i := 0
+	for _, field := range t.Results.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		if id, ok := field.Type.(*ast.Ident); ok && id.Name == "error" {
+			for j := 0; j < n; j++ {
+				out = append(out, i+j)
+			}
+		}
+		i += n
+	}
+	return out
+}
+
+// pointerVars returns the variables declared in body with a pointer type,
+// either explicitly, via a conversion like "(*T)(nil)" or as the result of one
+// of funcs.
+func pointerVars(s *sourceFile, body *ast.BlockStmt, funcs map[string]string) map[string]string {
+	vars := map[string]string{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ValueSpec:
+			if star, ok := n.Type.(*ast.StarExpr); ok {
+				for _, name := range n.Names {
+					vars[name.Name] = s.nodeString(star)
+				}
+			}
+		case *ast.AssignStmt:
+			if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, rhs := range n.Rhs {
+				id, ok := n.Lhs[i].(*ast.Ident)
+				call, ok2 := rhs.(*ast.CallExpr)
+				if !ok || !ok2 {
+					continue
+				}
+				switch fun := call.Fun.(type) {
+				case *ast.ParenExpr:
+					if star, ok := fun.X.(*ast.StarExpr); ok {
+						vars[id.Name] = s.nodeString(star)
+					}
+				case *ast.Ident:
+					if typ := funcs[fun.Name]; typ != "" {
+						vars[id.Name] = typ
+					}
+				}
+			}
+		}
+		return true
+	})
+	return vars
+}
+
+// contextParam returns the index of the first context.Context parameter of t,
+// the package context being imported as one of pkgs, or -1 if there is none.
+func contextParam(t *ast.FuncType, pkgs []string) int {
+	i := 0
+	for _, field := range t.Params.List {
+		if sel, ok := field.Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "Context" {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				for _, pkg := range pkgs {
+					if id.Name == pkg {
+						return i
+					}
+				}
+			}
+		}
+		if n := len(field.Names); n != 0 {
+			i += n
+		} else {
+			i++
+		}
+	}
+	return -1
+}
+
+// funcSignature returns the signature of fn without its body, e.g.
+// "func (f *Foo) Bar(a, b int) error".
+func funcSignature(s *sourceFile, fn *ast.FuncDecl) string {
+	sig := "func "
+	if fn.Recv != nil && len(fn.Recv.List) == 1 {
+		recv := fn.Recv.List[0]
+		sig += "("
+		if len(recv.Names) == 1 {
+			sig += recv.Names[0].Name + " "
+		}
+		sig += s.nodeString(recv.Type) + ") "
+	}
+	return sig + fn.Name.Name + strings.TrimPrefix(s.nodeString(fn.Type), "func")
+}
+
+// countExported returns the number of exported types, functions, variables
+// and constants declared at the top level of file.
+func countExported(file *ast.File) int {
+	count := 0
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.IsExported() {
+				count++
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						count++
+					}
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						if n.IsExported() {
+							count++
+						}
+					}
+				}
+			}
+		}
+	}
+	return count
+}
+
+// fieldName returns the names of the struct field, or its type when embedded.
+func fieldName(s *sourceFile, field *ast.Field) string {
+	if len(field.Names) == 0 {
+		return s.nodeString(field.Type)
+	}
+	names := make([]string, 0, len(field.Names))
+	for _, n := range field.Names {
+		names = append(names, n.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// isErrorMethod returns true if fn is a method with the signature of
+// error.Error().
+func isErrorMethod(fn *ast.FuncDecl) bool {
+	if fn.Recv == nil || len(fn.Recv.List) != 1 || fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != 1 {
+		return false
+	}
+	id, ok := fn.Type.Results.List[0].Type.(*ast.Ident)
+	return ok && id.Name == "string"
+}
+
+// receiverType returns the name of the type of the receiver of method fn.
+func receiverType(fn *ast.FuncDecl) string {
+	t := fn.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// typeSize returns the size of a value of type t. Returns false if t is
+// unknown or invalid.
+func typeSize(sizes types.Sizes, t types.Type) (size int64, ok bool) {
+	if t == nil || t == types.Typ[types.Invalid] {
+		return 0, false
+	}
+	// The size of a type parameter is unknown; Sizeof panics.
+	defer func() {
+		if recover() != nil {
+			size, ok = 0, false
+		}
+	}()
+	return sizes.Sizeof(t), true
+}
+
+// matchPatterns returns true if name matches one of the path.Match()
+// patterns. A pattern without "/" also matches the base name of name.
+func matchPatterns(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, path.Base(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isGenerated returns true if file has the "// Code generated ... DO NOT
+// EDIT." comment before the package clause. file must be parsed with
+// parser.ParseComments.
+func isGenerated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") && strings.HasSuffix(c.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTestName returns true if name is recognized by go test for the functions
+// of kind prefix, e.g. "TestFoo" or "Test_foo" but not "Testfoo".
+func isTestName(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
+
+// reOutput matches the output comment of an example, like go test does.
+var reOutput = regexp.MustCompile(`(?i)^[[:space:]]*(unordered )?output:`)
+
+// hasOutputComment returns true if the last comment of body is an example
+// output comment. file must be parsed with parser.ParseComments.
+func hasOutputComment(file *ast.File, body *ast.BlockStmt) bool {
+	var last *ast.CommentGroup
+	for _, group := range file.Comments {
+		if group.Pos() > body.Lbrace && group.End() < body.Rbrace {
+			last = group
+		}
+	}
+	return last != nil && reOutput.MatchString(last.Text())
+}
+
+// hasTestSignature returns true if fn is func(*testing.<param>), where testing
+// is the name the package testing is imported as.
+func hasTestSignature(fn *ast.FuncDecl, testing, param string) bool {
+	if testing == "" || fn.Type.Results.NumFields() != 0 || fn.Type.Params.NumFields() != 1 {
+		return false
+	}
+	star, ok := fn.Type.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != param {
+		return false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	return ok && id.Name == testing
+}
+
+func isTestFile(f string) bool {
+	return strings.HasSuffix(f, "_test.go")
+}
+
+func isNotTestFile(f string) bool {
+	return !isTestFile(f)
+}
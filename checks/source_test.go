@@ -0,0 +1,1721 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package checks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestTestingImport(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go":             "package foo\n\nimport \"testing\"\n",
+		"foo_test.go":        "package foo\n\nimport \"testing\"\n",
+		"quick/quick.go":     "package quick\n\nimport (\n\t\"fmt\"\n\t\"testing/quick\"\n)\n",
+		"testutil/util.go":   "package testutil\n\nimport \"testing\"\n",
+		"nothing/nothing.go": "package nothing\n",
+	}
+	expected := errors.New("testingimport failed:\nfoo.go:3:8: imports testing from non-test code\nquick/quick.go:5:2: imports testing/quick from non-test code")
+	ut.AssertEqual(t, expected, runCheck(t, &TestingImport{IssueFilter: IssueFilter{Blacklist: []string{"testutil/"}}}, files))
+}
+
+func TestFileFilterChecks(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go":      "package foo\n",
+		"foo_test.go": "package foo\n\nimport \"testing\"\n\nfunc Testfoo(t *testing.T) {}\n\nfunc TestMain(m *testing.M) {}\n",
+	}
+	filter := FileFilter{SkipTestFiles: true}
+	data := []struct {
+		check, filtered Check
+	}{
+		{&TestNaming{}, &TestNaming{FileFilter: filter}},
+		{&TestMainUsage{}, &TestMainUsage{FileFilter: filter}},
+	}
+	for i, line := range data {
+		ut.AssertEqualIndex(t, i, true, runCheck(t, line.check, files) != nil)
+		ut.AssertEqualIndex(t, i, nil, runCheck(t, line.filtered, files))
+	}
+	// The test files are not checked but they still count as the tests of the
+	// package.
+	ut.AssertEqual(t, nil, runCheck(t, &RequireTests{FileFilter: filter}, files))
+}
+
+func TestErrorComparison(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var ErrFoo = errors.New("foo")
+
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (p *PathError) Error() string { return p.Path + ": " + p.Err.Error() }
+
+type WrapError struct {
+	error
+}
+
+func (w WrapError) Error() string { return "wrap" }
+
+func (w WrapError) Unwrap() error { return w.error }
+
+func (w WrapError) Is(target error) bool { return target == ErrFoo }
+
+func A(err error) bool {
+	if err == ErrFoo || os.ErrNotExist != err {
+		return true
+	}
+	switch err {
+	case nil, io.EOF:
+	case ErrFoo:
+	}
+	if _, ok := err.(*PathError); ok {
+		return true
+	}
+	switch err.(type) {
+	}
+	return err == nil || err == io.EOF
+}
+`,
+	}
+	check := &ErrorComparison{}
+	expected := errors.New("errorcomparison failed:\n" +
+		"foo.go:16:21: PathError wraps an error in field Err but has no Unwrap method; errors.Is and errors.As can't see it\n" +
+		"foo.go:29:5: err == ErrFoo fails on wrapped errors; use errors.Is(err, ErrFoo)\n" +
+		"foo.go:29:22: os.ErrNotExist != err fails on wrapped errors; use !errors.Is(err, os.ErrNotExist)\n" +
+		"foo.go:34:7: case ErrFoo fails on wrapped errors; use errors.Is(err, ErrFoo)\n" +
+		"foo.go:36:14: err.(*PathError) fails on wrapped errors; use errors.As")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check.Sentinels = []string{"io.EOF"}
+	check.Blacklist = []string{"ErrFoo", "Unwrap", "errors.As"}
+	expected = errors.New("errorcomparison failed:\n" +
+		"foo.go:29:22: os.ErrNotExist != err fails on wrapped errors; use !errors.Is(err, os.ErrNotExist)\n" +
+		"foo.go:33:12: case io.EOF fails on wrapped errors; use errors.Is(err, io.EOF)\n" +
+		"foo.go:41:23: err == io.EOF fails on wrapped errors; use errors.Is(err, io.EOF)")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+}
+
+func TestErrorNaming(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"errors"
+	e "fmt"
+)
+
+var (
+	ErrGood          = errors.New("good")
+	NotFound         = errors.New("not found")
+	ErrorTimeout     = e.Errorf("timeout")
+	Unknown    error = nil
+	Legacy           = errors.New("legacy")
+	notExported      = errors.New("not exported")
+	Count            = 1
+)
+
+type Failure struct{}
+
+type GoodError struct{}
+
+type ParseErr struct{}
+
+type notExportedErr struct{}
+`,
+		"methods.go": `package foo
+
+func (f *Failure) Error() string { return "" }
+
+func (g GoodError) Error() string { return "" }
+
+func (p ParseErr) Error() string { return "" }
+
+func (n notExportedErr) Error() string { return "" }
+`,
+		"foo_test.go": `package foo
+
+import "errors"
+
+var Test = errors.New("test")
+`,
+	}
+	expected := errors.New("errornaming failed:\n" +
+		"foo.go:10:2: error variable NotFound must be named ErrNotFound\n" +
+		"foo.go:11:2: error variable ErrorTimeout must be named ErrTimeout\n" +
+		"foo.go:12:2: error variable Unknown must be named ErrUnknown\n" +
+		"foo.go:18:6: error type Failure must be named FailureError\n" +
+		"foo.go:22:6: error type ParseErr must be named ParseError")
+	ut.AssertEqual(t, expected, runCheck(t, &ErrorNaming{IssueFilter: IssueFilter{Blacklist: []string{"Legacy"}}}, files))
+}
+
+func TestErrorWrap(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"errors"
+	f "fmt"
+)
+
+func Foo(err error, readErr error) error {
+	if err != nil {
+		return f.Errorf("%d: %v", 1, err)
+	}
+	if readErr != nil {
+		return f.Errorf("%*d %s", 3, 1, readErr.Error())
+	}
+	if err == nil {
+		return f.Errorf("%w %%v %v", err, "foo")
+	}
+	return err
+}
+
+var errFoo = errors.New("foo")
+`,
+	}
+	expected := errors.New("errorwrap failed:\nfoo.go:10:32: fmt.Errorf formats error err with %v, use %w to wrap it\nfoo.go:13:35: fmt.Errorf formats error readErr.Error() with %s, use %w to wrap it")
+	ut.AssertEqual(t, expected, runCheck(t, &ErrorWrap{}, files))
+	expected = errors.New("errorwrap failed:\nfoo.go:10:32: fmt.Errorf formats error err with %v, use %w to wrap it\nfoo.go:13:35: fmt.Errorf formats error readErr.Error() with %s, use %w to wrap it\nfoo.go:18:9: error err is returned without context, wrap it with fmt.Errorf(\"...: %w\", err)")
+	ut.AssertEqual(t, expected, runCheck(t, &ErrorWrap{RequireContext: true}, files))
+}
+
+func TestFormatVerbs(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, []rune{'d', 'v'}, formatVerbs("%d: %v"))
+	ut.AssertEqual(t, []rune{'*', 'd', 's'}, formatVerbs("%*d %s"))
+	ut.AssertEqual(t, []rune{'w', 'v'}, formatVerbs("%w %% %-08.3v"))
+	ut.AssertEqual(t, []rune(nil), formatVerbs("100%%"))
+}
+
+func TestTestNaming(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": "package foo\n\nfunc testFoo(t *testing.T) {\n}\n",
+		"foo_test.go": `package foo
+
+import "testing"
+
+func TestMain(m *testing.M) {
+}
+
+func TestGood(t *testing.T) {
+}
+
+func Test_good(t *testing.T) {
+}
+
+func TestValue(t testing.T) {
+}
+
+func Testlower(t *testing.T) {
+}
+
+func testHelper(t *testing.T, i int) {
+}
+
+func BenchmarkFoo(t *testing.T) {
+}
+
+func benchmarkFoo(b *testing.B) {
+}
+
+func ExampleFoo() {
+}
+
+func ExampleBar(t *testing.T) {
+}
+
+func (f *foo) TestMethod() {
+}
+`,
+	}
+	expected := errors.New("testnaming failed:\n" +
+		"foo_test.go:14:6: TestValue has signature func(t testing.T), expected func(*testing.T)\n" +
+		"foo_test.go:17:6: Testlower won't be run, it must be named TestXxx\n" +
+		"foo_test.go:23:6: BenchmarkFoo has signature func(t *testing.T), expected func(*testing.B)\n" +
+		"foo_test.go:26:6: benchmarkFoo won't be run, it must be named BenchmarkXxx\n" +
+		"foo_test.go:32:6: ExampleBar has signature func(t *testing.T), expected func()")
+	ut.AssertEqual(t, expected, runCheck(t, &TestNaming{}, files))
+}
+
+func TestBuildConstraints(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"ok_linux.go":      "//go:build linux && !cgo\n// +build linux,!cgo\n\npackage foo\n",
+		"ignore.go":        "// Copyright\n\n// +build ignore\n\npackage foo\n",
+		"never_windows.go": "// +build linux\n\npackage foo\n",
+		"contradiction.go": "//go:build linux && darwin\n\npackage foo\n",
+		"disagree.go":      "//go:build linux\n// +build darwin\n\npackage foo\n",
+		"noblank.go":       "// +build linux\npackage foo\n",
+		"late.go":          "package foo\n\n// +build linux\n\nvar s = `\n// +build linux\n`\n",
+		"malformed.go":     "// +build: linux\n\n//go:build (linux\n\n// go:build linux\n\npackage foo\n",
+	}
+	expected := errors.New("buildconstraints failed:\n" +
+		"contradiction.go:1: build constraints never match any target\n" +
+		"disagree.go:1: //go:build and // +build lines disagree\n" +
+		"late.go:3: build constraint after the package clause is ignored\n" +
+		"malformed.go:1: invalid // +build line: expected \"+build\", got \"+build:\"\n" +
+		"malformed.go:3: invalid //go:build line: missing )\n" +
+		"malformed.go:5: malformed //go:build line, remove the space after //\n" +
+		"never_windows.go:1: build constraints never match any target\n" +
+		"noblank.go:1: build constraint must be followed by a blank line, it is ignored")
+	ut.AssertEqual(t, expected, runCheck(t, &BuildConstraints{}, files))
+}
+
+func TestEmbed(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "embed"
+
+//go:embed static/a.txt
+var a string
+
+//go:embed static/missing.txt "static/*.html"
+var b embed.FS
+
+//go:embed hidden
+var c embed.FS
+
+//go:embed all:hidden static
+var d embed.FS
+
+//go:embed ../x
+var e string
+
+//go:embed "unterminated
+var f string
+`,
+		"static/a.txt":     "a",
+		"hidden/_b.txt":    "b",
+		"bar/bar.go":       "package bar\n\nimport _ \"embed\"\n\n//go:embed a.txt\nvar A string\n",
+		"bar/a.txt":        "a",
+		"bar/ignored.html": "",
+	}
+	expected := errors.New("embed failed:\n" +
+		"foo.go:8:1: //go:embed static/*.html matches no file\n" +
+		"foo.go:8:1: //go:embed static/missing.txt matches no file\n" +
+		"foo.go:11:1: //go:embed hidden matches no file\n" +
+		"foo.go:17:1: //go:embed ../x: invalid pattern\n" +
+		"foo.go:20:1: invalid //go:embed directive: unterminated quoted pattern \"unterminated")
+	ut.AssertEqual(t, expected, runCheck(t, &Embed{}, files))
+	check := &Embed{IssueFilter: IssueFilter{Blacklist: []string{"matches no file"}}}
+	expected = errors.New("embed failed:\n" +
+		"foo.go:17:1: //go:embed ../x: invalid pattern\n" +
+		"foo.go:20:1: invalid //go:embed directive: unterminated quoted pattern \"unterminated")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+}
+
+func TestGoroutineSafety(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "safe"
+
+func logPanic() {
+	if r := recover(); r != nil {
+		println(r)
+	}
+}
+
+func worker() {
+	defer logPanic()
+}
+
+func A(c chan int) {
+	go func() {
+		defer func() {
+			recover()
+		}()
+	}()
+	go func() {
+		defer safe.Recover()
+	}()
+	go worker()
+	go func() {
+		c <- 1
+	}()
+	go A(c)
+	go safe.Go(A)
+	go safe.Run(A)
+}
+`,
+	}
+	check := &GoroutineSafety{SafeLaunchers: []string{"safe.Recover", "safe.Go"}}
+	expected := errors.New("goroutinesafety failed:\n" +
+		"foo.go:25:2: goroutine func literal doesn't recover from panics; defer a recover() or use a safe launcher\n" +
+		"foo.go:28:2: goroutine A doesn't recover from panics; defer a recover() or use a safe launcher\n" +
+		"foo.go:30:2: goroutine safe.Run doesn't recover from panics; defer a recover() or use a safe launcher")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check.SafeLaunchers = nil
+	check.Blacklist = []string{"safe."}
+	expected = errors.New("goroutinesafety failed:\n" +
+		"foo.go:21:2: goroutine func literal doesn't recover from panics; defer a recover() or use a safe launcher\n" +
+		"foo.go:25:2: goroutine func literal doesn't recover from panics; defer a recover() or use a safe launcher\n" +
+		"foo.go:28:2: goroutine A doesn't recover from panics; defer a recover() or use a safe launcher")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+}
+
+func TestHandlerContext(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"net/http"
+	"time"
+)
+
+type server struct {
+	c chan int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for {
+		s.c <- 1
+	}
+}
+
+func poll(w http.ResponseWriter, req *http.Request) {
+	time.Sleep(time.Second)
+}
+
+func wait(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func A(c chan int) {
+	http.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		<-c
+	})
+	<-c
+}
+
+func query(w http.ResponseWriter, r *http.Request) {
+	db.Query("SELECT 1")
+}
+`,
+	}
+	check := &HandlerContext{BlockingCalls: []string{"db.Query"}}
+	expected := errors.New("handlercontext failed:\n" +
+		"foo.go:13:2: handler server.ServeHTTP blocks (infinite for loop) without checking r.Context(); it keeps running after the client disconnected\n" +
+		"foo.go:19:2: handler poll blocks (time.Sleep) without checking req.Context(); it keeps running after the client disconnected\n" +
+		"foo.go:31:3: handler func literal in A blocks (channel receive) without checking the request context; it keeps running after the client disconnected\n" +
+		"foo.go:37:2: handler query blocks (db.Query) without checking r.Context(); it keeps running after the client disconnected")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check = &HandlerContext{IssueFilter: IssueFilter{Blacklist: []string{"ServeHTTP", "func literal"}}}
+	expected = errors.New("handlercontext failed:\n" +
+		"foo.go:19:2: handler poll blocks (time.Sleep) without checking req.Context(); it keeps running after the client disconnected")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+}
+
+func TestErrorDocs(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+// A does a.
+func A() error {
+	return nil
+}
+
+// B does b. It returns an error if b is not possible.
+func B() (int, error) {
+	return 0, nil
+}
+
+func C() error {
+	return nil
+}
+
+type T struct{}
+
+// D does d.
+func (t *T) D() error {
+	return nil
+}
+
+type u struct{}
+
+func (u *u) E() error {
+	return nil
+}
+
+func f() error {
+	return nil
+}
+`,
+		"foo_test.go": "package foo\n\nfunc G() error {\n\treturn nil\n}\n",
+	}
+	expected := errors.New("errordocs failed:\n" +
+		"foo.go:4:6: A returns an error but its doc comment doesn't describe when\n" +
+		"foo.go:13:6: C returns an error but has no doc comment\n" +
+		"foo.go:20:13: T.D returns an error but its doc comment doesn't describe when")
+	ut.AssertEqual(t, expected, runCheck(t, &ErrorDocs{}, files))
+	check := &ErrorDocs{RequirePattern: "does [ad]", IssueFilter: IssueFilter{Blacklist: []string{"no doc comment"}}}
+	expected = errors.New("errordocs failed:\n" +
+		"foo.go:9:6: B returns an error but its doc comment doesn't describe when")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	expected = errors.New("invalid require_pattern \"(\": error parsing regexp: missing closing ): `(`")
+	ut.AssertEqual(t, expected, runCheck(t, &ErrorDocs{RequirePattern: "("}, files))
+}
+
+func TestInitFuncs(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+var handler http.Handler
+
+func init() {
+	if os.Getenv("FOO") == "" {
+		os.Exit(1)
+	}
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		os.Exit(2)
+	})
+}
+
+func init() {
+	log.Printf("hi")
+}
+
+func A() {
+	os.Exit(1)
+}
+`,
+	}
+	check := &InitFuncs{MaxStatements: 2, Disallowed: []string{"os.Exit", "net/http.*"}}
+	expected := errors.New("initfuncs failed:\n" +
+		"foo.go:11:6: init() has 3 statements, max is 2; do the work explicitly or lazily\n" +
+		"foo.go:13:3: init() calls os.Exit (os.Exit); do it explicitly instead\n" +
+		"foo.go:15:2: init() calls http.HandleFunc (net/http.*); do it explicitly instead")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check.Blacklist = []string{"net/http"}
+	check.MaxStatements = 0
+	expected = errors.New("initfuncs failed:\n" +
+		"foo.go:13:3: init() calls os.Exit (os.Exit); do it explicitly instead")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	expected = errors.New("invalid disallowed function \"Exit\"; expected \"pkg.Func\" or \"pkg.*\"")
+	ut.AssertEqual(t, expected, runCheck(t, &InitFuncs{Disallowed: []string{"Exit"}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &InitFuncs{}, files))
+}
+
+func TestLogging(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"fmt"
+	stdlog "log"
+)
+
+func A() {
+	stdlog.Printf("a")
+	fmt.Println("a")
+	_ = fmt.Sprintf("a")
+}
+`,
+		"foo_test.go":     "package foo\n\nimport \"fmt\"\n\nfunc ExampleA() {\n\tfmt.Println(\"a\")\n}\n",
+		"cmd/foo/main.go": "package main\n\nimport \"log\"\n\nfunc main() {\n\tlog.Println(\"a\")\n}\n",
+	}
+	check := &Logging{Forbidden: []string{"log.*", "fmt.Println"}, Logger: "log/slog"}
+	expected := errors.New("logging failed:\n" +
+		"cmd/foo/main.go:6:2: log.Println is forbidden (log.*); use log/slog instead\n" +
+		"foo.go:9:2: stdlog.Printf is forbidden (log.*); use log/slog instead\n" +
+		"foo.go:10:2: fmt.Println is forbidden (fmt.Println); use log/slog instead")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check = &Logging{Forbidden: []string{"log.*", "fmt.Println"}, Allow: []string{"main.go"}}
+	expected = errors.New("logging failed:\n" +
+		"foo.go:9:2: stdlog.Printf is forbidden (log.*)\n" +
+		"foo.go:10:2: fmt.Println is forbidden (fmt.Println)")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	ut.AssertEqual(t, nil, runCheck(t, &Logging{}, files))
+	expected = errors.New("invalid forbidden function \"Println\"; expected \"pkg.Func\" or \"pkg.*\"")
+	ut.AssertEqual(t, expected, runCheck(t, &Logging{Forbidden: []string{"Println"}}, files))
+	expected = errors.New("invalid allow pattern \"[\": syntax error in pattern")
+	ut.AssertEqual(t, expected, runCheck(t, &Logging{Allow: []string{"["}}, files))
+}
+
+func TestNoPanic(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+func init() {
+	panic("init")
+}
+
+func A() {
+	go func() {
+		panic("A")
+	}()
+}
+
+func MustB() {
+	panic("B")
+}
+
+type T struct{}
+
+func (t *T) C() {
+	panic := func(string) {}
+	panic("C")
+}
+
+func (t *T) D() {
+	panic("D")
+}
+`,
+		"foo_test.go":   "package foo\n\nfunc helper() {\n\tpanic(\"test\")\n}\n",
+		"cmd/main.go":   "package main\n\nfunc main() {\n\tpanic(\"main\")\n}\n",
+		"internal/e.go": "package internal\n\nfunc E() {\n\tpanic(\"E\")\n}\n",
+	}
+	expected := errors.New("nopanic failed:\n" +
+		"foo.go:9:3: A calls panic(); return an error instead\n" +
+		"foo.go:14:2: MustB calls panic(); return an error instead\n" +
+		"foo.go:25:2: T.D calls panic(); return an error instead\n" +
+		"internal/e.go:4:2: E calls panic(); return an error instead")
+	ut.AssertEqual(t, expected, runCheck(t, &NoPanic{}, files))
+	check := &NoPanic{Allow: []string{"Must*", "*.D", "internal/*"}, IncludeTests: true}
+	expected = errors.New("nopanic failed:\n" +
+		"foo.go:9:3: A calls panic(); return an error instead\n" +
+		"foo_test.go:4:2: helper calls panic(); return an error instead")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check.Allow = []string{"foo*.go", "e.go"}
+	ut.AssertEqual(t, nil, runCheck(t, check, files))
+	expected = errors.New("invalid allow pattern \"[\": syntax error in pattern")
+	ut.AssertEqual(t, expected, runCheck(t, &NoPanic{Allow: []string{"["}}, files))
+}
+
+func TestMagicNumbers(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "time"
+
+const timeout = 5 * time.Second
+
+var retries = 3
+
+func A(i int) (float64, int) {
+	const size = 512
+	var buf [16]byte
+	if i == -1 || i == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return 2.5 * float64(i+1), len(buf) + 0x20 - 2
+}
+`,
+		"foo_test.go": "package foo\n\nfunc helper() int {\n\treturn 1_000\n}\n",
+	}
+	expected := errors.New("magicnumbers failed:\n" +
+		"foo.go:13:14: magic number 10; use a named constant\n" +
+		"foo.go:15:9: magic number 2.5; use a named constant\n" +
+		"foo.go:15:40: magic number 0x20; use a named constant\n" +
+		"foo.go:15:47: magic number 2; use a named constant\n" +
+		"foo_test.go:4:9: magic number 1_000; use a named constant")
+	ut.AssertEqual(t, expected, runCheck(t, &MagicNumbers{}, files))
+	check := &MagicNumbers{Allow: []float64{2, 10, 32}, FileFilter: FileFilter{SkipTestFiles: true}}
+	expected = errors.New("magicnumbers failed:\n" +
+		"foo.go:15:9: magic number 2.5; use a named constant")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+}
+
+func TestMustCheck(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"database/sql"
+	myos "os"
+)
+
+func A(p string) error {
+	f, err := myos.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	myos.Remove(p)
+	_ = myos.Remove(p)
+	if err := myos.Remove(p); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func B(db *sql.DB, f *myos.File) {
+	tx, _ := db.Begin()
+	tx.Rollback()
+	go f.Close()
+	var g myos.File
+	g.Close()
+}
+
+func C(f *myos.File) error {
+	return f.Close()
+}
+`,
+	}
+	check := &MustCheck{Functions: []string{"os.Remove", "(*os.File).Close", "tx.Rollback"}}
+	expected := errors.New("mustcheck failed:\n" +
+		"foo.go:13:8: error of f.Close ((*os.File).Close) is discarded by defer\n" +
+		"foo.go:14:2: error of myos.Remove (os.Remove) is not checked\n" +
+		"foo.go:15:6: error of myos.Remove (os.Remove) is assigned to _\n" +
+		"foo.go:24:2: error of tx.Rollback (tx.Rollback) is not checked\n" +
+		"foo.go:25:5: error of f.Close ((*os.File).Close) is discarded by go\n" +
+		"foo.go:27:2: error of g.Close ((*os.File).Close) is not checked")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	check.Blacklist = []string{"defer", "tx.Rollback"}
+	expected = errors.New("mustcheck failed:\n" +
+		"foo.go:14:2: error of myos.Remove (os.Remove) is not checked\n" +
+		"foo.go:15:6: error of myos.Remove (os.Remove) is assigned to _\n" +
+		"foo.go:25:5: error of f.Close ((*os.File).Close) is discarded by go\n" +
+		"foo.go:27:2: error of g.Close ((*os.File).Close) is not checked")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	expected = errors.New("invalid function \"Remove\"; expected \"pkg.Func\", \"(*pkg.Type).Method\" or \"variable.Method\"")
+	ut.AssertEqual(t, expected, runCheck(t, &MustCheck{Functions: []string{"Remove"}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &MustCheck{}, files))
+}
+
+func TestNilInterface(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+type MyError struct{}
+
+func (m *MyError) Error() string { return "" }
+
+func newError() *MyError { return nil }
+
+func Var() error {
+	var e *MyError
+	return e
+}
+
+func Conversion() (int, error) {
+	e := (*MyError)(nil)
+	return 0, e
+}
+
+func Call() error {
+	return newError()
+}
+
+func Assigned() error {
+	e := newError()
+	return e
+}
+
+func Good() error {
+	var e *MyError
+	if e == nil {
+		return nil
+	}
+	f := func() *MyError { return e }
+	_ = f
+	return error(e)
+}
+
+func NotError() *MyError {
+	var e *MyError
+	return e
+}
+`,
+	}
+	expected := errors.New("nilinterface failed:\n" +
+		"foo.go:11:9: *MyError is returned as error; a nil *MyError is a non-nil error\n" +
+		"foo.go:16:12: *MyError is returned as error; a nil *MyError is a non-nil error\n" +
+		"foo.go:20:9: *MyError is returned as error; a nil *MyError is a non-nil error\n" +
+		"foo.go:25:9: *MyError is returned as error; a nil *MyError is a non-nil error")
+	ut.AssertEqual(t, expected, runCheck(t, &NilInterface{}, files))
+}
+
+func TestNilInterfacePackage(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"errors.go": "package foo\n\ntype MyError struct{}\n\nfunc (m *MyError) Error() string { return \"\" }\n\nfunc newError() *MyError { return nil }\n",
+		"foo.go":    "package foo\n\nfunc Call() error {\n\treturn newError()\n}\n",
+	}
+	// Only foo.go is modified, newError() is declared in errors.go.
+	expected := errors.New("nilinterface failed:\nfoo.go:4:9: *MyError is returned as error; a nil *MyError is a non-nil error")
+	ut.AssertEqual(t, expected, runCheckChanged(t, &NilInterface{}, files, []string{"foo.go"}))
+}
+
+func TestSignatureLimits(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+type Foo struct{}
+
+func Params(a, b int, c string) {}
+
+func (f *Foo) Results() (int, int, error) { return 0, 0, nil }
+
+func Variadic(a int, b ...int) {}
+
+func Good(a, b int) (int, error) { return 0, nil }
+`,
+		"foo_test.go": `package foo
+
+func helper(a, b, c int) {}
+`,
+		"gen.go": `// Code generated by foo. DO NOT EDIT.
+
+package foo
+
+func Generated(a, b, c int) {}
+`,
+	}
+	expected := errors.New("signaturelimits failed:\n" +
+		"foo.go:5:6: func Params(a, b int, c string) has 3 parameters, max is 2; group them in a struct\n" +
+		"foo.go:7:15: func (f *Foo) Results() (int, int, error) has 3 results, max is 2; group them in a struct\n" +
+		"foo_test.go:3:6: func helper(a, b, c int) has 3 parameters, max is 2; group them in a struct")
+	ut.AssertEqual(t, expected, runCheck(t, &SignatureLimits{MaxParams: 2, MaxResults: 2}, files))
+	expected = errors.New("signaturelimits failed:\n" +
+		"foo.go:5:6: func Params(a, b int, c string) has 3 parameters, max is 2; group them in a struct")
+	ut.AssertEqual(t, expected, runCheck(t, &SignatureLimits{MaxParams: 2, FileFilter: FileFilter{SkipTestFiles: true}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &SignatureLimits{}, files))
+}
+
+func TestContextCancel(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"context"
+	"time"
+)
+
+func Deferred(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	<-ctx.Done()
+}
+
+func DeferredLiteral(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+	}()
+	<-ctx.Done()
+}
+
+func Returned(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel
+}
+
+func Called(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	<-ctx.Done()
+	cancel()
+}
+
+func Discarded(ctx context.Context) {
+	ctx, _ = context.WithDeadline(ctx, time.Now())
+	<-ctx.Done()
+}
+
+func Never(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	<-ctx.Done()
+}
+
+func Early(ctx context.Context, b bool) {
+	ctx, stop := context.WithCancel(ctx)
+	if b {
+		return
+	}
+	<-ctx.Done()
+	stop()
+}
+
+func Literal(ctx context.Context) {
+	go func() {
+		_, cancel := context.WithCancel(ctx)
+		_ = 1
+	}()
+}
+`,
+		"bar/bar.go": `package bar
+
+import netctx "golang.org/x/net/context"
+
+func Bar(ctx netctx.Context) {
+	ctx, _ = netctx.WithCancel(ctx)
+}
+`,
+	}
+	expected := errors.New("contextcancel failed:\n" +
+		"bar/bar.go:6:7: the cancel function returned by context.WithCancel is discarded; the context leaks\n" +
+		"foo.go:34:7: the cancel function returned by context.WithDeadline is discarded; the context leaks\n" +
+		"foo.go:39:7: cancel returned by context.WithTimeout is never called; defer cancel()\n" +
+		"foo.go:44:7: stop returned by context.WithCancel is not called on all paths, e.g. the return at line 46; defer stop()\n" +
+		"foo.go:54:6: cancel returned by context.WithCancel is never called; defer cancel()")
+	ut.AssertEqual(t, expected, runCheck(t, &ContextCancel{}, files))
+	expected = errors.New("contextcancel failed:\n" +
+		"foo.go:44:7: stop returned by context.WithCancel is not called on all paths, e.g. the return at line 46; defer stop()")
+	ut.AssertEqual(t, expected, runCheck(t, &ContextCancel{IssueFilter: IssueFilter{Blacklist: []string{"discarded", "never called"}}}, files))
+}
+
+func TestContextFirst(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "context"
+
+type Foo struct{}
+
+func First(ctx context.Context, a int) {}
+
+func Second(a int, ctx context.Context) {}
+
+func (f *Foo) Grouped(a, b int, ctx context.Context) {}
+
+func unexported(a int, ctx context.Context) {}
+
+func Legacy(a int, ctx context.Context) {}
+`,
+		"bar/bar.go": `package bar
+
+import netctx "golang.org/x/net/context"
+
+func Bar(a int, ctx netctx.Context) {}
+`,
+		"baz/baz.go": `package baz
+
+type context struct{ Context int }
+
+func Baz(a int, ctx context.Context) {}
+`,
+	}
+	expected := errors.New("contextfirst failed:\n" +
+		"bar/bar.go:5:6: func Bar(a int, ctx netctx.Context) takes context.Context as parameter 2; it must be the first\n" +
+		"foo.go:9:6: func Second(a int, ctx context.Context) takes context.Context as parameter 2; it must be the first\n" +
+		"foo.go:11:15: func (f *Foo) Grouped(a, b int, ctx context.Context) takes context.Context as parameter 3; it must be the first")
+	ut.AssertEqual(t, expected, runCheck(t, &ContextFirst{IssueFilter: IssueFilter{Blacklist: []string{"Legacy"}}}, files))
+	expected = errors.New("contextfirst failed:\n" +
+		"foo.go:13:6: func unexported(a int, ctx context.Context) takes context.Context as parameter 2; it must be the first")
+	ut.AssertEqual(t, expected, runCheck(t, &ContextFirst{IncludeUnexported: true, IssueFilter: IssueFilter{Blacklist: []string{"Legacy", "Bar", "Second", "Grouped"}}}, files))
+}
+
+func TestExampleOutput(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo_test.go": `package foo
+
+import "fmt"
+
+func ExampleGood() {
+	fmt.Println("a")
+	// Output: a
+}
+
+func ExampleUnordered() {
+	fmt.Println("a")
+	fmt.Println("b")
+	// Unordered output:
+	// b
+	// a
+}
+
+func ExampleMissing() {
+	fmt.Println("a")
+}
+
+func ExampleLegacy() {
+}
+
+func Examples() {
+}
+`,
+		"foo.go": "package foo\n\nfunc ExampleNotATest() {\n}\n",
+	}
+	expected := errors.New("exampleoutput failed:\n" +
+		"foo_test.go:18:6: ExampleMissing has no output comment so it is never run")
+	ut.AssertEqual(t, expected, runCheck(t, &ExampleOutput{IssueFilter: IssueFilter{Blacklist: []string{"ExampleLegacy"}}}, files))
+}
+
+func TestPublicSurface(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "errors"
+
+type A struct{}
+
+func (a *A) M() {}
+
+func F() {}
+
+func f() {}
+
+var (
+	V, W = 1, 2
+	v    = 3
+)
+
+const C = 4
+
+var ErrX = errors.New("x")
+`,
+		"foo_test.go": "package foo\n\nfunc Helper() {}\n",
+		"bar/bar.go":  "package bar\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n",
+		"cmd/cmd.go":  "package main\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n",
+	}
+	expected := errors.New("publicsurface failed:\n" +
+		"bar/bar.go:1:9: package bar (./bar) exports 3 symbols, more than 2; consider splitting it\n" +
+		"foo.go:1:9: package foo (.) exports 6 symbols, more than 2; consider splitting it")
+	ut.AssertEqual(t, expected, runCheck(t, &PublicSurface{MaxExported: 2}, files))
+	expected = errors.New("publicsurface failed:\n" +
+		"foo.go:1:9: package foo (.) exports 6 symbols, more than 5; consider splitting it")
+	ut.AssertEqual(t, expected, runCheck(t, &PublicSurface{MaxExported: 5, PerDir: map[string]int{"bar": 0}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &PublicSurface{MaxExported: 2, PerDir: map[string]int{".": 6}, IssueFilter: IssueFilter{Blacklist: []string{"./bar"}}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &PublicSurface{}, files))
+}
+
+func TestReceiverNames(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+type Client struct{}
+
+func (c *Client) A() {}
+
+func (c *Client) B() {}
+
+func (client *Client) C() {}
+
+func (this *Client) D() {}
+
+type Server struct{}
+
+func (s Server) A() {}
+
+func (server *Server) B() {}
+
+func (_ *Server) C() {}
+
+func (*Server) D() {}
+`,
+		"bar/bar.go": `package bar
+
+type Client struct{}
+
+func (self *Client) A() {}
+
+func (cl *Client) B() {}
+`,
+	}
+	expected := errors.New("receivernames failed:\n" +
+		"bar/bar.go:5:7: func (self *Client) A() receiver is named self; use a short name reflecting the type\n" +
+		"foo.go:9:7: func (client *Client) C() receiver is named client, the other methods of Client use c\n" +
+		"foo.go:11:7: func (this *Client) D() receiver is named this; use a short name reflecting the type\n" +
+		"foo.go:17:7: func (server *Server) B() receiver is named server, the other methods of Server use s")
+	ut.AssertEqual(t, expected, runCheck(t, &ReceiverNames{}, files))
+	expected = errors.New("receivernames failed:\n" +
+		"bar/bar.go:5:7: func (self *Client) A() receiver is named self; use a short name reflecting the type\n" +
+		"foo.go:9:7: func (client *Client) C() receiver name client is longer than 4\n" +
+		"foo.go:17:7: func (server *Server) B() receiver name server is longer than 4")
+	ut.AssertEqual(t, expected, runCheck(t, &ReceiverNames{MaxLength: 4, IssueFilter: IssueFilter{Blacklist: []string{"this", "other methods"}}}, files))
+}
+
+func TestStructTags(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": "package foo\n" +
+			"\n" +
+			"type Foo struct {\n" +
+			"\tA int `json:\"a\" yaml:\"a,omitempty\"`\n" +
+			"\tB int `json:\"b`\n" +
+			"\tC int `json:b`\n" +
+			"\tD int `json:\"d\"yaml:\"d\"`\n" +
+			"\tE int `Json:\"e\"`\n" +
+			"\tF int `json:\"f\" json:\"g\"`\n" +
+			"\tG int `json:\"myField\" yaml:\"-\"`\n" +
+			"\tH struct {\n" +
+			"\t\tI int `json:\"i\" :\"x\"`\n" +
+			"\t}\n" +
+			"}\n",
+	}
+	expected := errors.New("structtags failed:\n" +
+		"foo.go:5:8: field B has a malformed tag: value of key json is missing its closing quote\n" +
+		"foo.go:6:8: field C has a malformed tag: value of key json is not quoted\n" +
+		"foo.go:7:8: field D has a malformed tag: expected a space after the value of key json\n" +
+		"foo.go:8:8: field E has tag key Json; did you mean json?\n" +
+		"foo.go:9:8: field F has tag key json more than once\n" +
+		"foo.go:12:9: field I has a malformed tag: expected a key at \":\\\"x\\\"\"")
+	ut.AssertEqual(t, expected, runCheck(t, &StructTags{}, files))
+	expected = errors.New("structtags failed:\n" +
+		"foo.go:10:8: field G has json key \"myField\"; use snake_case")
+	ut.AssertEqual(t, expected, runCheck(t, &StructTags{RequireSnakeCase: true, IssueFilter: IssueFilter{Blacklist: []string{"malformed", "tag key"}}}, files))
+}
+
+func TestJSONNaming(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"api/api.go": "package api\n" +
+			"\n" +
+			"type Reply struct {\n" +
+			"\tUserID   int `json:\"user_id\"`\n" +
+			"\tFullName string `json:\"fullName,omitempty\"`\n" +
+			"\tSecret   string `json:\"-\"`\n" +
+			"\tCount    int\n" +
+			"\tEmpty    int `json:\",omitempty\"`\n" +
+			"\tprivate  int\n" +
+			"\tEmbedded\n" +
+			"}\n" +
+			"\n" +
+			"type Embedded struct {\n" +
+			"\tA int\n" +
+			"}\n",
+		"internal/state.go": "package internal\n" +
+			"\n" +
+			"type State struct {\n" +
+			"\tLastSeen int `json:\"lastSeen\"`\n" +
+			"}\n",
+	}
+	expected := errors.New("jsonnaming failed:\n" +
+		"api/api.go:5:18: field FullName has json name \"fullName\"; use snake_case\n" +
+		"api/api.go:7:2: field Count has no json tag; use a snake_case name\n" +
+		"api/api.go:8:15: field Empty has no json name; use a snake_case name\n" +
+		"internal/state.go:4:15: field LastSeen has json name \"lastSeen\"; use snake_case")
+	ut.AssertEqual(t, expected, runCheck(t, &JSONNaming{}, files))
+	expected = errors.New("jsonnaming failed:\n" +
+		"api/api.go:4:15: field UserID has json name \"user_id\"; use camelCase\n" +
+		"api/api.go:7:2: field Count has no json tag; use a camelCase name")
+	ut.AssertEqual(t, expected, runCheck(t, &JSONNaming{Convention: "camelCase", Packages: []string{"api"}, IssueFilter: IssueFilter{Blacklist: []string{"no json name"}}}, files))
+	ut.AssertEqual(t, errors.New("invalid convention \"kebab-case\"; expected snake_case or camelCase"), runCheck(t, &JSONNaming{Convention: "kebab-case"}, files))
+}
+
+func TestTypeSwitch(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+type Node interface {
+	Pos() int
+}
+
+type Expr interface {
+	Node
+	Value() int
+}
+
+type Leaf struct{}
+
+func (l Leaf) Pos() int { return 0 }
+
+type Tree struct{}
+
+func (t *Tree) Pos() int { return 0 }
+
+type Lit struct{}
+
+func (l *Lit) Pos() int   { return 0 }
+func (l *Lit) Value() int { return 0 }
+`,
+		"visit.go": `package foo
+
+func Declared(n Node) {
+	switch n.(type) {
+	case Leaf:
+	}
+}
+
+func Inferred(v interface{}) {
+	switch x := v.(type) {
+	case *Tree, nil:
+		_ = x
+	}
+}
+
+func Default(n Node) {
+	switch n.(type) {
+	case Leaf:
+	default:
+	}
+}
+
+func Complete(n Node) {
+	switch n.(type) {
+	case Leaf, *Tree:
+	case Expr:
+	}
+}
+
+func Unknown(v interface{}) {
+	switch v.(type) {
+	case int:
+	}
+}
+`,
+	}
+	expected := errors.New("typeswitch failed:\n" +
+		"visit.go:4:2: type switch on Node has no default case and doesn't handle *Lit, *Tree\n" +
+		"visit.go:10:2: type switch on Node has no default case and doesn't handle *Lit, Leaf")
+	ut.AssertEqual(t, expected, runCheck(t, &TypeSwitch{}, files))
+	expected = errors.New("typeswitch failed:\n" +
+		"visit.go:10:2: type switch on Node has no default case and doesn't handle *Lit, Leaf")
+	ut.AssertEqual(t, expected, runCheck(t, &TypeSwitch{IssueFilter: IssueFilter{Blacklist: []string{"*Tree"}}}, files))
+}
+
+func TestTestInternals(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo/foo.go": "package foo\n\nfunc parse() int { return 1 }\n",
+		"foo/export_test.go": `package foo
+
+import "testing"
+
+var Parse = parse
+
+const MaxItems = 10
+
+func SetClock() {}
+
+func TestInternal(t *testing.T) {}
+`,
+		"foo/foo_test.go": `package foo_test
+
+import (
+	"testing"
+
+	"example.com/foo"
+)
+
+func TestParse(t *testing.T) {
+	if foo.Parse() != foo.MaxItems {
+		foo.SetClock()
+	}
+}
+`,
+		"bar/bar_test.go": `package bar_test
+
+import "example.com/foo"
+
+var x = foo.Parse
+`,
+	}
+	expected := errors.New("testinternals failed:\n" +
+		"foo/foo_test.go:10:5: uses foo.Parse, exported for the tests by export_test.go; test through the public API\n" +
+		"foo/foo_test.go:10:20: uses foo.MaxItems, exported for the tests by export_test.go; test through the public API\n" +
+		"foo/foo_test.go:11:3: uses foo.SetClock, exported for the tests by export_test.go; test through the public API")
+	ut.AssertEqual(t, expected, runCheck(t, &TestInternals{}, files))
+	expected = errors.New("testinternals failed:\n" +
+		"foo/export_test.go:9:6: SetClock is a function exported for the tests; alias the production code instead, e.g. var SetClock = ...\n" +
+		"foo/foo_test.go:10:20: uses foo.MaxItems, exported for the tests by export_test.go; test through the public API")
+	ut.AssertEqual(t, expected, runCheck(t, &TestInternals{Allow: []string{"Parse", "Set*"}, AliasesOnly: true}, files))
+}
+
+func TestSortLess(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "sort"
+
+type byName []string
+
+func (b byName) Len() int           { return len(b) }
+func (b byName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byName) Less(i, j int) bool { return b[i] >= b[j] }
+
+type item struct{ a, b int }
+
+func Sort(s []item) {
+	sort.Slice(s, func(i, j int) bool {
+		return s[i].a < s[j].a
+	})
+	sort.Slice(s, func(i, j int) bool {
+		if len(s) <= 2 {
+			return false
+		}
+		return s[i].a <= s[j].a
+	})
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].a < s[i].b || s[j].a < 0
+	})
+	sort.Slice(s, func(i, _ int) bool {
+		return s[i].a < 0
+	})
+}
+`,
+	}
+	expected := errors.New("sortless failed:\n" +
+		"foo.go:9:51: less function of byName.Less compares with >=; use > for a strict weak ordering\n" +
+		"foo.go:21:17: less function of sort.Slice compares with <=; use < for a strict weak ordering\n" +
+		"foo.go:24:17: less function of sort.SliceStable compares s[i].a with s[i].b, both indexed by i\n" +
+		"foo.go:26:24: less function of sort.Slice doesn't use both indices")
+	ut.AssertEqual(t, expected, runCheck(t, &SortLess{}, files))
+}
+
+func TestImportCount(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"fmt"
+	"os"
+
+	_ "example.com/driver"
+	"example.com/log"
+)
+`,
+		"bar/bar.go": `package bar
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+`,
+		"gen.go": "// Code generated by foo. DO NOT EDIT.\n\npackage foo\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n)\n",
+	}
+	expected := errors.New("importcount failed:\n" +
+		"bar/bar.go:1:9: imports 3 packages, more than 2; consider splitting it\n" +
+		"foo.go:1:9: imports 4 packages, more than 2; consider splitting it")
+	ut.AssertEqual(t, expected, runCheck(t, &ImportCount{MaxImports: 2}, files))
+	expected = errors.New("importcount failed:\n" +
+		"foo.go:1:9: imports 2 non standard packages, more than 1; consider splitting it")
+	ut.AssertEqual(t, expected, runCheck(t, &ImportCount{MaxImports: 1, ExcludeStdlib: true}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &ImportCount{MaxImports: 2, PerDir: map[string]int{".": 4, "bar": 0}}, files))
+}
+
+func TestDeferInLoop(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "os"
+
+func Loops(names []string) {
+	defer println("done")
+	for _, n := range names {
+		f, _ := os.Open(n)
+		defer f.Close()
+	}
+	for i := 0; i < 2; i++ {
+		func() {
+			f, _ := os.Open(names[i])
+			defer f.Close()
+		}()
+		for {
+			defer println("intentional")
+			break
+		}
+	}
+	for range names {
+		go func() {
+			defer println("goroutine")
+		}()
+	}
+}
+`,
+	}
+	expected := errors.New("deferinloop failed:\n" +
+		"foo.go:9:3: defer inside a for range loop runs when the function returns, not at the end of the iteration; the resources leak until then, move the loop body to a function\n" +
+		"foo.go:17:4: defer inside a for loop runs when the function returns, not at the end of the iteration; the resources leak until then, move the loop body to a function")
+	ut.AssertEqual(t, expected, runCheck(t, &DeferInLoop{}, files))
+	expected = errors.New("deferinloop failed:\n" +
+		"foo.go:9:3: defer inside a for range loop runs when the function returns, not at the end of the iteration; the resources leak until then, move the loop body to a function")
+	ut.AssertEqual(t, expected, runCheck(t, &DeferInLoop{IssueFilter: IssueFilter{Blacklist: []string{"foo.go:17:"}}}, files))
+}
+
+func TestTimeNow(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "time"
+
+var now = time.Now
+
+func Expired(deadline time.Time) bool {
+	return time.Now().After(deadline)
+}
+`,
+		"bar.go":              "package foo\n\nimport clk \"time\"\n\nvar start = clk.Now()\n",
+		"foo_test.go":         "package foo\n\nimport \"time\"\n\nvar start = time.Now()\n",
+		"clock/clock.go":      "package clock\n\nimport \"time\"\n\nfunc Now() time.Time {\n\treturn time.Now()\n}\n",
+		"cmd/tool/main.go":    "package main\n\nimport \"time\"\n\nfunc main() {\n\tprintln(time.Now().String())\n}\n",
+		"other/other.go":      "package other\n\nfunc Now() int {\n\treturn 0\n}\n\nvar now = Now()\n",
+		"generated/gen.pb.go": "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage generated\n\nimport \"time\"\n\nvar start = time.Now()\n",
+	}
+	expected := errors.New("timenow failed:\n" +
+		"bar.go:5:13: clk.Now() makes the code hard to test deterministically; use an injected clock instead\n" +
+		"clock/clock.go:6:9: time.Now() makes the code hard to test deterministically; use an injected clock instead\n" +
+		"foo.go:8:9: time.Now() makes the code hard to test deterministically; use an injected clock instead")
+	ut.AssertEqual(t, expected, runCheck(t, &TimeNow{}, files))
+	expected = errors.New("timenow failed:\n" +
+		"foo.go:8:9: time.Now() makes the code hard to test deterministically; use an injected clock instead")
+	ut.AssertEqual(t, expected, runCheck(t, &TimeNow{Allow: []string{"clock/*.go"}, IssueFilter: IssueFilter{Blacklist: []string{"clk.Now"}}}, files))
+	ut.AssertEqual(t, errors.New("invalid allow pattern \"[\": syntax error in pattern"), runCheck(t, &TimeNow{Allow: []string{"["}}, files))
+}
+
+func TestLargeParam(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "example.com/missing"
+
+type Big struct {
+	buf [256]byte
+}
+
+func Copy(b Big, p *Big, s []Big, n int) {
+}
+
+func (b Big) Merge(other, _ Big, a [64]int64) {
+}
+
+func Unresolved(m missing.T) {
+}
+
+func Generic[T any](v [100]T) {
+}
+`,
+		"bar.go":        "package foo\n\nfunc bar(s struct{ a, b [20]int64 }) {\n}\n",
+		"foo_test.go":   "package foo\n\nfunc check(b Big) {\n}\n",
+		"ext_test.go":   "package foo_test\n\nfunc check(b [512]byte) {\n}\n",
+		"small/sm.go":   "package small\n\nfunc F(s string, b [4]byte) {\n}\n",
+		"gen/gen.pb.go": "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage gen\n\nfunc F(b [512]byte) {\n}\n",
+	}
+	expected := errors.New("largeparam failed:\n" +
+		"bar.go:3:10: parameter s of bar is 320 bytes, more than 100; pass a pointer instead\n" +
+		"foo.go:9:11: parameter b of Copy is 256 bytes, more than 100; pass a pointer instead\n" +
+		"foo.go:12:20: parameter other of Big.Merge is 256 bytes, more than 100; pass a pointer instead\n" +
+		"foo.go:12:27: parameter _ of Big.Merge is 256 bytes, more than 100; pass a pointer instead\n" +
+		"foo.go:12:34: parameter a of Big.Merge is 512 bytes, more than 100; pass a pointer instead\n" +
+		"foo_test.go:3:12: parameter b of check is 256 bytes, more than 100; pass a pointer instead")
+	ut.AssertEqual(t, expected, runCheck(t, &LargeParam{MaxParamBytes: 100}, files))
+	expected = errors.New("largeparam failed:\n" +
+		"foo.go:12:34: parameter a of Big.Merge is 512 bytes, more than 300; pass a pointer instead")
+	ut.AssertEqual(t, expected, runCheck(t, &LargeParam{MaxParamBytes: 300, IssueFilter: IssueFilter{Blacklist: []string{"bar.go"}}, FileFilter: FileFilter{SkipTestFiles: true}}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &LargeParam{}, files))
+}
+
+func TestWaitGroupUsage(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import "sync"
+
+type pool struct {
+	wg sync.WaitGroup
+}
+
+func (p *pool) start(f func()) {
+	go func() {
+		p.wg.Add(1)
+		defer p.wg.Done()
+		f()
+	}()
+}
+
+func run(wg *sync.WaitGroup, f func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f()
+	}()
+	go func() {
+		// Guards the nested goroutine, not this one.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}()
+	var other sync.WaitGroup
+	go func(wg *sync.WaitGroup) {
+		other.Add(1)
+		wg.Add(1)
+		defer wg.Done()
+	}(&other)
+}
+`,
+		"gen.go": "// Code generated by hand. DO NOT EDIT.\n\npackage foo\n\nimport \"sync\"\n\nfunc gen(wg *sync.WaitGroup) {\n\tgo func() {\n\t\twg.Add(1)\n\t\twg.Done()\n\t}()\n}\n",
+	}
+	expected := errors.New("waitgroupusage failed:\n" +
+		"foo.go:11:3: p.wg.Add() is called in the goroutine it guards, racing with p.wg.Wait(); call it before the go statement\n" +
+		"foo.go:34:3: wg.Add() is called in the goroutine it guards, racing with wg.Wait(); call it before the go statement")
+	ut.AssertEqual(t, expected, runCheck(t, &WaitGroupUsage{}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &WaitGroupUsage{IssueFilter: IssueFilter{Blacklist: []string{"is called in the goroutine"}}}, files))
+}
+
+func TestTestMainUsage(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"good/good_test.go": `package good
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+`,
+		"norun/norun_test.go": `package norun
+
+import "testing"
+
+func TestMain(m *testing.M) {
+	setup()
+}
+`,
+		"signature/signature_test.go": `package signature
+
+import "testing"
+
+func TestMain(t *testing.T) {
+}
+`,
+		"short/short_test.go": `package short
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if testing.Short() {
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+`,
+		"after/after_test.go": `package after
+
+import "testing"
+
+func TestMain(m *testing.M) {
+	m.Run()
+	if testing.Verbose() {
+		println("done")
+	}
+}
+`,
+	}
+	expected := errors.New("testmain failed:\n" +
+		"norun/norun_test.go:5:6: TestMain doesn't call m.Run(), no test is run\n" +
+		"short/short_test.go:9:5: testing.Short() is called before flag.Parse()\n" +
+		"signature/signature_test.go:5:6: TestMain has signature func(t *testing.T), expected func(*testing.M)")
+	ut.AssertEqual(t, expected, runCheck(t, &TestMainUsage{}, files))
+}
+
+func TestOsExit(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": `package foo
+
+import (
+	"log"
+	stdos "os"
+)
+
+func init() {
+	stdos.Exit(1)
+}
+
+func A() {
+	go func() {
+		stdos.Exit(2)
+	}()
+}
+
+func MustB(err error) {
+	log.Fatalf("%s", err)
+}
+
+type T struct{}
+
+func (t *T) C() {
+	log.Println("C")
+	log.Fatal("C")
+}
+`,
+		"foo_test.go": "package foo\n\nimport (\n\t\"os\"\n\t\"testing\"\n)\n\nfunc TestMain(m *testing.M) {\n\tos.Exit(m.Run())\n}\n\nfunc helper() {\n\tos.Exit(1)\n}\n",
+		"cmd/main.go": "package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(1)\n}\n\nfunc run() {\n\tos.Exit(1)\n}\n",
+		"bar/bar.go":  "package bar\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(1)\n}\n",
+	}
+	expected := errors.New("osexit failed:\n" +
+		"bar/bar.go:6:2: main calls os.Exit(), which skips the deferred calls; return an error instead\n" +
+		"cmd/main.go:10:2: run calls os.Exit(), which skips the deferred calls; return an error instead\n" +
+		"foo.go:14:3: A calls os.Exit(), which skips the deferred calls; return an error instead\n" +
+		"foo.go:19:2: MustB calls log.Fatalf(), which skips the deferred calls; return an error instead\n" +
+		"foo.go:26:2: T.C calls log.Fatal(), which skips the deferred calls; return an error instead\n" +
+		"foo_test.go:13:2: helper calls os.Exit(), which skips the deferred calls; return an error instead")
+	ut.AssertEqual(t, expected, runCheck(t, &OsExit{}, files))
+	check := &OsExit{Allow: []string{"Must*", "*.C", "cmd/*.go"}, IssueFilter: IssueFilter{Blacklist: []string{"helper"}}}
+	expected = errors.New("osexit failed:\n" +
+		"bar/bar.go:6:2: main calls os.Exit(), which skips the deferred calls; return an error instead\n" +
+		"foo.go:14:3: A calls os.Exit(), which skips the deferred calls; return an error instead")
+	ut.AssertEqual(t, expected, runCheck(t, check, files))
+	expected = errors.New("invalid allow pattern \"[\": syntax error in pattern")
+	ut.AssertEqual(t, expected, runCheck(t, &OsExit{Allow: []string{"["}}, files))
+}
+
+func TestRequireTests(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go":                     "package foo\n",
+		"foo_test.go":                "package foo\n",
+		"untested/a.go":              "package untested\n",
+		"untested/b.go":              "// Package untested is not tested.\npackage untested\n",
+		"cmd/tool/main.go":           "package main\n",
+		"generated/gen.go":           "// Code generated by stringer. DO NOT EDIT.\n\npackage generated\n",
+		"blacklisted/blacklisted.go": "package blacklisted\n",
+	}
+	expected := errors.New("requiretests failed:\n" +
+		"untested/a.go:1:9: package untested (./untested) has no _test.go file")
+	ut.AssertEqual(t, expected, runCheck(t, &RequireTests{IssueFilter: IssueFilter{Blacklist: []string{"./blacklisted"}}}, files))
+}
+
+func TestPackageName(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"root.go":                   "package foo\n",
+		"foo/foo.go":                "package foo\n",
+		"foo/foo_test.go":           "package foo_test\n",
+		"go-bar/bar.go":             "package bar\n",
+		"yaml.v2/yaml.go":           "package yaml\n",
+		"baz/v2/baz.go":             "package baz\n",
+		"cmd/tool/main.go":          "package main\n",
+		"copied/a.go":               "package original\n",
+		"copied/b.go":               "package original\n",
+		"external/external_test.go": "package other_test\n",
+		"legacy/legacy.go":          "package old\n",
+	}
+	expected := errors.New("packagename failed:\n" +
+		"copied/a.go:1:9: package original doesn't match its directory copied\n" +
+		"external/external_test.go:1:9: package other_test doesn't match its directory external")
+	ut.AssertEqual(t, expected, runCheck(t, &PackageName{IssueFilter: IssueFilter{Blacklist: []string{"legacy/"}}}, files))
+}
+
+func TestSubtests(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"foo.go": "package foo\n",
+		"foo_test.go": `package foo
+
+import "testing"
+
+var cases = map[string]int{"a": 1}
+
+func TestA(t *testing.T) {
+	for _, c := range []int{1, 2} {
+		if c == 0 {
+			t.Errorf("%d", c)
+		}
+	}
+	for name, c := range cases {
+		check(t, name, c)
+	}
+}
+
+func TestB(t *testing.T) {
+	data := []struct{ in, out int }{{1, 1}}
+	for _, d := range data {
+		t.Run("x", func(t *testing.T) {
+			if d.in != d.out {
+				t.Fatal("bad")
+			}
+		})
+	}
+	for _, d := range data {
+		_ = d
+	}
+	for _, s := range strings() {
+		t.Error(s)
+	}
+}
+
+func check(t *testing.T, name string, c int) {
+	for _, d := range []int{c} {
+		t.Error(d)
+	}
+}
+
+func strings() []string { return nil }
+`,
+	}
+	expected := errors.New("subtests failed:\n" +
+		"foo_test.go:8:2: TestA iterates over test cases without t.Run(); run each case as a named subtest\n" +
+		"foo_test.go:13:2: TestA iterates over test cases without t.Run(); run each case as a named subtest")
+	ut.AssertEqual(t, expected, runCheck(t, &Subtests{}, files))
+	ut.AssertEqual(t, nil, runCheck(t, &Subtests{IssueFilter: IssueFilter{Blacklist: []string{"TestA"}}}, files))
+}
+
+func TestTagConsistency(t *testing.T) {
+	t.Parallel()
+	files := map[string]string{
+		"ok_linux.go":         "//go:build cgo\n\npackage foo\n",
+		"android_linux.go":    "//go:build !android\n\npackage foo\n",
+		"none.go":             "//go:build linux\n\npackage foo\n",
+		"redundant_linux.go":  "//go:build linux\n// +build linux\n\npackage foo\n",
+		"unix_darwin.go":      "//go:build unix\n\npackage foo\n",
+		"excluded_windows.go": "//go:build !windows\n\npackage foo\n",
+		"mixed_linux.go":      "//go:build (linux && cgo) || darwin\n\npackage foo\n",
+		"arch_amd64.go":       "//go:build !arm64 && cgo\n\npackage foo\n",
+		"target_linux_arm.go": "//go:build linux && arm\n\npackage foo\n",
+		"malformed_linux.go":  "//go:build (linux\n\npackage foo\n",
+	}
+	expected := errors.New("tagconsistency failed:\n" +
+		"arch_amd64.go:1: build constraints mention arm64 but the _amd64 file name suffix already restricts the file to amd64\n" +
+		"excluded_windows.go:1: build constraints exclude windows, implied by the _windows file name suffix\n" +
+		"mixed_linux.go:1: build constraints mention darwin but the _linux file name suffix already restricts the file to linux\n" +
+		"redundant_linux.go:1: build constraints are redundant with the _linux file name suffix\n" +
+		"target_linux_arm.go:1: build constraints are redundant with the _linux_arm file name suffix\n" +
+		"unix_darwin.go:1: build constraints are redundant with the _darwin file name suffix")
+	ut.AssertEqual(t, expected, runCheck(t, &TagConsistency{}, files))
+}
@@ -5,7 +5,11 @@
 package checks
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -47,6 +51,16 @@ func rsplitn(s, sep string, n int) []string {
 	return items
 }
 
+// hasArg returns true if arg is in args.
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
 // round rounds a time.Duration at round.
 func round(value time.Duration, resolution time.Duration) time.Duration {
 	if value < 0 {
@@ -56,3 +70,75 @@ func round(value time.Duration, resolution time.Duration) time.Duration {
 	}
 	return value / resolution * resolution
 }
+
+// copyTree copies all the files in src into dst, skipping the .git directory.
+//
+// Returns the list of files copied, relative to src.
+func copyTree(src, dst string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dst, rel), 0700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return ioutil.WriteFile(filepath.Join(dst, rel), content, info.Mode().Perm())
+	})
+	return files, err
+}
+
+// diffTree returns the files in dst that differ from src, were added or were
+// removed. original is the list of files returned by copyTree().
+func diffTree(src, dst string, original []string) ([]string, error) {
+	var diff []string
+	seen := map[string]bool{}
+	err := filepath.Walk(dst, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		seen[rel] = true
+		newContent, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		oldContent, err := ioutil.ReadFile(filepath.Join(src, rel))
+		if os.IsNotExist(err) {
+			diff = append(diff, "added:    "+filepath.ToSlash(rel))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(oldContent, newContent) {
+			diff = append(diff, "modified: "+filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	for _, f := range original {
+		if !seen[f] {
+			diff = append(diff, "removed:  "+filepath.ToSlash(f))
+		}
+	}
+	sort.Strings(diff)
+	return diff, err
+}
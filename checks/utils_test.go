@@ -18,3 +18,13 @@ func TestRound(t *testing.T) {
 	ut.AssertEqual(t, -1500*time.Millisecond, round(-1549*time.Millisecond, 100*time.Millisecond))
 	ut.AssertEqual(t, -1600*time.Millisecond, round(-1550*time.Millisecond, 100*time.Millisecond))
 }
+
+func TestReTestResult(t *testing.T) {
+	t.Parallel()
+	out := "=== RUN   TestFoo\n--- PASS: TestFoo (1.50s)\n    --- FAIL: TestFoo/bar (0.25s)\nPASS\n"
+	expected := [][]string{
+		{"--- PASS: TestFoo (1.50s)", "TestFoo", "1.50"},
+		{"    --- FAIL: TestFoo/bar (0.25s)", "TestFoo/bar", "0.25"},
+	}
+	ut.AssertEqual(t, expected, reTestResult.FindAllStringSubmatch(out, -1))
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// cleanupStack is the process-wide stack of the pending cleanups, e.g. the
+// restore of the stashed changes or the removal of a temporary worktree.
+//
+// When pcg exits early, e.g. when it is interrupted, the pending cleanups are
+// run in LIFO order before exiting. A nil *cleanupStack only runs the cleanups
+// when done, which is convenient in tests.
+type cleanupStack struct {
+	// exit is os.Exit, except in tests.
+	exit func(code int)
+
+	lock    sync.Mutex
+	pending []*cleanup
+	signals chan os.Signal
+	exiting sync.Once
+}
+
+// cleanup is a function run once, either when done or when exiting early.
+type cleanup struct {
+	once sync.Once
+	fn   func() error
+	err  error
+}
+
+func (c *cleanup) run() error {
+	c.once.Do(func() {
+		c.err = c.fn()
+	})
+	return c.err
+}
+
+// newCleanupStack returns a cleanupStack calling exit once the pending
+// cleanups are run on early exit.
+func newCleanupStack(exit func(code int)) *cleanupStack {
+	c := &cleanupStack{exit: exit, signals: make(chan os.Signal, 1)}
+	go func() {
+		for range c.signals {
+			c.exitNow(exitError)
+		}
+	}()
+	return c
+}
+
+// push adds fn on the stack. It returns the function to call once done, which
+// calls fn once and removes it from the stack.
+//
+// While a cleanup is pending, an interrupt runs the pending cleanups then
+// exits.
+func (c *cleanupStack) push(fn func() error) func() error {
+	item := &cleanup{fn: fn}
+	if c == nil {
+		return item.run
+	}
+	c.lock.Lock()
+	c.pending = append(c.pending, item)
+	if len(c.pending) == 1 {
+		signal.Notify(c.signals, os.Interrupt, syscall.SIGTERM)
+	}
+	c.lock.Unlock()
+	return func() error {
+		err := item.run()
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		for i, p := range c.pending {
+			if p == item {
+				c.pending = append(c.pending[:i], c.pending[i+1:]...)
+				break
+			}
+		}
+		if len(c.pending) == 0 {
+			signal.Stop(c.signals)
+		}
+		return err
+	}
+}
+
+// exitNow runs the pending cleanups, the most recent first, then exits with
+// code. Only the first call is effective, the concurrent ones block until it
+// completes.
+func (c *cleanupStack) exitNow(code int) {
+	c.exiting.Do(func() {
+		c.lock.Lock()
+		pending := c.pending
+		c.pending = nil
+		c.lock.Unlock()
+		for i := len(pending) - 1; i >= 0; i-- {
+			if err := pending[i].run(); err != nil {
+				fmt.Fprintf(os.Stderr, "pcg: %s\n", err)
+			}
+		}
+		c.exit(code)
+	})
+}
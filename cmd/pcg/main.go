@@ -18,13 +18,17 @@ import (
 	"log"
 	"os"
 	"os/user"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -40,7 +44,7 @@ import (
 // significant way. This will make files written by this version backward
 // incompatible, forcing downstream users to update their pre-commit-go
 // version.
-const version = "0.4.7"
+const version = "0.5.0"
 
 const hookContent = `#!/bin/sh
 # AUTOGENERATED BY pcg.
@@ -56,7 +60,31 @@ pcg run-hook %s
 
 const gitNilCommit = "0000000000000000000000000000000000000000"
 
-const helpModes = "Supported modes (with shortcut names):\n- pre-commit / fast / pc\n- pre-push / slow / pp  (default)\n- continous-integration / full / ci\n- lint\n- all: includes both continuous-integration and lint"
+// Exit codes. They are a contract with the scripts calling pcg so they must
+// never change.
+const (
+	// exitChecksFailed means at least one check failed.
+	exitChecksFailed = 1
+	// exitUsage means the command line arguments are invalid. It is also used
+	// by package flag.
+	exitUsage = 2
+	// exitPrereq means the prerequisites are missing and couldn't be installed.
+	exitPrereq = 3
+	// exitError means pcg itself failed, e.g. the repository couldn't be read.
+	exitError = 4
+	// exitTimeout means the -deadline was exceeded.
+	exitTimeout = 5
+)
+
+// deadlineGrace is the delay after -deadline after which pcg exits even if
+// it is hung outside of a subprocess.
+const deadlineGrace = 10 * time.Second
+
+// budgetWarningRatio is the ratio of max_duration after which a notice is
+// printed, so developers know the mode is getting close to its time budget.
+const budgetWarningRatio = 0.8
+
+const helpModes = "Supported modes (with shortcut names):\n- pre-commit / fast / pc\n- pre-push / slow / pp  (default)\n- continous-integration / full / ci\n- lint\n- all: includes both continuous-integration and lint\n- any other mode defined in pre-commit-go.yml"
 
 // http://git-scm.com/docs/githooks#_pre_push
 var rePrePush = regexp.MustCompile("^(.+?) ([0-9a-f]{40}) (.+?) ([0-9a-f]{40})$")
@@ -64,20 +92,47 @@ var rePrePush = regexp.MustCompile("^(.+?) ([0-9a-f]{40}) (.+?) ([0-9a-f]{40})$"
 var helpText = template.Must(template.New("help").Parse(`pcg: runs pre-commit checks on Go projects, fast.
 
 Supported commands are:
+  advise      - runs each check once on all the files and suggests the mode it
+                belongs to as per its duration; see -fast and -slow
+  config      - prints the effective configuration, with the personal
+                settings and the defaults applied, as pre-commit-go.yml; use
+                -m to only print some modes
   help        - this page
+  help-check  - lists the checks or prints the documentation and options of
+                the check given as argument, e.g. 'help-check coverage'
   prereq      - installs prerequisites, e.g.: errcheck, golint, goimports,
                 govet, etc as applicable for the enabled checks
   info        - prints the current configuration used
+  migrate     - updates pre-commit-go.yml to the current schema, keeping the
+                original as pre-commit-go.yml.bak, and lists the unknown keys
   install     - runs 'prereq' then installs the git commit hook as
                 .git/hooks/pre-commit
   installrun  - runs 'prereq', 'install' then 'run'
   run         - runs all enabled checks
   run-hook    - used by hooks (pre-commit, pre-push) exclusively
+  schema      - prints the JSON Schema of pre-commit-go.yml, for editors
+  update-coverage - runs the coverage checks and raises the coverage bands
+                in pre-commit-go.yml that are exceeded, keeping their width,
+                and refreshes their baseline_file or baseline_ref
   version     - print the tool version number
-  writeconfig - writes (or rewrite) a pre-commit-go.yml
+  why         - prints whether the file given as argument is checked, the
+                rule excluding it otherwise, and the checks processing it in
+                each mode, e.g. 'why foo/bar.go'; use -m to only list some
+                modes
+  writeconfig - writes (or rewrite) a pre-commit-go.yml; use -minimal or -full
+                to select the verbosity, -m to only write some modes and
+                -preset to start from a curated configuration
 
 When executed without command, it does the equivalent of 'installrun'.
 
+Exit codes are:
+  0 - success
+  1 - at least one check failed
+  2 - invalid command line arguments
+  3 - prerequisites installation failed
+  4 - pcg itself failed, e.g. the repository couldn't be read
+  5 - the -deadline was exceeded
+
 Supported flags are:
 {{.Usage}}
 Supported checks:
@@ -90,6 +145,17 @@ Supported checks:
 No check ever modify any file.
 `))
 
+var helpCheckText = template.Must(template.New("help-check").Funcs(template.FuncMap{"indent": indent}).Parse(`{{.Name}}: {{.Description}}
+{{if .Doc}}
+{{indent .Doc "  "}}
+{{end}}
+Options:{{range .Fields}}
+  {{.Name}} ({{.Type}}, default: {{.Default}}){{if .Doc}}
+{{indent .Doc "      "}}{{end}}{{else}} none{{end}}
+
+See https://github.com/maruel/pre-commit-go/blob/master/CONFIGURATION.md#{{.Name}}
+`))
+
 const yamlHeader = `# https://github.com/maruel/pre-commit-go configuration file to run checks
 # automatically on commit, on push and on continuous integration service after
 # a push or on merge of a pull request.
@@ -105,6 +171,67 @@ var parsedVersion []int
 type application struct {
 	config        *checks.Config
 	maxConcurrent int
+	slowest       int
+	packages      stringsFlag
+	deadline      time.Duration
+	deadlineAt    time.Time
+	noDedup       bool
+	format        string
+	groupBy       string
+	// out receives the report of the checks; it is os.Stdout, teed to the
+	// -out file if specified.
+	out io.Writer
+	// in is the standard input, from which the git pre-push hook reads the refs
+	// being pushed.
+	in io.Reader
+	// errOut receives the notices printed while the checks run; it is
+	// os.Stderr when nil.
+	errOut io.Writer
+	// cleanups are run before exiting early, e.g. when interrupted.
+	cleanups *cleanupStack
+}
+
+// allModes returns the predefined modes and the ones defined in the
+// configuration.
+func (a *application) allModes() []checks.Mode {
+	return append(append([]checks.Mode{}, checks.AllModes...), a.config.UserModes()...)
+}
+
+// notice prints msg to errOut right away, instead of in the report.
+func (a *application) notice(msg string) {
+	w := a.errOut
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "%s\n", msg)
+}
+
+// deadlineExceeded returns true if -deadline was specified and is exceeded.
+func (a *application) deadlineExceeded() bool {
+	return a.deadline > 0 && !time.Now().Before(a.deadlineAt)
+}
+
+// exitOnDeadline exits with exitTimeout once -deadline is exceeded by grace,
+// in case pcg hangs outside of a subprocess. The pending cleanups are run
+// first.
+func (a *application) exitOnDeadline(grace time.Duration) *time.Timer {
+	return time.AfterFunc(a.deadline+grace, func() {
+		fmt.Fprintf(os.Stderr, "pcg: deadline of %s exceeded\n", a.deadline)
+		a.cleanups.exitNow(exitTimeout)
+	})
+}
+
+// stringsFlag is a flag.Value that accumulates the values when specified
+// multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
 // Utils.
@@ -131,78 +258,158 @@ func parseVersion(v string) ([]int, error) {
 }
 
 // loadConfigFile returns a Config with defaults set then loads the config from
-// file "pathname".
-func loadConfigFile(pathname string) *checks.Config {
+// file "pathname". It returns nil if the file doesn't exist.
+func loadConfigFile(pathname string) (*checks.Config, error) {
 	content, err := ioutil.ReadFile(pathname)
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 	config := &checks.Config{}
 	if err := yaml.Unmarshal(content, config); err != nil {
-		// Log but ignore the error, recreate a new config instance.
-		log.Printf("failed to parse %s: %s", pathname, err)
-		return nil
+		return nil, usageErrorf("failed to parse %s: %s", pathname, err)
 	}
 	configVersion, err := parseVersion(config.MinVersion)
 	if err != nil {
 		log.Printf("invalid version %s", config.MinVersion)
 	}
+	if requiresNewer(configVersion) {
+		return nil, usageErrorf("%s requires pcg version %s or later, this is %s", pathname, config.MinVersion, version)
+	}
+	return config, nil
+}
+
+// requiresNewer returns true if configVersion is newer than this version.
+func requiresNewer(configVersion []int) bool {
 	for i, v := range configVersion {
 		if len(parsedVersion) <= i {
 			if v == 0 {
 				// 3.0 == 3.0.0
 				continue
 			}
-			log.Printf("requires newer version %s", config.MinVersion)
-			return nil
+			return true
 		}
 		if parsedVersion[i] > v {
 			break
 		}
 		if parsedVersion[i] < v {
-			log.Printf("requires newer version %s", config.MinVersion)
-			return nil
+			return true
+		}
+	}
+	return false
+}
+
+// setGoCaches sets GOCACHE and GOMODCACHE as per the configuration so every
+// process started by pcg uses the same caches. The directories are created if
+// needed and must be writable.
+func setGoCaches(root string, config *checks.Config) error {
+	caches := []struct {
+		env string
+		dir string
+	}{
+		{"GOCACHE", config.GoCache},
+		{"GOMODCACHE", config.GoModCache},
+	}
+	for _, c := range caches {
+		if c.dir == "" {
+			continue
+		}
+		dir := os.ExpandEnv(c.dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		if err := checkWritable(dir); err != nil {
+			return fmt.Errorf("invalid %s directory: %s", c.env, err)
 		}
+		log.Printf("%s=%s", c.env, dir)
+		if err := os.Setenv(c.env, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWritable creates the directory dir if needed and verifies that a file
+// can be created in it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "pcg")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
 	}
-	return config
+	return os.Remove(name)
 }
 
 // loadConfig loads the on disk configuration or use the default configuration
 // if none is found. See CONFIGURATION.md for the logic.
-func loadConfig(repo scm.ReadOnlyRepo, path string) (string, *checks.Config) {
+//
+// A configuration file found but invalid is an error, it is not skipped.
+func loadConfig(repo scm.ReadOnlyRepo, path string) (string, *checks.Config, error) {
+	var files []string
 	if filepath.IsAbs(path) {
-		if config := loadConfigFile(path); config != nil {
-			return path, config
-		}
+		files = append(files, path)
 	} else {
 		// <repo root>/.git/<path>
 		if scmDir, err := repo.ScmDir(); err == nil {
-			file := filepath.Join(scmDir, path)
-			if config := loadConfigFile(file); config != nil {
-				return file, config
-			}
+			files = append(files, filepath.Join(scmDir, path))
 		}
 
 		// <repo root>/<path>
-		file := filepath.Join(repo.Root(), path)
-		if config := loadConfigFile(file); config != nil {
-			return file, config
-		}
+		files = append(files, filepath.Join(repo.Root(), path))
 
 		if user, err := user.Current(); err == nil && user.HomeDir != "" {
 			if runtime.GOOS == "windows" {
 				// ~/<path>
-				file = filepath.Join(user.HomeDir, path)
+				files = append(files, filepath.Join(user.HomeDir, path))
 			} else {
 				// ~/.config/<path>
-				file = filepath.Join(user.HomeDir, ".config", path)
-			}
-			if config := loadConfigFile(file); config != nil {
-				return file, config
+				files = append(files, filepath.Join(user.HomeDir, ".config", path))
 			}
 		}
 	}
-	return "<N/A>", checks.New(version)
+	for _, file := range files {
+		config, err := loadConfigFile(file)
+		if err != nil {
+			return file, nil, err
+		}
+		if config != nil {
+			return file, config, nil
+		}
+	}
+	return "<N/A>", checks.New(version), nil
+}
+
+// localConfigPath returns the path of the personal overlay of the config at
+// path, e.g. pre-commit-go.local.yml for pre-commit-go.yml.
+func localConfigPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".local" + ext
+}
+
+// loadLocalConfig merges the personal overlay file, if present, on top of
+// config. The settings stricter than the shared ones are printed.
+func loadLocalConfig(path string, config *checks.Config) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	warnings, err := config.Overlay(content)
+	if err != nil {
+		return usageErrorf("failed to parse %s: %s", path, err)
+	}
+	log.Printf("local config: %s", path)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s is stricter than the shared config: %s\n", filepath.Base(path), w)
+	}
+	return nil
 }
 
 func callRun(check checks.Check, change scm.Change, options *checks.Options) (time.Duration, error) {
@@ -222,74 +429,584 @@ func (a *application) runChecks(change scm.Change, modes []checks.Mode, prereqRe
 		log.Printf("no change")
 		return nil
 	}
+	changes, err := a.splitModules(change)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		log.Printf("no change in any module")
+		return nil
+	}
+	var dirs []string
+	for dir := range changes {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
 	var wg sync.WaitGroup
-	errs := make(chan error, len(enabledChecks))
-	warnings := make(chan error, len(enabledChecks))
+	results := &report{}
+	var buildFailed int32
 	start := time.Now()
-	for _, c := range enabledChecks {
+	launch := func(dir string, check checks.Check) {
+		// The slot is reserved before starting the check so the report is in
+		// launch order.
+		slot := results.reserve()
 		wg.Add(1)
-		go func(check checks.Check) {
+		go func() {
 			defer wg.Done()
+			// Prefix everything with the module when running in multiple modules.
+			name := check.GetName()
+			if dir != "" {
+				name = "module " + dir + ": " + name
+			}
+			r := checkResult{name: name}
+			defer func() {
+				// A check panicking must not take down pcg, as the pending cleanups
+				// wouldn't run.
+				if v := recover(); v != nil {
+					r.issues = moduleIssues(dir, checks.AsIssues(check, fmt.Errorf("%s panicked: %v\n%s", name, v, debug.Stack())))
+				}
+				results.record(slot, r)
+			}()
 			if len(check.GetPrerequisites()) != 0 {
 				// If this check has prerequisites, wait for all prerequisites to be
 				// checked for presence.
 				prereqReady.Wait()
 			}
-			log.Printf("%s...", check.GetName())
-			duration, err := callRun(check, change, options)
+			triggered, err := checks.IsTriggered(check, changes[dir])
+			if err != nil {
+				r.issues = moduleIssues(dir, checks.AsIssues(check, err))
+				return
+			}
+			if !triggered {
+				log.Printf("%s not triggered", name)
+				r.untriggered = true
+				return
+			}
+			log.Printf("%s...", name)
+			r.duration, err = callRun(check, changes[dir], options)
+			r.ran = true
 			if err != nil {
-				log.Printf("... %s in %1.2fs FAILED\n%s", check.GetName(), duration.Seconds(), err)
-				errs <- err
+				log.Printf("... %s in %1.2fs FAILED\n%s", name, r.duration.Seconds(), err)
+				if checks.IsBuildFailure(check, err) {
+					atomic.StoreInt32(&buildFailed, 1)
+				}
+				r.issues = moduleIssues(dir, checks.AsIssues(check, err))
 				return
 			}
-			log.Printf("... %s in %1.2fs", check.GetName(), duration.Seconds())
+			log.Printf("... %s in %1.2fs", name, r.duration.Seconds())
+			r.passed = true
 			// A check that took too long is a check that failed.
 			max := time.Duration(options.MaxDuration) * time.Second
-			if duration > max {
-				warnings <- fmt.Errorf("check %s took %1.2fs -> IT IS TOO SLOW (limit: %s)", check.GetName(), duration.Seconds(), max)
+			if options.MaxDuration > 0 && r.duration > max {
+				r.warning = errors.New(checks.Message(checks.MsgTooSlow, name, r.duration.Seconds(), max))
+			} else if elapsed := time.Since(start); options.MaxDuration > 0 && elapsed >= time.Duration(budgetWarningRatio*float64(max)) {
+				// Printed as each check completes, while the remaining checks still
+				// run, so the running total is not lost if pcg is interrupted.
+				a.notice(checks.Message(checks.MsgWarning, checks.Message(checks.MsgBudgetUsed, name, elapsed.Seconds(), max, int(100*elapsed/max))))
+			}
+		}()
+	}
+	first, rest := enabledChecks, []checks.Check(nil)
+	if options.FailFastOnBuild {
+		first, rest = splitBuildChecks(enabledChecks)
+	}
+	for _, dir := range dirs {
+		for _, c := range first {
+			launch(dir, c)
+		}
+	}
+	if len(rest) != 0 {
+		wg.Wait()
+		if atomic.LoadInt32(&buildFailed) != 0 {
+			var names []string
+			for _, c := range rest {
+				names = append(names, c.GetName())
 			}
-		}(c)
+			results.record(results.reserve(), checkResult{issues: checks.Issues{{Severity: checks.SeverityError, Message: checks.Message(checks.MsgBuildFailed, strings.Join(names, ", "))}}})
+		} else {
+			for _, dir := range dirs {
+				for _, c := range rest {
+					launch(dir, c)
+				}
+			}
+		}
 	}
 	wg.Wait()
+	return a.printReport(results.snapshot(), options, start)
+}
 
-	var err error
-	for {
-		select {
-		case err = <-errs:
-			fmt.Printf("%s\n", err)
-		case warning := <-warnings:
-			fmt.Printf("warning: %s\n", warning)
-		default:
-			if err != nil {
-				duration := time.Now().Sub(start)
-				return fmt.Errorf("checks failed in %1.2fs", duration.Seconds())
+// checkResult is the outcome of a check run on a module.
+type checkResult struct {
+	name        string
+	issues      checks.Issues
+	warning     error
+	duration    time.Duration
+	ran         bool
+	passed      bool
+	untriggered bool
+}
+
+// report aggregates the results of the checks run concurrently.
+//
+// A slot is reserved for each check when it is launched, so the results are
+// in launch order, which is the order of the configuration, whatever the
+// order in which the checks complete.
+type report struct {
+	lock    sync.Mutex
+	results []checkResult
+}
+
+// reserve returns the slot of the check being launched.
+func (r *report) reserve() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results = append(r.results, checkResult{})
+	return len(r.results) - 1
+}
+
+// record sets the result of the check of slot i.
+func (r *report) record(i int, result checkResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results[i] = result
+}
+
+// snapshot returns a copy of the results, in launch order.
+func (r *report) snapshot() []checkResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]checkResult(nil), r.results...)
+}
+
+// printReport prints the results of the checks, in launch order, and returns
+// an error if they failed.
+func (a *application) printReport(results []checkResult, options *checks.Options, start time.Time) error {
+	var skipped, passed []string
+	var checkTimings checks.Timings
+	var issues checks.Issues
+	for _, r := range results {
+		if r.untriggered {
+			skipped = append(skipped, r.name)
+		}
+		if r.ran {
+			checkTimings = append(checkTimings, checks.Timing{Name: r.name, Duration: r.duration})
+		}
+		if r.passed {
+			passed = append(passed, r.name)
+		}
+		// The issues of a check are sorted by file and line but the checks stay
+		// in launch order.
+		sort.Stable(r.issues)
+		issues = append(issues, r.issues...)
+	}
+	if len(skipped) != 0 {
+		sort.Strings(skipped)
+		fmt.Fprintf(a.out, "%s\n", checks.Message(checks.MsgNotTriggered, strings.Join(skipped, ", ")))
+	}
+	if a.slowest > 0 {
+		sort.Stable(checkTimings)
+		printSlowest(a.out, "checks", checkTimings, a.slowest)
+		printSlowest(a.out, "tests", options.TestTimings(), a.slowest)
+	}
+	for _, r := range results {
+		if r.warning != nil {
+			fmt.Fprintf(a.out, "%s\n", checks.Message(checks.MsgWarning, r.warning))
+		}
+	}
+	for _, n := range options.Notices() {
+		fmt.Fprintf(a.out, "%s\n", n)
+	}
+	if len(issues) != 0 {
+		if !a.noDedup {
+			issues = dedupIssues(issues)
+		}
+		if a.format == "github" {
+			fmt.Fprintf(a.out, "%s\n", formatGitHub(issues))
+		} else if a.groupBy == "file" {
+			fmt.Fprintf(a.out, "%s\n", formatIssuesByFile(issues))
+		} else {
+			fmt.Fprintf(a.out, "%s\n", formatIssues(issues))
+		}
+	}
+	if a.deadlineExceeded() {
+		sort.Strings(passed)
+		if len(passed) == 0 {
+			passed = []string{"none"}
+		}
+		return &exitCodeError{exitTimeout, errors.New(checks.Message(checks.MsgDeadlineExceeded, a.deadline, strings.Join(passed, ", ")))}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+	failOn := a.config.FailOn
+	if failOn == "" {
+		failOn = checks.SeverityError
+	}
+	for _, issue := range issues {
+		if issue.Severity.AtLeast(failOn) {
+			duration := time.Now().Sub(start)
+			return &exitCodeError{exitChecksFailed, errors.New(checks.Message(checks.MsgChecksFailed, duration.Seconds(), formatTally(issues)))}
+		}
+	}
+	fmt.Fprintf(a.out, "%s\n", checks.Message(checks.MsgBelowFailOn, formatTally(issues), failOn))
+	return nil
+}
+
+// moduleIssues makes the issues found in the module dir relative to the
+// repository root. The text of the plain errors is prefixed with the module
+// instead.
+func moduleIssues(dir string, issues checks.Issues) checks.Issues {
+	if dir == "" {
+		return issues
+	}
+	for i := range issues {
+		if issues[i].File != "" {
+			issues[i].File = path.Join(dir, issues[i].File)
+		} else {
+			issues[i].Message = "module " + dir + ": " + issues[i].Message
+		}
+	}
+	return issues
+}
+
+// dedupIssues merges the issues reported at the same line of the same file
+// with the same message, ignoring case and whitespace, e.g. when overlapping
+// linters are enabled. The first one is kept, with the highest severity and
+// the number of times it was reported.
+func dedupIssues(issues checks.Issues) checks.Issues {
+	type key struct {
+		file    string
+		line    int
+		message string
+	}
+	var out checks.Issues
+	index := map[key]int{}
+	reporters := map[int][]string{}
+	for _, issue := range issues {
+		k := key{issue.File, issue.Line, strings.ToLower(strings.Join(strings.Fields(issue.Message), " "))}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(out)
+			reporters[len(out)] = []string{issue.Check}
+			out = append(out, issue)
+			continue
+		}
+		if !out[i].Severity.AtLeast(issue.Severity) {
+			out[i].Severity = issue.Severity
+		}
+		reporters[i] = append(reporters[i], issue.Check)
+	}
+	for i, names := range reporters {
+		if len(names) == 1 {
+			continue
+		}
+		var uniques []string
+		for j, name := range names {
+			if j == 0 || name != names[j-1] {
+				uniques = append(uniques, name)
 			}
-			return err
 		}
+		note := fmt.Sprintf(" (reported %d times", len(names))
+		if len(uniques) > 1 {
+			note += " by " + strings.Join(uniques, ", ")
+		}
+		out[i].Message += note + ")"
+	}
+	return out
+}
+
+// reEscape matches an ANSI terminal escape sequence, e.g. a color change.
+var reEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+
+// stripEscapes is an io.Writer removing the ANSI terminal escape sequences,
+// e.g. the colors from the output of a tool, before writing to w.
+type stripEscapes struct {
+	w io.Writer
+}
+
+func (s *stripEscapes) Write(p []byte) (int, error) {
+	if _, err := s.w.Write(reEscape.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// formatIssues returns the text to print for issues, which must be sorted.
+// The structured issues are listed under their check, one per line. The plain
+// errors are printed as is. The message of the issues that are not errors is
+// prefixed with their severity.
+func formatIssues(issues checks.Issues) string {
+	var lines []string
+	check := ""
+	for i, issue := range issues {
+		if issue.Severity != "" && issue.Severity != checks.SeverityError {
+			issue.Message = string(issue.Severity) + ": " + issue.Message
+		}
+		if issue.File == "" {
+			lines = append(lines, issue.Message)
+			check = ""
+			continue
+		}
+		if i == 0 || issue.Check != check {
+			check = issue.Check
+			lines = append(lines, check+" failed:")
+		}
+		lines = append(lines, issue.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatIssuesByFile returns the text to print for issues, with the structured
+// issues of all the checks listed under their file, sorted by line, and
+// suffixed with the check that reported them. The plain errors are printed
+// first as is.
+func formatIssuesByFile(issues checks.Issues) string {
+	sorted := make(byFile, len(issues))
+	copy(sorted, issues)
+	sort.Stable(sorted)
+	var lines []string
+	file := ""
+	for _, issue := range sorted {
+		if issue.Severity != "" && issue.Severity != checks.SeverityError {
+			issue.Message = string(issue.Severity) + ": " + issue.Message
+		}
+		if issue.File == "" {
+			lines = append(lines, issue.Message)
+			continue
+		}
+		if issue.File != file {
+			file = issue.File
+			lines = append(lines, file+":")
+		}
+		lines = append(lines, issue.String()+" ["+issue.Check+"]")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// byFile sorts the issues by file and position, then by check. The issues
+// not about a file are first.
+type byFile checks.Issues
+
+func (b byFile) Len() int      { return len(b) }
+func (b byFile) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byFile) Less(i, j int) bool {
+	x, y := &b[i], &b[j]
+	if x.File != y.File {
+		return x.File < y.File
+	}
+	if x.Line != y.Line {
+		return x.Line < y.Line
+	}
+	if x.Col != y.Col {
+		return x.Col < y.Col
+	}
+	return x.Check < y.Check
+}
+
+// formatGitHub returns issues as GitHub Actions workflow commands, so they are
+// annotated on the pull request diff. The issues not about a file are shown
+// in the summary of the run.
+func formatGitHub(issues checks.Issues) string {
+	levels := map[checks.Severity]string{checks.SeverityWarning: "warning", checks.SeverityInfo: "notice"}
+	escape := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	escapeProperty := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	var lines []string
+	for _, issue := range issues {
+		level := levels[issue.Severity]
+		if level == "" {
+			level = "error"
+		}
+		var props []string
+		if issue.File != "" {
+			props = append(props, "file="+escapeProperty.Replace(issue.File))
+			if issue.Line != 0 {
+				props = append(props, "line="+strconv.Itoa(issue.Line))
+				if issue.Col != 0 {
+					props = append(props, "col="+strconv.Itoa(issue.Col))
+				}
+			}
+		}
+		if issue.Check != "" {
+			props = append(props, "title="+escapeProperty.Replace(issue.Check))
+		}
+		cmd := "::" + level
+		if len(props) != 0 {
+			cmd += " " + strings.Join(props, ",")
+		}
+		lines = append(lines, cmd+"::"+escape.Replace(issue.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatTally returns the number of issues of each severity, e.g.
+// "2 errors, 1 warning".
+func formatTally(issues checks.Issues) string {
+	tally := issues.Tally()
+	var out []string
+	for _, s := range checks.AllSeverities {
+		n := tally[s]
+		if n == 0 {
+			continue
+		}
+		name := string(s)
+		if n > 1 && s != checks.SeverityInfo {
+			name += "s"
+		}
+		out = append(out, fmt.Sprintf("%d %s", n, name))
+	}
+	return strings.Join(out, ", ")
+}
+
+// splitBuildChecks returns the checks that compile the code, to run first, and
+// the others. These are the checks build or if there is none, the checks test.
+func splitBuildChecks(enabledChecks []checks.Check) ([]checks.Check, []checks.Check) {
+	for _, name := range []string{(&checks.Build{}).GetName(), (&checks.Test{}).GetName()} {
+		var first, rest []checks.Check
+		for _, c := range enabledChecks {
+			if c.GetName() == name {
+				first = append(first, c)
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		if len(first) != 0 {
+			return first, rest
+		}
+	}
+	return enabledChecks, nil
+}
+
+// splitModules returns the change of each Go module to check, keyed by the
+// module directory. Returns the change keyed by "" when the configuration
+// doesn't list modules.
+func (a *application) splitModules(change scm.Change) (map[string]scm.Change, error) {
+	if len(a.config.Modules) == 0 {
+		return map[string]scm.Change{"": change}, nil
+	}
+	dirs := []string(a.config.Modules)
+	if a.config.Modules.IsAuto() {
+		var err error
+		if dirs, err = scm.FindModules(change.Repo().Root(), a.config.IgnorePatterns); err != nil {
+			return nil, err
+		}
+		if len(dirs) == 0 {
+			return nil, errors.New("modules: no go.mod file found")
+		}
+	}
+	return scm.SplitModules(change, dirs)
+}
+
+// printSlowest prints the first n items of timings, which must be sorted.
+func printSlowest(w io.Writer, title string, timings checks.Timings, n int) {
+	if len(timings) == 0 {
+		return
+	}
+	if len(timings) > n {
+		timings = timings[:n]
+	}
+	fmt.Fprintf(w, "slowest %s:\n", title)
+	for _, t := range timings {
+		fmt.Fprintf(w, "  %7.2fs %s\n", t.Duration.Seconds(), t.Name)
+	}
+}
+
+// warnUntracked prints a warning listing the untracked Go files, if enabled,
+// since they are silently not checked.
+func (a *application) warnUntracked(repo scm.ReadOnlyRepo) error {
+	if !a.config.WarnUntracked {
+		return nil
+	}
+	untracked, err := repo.Untracked(a.config.IgnorePatterns)
+	if err != nil {
+		return err
+	}
+	var goFiles []string
+	for _, f := range untracked {
+		if strings.HasSuffix(f, ".go") {
+			goFiles = append(goFiles, f)
+		}
+	}
+	if len(goFiles) != 0 {
+		fmt.Fprintf(a.out, "%s\n", checks.Message(checks.MsgUntracked, strings.Join(goFiles, "\n  ")))
 	}
+	return nil
 }
 
-func (a *application) runPreCommit(repo scm.Repo) error {
-	// First, stash index and work dir, keeping only the to-be-committed changes
-	// in the working directory.
+func (a *application) runPreCommit(repo scm.Repo) (err error) {
+	// Run the checks on a copy of the index, so partially staged files are
+	// checked as they are about to be committed, independent of the working
+	// tree.
 	// TODO(maruel): When running for an git commit --amend run, use HEAD~1.
-	stashed, err := repo.Stash()
+	if err := a.warnUntracked(repo); err != nil {
+		return err
+	}
+	if a.config.StashUnstaged {
+		return a.runPreCommitStashed(repo)
+	}
+	change, cleanup, err := repo.Staged(a.config.IgnorePatterns)
 	if err != nil {
 		return err
 	}
-	// Run the checks.
-	var change scm.Change
-	change, err = repo.Between(scm.Current, scm.Head, a.config.IgnorePatterns)
-	if change != nil {
-		err = a.runChecks(change, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+	done := a.cleanups.push(cleanup)
+	defer func() {
+		if err2 := done(); err == nil {
+			err = err2
+		}
+	}()
+	return a.runChecks(change, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+}
+
+// runPreCommitStashed runs the pre-commit checks in the checkout. First, stash
+// the work dir, keeping only the to-be-committed changes in the working
+// directory.
+//
+// The unstaged changes are restored even if a check panics or pcg is
+// interrupted.
+func (a *application) runPreCommitStashed(repo scm.Repo) (err error) {
+	stashed, err := repo.Stash()
+	if err != nil {
+		return err
 	}
 	// If stashed is false, everything was in the index so no stashing was needed.
 	if stashed {
-		if err2 := repo.Restore(); err == nil {
+		restore := a.cleanups.push(func() error {
+			if err := repo.Restore(); err != nil {
+				return fmt.Errorf("%s\nthe unstaged changes are still saved in git stash", err)
+			}
+			return nil
+		})
+		defer func() {
+			if err2 := restore(); err == nil {
+				err = err2
+			}
+		}()
+	}
+	change, err := repo.Between(scm.Current, scm.Head, a.config.IgnorePatterns)
+	if err != nil {
+		return err
+	}
+	return a.runChecks(change, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+}
+
+// inRepo calls fn with repo, or with a worktree of its staging area when
+// isolation is enabled with -worktree or the isolate option. The worktree is
+// removed afterward, even if pcg is interrupted.
+func (a *application) inRepo(repo scm.Repo, worktree bool, fn func(repo scm.Repo) error) (err error) {
+	if !worktree && !a.config.Isolate {
+		return fn(repo)
+	}
+	w, cleanup, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	log.Printf("worktree: %s", w.Root())
+	done := a.cleanups.push(cleanup)
+	defer func() {
+		if err2 := done(); err == nil {
 			err = err2
 		}
-	}
-	return err
+	}()
+	return fn(w)
 }
 
 func (a *application) runPrePush(repo scm.Repo) (err error) {
@@ -298,26 +1015,19 @@ func (a *application) runPrePush(repo scm.Repo) (err error) {
 	previousRef := repo.Ref(scm.Head)
 	curr := previous
 	stashed := false
+	// The checkout and the stash are restored even when exiting early, e.g.
+	// when interrupted or once -deadline is exceeded.
+	var restore func() error
 	defer func() {
-		if curr != previous {
-			p := previousRef
-			if p == "" {
-				p = string(previous)
-			}
-			if err2 := repo.Checkout(p); err == nil {
-				err = err2
-			}
-		}
-		if stashed {
-			if err2 := repo.Restore(); err == nil {
+		if restore != nil {
+			if err2 := restore(); err == nil {
 				err = err2
 			}
 		}
 	}()
 
-	bio := bufio.NewReader(os.Stdin)
+	bio := bufio.NewReader(a.in)
 	line := ""
-	triedToStash := false
 	for {
 		if line, err = bio.ReadString('\n'); err != nil {
 			break
@@ -334,9 +1044,24 @@ func (a *application) runPrePush(repo scm.Repo) (err error) {
 		}
 		if to != curr {
 			// Stash, checkout, run tests.
-			if !triedToStash {
+			if restore == nil {
 				// Only try to stash once.
-				triedToStash = true
+				restore = a.cleanups.push(func() error {
+					var err error
+					if curr != previous {
+						p := previousRef
+						if p == "" {
+							p = string(previous)
+						}
+						err = repo.Checkout(p)
+					}
+					if stashed {
+						if err2 := repo.Restore(); err == nil && err2 != nil {
+							err = fmt.Errorf("%s\nthe unstaged changes are still saved in git stash", err2)
+						}
+					}
+					return err
+				})
 				if stashed, err = repo.Stash(); err != nil {
 					return
 				}
@@ -363,7 +1088,7 @@ func (a *application) runPrePush(repo scm.Repo) (err error) {
 	return
 }
 
-func processModes(modeFlag string) ([]checks.Mode, error) {
+func processModes(modeFlag string, config *checks.Config) ([]checks.Mode, error) {
 	if len(modeFlag) == 0 {
 		return nil, nil
 	}
@@ -382,7 +1107,10 @@ func processModes(modeFlag string) ([]checks.Mode, error) {
 			case string(checks.Lint):
 				modes = append(modes, checks.Lint)
 			default:
-				return nil, fmt.Errorf("invalid mode \"%s\"\n\n%s", p, helpModes)
+				if _, ok := config.Modes[checks.Mode(p)]; !ok {
+					return nil, fmt.Errorf("invalid mode \"%s\"\n\n%s", p, helpModes)
+				}
+				modes = append(modes, checks.Mode(p))
 			}
 		}
 	}
@@ -397,6 +1125,89 @@ func (s sortedChecks) Less(i, j int) bool { return s[i].GetName() < s[j].GetName
 
 // Commands.
 
+// adviceModes are the modes considered by 'advise', from the fastest.
+var adviceModes = []checks.Mode{checks.PreCommit, checks.PrePush, checks.ContinuousIntegration}
+
+// adviseMode returns the fastest mode where a check taking d belongs.
+func adviseMode(d, fast, slow time.Duration) checks.Mode {
+	switch {
+	case d <= fast:
+		return checks.PreCommit
+	case d <= slow:
+		return checks.PrePush
+	default:
+		return checks.ContinuousIntegration
+	}
+}
+
+// cmdAdvise runs each check enabled in modes once on all the files and
+// suggests the fastest mode it belongs to, as per its duration.
+//
+// The checks are run serially so their durations are not skewed by each
+// other.
+func (a *application) cmdAdvise(repo scm.ReadOnlyRepo, modes []checks.Mode, fast, slow time.Duration) error {
+	if fast > slow {
+		return usageErrorf("-fast must not be larger than -slow")
+	}
+	change, err := repo.Between(scm.Current, scm.Initial, a.config.IgnorePatterns)
+	if err != nil {
+		return err
+	}
+	if change, err = scm.Restrict(change, a.packages); err != nil {
+		return &exitCodeError{exitUsage, err}
+	}
+	if change == nil {
+		log.Printf("no change")
+		return nil
+	}
+	changes, err := a.splitModules(change)
+	if err != nil {
+		return err
+	}
+	enabledChecks, options := a.config.EnabledChecks(modes)
+	sort.Stable(sortedChecks(enabledChecks))
+	suggested := map[checks.Mode][]string{}
+	maxLen := 0
+	for _, c := range enabledChecks {
+		if l := len(c.GetName()); l > maxLen {
+			maxLen = l
+		}
+	}
+	for _, c := range enabledChecks {
+		var current []string
+		for _, mode := range modes {
+			for _, other := range a.config.Modes[mode].Checks[c.GetName()] {
+				if reflect.DeepEqual(c, other) {
+					current = append(current, string(mode))
+					break
+				}
+			}
+		}
+		var total time.Duration
+		failed := ""
+		for _, change := range changes {
+			log.Printf("%s...", c.GetName())
+			d, err := callRun(c, change, options)
+			total += d
+			if err != nil {
+				failed = " (failed)"
+			}
+		}
+		mode := adviseMode(total, fast, slow)
+		suggested[mode] = append(suggested[mode], c.GetName())
+		fmt.Printf("%-*s %8.2fs  %-40s -> %s%s\n", maxLen, c.GetName(), total.Seconds(), strings.Join(current, ","), mode, failed)
+	}
+	fmt.Printf("\nSuggested modes; each check also runs in the slower modes:\n")
+	for _, mode := range adviceModes {
+		names := strings.Join(suggested[mode], ", ")
+		if names == "" {
+			names = "<none>"
+		}
+		fmt.Printf("  %s: %s\n", mode, names)
+	}
+	return nil
+}
+
 func (a *application) cmdHelp(repo scm.ReadOnlyRepo, usage string) error {
 	s := &struct {
 		Usage        string
@@ -425,6 +1236,37 @@ func (a *application) cmdHelp(repo scm.ReadOnlyRepo, usage string) error {
 	return helpText.Execute(os.Stdout, s)
 }
 
+// cmdHelpCheck prints the documentation of the check type name or lists the
+// checks if name is empty.
+func (a *application) cmdHelpCheck(name string) error {
+	if name == "" {
+		var names []string
+		max := 0
+		for n := range checks.KnownChecks {
+			names = append(names, n)
+			if len(n) > max {
+				max = len(n)
+			}
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Printf("%-*s : %s\n", max, n, checks.KnownChecks[n]().GetDescription())
+		}
+		fmt.Printf("\nRun 'pcg help-check <check>' for the options of a check.\n")
+		return nil
+	}
+	doc, err := checks.Document(name)
+	if err != nil {
+		return &exitCodeError{exitUsage, err}
+	}
+	return helpCheckText.Execute(os.Stdout, doc)
+}
+
+// indent prefixes each line of s with prefix.
+func indent(s, prefix string) string {
+	return prefix + strings.Replace(s, "\n", "\n"+prefix, -1)
+}
+
 // cmdInfo displays the current configuration used.
 func (a *application) cmdInfo(repo scm.ReadOnlyRepo, modes []checks.Mode, configPath string) error {
 	fmt.Printf("File: %s\n", configPath)
@@ -438,7 +1280,7 @@ func (a *application) cmdInfo(repo scm.ReadOnlyRepo, modes []checks.Mode, config
 	fmt.Printf("IgnorePatterns:\n%s", content)
 
 	if len(modes) == 0 {
-		modes = checks.AllModes
+		modes = a.allModes()
 	}
 	for _, mode := range modes {
 		settings := a.config.Modes[mode]
@@ -477,7 +1319,7 @@ func (a *application) cmdInstallPrereq(repo scm.ReadOnlyRepo, modes []checks.Mod
 	var wg sync.WaitGroup
 	enabledChecks, _ := a.config.EnabledChecks(modes)
 	number := 0
-	c := make(chan string, len(enabledChecks))
+	c := make(chan checks.CheckPrerequisite, len(enabledChecks))
 	for _, check := range enabledChecks {
 		for _, p := range check.GetPrerequisites() {
 			number++
@@ -485,58 +1327,108 @@ func (a *application) cmdInstallPrereq(repo scm.ReadOnlyRepo, modes []checks.Mod
 			go func(prereq checks.CheckPrerequisite) {
 				defer wg.Done()
 				if !prereq.IsPresent() {
-					c <- prereq.URL
+					c <- prereq
 				}
 			}(p)
 		}
 	}
 	wg.Wait()
 	log.Printf("Checked for %d prerequisites", number)
+	var missing []checks.CheckPrerequisite
 	loop := true
-	// Use a map to remove duplicates.
-	m := map[string]bool{}
 	for loop {
 		select {
-		case url := <-c:
-			m[url] = true
+		case prereq := <-c:
+			missing = append(missing, prereq)
 		default:
 			loop = false
 		}
 	}
-	urls := make([]string, 0, len(m))
-	for url := range m {
-		urls = append(urls, url)
-	}
+	urls, cmds := installCommands(missing)
 	wd, err := os.Getwd()
 	if err != nil {
 		return err
 	}
-	sort.Strings(urls)
-	if len(urls) != 0 {
+	if len(urls) != 0 || len(cmds) != 0 {
 		if noUpdate {
 			out := "-n is specified but prerequites are missing:\n"
 			for _, url := range urls {
 				out += "  " + url + "\n"
 			}
-			return errors.New(out)
+			for _, cmd := range cmds {
+				out += "  " + strings.Join(cmd, " ") + "\n"
+			}
+			return &exitCodeError{exitPrereq, errors.New(out)}
 		}
 		fmt.Printf("Installing:\n")
 		for _, url := range urls {
 			fmt.Printf("  %s\n", url)
 		}
+		for _, cmd := range cmds {
+			fmt.Printf("  %s\n", strings.Join(cmd, " "))
+		}
 
-		out, _, err := internal.Capture(wd, nil, append([]string{"go", "get"}, urls...)...)
-		if len(out) != 0 {
-			return fmt.Errorf("prerequisites installation failed: %s", out)
+		if len(urls) != 0 {
+			out, _, err := internal.Capture(wd, nil, append([]string{"go", "get"}, urls...)...)
+			if err == internal.ErrTimeout {
+				return &exitCodeError{exitTimeout, fmt.Errorf("prerequisites installation failed: deadline of %s exceeded", a.deadline)}
+			}
+			if len(out) != 0 {
+				return &exitCodeError{exitPrereq, fmt.Errorf("prerequisites installation failed: %s", out)}
+			}
+			if err != nil {
+				return &exitCodeError{exitPrereq, fmt.Errorf("prerequisites installation failed: %s", err)}
+			}
 		}
-		if err != nil {
-			return fmt.Errorf("prerequisites installation failed: %s", err)
+		for _, cmd := range cmds {
+			// Unlike go get, these tools are commonly verbose on success so only the
+			// exit code is used.
+			out, exitCode, err := internal.Capture(wd, nil, cmd...)
+			if err == internal.ErrTimeout {
+				return &exitCodeError{exitTimeout, fmt.Errorf("prerequisites installation failed: deadline of %s exceeded", a.deadline)}
+			}
+			if err != nil {
+				return &exitCodeError{exitPrereq, fmt.Errorf("prerequisites installation failed: %s: %s", strings.Join(cmd, " "), err)}
+			}
+			if exitCode != 0 {
+				return &exitCodeError{exitPrereq, fmt.Errorf("prerequisites installation failed: %s exited with %d:\n%s", strings.Join(cmd, " "), exitCode, out)}
+			}
 		}
 	}
 	log.Printf("Prerequisites installation succeeded")
 	return nil
 }
 
+// installCommands returns the sorted unique packages to install with go get
+// and the sorted unique install commands of the prerequisites prereqs.
+func installCommands(prereqs []checks.CheckPrerequisite) ([]string, [][]string) {
+	// Use maps to remove duplicates.
+	urls := map[string]bool{}
+	cmds := map[string][]string{}
+	for _, p := range prereqs {
+		if len(p.InstallCommand) != 0 {
+			cmds[strings.Join(p.InstallCommand, " ")] = p.InstallCommand
+		} else {
+			urls[p.URL] = true
+		}
+	}
+	outURLs := make([]string, 0, len(urls))
+	for url := range urls {
+		outURLs = append(outURLs, url)
+	}
+	sort.Strings(outURLs)
+	keys := make([]string, 0, len(cmds))
+	for k := range cmds {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	outCmds := make([][]string, 0, len(cmds))
+	for _, k := range keys {
+		outCmds = append(outCmds, cmds[k])
+	}
+	return outURLs, outCmds
+}
+
 // cmdInstall first calls cmdInstallPrereq() then install the
 // .git/hooks/pre-commit and pre-push hooks.
 //
@@ -580,22 +1472,64 @@ func (a *application) cmdInstall(repo scm.ReadOnlyRepo, modes []checks.Mode, noU
 func (a *application) cmdRun(repo scm.ReadOnlyRepo, modes []checks.Mode, against string, prereqReady *sync.WaitGroup) error {
 	var err error
 	var old scm.Commit
+	if against == "" && len(a.packages) != 0 {
+		// Specifying packages implies all the files in these packages.
+		against = string(scm.Initial)
+	}
 	if against != "" {
 		if old = repo.Eval(against); old == scm.Invalid {
-			return errors.New("invalid commit 'against'")
+			return usageErrorf("invalid commit 'against'")
 		}
+	} else if len(a.config.FilesCommand) != 0 {
+		old = scm.Initial
 	} else {
 		if old = repo.Eval(string(scm.Upstream)); old == scm.Invalid {
 			return errors.New("no upstream")
 		}
 	}
+	if err := a.warnUntracked(repo); err != nil {
+		return err
+	}
 	change, err := repo.Between(scm.Current, old, a.config.IgnorePatterns)
 	if err != nil {
 		return err
 	}
+	if against == "" && len(a.config.FilesCommand) != 0 {
+		files, err := runFilesCommand(repo.Root(), a.config.FilesCommand)
+		if err != nil {
+			return err
+		}
+		var missing []string
+		change, missing = scm.WithFiles(change, files)
+		if len(missing) != 0 {
+			fmt.Fprintf(a.out, "warning: files_command listed files that don't exist in the repository:\n  %s\n", strings.Join(missing, "\n  "))
+		}
+	}
+	if change, err = scm.Restrict(change, a.packages); err != nil {
+		return &exitCodeError{exitUsage, err}
+	}
 	return a.runChecks(change, modes, prereqReady)
 }
 
+// runFilesCommand runs the files_command from root and returns the files it
+// listed, one per line.
+func runFilesCommand(root string, command []string) ([]string, error) {
+	out, exitCode, err := internal.Capture(root, nil, command...)
+	if err != nil {
+		return nil, fmt.Errorf("files_command %q failed: %s", strings.Join(command, " "), err)
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("files_command %q failed with code %d:\n%s", strings.Join(command, " "), exitCode, out)
+	}
+	var files []string
+	for _, l := range strings.Split(out, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			files = append(files, l)
+		}
+	}
+	return files, nil
+}
+
 // cmdRunHook runs the checks in a git repository.
 //
 // Use a precise "stash, run checks, unstash" to ensure that the check is
@@ -634,13 +1568,318 @@ func (a *application) cmdRunHook(repo scm.Repo, mode string, noUpdate bool) erro
 		return err
 
 	default:
-		return errors.New("unsupported hook type for run-hook")
+		return usageErrorf("unsupported hook type for run-hook")
 	}
 }
 
-func (a *application) cmdWriteConfig(repo scm.ReadOnlyRepo, configPath string) error {
-	a.config.MinVersion = version
-	content, err := yaml.Marshal(a.config)
+// cmdUpdateCoverage runs the coverage checks of modes on all the files and
+// raises the coverage bands whose max_coverage is exceeded. The configuration
+// file is edited in place so its comments are kept.
+func (a *application) cmdUpdateCoverage(repo scm.Repo, modes []checks.Mode, configPath string) error {
+	if configPath == "<N/A>" {
+		return errors.New("no configuration file to update; run writeconfig first")
+	}
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	var raw struct {
+		Modes map[checks.Mode]interface{} `yaml:"modes"`
+	}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return err
+	}
+	change, err := repo.Between(scm.Current, scm.Initial, a.config.IgnorePatterns)
+	if err != nil {
+		return err
+	}
+	if change == nil {
+		log.Printf("no change")
+		return nil
+	}
+	changes, err := a.splitModules(change)
+	if err != nil {
+		return err
+	}
+	updated := 0
+	for _, mode := range modes {
+		if _, ok := raw.Modes[mode]; !ok {
+			// The mode uses the default settings, there's nothing to update.
+			continue
+		}
+		_, options := a.config.EnabledChecks([]checks.Mode{mode})
+		for i, check := range a.config.Modes[mode].Checks["coverage"] {
+			c := check.(*checks.Coverage)
+			var bands []checks.CoverageBand
+			baseline := checks.CoverageBaseline{}
+			for _, ch := range changes {
+				b, current, err := c.ExceededBands(ch, options)
+				if err != nil {
+					return err
+				}
+				bands = mergeBands(bands, b)
+				for dir, percent := range current {
+					if old, ok := baseline[dir]; !ok || percent < old {
+						baseline[dir] = percent
+					}
+				}
+			}
+			if c.BaselineRef != "" {
+				data, err := baseline.Marshal()
+				if err != nil {
+					return err
+				}
+				if err := repo.SetNote(c.BaselineRef, string(data)); err == nil {
+					fmt.Printf("%s: %s: updated the coverage of %d packages\n", mode, c.BaselineRef, len(baseline))
+				} else if c.BaselineFile == "" {
+					return err
+				} else {
+					// The file is the fallback when the git notes are unavailable.
+					log.Printf("coverage: %s; only updating %s", err, c.BaselineFile)
+				}
+			}
+			if c.BaselineFile != "" {
+				if err := baseline.Save(filepath.Join(repo.Root(), c.BaselineFile)); err != nil {
+					return err
+				}
+				fmt.Printf("%s: %s: updated the coverage of %d packages\n", mode, c.BaselineFile, len(baseline))
+			}
+			path := []string{"modes", string(mode), "checks", "coverage", fmt.Sprintf("[%d]", i)}
+			if content, err = updateCoverageYAML(content, path, c, bands); err != nil {
+				return fmt.Errorf("%s: %s", configPath, err)
+			}
+			for _, b := range bands {
+				name := b.Dir
+				if name == "" {
+					name = "global"
+				}
+				fmt.Printf("%s: %s: coverage %.1f%%; band %g-%g -> %g-%g\n", mode, name, b.Percent, b.Old.MinCoverage, b.Old.MaxCoverage, b.New.MinCoverage, b.New.MaxCoverage)
+			}
+			updated += len(bands)
+		}
+	}
+	if updated == 0 {
+		fmt.Printf("coverage bands are up to date\n")
+		return nil
+	}
+	return ioutil.WriteFile(configPath, content, 0666)
+}
+
+// mergeBands adds the bands b to bands. When a directory is in both, the band
+// with the lowest coverage is kept, so the coverage of every module is in it.
+func mergeBands(bands, b []checks.CoverageBand) []checks.CoverageBand {
+	for _, band := range b {
+		found := false
+		for i := range bands {
+			if bands[i].Dir == band.Dir {
+				found = true
+				if band.Percent < bands[i].Percent {
+					bands[i] = band
+				}
+			}
+		}
+		if !found {
+			bands = append(bands, band)
+		}
+	}
+	return bands
+}
+
+// updateCoverageYAML sets the new values of bands in the coverage check at
+// path in the YAML document content.
+//
+// The band of a package using per_dir_default is added to per_dir, since
+// raising the default would affect the other packages.
+func updateCoverageYAML(content []byte, path []string, c *checks.Coverage, bands []checks.CoverageBand) ([]byte, error) {
+	set := func(p []string, value string) error {
+		var err error
+		content, err = internal.SetYAML(content, append(append([]string{}, path...), p...), value)
+		return err
+	}
+	// New per_dir entries, as YAML flow mappings keyed by directory.
+	var added, values []string
+	for _, b := range bands {
+		min := strconv.FormatFloat(b.New.MinCoverage, 'f', -1, 64)
+		max := strconv.FormatFloat(b.New.MaxCoverage, 'f', -1, 64)
+		prefix := []string{"global"}
+		if b.Dir != "" {
+			if _, ok := c.PerDir[b.Dir]; !ok {
+				added = append(added, b.Dir)
+				values = append(values, fmt.Sprintf("{min_coverage: %s, max_coverage: %s}", min, max))
+				continue
+			}
+			prefix = []string{"per_dir", b.Dir}
+		}
+		if err := set(append(prefix, "min_coverage"), min); err != nil {
+			return nil, err
+		}
+		if err := set(append(prefix, "max_coverage"), max); err != nil {
+			return nil, err
+		}
+	}
+	if len(added) == 0 {
+		return content, nil
+	}
+	if len(c.PerDir) == 0 {
+		// per_dir is missing or empty, so it is likely written as "{}".
+		var items []string
+		for i, dir := range added {
+			items = append(items, strconv.Quote(dir)+": "+values[i])
+		}
+		return content, set([]string{"per_dir"}, "{"+strings.Join(items, ", ")+"}")
+	}
+	for i, dir := range added {
+		if err := set([]string{"per_dir", dir}, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// cmdWhy prints whether the file p is checked and why, then the checks
+// processing it in each mode.
+//
+// p is relative to cwd unless absolute. The file is excluded when it is
+// ignored by git, untracked, matches ignore_patterns or is outside of every
+// module.
+func (a *application) cmdWhy(repo scm.ReadOnlyRepo, modes []checks.Mode, cwd, p string) error {
+	rel, err := repoPath(repo.Root(), cwd, p)
+	if err != nil {
+		return &exitCodeError{exitUsage, err}
+	}
+	excluded, err := a.whyExcluded(repo, rel)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "File: %s\n", rel)
+	if excluded != "" {
+		fmt.Fprintf(a.out, "Included: no, %s\n", excluded)
+		return nil
+	}
+	fmt.Fprintf(a.out, "Included: yes\n")
+	if len(a.config.Modules) != 0 {
+		dirs := []string(a.config.Modules)
+		if a.config.Modules.IsAuto() {
+			if dirs, err = scm.FindModules(repo.Root(), a.config.IgnorePatterns); err != nil {
+				return err
+			}
+		}
+		module, inModule := moduleOf(dirs, rel)
+		if module == "" {
+			fmt.Fprintf(a.out, "Module: none, it is outside of every module so it is not checked\n")
+			return nil
+		}
+		fmt.Fprintf(a.out, "Module: %s\n", module)
+		// The checks see the paths relative to the module.
+		rel = inModule
+	}
+	if len(modes) == 0 {
+		modes = a.allModes()
+	}
+	for _, mode := range modes {
+		enabled, _ := a.config.EnabledChecks([]checks.Mode{mode})
+		fmt.Fprintf(a.out, "\n%s:\n", mode)
+		if len(enabled) == 0 {
+			fmt.Fprintf(a.out, "  no check\n")
+		}
+		for _, check := range enabled {
+			if reasons := checks.ExplainFile(check, rel); len(reasons) != 0 {
+				fmt.Fprintf(a.out, "  %s: %s\n", check.GetName(), strings.Join(reasons, "; "))
+			} else {
+				fmt.Fprintf(a.out, "  %s\n", check.GetName())
+			}
+		}
+	}
+	return nil
+}
+
+// whyExcluded returns why the file rel, relative to the repository root, is
+// not checked at all, or "" if it is.
+func (a *application) whyExcluded(repo scm.ReadOnlyRepo, rel string) (string, error) {
+	rule, err := repo.IgnoredBy(rel)
+	if err != nil {
+		return "", err
+	}
+	if rule != "" {
+		return fmt.Sprintf("ignored by git as per %s", rule), nil
+	}
+	untracked, err := repo.Untracked(nil)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range untracked {
+		if f == rel {
+			return "it is untracked, git add it to check it", nil
+		}
+	}
+	if _, err := os.Stat(filepath.Join(repo.Root(), rel)); err != nil {
+		return "", fmt.Errorf("%s doesn't exist", rel)
+	}
+	ignorePatterns := scm.IgnorePatterns(a.config.IgnorePatterns)
+	if pattern := ignorePatterns.Matching(rel); pattern != "" {
+		return fmt.Sprintf("ignored by the ignore_patterns entry %q", pattern), nil
+	}
+	return "", nil
+}
+
+// repoPath returns the path p, relative to cwd unless absolute, relative to
+// the repository root, with '/' as separator.
+func repoPath(root, cwd, p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(cwd, p)
+	}
+	// The root is reported by git with the symlinks resolved.
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(p)); err == nil {
+		p = filepath.Join(dir, filepath.Base(p))
+	}
+	if r, err := filepath.EvalSymlinks(root); err == nil {
+		root = r
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the repository %s", p, root)
+	}
+	if rel == "." {
+		return "", fmt.Errorf("%s is the root of the repository, not a file", p)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// moduleOf returns the innermost module of dirs containing the file rel, and
+// the path of rel relative to it. Returns "" if no module contains it.
+func moduleOf(dirs []string, rel string) (string, string) {
+	best := ""
+	for _, d := range dirs {
+		d = path.Clean(filepath.ToSlash(d))
+		if (d == "." || strings.HasPrefix(rel, d+"/")) && (best == "" || best == "." || len(d) > len(best)) {
+			best = d
+		}
+	}
+	if best == "" || best == "." {
+		return best, rel
+	}
+	return best, rel[len(best)+1:]
+}
+
+// cmdWriteConfig writes the current configuration. If modes is not empty,
+// only these modes are written.
+//
+// With minimal, only the check names are written with empty options. With
+// full, every field is written with its documentation as a comment and the
+// checks not used are listed commented out.
+func (a *application) cmdWriteConfig(repo scm.ReadOnlyRepo, configPath string, modes []checks.Mode, minimal, full bool) error {
+	config := selectModes(a.config, modes)
+	config.MinVersion = version
+	var content []byte
+	var err error
+	switch {
+	case minimal:
+		content, err = minimalConfig(config)
+	case full:
+		content, err = fullConfig(config)
+	default:
+		content, err = yaml.Marshal(config)
+	}
 	if err != nil {
 		return fmt.Errorf("internal error when marshaling config: %s", err)
 	}
@@ -648,9 +1887,126 @@ func (a *application) cmdWriteConfig(repo scm.ReadOnlyRepo, configPath string) e
 	return ioutil.WriteFile(configPath, append([]byte(yamlHeader), content...), 0666)
 }
 
+// cmdConfig prints the effective configuration, once the personal settings
+// and the defaults are applied, in the format of pre-commit-go.yml.
+func (a *application) cmdConfig(modes []checks.Mode) error {
+	content, err := yaml.Marshal(selectModes(a.config, modes))
+	if err != nil {
+		return fmt.Errorf("internal error when marshaling config: %s", err)
+	}
+	fmt.Printf("%s%s", yamlHeader, content)
+	return nil
+}
+
+// selectModes returns a copy of config with only modes, or all of them if
+// modes is empty.
+func selectModes(config *checks.Config, modes []checks.Mode) *checks.Config {
+	out := *config
+	if len(modes) != 0 {
+		out.Modes = map[checks.Mode]checks.Settings{}
+		for _, m := range modes {
+			if s, ok := config.Modes[m]; ok {
+				out.Modes[m] = s
+			}
+		}
+	}
+	return &out
+}
+
+// minimalConfig returns the serialized config with only the names of the
+// checks of each mode, with their default options.
+func minimalConfig(config *checks.Config) ([]byte, error) {
+	var modeNames []string
+	for m := range config.Modes {
+		modeNames = append(modeNames, string(m))
+	}
+	sort.Strings(modeNames)
+	modes := yaml.MapSlice{}
+	for _, m := range modeNames {
+		var names []string
+		for name := range config.Modes[checks.Mode(m)].Checks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		items := yaml.MapSlice{}
+		for _, name := range names {
+			items = append(items, yaml.MapItem{Key: name, Value: []map[string]string{{}}})
+		}
+		modes = append(modes, yaml.MapItem{Key: m, Value: yaml.MapSlice{{Key: "checks", Value: items}}})
+	}
+	return yaml.Marshal(yaml.MapSlice{
+		{Key: "min_version", Value: config.MinVersion},
+		{Key: "modes", Value: modes},
+	})
+}
+
+// fullConfig returns the serialized config with all the fields documented,
+// followed by the other known checks commented out.
+func fullConfig(config *checks.Config) ([]byte, error) {
+	content, err := checks.MarshalDocumented(config)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, s := range config.Modes {
+		for name := range s.Checks {
+			used[name] = true
+		}
+	}
+	var names []string
+	for name := range checks.KnownChecks {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return content, nil
+	}
+	b := bytes.NewBuffer(content)
+	b.WriteString("\n# Other available checks, to add to the checks of a mode:\n")
+	for _, name := range names {
+		c, err := checks.MarshalDocumentedCheck(checks.KnownChecks[name]())
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString("#\n")
+		for _, line := range strings.Split(strings.TrimRight(string(c), "\n"), "\n") {
+			fmt.Fprintf(b, "#   %s\n", line)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// exitCodeError is an error that causes pcg to exit with a specific code.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+// usageErrorf returns an error for invalid command line arguments.
+func usageErrorf(format string, a ...interface{}) error {
+	return &exitCodeError{exitUsage, fmt.Errorf(format, a...)}
+}
+
+// exitCode returns the process exit code to use for err.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*exitCodeError); ok {
+		return e.code
+	}
+	return exitError
+}
+
 // mainImpl implements pcg.
-func mainImpl() error {
-	a := application{}
+func mainImpl() (err error) {
+	a := application{out: os.Stdout, in: os.Stdin, errOut: os.Stderr, cleanups: newCleanupStack(os.Exit)}
 
 	exec, args := os.Args[0], os.Args[1:]
 	var commands, flags []string
@@ -678,24 +2034,97 @@ func mainImpl() error {
 	configPathFlag := fs.String("c", "pre-commit-go.yml", "file name of the config to load")
 	modeFlag := fs.String("m", "", "comma separated list of modes to process; default depends on the command")
 	fs.IntVar(&a.maxConcurrent, "C", 0, "maximum number of concurrent processes")
+	fs.IntVar(&a.slowest, "slowest", 0, "prints the N slowest checks and tests after running the checks")
+	fs.DurationVar(&a.deadline, "deadline", 0, "maximum wall clock duration of the whole run, e.g. 10m; the processes still running are killed once exceeded")
+	minimalFlag := fs.Bool("minimal", false, "writeconfig: only writes the check names of each mode, with their default options")
+	fullFlag := fs.Bool("full", false, "writeconfig: writes every option documented, and the checks not used commented out")
+	presetFlag := fs.String("preset", "", "writeconfig: writes a curated configuration instead of the current one; one of "+strings.Join(checks.AllPresets, ", "))
+	fastFlag := fs.Duration("fast", 2*time.Second, "advise: maximum duration of a check suggested for pre-commit")
+	slowFlag := fs.Duration("slow", 30*time.Second, "advise: maximum duration of a check suggested for pre-push; the slower ones are suggested for continuous-integration")
+	fs.StringVar(&a.format, "format", "text", "format of the issues: text, or github to emit GitHub Actions annotations shown inline in the pull request")
+	fs.StringVar(&a.groupBy, "group-by", "check", "grouping of the issues in the text format: check, or file to list the issues of all the checks under each file")
+	fs.BoolVar(&a.noDedup, "no-dedup", false, "prints every issue, even the ones reported multiple times at the same line with the same message")
+	fs.Var(&a.packages, "pkg", "only runs the checks on this package, e.g. ./cmd/..., use multiple times; implies -a unless -r is used")
+	cpuProfileFlag := fs.String("cpuprofile", "", "writes the CPU profile of pcg itself to this file")
+	memProfileFlag := fs.String("memprofile", "", "writes the memory profile of pcg itself to this file when it exits")
+	traceFlag := fs.String("trace", "", "writes the execution trace of pcg itself to this file")
+	outFlag := fs.String("out", "", "run: also writes the report to this file, without the terminal escape sequences")
+	messagesFlag := fs.String("messages", "", "YAML file overriding the status and summary messages printed, per key; see checks.Messages")
+	worktreeFlag := fs.Bool("worktree", false, "run: runs the checks in a temporary git worktree of the staging area, so they have no side effect on the checkout")
 	fs.Parse(flags)
 
 	if *allFlag {
 		if *againstFlag != "" {
-			return errors.New("-a can't be used with -r")
+			return usageErrorf("-a can't be used with -r")
 		}
 		*againstFlag = string(scm.Initial)
 	}
 
+	if a.deadline > 0 {
+		a.deadlineAt = time.Now().Add(a.deadline)
+		internal.SetDeadline(a.deadlineAt)
+		a.exitOnDeadline(deadlineGrace)
+	}
+
 	log.SetFlags(log.Lmicroseconds)
 	if !*verboseFlag {
 		log.SetOutput(ioutil.Discard)
 	}
 
-	modes, err := processModes(*modeFlag)
+	if *messagesFlag != "" {
+		content, err := ioutil.ReadFile(*messagesFlag)
+		if err != nil {
+			return err
+		}
+		if err := checks.LoadMessages(content); err != nil {
+			return &exitCodeError{exitUsage, fmt.Errorf("-messages %s: %s", *messagesFlag, err)}
+		}
+	}
+	if a.format != "text" && a.format != "github" {
+		return usageErrorf("unknown -format %q; expected text or github", a.format)
+	}
+	if a.groupBy != "check" && a.groupBy != "file" {
+		return usageErrorf("unknown -group-by %q; expected check or file", a.groupBy)
+	}
+	if *worktreeFlag {
+		switch commands[0] {
+		case "installrun", "run", "r", "run-hook":
+		default:
+			return usageErrorf("-worktree can't be used with %s", commands[0])
+		}
+	}
+	if *outFlag != "" {
+		switch commands[0] {
+		case "installrun", "run", "r":
+		default:
+			return usageErrorf("-out can't be used with %s", commands[0])
+		}
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			return err
+		}
+		report := &stripEscapes{w: f}
+		a.out = io.MultiWriter(os.Stdout, report)
+		defer func() {
+			// The final error is printed by main(), include it in the file.
+			if err != nil {
+				fmt.Fprintf(report, "pcg: %s\n", err)
+			}
+			if err2 := f.Close(); err == nil {
+				err = err2
+			}
+		}()
+	}
+
+	stopProfiling, err := startProfiling(*cpuProfileFlag, *memProfileFlag, *traceFlag)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err := stopProfiling(); err != nil {
+			fmt.Fprintf(os.Stderr, "pcg: %s\n", err)
+		}
+	}()
 
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -706,59 +2135,190 @@ func mainImpl() error {
 		return err
 	}
 
-	var configPath string
-	configPath, a.config = loadConfig(repo, *configPathFlag)
+	configPath, config, err := loadConfig(repo, *configPathFlag)
+	if err != nil {
+		if commands[0] != "migrate" {
+			return err
+		}
+		// Fixing the file is the point of migrate.
+		log.Printf("%s", err)
+		configPath, config = "<N/A>", checks.New(version)
+	}
+	a.config = config
 	log.Printf("config: %s", configPath)
+	switch commands[0] {
+	case "migrate", "update-coverage", "writeconfig", "w":
+		// These rewrite the shared config, the personal settings must not leak
+		// into it.
+	default:
+		local := configPath
+		if local == "<N/A>" {
+			if local = *configPathFlag; !filepath.IsAbs(local) {
+				local = filepath.Join(repo.Root(), local)
+			}
+		}
+		if err := loadLocalConfig(localConfigPath(local), a.config); err != nil {
+			return err
+		}
+	}
 	if a.maxConcurrent > 0 {
 		log.Printf("using %d maximum concurrent goroutines", a.maxConcurrent)
 		a.config.MaxConcurrent = a.maxConcurrent
 	}
+	a.config.RecordTests = a.slowest > 0
+	if err := setGoCaches(repo.Root(), a.config); err != nil {
+		return err
+	}
+
+	modes, err := processModes(*modeFlag, a.config)
+	if err != nil {
+		return &exitCodeError{exitUsage, err}
+	}
+
+	if cmd := commands[0]; cmd != "writeconfig" && cmd != "w" {
+		if *minimalFlag {
+			return usageErrorf("-minimal can't be used with %s", cmd)
+		}
+		if *fullFlag {
+			return usageErrorf("-full can't be used with %s", cmd)
+		}
+		if *presetFlag != "" {
+			return usageErrorf("-preset can't be used with %s", cmd)
+		}
+	}
+	if cmd := commands[0]; cmd != "advise" {
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "fast" || f.Name == "slow" {
+				err = usageErrorf("-%s can't be used with %s", f.Name, cmd)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
 
 	switch cmd := commands[0]; cmd {
+	case "advise":
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		if len(modes) == 0 {
+			modes = adviceModes
+		}
+		return a.cmdAdvise(repo, modes, *fastFlag, *slowFlag)
+
+	case "config":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		return a.cmdConfig(modes)
+
 	case "help", "-help", "-h":
 		cmd = "help"
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 		if *noUpdateFlag != false {
-			return fmt.Errorf("-n can't be used with %s", cmd)
+			return usageErrorf("-n can't be used with %s", cmd)
 		}
 		if *configPathFlag != "pre-commit-go.yml" {
-			return fmt.Errorf("-m can't be used with %s", cmd)
+			return usageErrorf("-m can't be used with %s", cmd)
 		}
 		if *modeFlag != "" {
-			return fmt.Errorf("-m can't be used with %s", cmd)
+			return usageErrorf("-m can't be used with %s", cmd)
 		}
 		b := &bytes.Buffer{}
 		fs.SetOutput(b)
 		fs.PrintDefaults()
 		return a.cmdHelp(repo, b.String())
 
+	case "help-check":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		if modes != nil {
+			return usageErrorf("-m can't be used with %s", cmd)
+		}
+		if len(commands) > 2 {
+			return usageErrorf("%s accepts at most one check", cmd)
+		}
+		name := ""
+		if len(commands) == 2 {
+			name = commands[1]
+		}
+		return a.cmdHelpCheck(name)
+
 	case "info":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 		if *noUpdateFlag != false {
-			return fmt.Errorf("-n can't be used with %s", cmd)
+			return usageErrorf("-n can't be used with %s", cmd)
 		}
 		return a.cmdInfo(repo, modes, configPath)
 
 	case "install", "i":
 		cmd = "install"
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 		if len(modes) == 0 {
-			modes = checks.AllModes
+			modes = a.allModes()
 		}
 		var prereqReady sync.WaitGroup
 		prereqReady.Add(1)
@@ -776,7 +2336,9 @@ func mainImpl() error {
 		go func() {
 			errCh <- a.cmdInstall(repo, modes, *noUpdateFlag, &prereqReady)
 		}()
-		err := a.cmdRun(repo, modes, *againstFlag, &prereqReady)
+		err := a.inRepo(repo, *worktreeFlag, func(repo scm.Repo) error {
+			return a.cmdRun(repo, modes, *againstFlag, &prereqReady)
+		})
 		if err2 := <-errCh; err2 != nil {
 			return err2
 		}
@@ -784,80 +2346,196 @@ func mainImpl() error {
 
 	case "prereq", "p":
 		cmd = "prereq"
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 		if len(modes) == 0 {
-			modes = checks.AllModes
+			modes = a.allModes()
 		}
 		return a.cmdInstallPrereq(repo, modes, *noUpdateFlag)
 
 	case "run", "r":
 		cmd = "run"
 		if *noUpdateFlag != false {
-			return fmt.Errorf("-n can't be used with %s", cmd)
+			return usageErrorf("-n can't be used with %s", cmd)
 		}
 		if len(modes) == 0 {
 			modes = []checks.Mode{checks.PrePush}
 		}
-		return a.cmdRun(repo, modes, *againstFlag, &sync.WaitGroup{})
+		return a.inRepo(repo, *worktreeFlag, func(repo scm.Repo) error {
+			return a.cmdRun(repo, modes, *againstFlag, &sync.WaitGroup{})
+		})
 
 	case "run-hook":
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if modes != nil {
-			return fmt.Errorf("-m can't be used with %s", cmd)
+			return usageErrorf("-m can't be used with %s", cmd)
 		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 
 		if len(commands) < 2 {
-			return errors.New("run-hook is only meant to be used by hooks")
+			return usageErrorf("run-hook is only meant to be used by hooks")
+		}
+		return a.inRepo(repo, *worktreeFlag, func(repo scm.Repo) error {
+			return a.cmdRunHook(repo, commands[1], *noUpdateFlag)
+		})
+
+	case "migrate":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		if modes != nil {
+			return usageErrorf("-m can't be used with %s", cmd)
+		}
+		return a.cmdMigrate(repo, configPath, *configPathFlag)
+
+	case "schema":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if modes != nil {
+			return usageErrorf("-m can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		schema, err := checks.Schema()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", schema)
+		return nil
+
+	case "update-coverage":
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
-		return a.cmdRunHook(repo, commands[1], *noUpdateFlag)
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		if len(modes) == 0 {
+			modes = a.allModes()
+		}
+		return a.cmdUpdateCoverage(repo, modes, configPath)
 
 	case "version":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
 		if modes != nil {
-			return fmt.Errorf("-m can't be used with %s", cmd)
+			return usageErrorf("-m can't be used with %s", cmd)
 		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
 		}
 		if *noUpdateFlag != false {
-			return fmt.Errorf("-n can't be used with %s", cmd)
+			return usageErrorf("-n can't be used with %s", cmd)
 		}
 		fmt.Println(version)
 		return nil
 
+	case "why":
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *allFlag != false {
+			return usageErrorf("-a can't be used with %s", cmd)
+		}
+		if *againstFlag != "" {
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *noUpdateFlag != false {
+			return usageErrorf("-n can't be used with %s", cmd)
+		}
+		if len(commands) != 2 {
+			return usageErrorf("%s requires exactly one file", cmd)
+		}
+		return a.cmdWhy(repo, modes, cwd, commands[1])
+
 	case "writeconfig", "w":
-		if modes != nil {
-			return fmt.Errorf("-m can't be used with %s", cmd)
+		cmd = "writeconfig"
+		if a.deadline != 0 {
+			return usageErrorf("-deadline can't be used with %s", cmd)
+		}
+		if len(a.packages) != 0 {
+			return usageErrorf("-pkg can't be used with %s", cmd)
+		}
+		if *minimalFlag && *fullFlag {
+			return usageErrorf("-minimal can't be used with -full")
 		}
 		if *allFlag != false {
-			return fmt.Errorf("-a can't be used with %s", cmd)
+			return usageErrorf("-a can't be used with %s", cmd)
 		}
 		if *againstFlag != "" {
-			return fmt.Errorf("-r can't be used with %s", cmd)
+			return usageErrorf("-r can't be used with %s", cmd)
+		}
+		if *presetFlag != "" {
+			config, err := checks.NewPreset(version, *presetFlag)
+			if err != nil {
+				return &exitCodeError{exitUsage, err}
+			}
+			a.config = config
 		}
 		// Note that in that case, configPath is ignored and not overritten.
-		return a.cmdWriteConfig(repo, *configPathFlag)
+		return a.cmdWriteConfig(repo, *configPathFlag, modes, *minimalFlag, *fullFlag)
 
 	default:
-		return fmt.Errorf("unknown command %q, try 'help'", cmd)
+		return usageErrorf("unknown command %q, try 'help'", cmd)
 	}
 }
 
 func main() {
 	if err := mainImpl(); err != nil {
 		fmt.Fprintf(os.Stderr, "pcg: %s\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
@@ -5,11 +5,20 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
 	"github.com/maruel/pre-commit-go/checks"
+	"github.com/maruel/pre-commit-go/scm"
 )
 
 func TestProcessModes(t *testing.T) {
@@ -27,10 +36,714 @@ func TestProcessModes(t *testing.T) {
 		{"ci", []checks.Mode{checks.ContinuousIntegration}, nil},
 		{"full", []checks.Mode{checks.ContinuousIntegration}, nil},
 		{"foo", nil, errors.New("invalid mode \"foo\"\n\n" + helpModes)},
+		{"nightly,pc", []checks.Mode{"nightly", checks.PreCommit}, nil},
 	}
+	config := checks.New("0.1")
+	config.Modes["nightly"] = checks.Settings{}
 	for i, line := range data {
-		actual, err := processModes(line.in)
+		actual, err := processModes(line.in, config)
 		ut.AssertEqualIndex(t, i, line.expected, actual)
 		ut.AssertEqualIndex(t, i, line.err, err)
 	}
 }
+
+func TestAdviseMode(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, checks.PreCommit, adviseMode(time.Second, 2*time.Second, 30*time.Second))
+	ut.AssertEqual(t, checks.PreCommit, adviseMode(2*time.Second, 2*time.Second, 30*time.Second))
+	ut.AssertEqual(t, checks.PrePush, adviseMode(10*time.Second, 2*time.Second, 30*time.Second))
+	ut.AssertEqual(t, checks.ContinuousIntegration, adviseMode(time.Minute, 2*time.Second, 30*time.Second))
+}
+
+func TestLocalConfigPath(t *testing.T) {
+	t.Parallel()
+	ut.AssertEqual(t, "pre-commit-go.local.yml", localConfigPath("pre-commit-go.yml"))
+	ut.AssertEqual(t, filepath.Join("a", "b.local.yaml"), localConfigPath(filepath.Join("a", "b.yaml")))
+	ut.AssertEqual(t, "config.local", localConfigPath("config"))
+}
+
+func TestExitCode(t *testing.T) {
+	ut.AssertEqual(t, 0, exitCode(nil))
+	ut.AssertEqual(t, exitError, exitCode(errors.New("foo")))
+	ut.AssertEqual(t, exitUsage, exitCode(usageErrorf("-a can't be used with %s", "help")))
+	ut.AssertEqual(t, "-a can't be used with help", usageErrorf("-a can't be used with %s", "help").Error())
+	ut.AssertEqual(t, exitChecksFailed, exitCode(&exitCodeError{exitChecksFailed, errors.New("checks failed")}))
+	ut.AssertEqual(t, exitPrereq, exitCode(&exitCodeError{exitPrereq, errors.New("prerequisites installation failed")}))
+	ut.AssertEqual(t, exitTimeout, exitCode(&exitCodeError{exitTimeout, errors.New("deadline of 1s exceeded")}))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		ut.AssertEqual(t, nil, os.RemoveAll(td))
+	}()
+	shared := filepath.Join(td, "pre-commit-go.yml")
+	local := filepath.Join(td, "pre-commit-go.local.yml")
+	ut.AssertEqual(t, nil, ioutil.WriteFile(shared, []byte("max_concurrent: [\n"), 0666))
+	ut.AssertEqual(t, nil, ioutil.WriteFile(local, []byte("fail_on: [\n"), 0666))
+
+	path, config, err := loadConfig(nil, shared)
+	ut.AssertEqual(t, shared, path)
+	ut.AssertEqual(t, (*checks.Config)(nil), config)
+	ut.AssertEqual(t, exitUsage, exitCode(err))
+	ut.AssertEqual(t, true, strings.HasPrefix(err.Error(), "failed to parse "+shared+": "))
+
+	ut.AssertEqual(t, nil, ioutil.WriteFile(shared, []byte("min_version: 999.0\n"), 0666))
+	_, _, err = loadConfig(nil, shared)
+	ut.AssertEqual(t, exitUsage, exitCode(err))
+	ut.AssertEqual(t, fmt.Sprintf("%s requires pcg version 999.0 or later, this is %s", shared, version), err.Error())
+
+	err = loadLocalConfig(local, checks.New(version))
+	ut.AssertEqual(t, exitUsage, exitCode(err))
+	ut.AssertEqual(t, true, strings.HasPrefix(err.Error(), "failed to parse "+local+": "))
+}
+
+func TestSplitBuildChecks(t *testing.T) {
+	b := &checks.Build{}
+	g := &checks.Gofmt{}
+	tst := &checks.Test{}
+	first, rest := splitBuildChecks([]checks.Check{g, tst, b})
+	ut.AssertEqual(t, []checks.Check{b}, first)
+	ut.AssertEqual(t, []checks.Check{g, tst}, rest)
+	first, rest = splitBuildChecks([]checks.Check{g, tst})
+	ut.AssertEqual(t, []checks.Check{tst}, first)
+	ut.AssertEqual(t, []checks.Check{g}, rest)
+	first, rest = splitBuildChecks([]checks.Check{g})
+	ut.AssertEqual(t, []checks.Check{g}, first)
+	ut.AssertEqual(t, []checks.Check(nil), rest)
+}
+
+func TestMinimalConfig(t *testing.T) {
+	config := &checks.Config{
+		MinVersion: "0.1",
+		Modes: map[checks.Mode]checks.Settings{
+			checks.PreCommit: {Checks: checks.Checks{"test": {&checks.Test{ExtraArgs: []string{"-short"}}}, "build": {&checks.Build{}}}},
+		},
+	}
+	content, err := minimalConfig(config)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "min_version: \"0.1\"\nmodes:\n  pre-commit:\n    checks:\n      build:\n      - {}\n      test:\n      - {}\n", string(content))
+}
+
+func TestSelectModes(t *testing.T) {
+	config := &checks.Config{
+		MinVersion: "0.1",
+		Modes: map[checks.Mode]checks.Settings{
+			checks.PreCommit: {Options: checks.Options{MaxDuration: 5}},
+			checks.PrePush:   {Options: checks.Options{MaxDuration: 60}},
+		},
+	}
+	ut.AssertEqual(t, config, selectModes(config, nil))
+	expected := &checks.Config{
+		MinVersion: "0.1",
+		Modes:      map[checks.Mode]checks.Settings{checks.PrePush: {Options: checks.Options{MaxDuration: 60}}},
+	}
+	ut.AssertEqual(t, expected, selectModes(config, []checks.Mode{checks.PrePush, checks.Lint}))
+	// The original is not modified.
+	ut.AssertEqual(t, 2, len(config.Modes))
+}
+
+func TestRunFilesCommand(t *testing.T) {
+	files, err := runFilesCommand(".", []string{"go", "list", "-f", "{{range .GoFiles}}\n  {{.}}\n\n{{end}}", "."})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, true, len(files) > 1)
+	ut.AssertEqual(t, "cleanup.go", files[0])
+	_, err = runFilesCommand(".", []string{"go", "invalid"})
+	ut.AssertEqual(t, true, strings.HasPrefix(err.Error(), "files_command \"go invalid\" failed with code 2:\ngo invalid: unknown command"))
+}
+
+func TestUpdateCoverageYAML(t *testing.T) {
+	content := []byte(`modes:
+  lint:
+    checks:
+      coverage:
+      - global:
+          min_coverage: 50 # Keep me.
+          max_coverage: 60
+        per_dir:
+          a:
+            min_coverage: 10
+            max_coverage: 20
+`)
+	c := &checks.Coverage{PerDir: map[string]*checks.CoverageSettings{"a": {MinCoverage: 10, MaxCoverage: 20}}}
+	bands := []checks.CoverageBand{
+		{Dir: "", Percent: 70.5, New: checks.CoverageSettings{MinCoverage: 70, MaxCoverage: 80}},
+		{Dir: "a", Percent: 30, New: checks.CoverageSettings{MinCoverage: 30, MaxCoverage: 40}},
+		{Dir: "b", Percent: 50, New: checks.CoverageSettings{MinCoverage: 50, MaxCoverage: 60.5}},
+	}
+	path := []string{"modes", "lint", "checks", "coverage", "[0]"}
+	out, err := updateCoverageYAML(content, path, c, bands)
+	ut.AssertEqual(t, nil, err)
+	expected := `modes:
+  lint:
+    checks:
+      coverage:
+      - global:
+          min_coverage: 70 # Keep me.
+          max_coverage: 80
+        per_dir:
+          a:
+            min_coverage: 30
+            max_coverage: 40
+          b: {min_coverage: 50, max_coverage: 60.5}
+`
+	ut.AssertEqual(t, expected, string(out))
+
+	content = []byte("modes:\n  lint:\n    checks:\n      coverage:\n      - per_dir: {}\n")
+	out, err = updateCoverageYAML(content, path, &checks.Coverage{}, bands[2:])
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "modes:\n  lint:\n    checks:\n      coverage:\n      - per_dir: {\"b\": {min_coverage: 50, max_coverage: 60.5}}\n", string(out))
+
+	// The settings shared with an anchor can't be updated in place.
+	content = []byte("modes:\n  lint:\n    checks:\n      coverage:\n      - global: &cov\n          min_coverage: 50\n        per_dir:\n          a: *cov\n")
+	_, err = updateCoverageYAML(content, path, c, bands[1:2])
+	ut.AssertEqual(t, errors.New("modes.lint.checks.coverage.[0].per_dir.a: is the alias *cov; replace it with an explicit value to edit it"), err)
+	_, err = updateCoverageYAML(content, path, c, bands[:1])
+	ut.AssertEqual(t, errors.New("modes.lint.checks.coverage.[0].global: is the anchor &cov used by aliases; replace them with explicit values to edit it"), err)
+}
+
+func TestMergeBands(t *testing.T) {
+	a := checks.CoverageBand{Dir: ".", Percent: 80}
+	b := checks.CoverageBand{Dir: ".", Percent: 70}
+	c := checks.CoverageBand{Dir: "c", Percent: 90}
+	ut.AssertEqual(t, []checks.CoverageBand{b, c}, mergeBands([]checks.CoverageBand{a}, []checks.CoverageBand{b, c}))
+	ut.AssertEqual(t, []checks.CoverageBand{b}, mergeBands([]checks.CoverageBand{b}, []checks.CoverageBand{a}))
+}
+
+func TestInstallCommands(t *testing.T) {
+	prereqs := []checks.CheckPrerequisite{
+		{URL: "github.com/b/b"},
+		{URL: "github.com/a/a"},
+		{InstallCommand: []string{"npm", "install", "-g", "foo"}, URL: "ignored"},
+		{URL: "github.com/a/a"},
+		{InstallCommand: []string{"apt-get", "install", "bar"}},
+		{InstallCommand: []string{"npm", "install", "-g", "foo"}},
+	}
+	urls, cmds := installCommands(prereqs)
+	ut.AssertEqual(t, []string{"github.com/a/a", "github.com/b/b"}, urls)
+	ut.AssertEqual(t, [][]string{{"apt-get", "install", "bar"}, {"npm", "install", "-g", "foo"}}, cmds)
+}
+
+func TestStartProfiling(t *testing.T) {
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer func() {
+		ut.ExpectEqual(t, nil, os.RemoveAll(td))
+	}()
+	stop, err := startProfiling("", "", "")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, stop())
+
+	cpu := filepath.Join(td, "cpu.prof")
+	mem := filepath.Join(td, "mem.prof")
+	trace := filepath.Join(td, "trace.out")
+	stop, err = startProfiling(cpu, mem, trace)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, stop())
+	for _, p := range []string{cpu, mem, trace} {
+		fi, err := os.Stat(p)
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, true, fi.Size() > 0)
+	}
+
+	_, err = startProfiling(filepath.Join(td, "missing", "cpu.prof"), "", "")
+	ut.AssertEqual(t, true, err != nil)
+}
+
+func TestFormatIssues(t *testing.T) {
+	issues := checks.Issues{
+		{Check: "build", Message: "go build failed: foo"},
+		{Check: "golint", File: "a.go", Line: 1, Col: 2, Message: "x"},
+		{Check: "golint", File: "b.go", Line: 3, Message: "y"},
+		{Check: "nilinterface", File: "a.go", Line: 4, Col: 1, Message: "z"},
+	}
+	expected := "go build failed: foo\ngolint failed:\na.go:1:2: x\nb.go:3: y\nnilinterface failed:\na.go:4:1: z"
+	ut.AssertEqual(t, expected, formatIssues(issues))
+	issues[1].Severity = checks.SeverityWarning
+	ut.AssertEqual(t, "golint failed:\na.go:1:2: warning: x", formatIssues(issues[1:2]))
+}
+
+func TestFormatIssuesByFile(t *testing.T) {
+	t.Parallel()
+	issues := checks.Issues{
+		{Check: "build", Message: "go build failed: foo"},
+		{Check: "golint", File: "a.go", Line: 4, Col: 2, Message: "x"},
+		{Check: "golint", File: "b.go", Line: 3, Message: "y"},
+		{Check: "nilinterface", File: "a.go", Line: 1, Col: 1, Severity: checks.SeverityWarning, Message: "z"},
+	}
+	expected := "go build failed: foo\na.go:\na.go:1:1: warning: z [nilinterface]\na.go:4:2: x [golint]\nb.go:\nb.go:3: y [golint]"
+	ut.AssertEqual(t, expected, formatIssuesByFile(issues))
+	// The issues are not modified.
+	ut.AssertEqual(t, "golint", issues[1].Check)
+	ut.AssertEqual(t, "z", issues[3].Message)
+}
+
+func TestRunChecksDeterministic(t *testing.T) {
+	t.Parallel()
+	// The checks listed first complete last.
+	config := &checks.Config{Modes: map[checks.Mode]checks.Settings{
+		checks.PreCommit: {Checks: checks.Checks{
+			"fake": {
+				&fakeCheck{delay: 40 * time.Millisecond, issues: checks.Issues{{Check: "fake", File: "a.go", Line: 2, Message: "first"}}},
+				&fakeCheck{delay: 30 * time.Millisecond, issues: checks.Issues{{Check: "fake", File: "a.go", Line: 1, Message: "second"}}},
+				&fakeCheck{delay: 20 * time.Millisecond, err: errors.New("plain")},
+				&fakeCheck{delay: 10 * time.Millisecond, issues: checks.Issues{{Check: "fake", File: "b.go", Line: 1, Severity: checks.SeverityWarning, Message: "fourth"}}},
+				&fakeCheck{},
+			},
+		}},
+	}}
+	// The checks are reported in the order of the configuration, not sorted.
+	expected := "fake failed:\na.go:2: first\na.go:1: second\nplain\nfake failed:\nb.go:1: warning: fourth\n"
+	for i := 0; i < 5; i++ {
+		b := &bytes.Buffer{}
+		a := &application{config: config, out: b}
+		err := a.runChecks(fakeChange{}, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+		ut.AssertEqualIndex(t, i, exitChecksFailed, exitCode(err))
+		ut.AssertEqualIndex(t, i, expected, b.String())
+	}
+}
+
+func TestRunChecksPanic(t *testing.T) {
+	t.Parallel()
+	config := &checks.Config{Modes: map[checks.Mode]checks.Settings{
+		checks.PreCommit: {Checks: checks.Checks{
+			"fake": {&fakeCheck{panic: "boom"}, &fakeCheck{}},
+		}},
+	}}
+	b := &bytes.Buffer{}
+	a := &application{config: config, out: b}
+	err := a.runChecks(fakeChange{}, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+	ut.AssertEqual(t, exitChecksFailed, exitCode(err))
+	ut.AssertEqual(t, true, strings.HasPrefix(b.String(), "fake panicked: boom\ngoroutine "))
+}
+
+func TestRunChecksNotices(t *testing.T) {
+	t.Parallel()
+	config := &checks.Config{Modes: map[checks.Mode]checks.Settings{
+		checks.PreCommit: {Checks: checks.Checks{"fake": {&fakeCheck{notice: "consider it"}}}},
+	}}
+	b := &bytes.Buffer{}
+	a := &application{config: config, out: b}
+	err := a.runChecks(fakeChange{}, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "consider it\n", b.String())
+}
+
+func TestRunChecksBudgetNotice(t *testing.T) {
+	t.Parallel()
+	block := make(chan struct{})
+	config := &checks.Config{Modes: map[checks.Mode]checks.Settings{
+		checks.PreCommit: {
+			Options: checks.Options{MaxDuration: 1},
+			Checks:  checks.Checks{"fake": {&fakeCheck{delay: 850 * time.Millisecond}, &fakeCheck{block: block}}},
+		},
+	}}
+	notices := make(chanWriter, 2)
+	b := &bytes.Buffer{}
+	a := &application{config: config, out: b, errOut: notices}
+	done := make(chan error)
+	go func() {
+		done <- a.runChecks(fakeChange{}, []checks.Mode{checks.PreCommit}, &sync.WaitGroup{})
+	}()
+	// The notice is printed while the second check is still running.
+	notice := <-notices
+	ut.AssertEqual(t, true, strings.HasPrefix(notice, "warning: after check fake, "))
+	ut.AssertEqual(t, true, strings.Contains(notice, " of the 1s budget is used ("))
+	ut.AssertEqual(t, 0, len(notices))
+	close(block)
+	ut.AssertEqual(t, nil, <-done)
+	// The running total is printed again as the second check completes, and
+	// not repeated in the report.
+	ut.AssertEqual(t, 1, len(notices))
+	ut.AssertEqual(t, true, strings.HasPrefix(<-notices, "warning: after check fake, "))
+	ut.AssertEqual(t, "", b.String())
+}
+
+func TestCleanupStack(t *testing.T) {
+	t.Parallel()
+	var codes []int
+	c := newCleanupStack(func(code int) {
+		codes = append(codes, code)
+	})
+	var order []string
+	push := func(name string) func() error {
+		return c.push(func() error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	doneA := push("a")
+	doneB := push("b")
+	push("c")
+	ut.AssertEqual(t, nil, doneB())
+	ut.AssertEqual(t, nil, doneB())
+	c.exitNow(exitTimeout)
+	c.exitNow(exitError)
+	ut.AssertEqual(t, []string{"b", "c", "a"}, order)
+	ut.AssertEqual(t, []int{exitTimeout}, codes)
+	// Already run on exit.
+	ut.AssertEqual(t, nil, doneA())
+	ut.AssertEqual(t, []string{"b", "c", "a"}, order)
+
+	// Without a stack, the cleanup is only run when done.
+	var nilStack *cleanupStack
+	done := nilStack.push(func() error {
+		return errors.New("cleaned")
+	})
+	ut.AssertEqual(t, errors.New("cleaned"), done())
+}
+
+func TestDeadlineRestoresStash(t *testing.T) {
+	t.Parallel()
+	block := make(chan struct{})
+	defer close(block)
+	config := &checks.Config{
+		StashUnstaged: true,
+		Modes: map[checks.Mode]checks.Settings{
+			checks.PreCommit: {Checks: checks.Checks{"fake": {&fakeCheck{block: block}}}},
+		},
+	}
+	codes := make(chan int, 1)
+	a := &application{config: config, out: &bytes.Buffer{}, deadline: 10 * time.Millisecond}
+	a.cleanups = newCleanupStack(func(code int) {
+		codes <- code
+	})
+	repo := &stashRepo{stashed: make(chan struct{}), restored: make(chan struct{}, 2)}
+	go a.runPreCommit(repo)
+	// The check hangs, the deadline is hit while the changes are stashed.
+	<-repo.stashed
+	a.exitOnDeadline(0)
+	ut.AssertEqual(t, exitTimeout, <-codes)
+	<-repo.restored
+	ut.AssertEqual(t, 0, len(repo.restored))
+}
+
+func TestDeadlineRestoresPrePush(t *testing.T) {
+	t.Parallel()
+	block := make(chan struct{})
+	defer close(block)
+	config := &checks.Config{Modes: map[checks.Mode]checks.Settings{
+		checks.PrePush: {Checks: checks.Checks{"fake": {&fakeCheck{block: block}}}},
+	}}
+	codes := make(chan int, 1)
+	to := strings.Repeat("1", 40)
+	in := strings.NewReader("refs/heads/main " + to + " refs/heads/main " + strings.Repeat("2", 40) + "\n")
+	a := &application{config: config, out: &bytes.Buffer{}, in: in, deadline: 10 * time.Millisecond}
+	a.cleanups = newCleanupStack(func(code int) {
+		codes <- code
+	})
+	repo := &prePushRepo{stashRepo{stashed: make(chan struct{}), restored: make(chan struct{}, 2)}, make(chan string, 3)}
+	go a.runPrePush(repo)
+	// The check hangs, the deadline is hit while the pushed commit is checked
+	// out and the changes are stashed.
+	<-repo.stashed
+	a.exitOnDeadline(0)
+	ut.AssertEqual(t, exitTimeout, <-codes)
+	ut.AssertEqual(t, to, <-repo.checkouts)
+	ut.AssertEqual(t, "main", <-repo.checkouts)
+	<-repo.restored
+	ut.AssertEqual(t, 0, len(repo.checkouts))
+	ut.AssertEqual(t, 0, len(repo.restored))
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	r := &report{}
+	var slots []int
+	for i := 0; i < 10; i++ {
+		slots = append(slots, r.reserve())
+	}
+	var wg sync.WaitGroup
+	for i := len(slots) - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.record(slots[i], checkResult{name: fmt.Sprintf("check%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range r.snapshot() {
+		ut.AssertEqualIndex(t, i, fmt.Sprintf("check%d", i), result.name)
+	}
+}
+
+func TestStripEscapes(t *testing.T) {
+	t.Parallel()
+	b := &bytes.Buffer{}
+	w := &stripEscapes{w: b}
+	in := "\x1b[1;31mFAIL\x1b[0m foo.go:1: bar\x1b[K\n"
+	n, err := w.Write([]byte(in))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, len(in), n)
+	ut.AssertEqual(t, "FAIL foo.go:1: bar\n", b.String())
+}
+
+func TestDedupIssues(t *testing.T) {
+	issues := checks.Issues{
+		{Check: "govet", File: "a.go", Line: 1, Severity: checks.SeverityWarning, Message: "unreachable code"},
+		{Check: "govet", File: "a.go", Line: 2, Message: "x"},
+		{Check: "govet", File: "b.go", Line: 1, Message: "y"},
+		{Check: "govet", File: "b.go", Line: 1, Message: "y"},
+		{Check: "staticcheck", File: "a.go", Line: 1, Col: 3, Severity: checks.SeverityError, Message: "Unreachable  code"},
+	}
+	expected := checks.Issues{
+		{Check: "govet", File: "a.go", Line: 1, Severity: checks.SeverityError, Message: "unreachable code (reported 2 times by govet, staticcheck)"},
+		{Check: "govet", File: "a.go", Line: 2, Message: "x"},
+		{Check: "govet", File: "b.go", Line: 1, Message: "y (reported 2 times)"},
+	}
+	ut.AssertEqual(t, expected, dedupIssues(issues))
+}
+
+func TestFormatGitHub(t *testing.T) {
+	t.Parallel()
+	issues := checks.Issues{
+		{Check: "gofmt", File: "a, b.go", Line: 2, Col: 3, Severity: checks.SeverityError, Message: "not formatted"},
+		{Check: "golint", File: "b.go", Line: 1, Severity: checks.SeverityWarning, Message: "100% bad"},
+		{Check: "test", File: "c.go", Severity: checks.SeverityInfo, Message: "slow"},
+		{Check: "build", Message: "build failed:\nfoo"},
+		{Message: "plain"},
+	}
+	expected := "::error file=a%2C b.go,line=2,col=3,title=gofmt::not formatted\n" +
+		"::warning file=b.go,line=1,title=golint::100%25 bad\n" +
+		"::notice file=c.go,title=test::slow\n" +
+		"::error title=build::build failed:%0Afoo\n" +
+		"::error::plain"
+	ut.AssertEqual(t, expected, formatGitHub(issues))
+}
+
+func TestFormatTally(t *testing.T) {
+	issues := checks.Issues{
+		{Severity: checks.SeverityError},
+		{Severity: checks.SeverityInfo},
+		{Severity: checks.SeverityWarning},
+		{},
+		{Severity: checks.SeverityInfo},
+	}
+	ut.AssertEqual(t, "2 errors, 1 warning, 2 info", formatTally(issues))
+}
+
+func TestModuleIssues(t *testing.T) {
+	issues := checks.Issues{{Check: "build", Message: "foo"}, {Check: "golint", File: "a.go", Message: "x"}}
+	expected := checks.Issues{{Check: "build", Message: "module sub: foo"}, {Check: "golint", File: "sub/a.go", Message: "x"}}
+	ut.AssertEqual(t, expected, moduleIssues("sub", issues))
+	ut.AssertEqual(t, expected, moduleIssues("", expected))
+}
+
+func TestSetGoCaches(t *testing.T) {
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(td)
+	oldCache, oldModCache := os.Getenv("GOCACHE"), os.Getenv("GOMODCACHE")
+	defer func() {
+		os.Setenv("GOCACHE", oldCache)
+		os.Setenv("GOMODCACHE", oldModCache)
+	}()
+
+	ut.AssertEqual(t, nil, os.Setenv("PCG_TEST_CACHE", td))
+	defer os.Unsetenv("PCG_TEST_CACHE")
+	config := &checks.Config{GoCache: ".cache/go-build", GoModCache: "$PCG_TEST_CACHE/mod"}
+	ut.AssertEqual(t, nil, setGoCaches(td, config))
+	ut.AssertEqual(t, filepath.Join(td, ".cache", "go-build"), os.Getenv("GOCACHE"))
+	ut.AssertEqual(t, filepath.Join(td, "mod"), os.Getenv("GOMODCACHE"))
+	_, err = os.Stat(filepath.Join(td, ".cache", "go-build"))
+	ut.AssertEqual(t, nil, err)
+
+	// A file is in the way.
+	ut.AssertEqual(t, nil, ioutil.WriteFile(filepath.Join(td, "file"), nil, 0600))
+	err = setGoCaches(td, &checks.Config{GoCache: "file"})
+	ut.AssertEqual(t, true, err != nil && strings.HasPrefix(err.Error(), "invalid GOCACHE directory: "))
+}
+
+func TestRepoPath(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(td)
+	ut.AssertEqual(t, nil, os.MkdirAll(filepath.Join(td, "a", "b"), 0700))
+	rel, err := repoPath(td, filepath.Join(td, "a"), filepath.Join("b", "c.go"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a/b/c.go", rel)
+	rel, err = repoPath(td, "/", filepath.Join(td, "a", "c.go"))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "a/c.go", rel)
+	_, err = repoPath(filepath.Join(td, "a"), td, "c.go")
+	ut.AssertEqual(t, true, err != nil && strings.HasSuffix(err.Error(), " is outside of the repository "+filepath.Join(td, "a")))
+}
+
+func TestModuleOf(t *testing.T) {
+	t.Parallel()
+	dirs := []string{".", "tools", "tools/gen"}
+	data := []struct {
+		rel, module, inModule string
+	}{
+		{"main.go", ".", "main.go"},
+		{"tools/a.go", "tools", "a.go"},
+		{"tools/gen/b/c.go", "tools/gen", "b/c.go"},
+		{"toolsx/a.go", ".", "toolsx/a.go"},
+	}
+	for i, line := range data {
+		module, inModule := moduleOf(dirs, line.rel)
+		ut.AssertEqualIndex(t, i, line.module, module)
+		ut.AssertEqualIndex(t, i, line.inModule, inModule)
+	}
+	module, _ := moduleOf([]string{"tools"}, "main.go")
+	ut.AssertEqual(t, "", module)
+}
+
+func TestCmdWhy(t *testing.T) {
+	t.Parallel()
+	td, err := ioutil.TempDir("", "pre-commit-go")
+	ut.AssertEqual(t, nil, err)
+	defer os.RemoveAll(td)
+	for _, f := range []string{"a.go", "a_test.go", "_b/b.go", "new.go", "tools/t.go"} {
+		p := filepath.Join(td, filepath.FromSlash(f))
+		ut.AssertEqual(t, nil, os.MkdirAll(filepath.Dir(p), 0700))
+		ut.AssertEqual(t, nil, ioutil.WriteFile(p, nil, 0600))
+	}
+	repo := &whyRepo{root: td, ignored: map[string]string{"out.go": ".gitignore:1:out.go"}, untracked: []string{"new.go"}}
+	config := &checks.Config{
+		IgnorePatterns: []string{"_*"},
+		Modes: map[checks.Mode]checks.Settings{
+			checks.PreCommit: {Checks: checks.Checks{
+				"gofmt": {&checks.Gofmt{}},
+				"govet": {&checks.Govet{FileFilter: checks.FileFilter{SkipTestFiles: true}}},
+			}},
+			checks.PrePush: {Checks: checks.Checks{
+				"custom": {&checks.Custom{DisplayName: "proto", Trigger: checks.Trigger{TriggerPaths: []string{"*.proto"}}}},
+			}},
+		},
+	}
+	data := []struct {
+		p        string
+		expected string
+	}{
+		{"a_test.go", "File: a_test.go\nIncluded: yes\n\npre-commit:\n  gofmt\n  govet: skipped as per skip_test_files\n\npre-push:\n  custom: not triggered by it, trigger_paths is *.proto\n"},
+		{"out.go", "File: out.go\nIncluded: no, ignored by git as per .gitignore:1:out.go\n"},
+		{"new.go", "File: new.go\nIncluded: no, it is untracked, git add it to check it\n"},
+		{"_b/b.go", "File: _b/b.go\nIncluded: no, ignored by the ignore_patterns entry \"_*\"\n"},
+	}
+	modes := []checks.Mode{checks.PreCommit, checks.PrePush}
+	for i, line := range data {
+		b := &bytes.Buffer{}
+		a := &application{config: config, out: b}
+		ut.AssertEqualIndex(t, i, nil, a.cmdWhy(repo, modes, td, line.p))
+		ut.AssertEqualIndex(t, i, line.expected, b.String())
+	}
+	a := &application{config: config, out: &bytes.Buffer{}}
+	ut.AssertEqual(t, errors.New("missing.go doesn't exist"), a.cmdWhy(repo, modes, td, "missing.go"))
+
+	// The files outside of every module are not checked.
+	b := &bytes.Buffer{}
+	a = &application{config: &checks.Config{Modules: checks.Modules{"tools"}}, out: b}
+	ut.AssertEqual(t, nil, a.cmdWhy(repo, []checks.Mode{checks.PreCommit}, td, "a.go"))
+	ut.AssertEqual(t, "File: a.go\nIncluded: yes\nModule: none, it is outside of every module so it is not checked\n", b.String())
+	b.Reset()
+	ut.AssertEqual(t, nil, a.cmdWhy(repo, []checks.Mode{checks.PreCommit}, filepath.Join(td, "tools"), "t.go"))
+	ut.AssertEqual(t, "File: tools/t.go\nIncluded: yes\nModule: tools\n\npre-commit:\n  no check\n", b.String())
+}
+
+// fakeCheck is a check that returns its issues or err after delay.
+type fakeCheck struct {
+	delay  time.Duration
+	issues checks.Issues
+	err    error
+	panic  string
+	// notice, if set, is recorded via Options.Notice.
+	notice string
+	// block, if set, is waited for before returning.
+	block chan struct{}
+}
+
+func (f *fakeCheck) GetDescription() string                       { return "fake" }
+func (f *fakeCheck) GetName() string                              { return "fake" }
+func (f *fakeCheck) GetPrerequisites() []checks.CheckPrerequisite { return nil }
+
+func (f *fakeCheck) Run(change scm.Change, options *checks.Options) error {
+	time.Sleep(f.delay)
+	if f.block != nil {
+		<-f.block
+	}
+	if f.panic != "" {
+		panic(f.panic)
+	}
+	if f.notice != "" {
+		options.Notice("%s", f.notice)
+	}
+	if f.issues != nil {
+		return f.issues
+	}
+	return f.err
+}
+
+// chanWriter sends each write on the channel.
+type chanWriter chan string
+
+func (c chanWriter) Write(p []byte) (int, error) {
+	c <- string(p)
+	return len(p), nil
+}
+
+// fakeChange is a non-nil scm.Change that must not be used.
+type fakeChange struct {
+	scm.Change
+}
+
+// whyRepo is a repository with the files ignored by the scm and the
+// untracked files preset.
+type whyRepo struct {
+	scm.ReadOnlyRepo
+	root      string
+	ignored   map[string]string
+	untracked []string
+}
+
+func (w *whyRepo) Root() string {
+	return w.root
+}
+
+func (w *whyRepo) IgnoredBy(p string) (string, error) {
+	return w.ignored[p], nil
+}
+
+func (w *whyRepo) Untracked(ignorePatterns scm.IgnorePatterns) ([]string, error) {
+	return w.untracked, nil
+}
+
+// stashRepo is a repository with unstaged changes to stash.
+type stashRepo struct {
+	scm.Repo
+	stashed  chan struct{}
+	restored chan struct{}
+}
+
+func (s *stashRepo) Stash() (bool, error) {
+	return true, nil
+}
+
+func (s *stashRepo) Restore() error {
+	s.restored <- struct{}{}
+	return nil
+}
+
+func (s *stashRepo) Between(recent, old scm.Commit, ignorePatterns scm.IgnorePatterns) (scm.Change, error) {
+	// The changes are stashed and the restore is pending.
+	close(s.stashed)
+	return fakeChange{}, nil
+}
+
+// prePushRepo is a stashRepo recording the checkouts.
+type prePushRepo struct {
+	stashRepo
+	checkouts chan string
+}
+
+func (p *prePushRepo) Ref(c scm.Commit) string {
+	return "main"
+}
+
+func (p *prePushRepo) Checkout(ref string) error {
+	p.checkouts <- ref
+	return nil
+}
@@ -0,0 +1,292 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Migration of the configuration file to the current schema.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/gopkg.in/yaml.v2"
+	"github.com/maruel/pre-commit-go/checks"
+	"github.com/maruel/pre-commit-go/internal"
+	"github.com/maruel/pre-commit-go/scm"
+)
+
+// migration is a change of the configuration schema.
+type migration struct {
+	// name describes the change.
+	name string
+	// apply edits the configuration file content. It returns the description
+	// of each edit done, if any.
+	apply func(content []byte) ([]byte, []string, error)
+}
+
+// migrations is the list of the known changes of the configuration schema,
+// applied in order.
+var migrations = []migration{
+	{"coverage min_coverage and max_coverage moved under global", migrateCoverageGlobal},
+	{"min_version set to the current version", migrateMinVersion},
+}
+
+// cmdMigrate applies the known migrations to the configuration file, keeping
+// a backup of the original, and reports the keys that are still unknown.
+func (a *application) cmdMigrate(repo scm.ReadOnlyRepo, configPath, name string) error {
+	if configPath == "<N/A>" {
+		// The file may exist but fail to load.
+		configPath = name
+		if !filepath.IsAbs(name) {
+			configPath = filepath.Join(repo.Root(), name)
+		}
+	}
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.New("no configuration file to migrate; run writeconfig instead")
+		}
+		return err
+	}
+	migrated, changes, err := migrate(content)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %s", configPath, err)
+	}
+	if len(changes) == 0 {
+		fmt.Printf("%s is up to date\n", configPath)
+	} else {
+		backup := configPath + ".bak"
+		if err := ioutil.WriteFile(backup, content, 0666); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(configPath, migrated, 0666); err != nil {
+			return err
+		}
+		fmt.Printf("migrated %s, the original is saved as %s:\n", configPath, backup)
+		for _, c := range changes {
+			fmt.Printf("  - %s\n", c)
+		}
+	}
+	unknown, err := unknownKeys(migrated)
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %s", configPath, err)
+	}
+	if len(unknown) != 0 {
+		for _, k := range unknown {
+			fmt.Printf("unknown key %s is ignored; rename or remove it\n", k)
+		}
+		return fmt.Errorf("%s has %d unknown keys", configPath, len(unknown))
+	}
+	return nil
+}
+
+// migrate applies all the migrations to content.
+func migrate(content []byte) ([]byte, []string, error) {
+	var changes []string
+	for _, m := range migrations {
+		c, edits, err := m.apply(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", m.name, err)
+		}
+		content = c
+		changes = append(changes, edits...)
+	}
+	return content, changes, nil
+}
+
+// migrateCoverageGlobal moves the min_coverage and max_coverage keys of the
+// coverage checks under global.
+func migrateCoverageGlobal(content []byte) ([]byte, []string, error) {
+	var raw struct {
+		Modes map[string]struct {
+			Checks map[string][]map[string]interface{} `yaml:"checks"`
+		} `yaml:"modes"`
+	}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, nil, err
+	}
+	var modes []string
+	for m := range raw.Modes {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	var changes []string
+	for _, m := range modes {
+		for i, item := range raw.Modes[m].Checks["coverage"] {
+			path := []string{"modes", m, "checks", "coverage", fmt.Sprintf("[%d]", i)}
+			var moved []string
+			var values []string
+			for _, key := range []string{"min_coverage", "max_coverage"} {
+				if v, ok := item[key]; ok {
+					moved = append(moved, key)
+					values = append(values, fmt.Sprintf("%s: %v", key, v))
+				}
+			}
+			if len(moved) == 0 {
+				continue
+			}
+			var err error
+			if global, ok := item["global"].(map[interface{}]interface{}); ok && len(global) != 0 {
+				for j, key := range moved {
+					if _, ok := global[key]; ok {
+						// global wins, like when the file was loaded.
+						continue
+					}
+					content, err = internal.SetYAML(content, append(path, "global", key), strings.TrimPrefix(values[j], key+": "))
+					if err != nil {
+						return nil, nil, err
+					}
+				}
+			} else {
+				content, err = internal.SetYAML(content, append(path, "global"), "{"+strings.Join(values, ", ")+"}")
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			for _, key := range moved {
+				if content, err = internal.DeleteYAML(content, append(path, key)); err != nil {
+					return nil, nil, err
+				}
+			}
+			changes = append(changes, fmt.Sprintf("%s: moved %s under global", strings.Join(path, "."), strings.Join(moved, " and ")))
+		}
+	}
+	return content, changes, nil
+}
+
+// migrateMinVersion sets min_version to the current version, as the migrated
+// file may not be understood by older versions.
+func migrateMinVersion(content []byte) ([]byte, []string, error) {
+	var raw struct {
+		MinVersion string `yaml:"min_version"`
+	}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, nil, err
+	}
+	if raw.MinVersion == version {
+		return content, nil, nil
+	}
+	if v, err := parseVersion(raw.MinVersion); err == nil && requiresNewer(v) {
+		return nil, nil, fmt.Errorf("the file requires version %s, this is version %s", raw.MinVersion, version)
+	}
+	content, err := internal.SetYAML(content, []string{"min_version"}, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, []string{fmt.Sprintf("min_version: %s -> %s", raw.MinVersion, version)}, nil
+}
+
+// unknownKeys returns the path of the keys of the configuration file content
+// that are not part of the schema, thus silently ignored when loading it.
+func unknownKeys(content []byte) ([]string, error) {
+	var actual, expected interface{}
+	if err := yaml.Unmarshal(content, &actual); err != nil {
+		return nil, err
+	}
+	// The checks whose when condition doesn't hold in this environment are not
+	// loaded, so load them all to compare the checks at the same index.
+	stripConditions(actual)
+	stripped, err := yaml.Marshal(actual)
+	if err != nil {
+		return nil, err
+	}
+	config := &checks.Config{}
+	if err := yaml.Unmarshal(stripped, config); err != nil {
+		return nil, err
+	}
+	known, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(known, &expected); err != nil {
+		return nil, err
+	}
+	var keys []string
+	diffKeys("", actual, expected, &keys)
+	// The root keys holding anchors are expected.
+	holders := anchorHolders(content)
+	var out []string
+	for _, k := range keys {
+		if !holders[k] {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// anchorHolders returns the root keys of the configuration file content whose
+// value is anchored, e.g. "coverage_settings: &cov". They only hold the
+// anchors used by the rest of the file.
+func anchorHolders(content []byte) map[string]bool {
+	out := map[string]bool{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		if i := strings.Index(line, ":"); i != -1 && strings.HasPrefix(strings.TrimSpace(line[i+1:]), "&") {
+			out[strings.Trim(strings.TrimSpace(line[:i]), "\"'")] = true
+		}
+	}
+	return out
+}
+
+// stripConditions removes the when condition of each check of the decoded
+// configuration file config.
+func stripConditions(config interface{}) {
+	root, _ := config.(map[interface{}]interface{})
+	modes, _ := root["modes"].(map[interface{}]interface{})
+	for _, settings := range modes {
+		s, _ := settings.(map[interface{}]interface{})
+		checkTypes, _ := s["checks"].(map[interface{}]interface{})
+		for _, list := range checkTypes {
+			l, _ := list.([]interface{})
+			for _, check := range l {
+				if c, ok := check.(map[interface{}]interface{}); ok {
+					delete(c, checks.WhenKey)
+				}
+			}
+		}
+	}
+}
+
+// diffKeys appends to out the path of the mapping keys of actual that are
+// missing in expected.
+func diffKeys(prefix string, actual, expected interface{}, out *[]string) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch a := actual.(type) {
+	case map[interface{}]interface{}:
+		e, _ := expected.(map[interface{}]interface{})
+		for k, v := range a {
+			key := fmt.Sprint(k)
+			ev, ok := e[k]
+			if !ok {
+				// The zero values of the fields tagged omitempty are not marshaled.
+				if v != nil && !reflect.DeepEqual(v, reflect.Zero(reflect.TypeOf(v)).Interface()) {
+					*out = append(*out, join(key))
+				}
+				continue
+			}
+			diffKeys(join(key), v, ev, out)
+		}
+	case []interface{}:
+		e, _ := expected.([]interface{})
+		for i, v := range a {
+			if i < len(e) {
+				diffKeys(join(fmt.Sprintf("[%d]", i)), v, e[i], out)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestMigrate(t *testing.T) {
+	old := `# Comment.
+min_version: 0.4.0
+modes:
+  pre-push:
+    checks:
+      coverage:
+      - min_coverage: 50
+        max_coverage: 100 # Full.
+        per_dir_default:
+          min_coverage: 1
+      - use_global_inference: false
+        global:
+          min_coverage: 60
+        min_coverage: 40
+        max_coverage: 90
+`
+	expected := `# Comment.
+min_version: ` + version + `
+modes:
+  pre-push:
+    checks:
+      coverage:
+      - per_dir_default:
+          min_coverage: 1
+        global: {min_coverage: 50, max_coverage: 100}
+      - use_global_inference: false
+        global:
+          min_coverage: 60
+          max_coverage: 90
+`
+	actual, changes, err := migrate([]byte(old))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, string(actual))
+	ut.AssertEqual(t, []string{
+		"modes.pre-push.checks.coverage.[0]: moved min_coverage and max_coverage under global",
+		"modes.pre-push.checks.coverage.[1]: moved min_coverage and max_coverage under global",
+		"min_version: 0.4.0 -> " + version,
+	}, changes)
+
+	// Migrating again is a no-op.
+	again, changes, err := migrate(actual)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, expected, string(again))
+	ut.AssertEqual(t, []string(nil), changes)
+
+	_, _, err = migrate([]byte("min_version: 99.0\n"))
+	ut.AssertEqual(t, errors.New("min_version set to the current version: the file requires version 99.0, this is version "+version), err)
+}
+
+func TestUnknownKeys(t *testing.T) {
+	content := `min_version: 0.4.7
+modes:
+  lint:
+    checks:
+      custom:
+      - display_name: foo
+        command: [foo]
+        prerequisites:
+        - help_command: [foo, -h]
+          timeout: 0
+      coverage:
+      - global:
+          min_coverage: 10
+          min: 10
+        per_dir:
+          "a/b": {max: 1}
+      govet:
+      - when: ${PCG_TEST_NEVER_SET}
+      - blacklist: [foo]
+        typo: 1
+    max_durations: 10
+ignored_patterns: [".*"]
+`
+	unknown, err := unknownKeys([]byte(content))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{
+		"ignored_patterns",
+		"modes.lint.checks.coverage.[0].global.min",
+		"modes.lint.checks.coverage.[0].per_dir.a/b.max",
+		"modes.lint.checks.govet.[1].typo",
+		"modes.lint.max_durations",
+	}, unknown)
+}
+
+func TestMigrateAnchors(t *testing.T) {
+	// The example of CONFIGURATION.md.
+	content := `min_version: ` + version + `
+coverage_settings: &cov
+  min_coverage: 50
+  max_coverage: 100
+modes:
+  pre-push:
+    checks:
+      coverage:
+      - per_dir_default: *cov
+        per_dir:
+          internal:
+            <<: *cov
+            min_coverage: 90
+unused: {min_coverage: 50}
+`
+	actual, changes, err := migrate([]byte(content))
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, content, string(actual))
+	ut.AssertEqual(t, []string(nil), changes)
+	unknown, err := unknownKeys(actual)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"unused"}, unknown)
+}
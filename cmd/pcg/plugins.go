@@ -0,0 +1,13 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+// Third party checks are compiled in pcg by importing their package here. The
+// package registers its checks with checks.Register() in an init() function.
+// For example, to add the checks of package example.com/org/pcgchecks:
+//
+//   import _ "example.com/org/pcgchecks"
+//
+// then rebuild pcg. See checks.ExampleRegister for a check implementation.
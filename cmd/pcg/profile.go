@@ -0,0 +1,79 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// Profiling of pcg itself, not of the code being checked.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfiling starts the CPU profile and the execution trace of pcg when
+// their file name is not empty.
+//
+// The returned function stops them and writes the heap profile to memProfile
+// if not empty. It must be called once pcg is done.
+func startProfiling(cpuProfile, memProfile, traceFile string) (func() error, error) {
+	var stops []func() error
+	stop := func() error {
+		var err error
+		for i := len(stops) - 1; i >= 0; i-- {
+			if err2 := stops[i](); err == nil {
+				err = err2
+			}
+		}
+		return err
+	}
+	if cpuProfile != "" {
+		f, err := os.Create(cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the CPU profile: %s", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to start the CPU profile: %s", err)
+		}
+		stops = append(stops, func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+	if traceFile != "" {
+		f, err := os.Create(traceFile)
+		if err != nil {
+			_ = stop()
+			return nil, fmt.Errorf("failed to create the trace: %s", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			_ = stop()
+			return nil, fmt.Errorf("failed to start the trace: %s", err)
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+	if memProfile != "" {
+		stops = append(stops, func() error {
+			f, err := os.Create(memProfile)
+			if err != nil {
+				return fmt.Errorf("failed to create the memory profile: %s", err)
+			}
+			// Get up-to-date statistics.
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to write the memory profile: %s", err)
+			}
+			return f.Close()
+		})
+	}
+	return stop, nil
+}
@@ -8,6 +8,9 @@ package internal
 
 import "os"
 
+// exeSuffix is the suffix of executables on this OS.
+const exeSuffix = ""
+
 // Remove calls back os.Remove() on non-Windows.
 func Remove(name string) error {
 	return os.Remove(name)
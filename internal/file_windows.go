@@ -20,6 +20,9 @@ import (
 	"syscall"
 )
 
+// exeSuffix is the suffix of executables on this OS.
+const exeSuffix = ".exe"
+
 func Remove(name string) error {
 	p, e := syscall.UTF16PtrFromString(name)
 	if e != nil {
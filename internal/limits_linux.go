@@ -0,0 +1,31 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package internal
+
+import "strconv"
+
+// LimitsSupported is true when WithLimits enforces the limits on this OS.
+const LimitsSupported = true
+
+// WithLimits returns the command line args wrapped so the process and each
+// of its children can use at most maxMemoryMB MiB of virtual memory and
+// maxCPUSeconds of CPU time. A zero value means no limit.
+//
+// The limits are rlimits set by the shell before running the process.
+func WithLimits(args []string, maxMemoryMB, maxCPUSeconds int) []string {
+	script := ""
+	if maxMemoryMB > 0 {
+		script += "ulimit -v " + strconv.Itoa(maxMemoryMB*1024) + " && "
+	}
+	if maxCPUSeconds > 0 {
+		script += "ulimit -t " + strconv.Itoa(maxCPUSeconds) + " && "
+	}
+	if script == "" {
+		return args
+	}
+	return append([]string{"sh", "-c", script + `exec "$@"`, "sh"}, args...)
+}
@@ -0,0 +1,26 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+func TestWithLimits(t *testing.T) {
+	t.Parallel()
+	args := []string{"sh", "-c", "ulimit -v; ulimit -t"}
+	ut.AssertEqual(t, args, WithLimits(args, 0, 0))
+	out, exitCode, err := Capture(".", nil, WithLimits(args, 1024, 7)...)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0, exitCode)
+	ut.AssertEqual(t, "1048576\n7", strings.TrimSpace(out))
+	out, exitCode, err = Capture(".", nil, WithLimits([]string{"sh", "-c", "ulimit -t"}, 0, 3)...)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 0, exitCode)
+	ut.AssertEqual(t, "3", strings.TrimSpace(out))
+}
@@ -0,0 +1,16 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package internal
+
+// LimitsSupported is true when WithLimits enforces the limits on this OS.
+const LimitsSupported = false
+
+// WithLimits returns args as is, resource limits are not supported on this
+// OS.
+func WithLimits(args []string, maxMemoryMB, maxCPUSeconds int) []string {
+	return args
+}
@@ -0,0 +1,24 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup is a no-op, killProcessGroup kills the process tree
+// instead.
+func setProcessGroup(c *exec.Cmd) {
+}
+
+// killProcessGroup kills c and the processes it started with taskkill. Only c
+// is killed if taskkill fails.
+func killProcessGroup(c *exec.Cmd) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(c.Process.Pid)).Run(); err != nil {
+		return c.Process.Kill()
+	}
+	return nil
+}
@@ -10,16 +10,48 @@
 package internal
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
+// ErrTimeout is returned by CaptureTimeout when the process was killed because
+// it didn't complete in time.
+var ErrTimeout = errors.New("process timed out")
+
+var (
+	deadlineLock sync.Mutex
+	deadline     time.Time
+)
+
+// SetDeadline sets a wall clock deadline after which the processes started by
+// Capture and CaptureTimeout are killed and ErrTimeout is returned. A zero
+// value means no deadline.
+func SetDeadline(t time.Time) {
+	deadlineLock.Lock()
+	defer deadlineLock.Unlock()
+	deadline = t
+}
+
 // Capture runs an executable from a directory returns the output, exit code
 // and error if appropriate. It sets the environment variables specified.
 func Capture(wd string, env []string, args ...string) (string, int, error) {
+	return CaptureTimeout(wd, env, 0, args...)
+}
+
+// CaptureTimeout is like Capture except that the process is killed if it
+// runs for longer than timeout. In this case, ErrTimeout is returned. A zero
+// timeout means no timeout.
+//
+// With a timeout, the process is started in its own process group and the
+// whole group is killed, so the processes it started, e.g. the test binary
+// run by "go test", don't outlive it.
+func CaptureTimeout(wd string, env []string, timeout time.Duration, args ...string) (string, int, error) {
 	exitCode := -1
 	//log.Printf("Capture(%s, %s, %s)", wd, env, args)
 	var c *exec.Cmd
@@ -27,13 +59,25 @@ func Capture(wd string, env []string, args ...string) (string, int, error) {
 	case 0:
 		return "", -1, errors.New("no command specified")
 	case 1:
-		c = exec.Command(args[0])
+		c = exec.Command(lookExecutable(args[0]))
 	default:
-		c = exec.Command(args[0], args[1:]...)
+		c = exec.Command(lookExecutable(args[0]), args[1:]...)
 	}
 	if wd == "" {
 		return "", -1, errors.New("wd is required")
 	}
+	deadlineLock.Lock()
+	d := deadline
+	deadlineLock.Unlock()
+	if !d.IsZero() {
+		remaining := d.Sub(time.Now())
+		if remaining <= 0 {
+			return "", exitCode, ErrTimeout
+		}
+		if timeout == 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
 	c.Dir = wd
 	procEnv := map[string]string{}
 	for _, item := range os.Environ() {
@@ -55,7 +99,33 @@ func Capture(wd string, env []string, args ...string) (string, int, error) {
 	for k, v := range procEnv {
 		c.Env = append(c.Env, k+"="+v)
 	}
-	out, err := c.CombinedOutput()
+	out := &bytes.Buffer{}
+	c.Stdout = out
+	c.Stderr = out
+	if timeout > 0 {
+		setProcessGroup(c)
+	}
+	if err := c.Start(); err != nil {
+		return "", exitCode, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+	var err error
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		select {
+		case err = <-done:
+			t.Stop()
+		case <-t.C:
+			_ = killProcessGroup(c)
+			<-done
+			return out.String(), exitCode, ErrTimeout
+		}
+	} else {
+		err = <-done
+	}
 	if c.ProcessState != nil {
 		if waitStatus, ok := c.ProcessState.Sys().(syscall.WaitStatus); ok {
 			exitCode = waitStatus.ExitStatus()
@@ -65,5 +135,21 @@ func Capture(wd string, env []string, args ...string) (string, int, error) {
 		}
 	}
 	// TODO(maruel): Handle code page on Windows.
-	return string(out), exitCode, err
+	return out.String(), exitCode, err
+}
+
+// lookExecutable returns the name to use to run the executable name.
+//
+// It accounts for the ".exe" suffix so the commands in a configuration file
+// can be shared across OSes; "foo.exe" is run as "foo" on POSIX and "foo" is
+// run as "foo.exe" on Windows, if only the later exists.
+func lookExecutable(name string) string {
+	if _, err := exec.LookPath(name); err == nil {
+		return name
+	}
+	alt := strings.TrimSuffix(name, ".exe") + exeSuffix
+	if _, err := exec.LookPath(alt); err == nil {
+		return alt
+	}
+	return name
 }
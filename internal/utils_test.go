@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
 )
@@ -59,3 +60,67 @@ func TestCaptureNoWd(t *testing.T) {
 	ut.AssertEqual(t, -1, code)
 	ut.AssertEqual(t, errors.New("wd is required"), err)
 }
+
+func TestCaptureTimeout(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	_, code, err := CaptureTimeout(wd, nil, 10*time.Millisecond, "sleep", "10")
+	ut.AssertEqual(t, -1, code)
+	ut.AssertEqual(t, ErrTimeout, err)
+}
+
+func TestCaptureTimeoutChildren(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	// The grandchild keeps the output open until it is killed too.
+	start := time.Now()
+	_, code, err := CaptureTimeout(wd, nil, 10*time.Millisecond, "sh", "-c", "sleep 10 & wait")
+	ut.AssertEqual(t, -1, code)
+	ut.AssertEqual(t, ErrTimeout, err)
+	ut.AssertEqual(t, true, time.Since(start) < 5*time.Second)
+}
+
+func TestCaptureDeadline(t *testing.T) {
+	// Not parallel since the deadline is global.
+	defer SetDeadline(time.Time{})
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	SetDeadline(time.Now().Add(-time.Second))
+	_, code, err := Capture(wd, nil, "go", "version")
+	ut.AssertEqual(t, -1, code)
+	ut.AssertEqual(t, ErrTimeout, err)
+	if runtime.GOOS != "windows" {
+		SetDeadline(time.Now().Add(10 * time.Millisecond))
+		_, code, err = CaptureTimeout(wd, nil, time.Minute, "sleep", "10")
+		ut.AssertEqual(t, -1, code)
+		ut.AssertEqual(t, ErrTimeout, err)
+	}
+}
+
+func TestCaptureTimeoutFast(t *testing.T) {
+	t.Parallel()
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	out, code, err := CaptureTimeout(wd, nil, time.Minute, "go", "version")
+	ut.AssertEqual(t, true, strings.Contains(out, runtime.Version()))
+	ut.AssertEqual(t, 0, code)
+	ut.AssertEqual(t, nil, err)
+}
+
+func TestCaptureExeSuffix(t *testing.T) {
+	t.Parallel()
+	wd, err := os.Getwd()
+	ut.AssertEqual(t, nil, err)
+	out, code, err := Capture(wd, nil, "go.exe", "version")
+	ut.AssertEqual(t, true, strings.Contains(out, runtime.Version()))
+	ut.AssertEqual(t, 0, code)
+	ut.AssertEqual(t, nil, err)
+}
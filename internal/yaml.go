@@ -0,0 +1,387 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetYAML sets the scalar at path in the YAML document content to value,
+// keeping the comments and the formatting of the rest of the document
+// untouched.
+//
+// yaml.v2 drops the comments when a document is unmarshaled then marshaled
+// back, so the configuration file is edited in place instead. Only the block
+// style, as written by pcg writeconfig, is supported.
+//
+// The elements of path are mapping keys or sequence indexes written as "[0]".
+// value must be serialized as YAML, e.g. "90" or "null". When the last key of
+// path is missing, it is appended to its mapping.
+//
+// An alias on path or an anchor used by aliases is an error, as editing it in
+// place would silently change the other nodes sharing it.
+func SetYAML(content []byte, path []string, value string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	lines := strings.Split(string(content), "\n")
+	s, err := parentScope(lines, path)
+	if err != nil {
+		return nil, err
+	}
+	p := path[len(path)-1]
+	entries := s.entries(lines)
+	if e, valueCol, ok := findKey(lines, entries, p); ok {
+		line := lines[e.line]
+		rest := line[valueCol:]
+		inline := strings.TrimSpace(stripComment(rest))
+		if err := checkAnchor(lines, path, inline); err != nil {
+			return nil, err
+		}
+		if inline == "" && e.valueScope(lines, s.end).hasContent(lines) {
+			return nil, fmt.Errorf("%s: is not a scalar", strings.Join(path, "."))
+		}
+		comment := rest[len(stripComment(rest)):]
+		if comment != "" {
+			comment = " " + strings.TrimLeft(comment, " ")
+		}
+		lines[e.line] = line[:valueCol] + " " + value + comment
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+	// Append the key after the last line of the mapping.
+	col := s.col
+	at := s.first
+	for _, e := range entries {
+		col = e.col
+	}
+	for j := s.first; j < s.end; j++ {
+		if t := strings.TrimSpace(lines[j]); t != "" && !strings.HasPrefix(t, "#") {
+			at = j + 1
+		}
+	}
+	if s.inline && at == s.first {
+		return nil, fmt.Errorf("%s: is not a block mapping", strings.Join(path[:len(path)-1], "."))
+	}
+	line := strings.Repeat(" ", col) + quoteKey(p) + ": " + value
+	lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// DeleteYAML removes the key at path in the YAML document content, with its
+// value, keeping the comments and the formatting of the rest of the document
+// untouched. The same subset of YAML as SetYAML is supported.
+func DeleteYAML(content []byte, path []string) ([]byte, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	lines := strings.Split(string(content), "\n")
+	s, err := parentScope(lines, path)
+	if err != nil {
+		return nil, err
+	}
+	e, valueCol, ok := findKey(lines, s.entries(lines), path[len(path)-1])
+	if !ok {
+		return nil, fmt.Errorf("%s: not found", strings.Join(path, "."))
+	}
+	if name, _ := splitAnchor(strings.TrimSpace(stripComment(lines[e.line][valueCol:]))); name != "" && hasAlias(lines, name) {
+		return nil, fmt.Errorf("%s: is the anchor &%s used by aliases; replace them with explicit values to edit it", strings.Join(path, "."), name)
+	}
+	// Keep the comments and blank lines following the value, they are about
+	// what follows.
+	end := e.line + 1
+	v := e.valueScope(lines, s.end)
+	for j := v.first; j < v.end; j++ {
+		if t := strings.TrimSpace(lines[j]); t != "" && !strings.HasPrefix(t, "#") {
+			end = j + 1
+		}
+	}
+	if s.inline && e.line == s.first {
+		// The key follows a sequence item marker, which must be kept. Move the
+		// next entry of the item on the marker line.
+		marker := lines[e.line][:e.col]
+		next := -1
+		for j := end; j < s.end; j++ {
+			if t := strings.TrimSpace(lines[j]); t != "" && !strings.HasPrefix(t, "#") {
+				next = j
+				break
+			}
+		}
+		if next == -1 {
+			lines[e.line] = marker + "{}"
+			lines = append(lines[:e.line+1], lines[end:]...)
+		} else {
+			lines[e.line] = marker + strings.TrimLeft(lines[next], " ")
+			lines = append(lines[:e.line+1], lines[next+1:]...)
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+	lines = append(lines[:e.line], lines[end:]...)
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// parentScope returns the scope of the mapping containing the last element
+// of path.
+func parentScope(lines []string, path []string) (yamlScope, error) {
+	s := yamlScope{first: 0, end: len(lines), col: 0}
+	for i, p := range path {
+		last := i == len(path)-1
+		entries := s.entries(lines)
+		if strings.HasPrefix(p, "[") && strings.HasSuffix(p, "]") {
+			index, err := strconv.Atoi(p[1 : len(p)-1])
+			if err != nil {
+				return s, fmt.Errorf("invalid index %q", p)
+			}
+			var items []yamlEntry
+			for _, e := range entries {
+				if isSequenceItem(lines[e.line][e.col:]) {
+					items = append(items, e)
+				}
+			}
+			if index < 0 || index >= len(items) {
+				return s, fmt.Errorf("%s: index out of range", strings.Join(path[:i+1], "."))
+			}
+			if last {
+				return s, fmt.Errorf("%s: is not a mapping value", strings.Join(path, "."))
+			}
+			s = items[index].itemScope(lines, s.end)
+			continue
+		}
+		if last {
+			return s, nil
+		}
+		e, valueCol, ok := findKey(lines, entries, p)
+		if !ok {
+			return s, fmt.Errorf("%s: not found", strings.Join(path[:i+1], "."))
+		}
+		value := strings.TrimSpace(stripComment(lines[e.line][valueCol:]))
+		if err := checkAnchor(lines, path[:i+1], value); err != nil {
+			return s, err
+		}
+		if _, value = splitAnchor(value); value != "" {
+			return s, fmt.Errorf("%s: is not a block mapping", strings.Join(path[:i+1], "."))
+		}
+		s = e.valueScope(lines, s.end)
+	}
+	return s, nil
+}
+
+// checkAnchor returns an error if the value of the key at path is an alias or
+// an anchor used by aliases, so it can't be edited in place.
+func checkAnchor(lines []string, path []string, value string) error {
+	if strings.HasPrefix(value, "*") {
+		return fmt.Errorf("%s: is the alias %s; replace it with an explicit value to edit it", strings.Join(path, "."), value)
+	}
+	if name, _ := splitAnchor(value); name != "" && hasAlias(lines, name) {
+		return fmt.Errorf("%s: is the anchor &%s used by aliases; replace them with explicit values to edit it", strings.Join(path, "."), name)
+	}
+	return nil
+}
+
+// splitAnchor splits the anchor name off the value of a key, e.g. "cov" and
+// "{}" for "&cov {}".
+func splitAnchor(value string) (string, string) {
+	if !strings.HasPrefix(value, "&") {
+		return "", value
+	}
+	if i := strings.IndexByte(value, ' '); i != -1 {
+		return value[1:i], strings.TrimSpace(value[i:])
+	}
+	return value[1:], ""
+}
+
+// hasAlias returns true if the anchor name is referenced by an alias.
+func hasAlias(lines []string, name string) bool {
+	for _, line := range lines {
+		t := stripComment(line)
+		for i := strings.Index(t, "*"+name); i != -1; {
+			end := i + 1 + len(name)
+			before := i == 0 || strings.IndexByte(" -:,[{", t[i-1]) != -1
+			after := end == len(t) || strings.IndexByte(" ,]}", t[end]) != -1
+			if before && after {
+				return true
+			}
+			next := strings.Index(t[end:], "*"+name)
+			if next == -1 {
+				break
+			}
+			i = end + next
+		}
+	}
+	return false
+}
+
+// findKey returns the entry of the mapping key key and the column just after
+// its ':'.
+func findKey(lines []string, entries []yamlEntry, key string) (yamlEntry, int, bool) {
+	for _, e := range entries {
+		if k, valueCol, ok := parseKey(lines[e.line], e.col); ok && k == key {
+			return e, valueCol, true
+		}
+	}
+	return yamlEntry{}, 0, false
+}
+
+// yamlScope is a range of lines containing a block node.
+type yamlScope struct {
+	// first is the first line and end is the line after the last one.
+	first, end int
+	// col is the column of the entries.
+	col int
+	// inline is true when the first entry starts at col on line first, after a
+	// sequence item marker.
+	inline bool
+}
+
+// yamlEntry is a mapping key or a sequence item.
+type yamlEntry struct {
+	line, col int
+}
+
+// entries returns the mapping keys or sequence items directly in the scope.
+func (s yamlScope) entries(lines []string) []yamlEntry {
+	var out []yamlEntry
+	col := -1
+	for i := s.first; i < s.end; i++ {
+		c := indentOf(lines[i])
+		if s.inline && i == s.first {
+			c = s.col + indentOf(lines[i][s.col:])
+		}
+		t := strings.TrimSpace(lines[i])
+		if s.inline && i == s.first {
+			t = strings.TrimSpace(lines[i][s.col:])
+		}
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if col == -1 {
+			col = c
+		}
+		if c < col {
+			break
+		}
+		if c == col {
+			out = append(out, yamlEntry{i, c})
+		}
+	}
+	return out
+}
+
+// hasContent returns true if the scope contains anything but comments.
+func (s yamlScope) hasContent(lines []string) bool {
+	for i := s.first; i < s.end; i++ {
+		if t := strings.TrimSpace(lines[i]); t != "" && !strings.HasPrefix(t, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// valueScope returns the scope of the block value of the mapping key e.
+func (e yamlEntry) valueScope(lines []string, end int) yamlScope {
+	s := yamlScope{first: e.line + 1, end: end, col: e.col + 2}
+	sequence := false
+	for i := e.line + 1; i < end; i++ {
+		t := strings.TrimSpace(lines[i])
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		c := indentOf(lines[i])
+		if c == e.col && isSequenceItem(t) && (sequence || !s.hasContentBefore(lines, i)) {
+			// A sequence can be at the same indentation as its key.
+			sequence = true
+			continue
+		}
+		if c <= e.col {
+			s.end = i
+			break
+		}
+	}
+	return s
+}
+
+// itemScope returns the scope of the content of the sequence item e.
+func (e yamlEntry) itemScope(lines []string, end int) yamlScope {
+	s := yamlScope{first: e.line, end: end, col: e.col + 2, inline: true}
+	for i := e.line + 1; i < end; i++ {
+		t := strings.TrimSpace(lines[i])
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if indentOf(lines[i]) <= e.col {
+			s.end = i
+			break
+		}
+	}
+	return s
+}
+
+// hasContentBefore returns true if the scope has content before line i.
+func (s yamlScope) hasContentBefore(lines []string, i int) bool {
+	return yamlScope{first: s.first, end: i}.hasContent(lines)
+}
+
+// parseKey parses the mapping key starting at column col of line. Returns the
+// unquoted key and the column just after the ':'.
+func parseKey(line string, col int) (string, int, bool) {
+	t := line[col:]
+	if isSequenceItem(t) {
+		return "", 0, false
+	}
+	if strings.HasPrefix(t, "\"") || strings.HasPrefix(t, "'") {
+		end := strings.IndexByte(t[1:], t[0])
+		if end == -1 || !strings.HasPrefix(t[end+2:], ":") {
+			return "", 0, false
+		}
+		key := t[:end+2]
+		if t[0] == '"' {
+			if k, err := strconv.Unquote(key); err == nil {
+				return k, col + end + 3, true
+			}
+		}
+		return key[1 : len(key)-1], col + end + 3, true
+	}
+	for i := 0; i < len(t); i++ {
+		if t[i] == ':' && (i == len(t)-1 || t[i+1] == ' ') {
+			return t[:i], col + i + 1, true
+		}
+	}
+	return "", 0, false
+}
+
+// quoteKey quotes a key if needed.
+func quoteKey(k string) string {
+	if k == "" || strings.ContainsAny(k, ":#\"'{}[],&*!|>%@`") || strings.TrimSpace(k) != k {
+		return strconv.Quote(k)
+	}
+	return k
+}
+
+// stripComment returns s without its trailing comment.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func isSequenceItem(t string) bool {
+	return t == "-" || strings.HasPrefix(t, "- ")
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
+)
+
+const yamlDoc = `# Header comment.
+
+min_version: 0.4.7
+modes:
+  # The CI mode.
+  continuous-integration:
+    checks:
+      build:
+      - build_all: false
+        extra_args:
+        - -v
+      coverage:
+      - # Merge the coverage.
+        use_global_inference: false
+        global:
+          min_coverage: 50   # Keep it low.
+          max_coverage: 90
+        per_dir:
+          "cmd/pcg": null
+          scm:
+            min_coverage: 60
+    max_duration: 120
+ignore_patterns:
+- .*
+`
+
+func TestSetYAML(t *testing.T) {
+	t.Parallel()
+	prefix := []string{"modes", "continuous-integration", "checks", "coverage", "[0]"}
+	data := []struct {
+		path     []string
+		value    string
+		old, new string
+	}{
+		{
+			append(prefix, "global", "min_coverage"), "55",
+			"          min_coverage: 50   # Keep it low.\n",
+			"          min_coverage: 55 # Keep it low.\n",
+		},
+		{
+			append(prefix, "global", "max_coverage"), "95",
+			"          max_coverage: 90\n",
+			"          max_coverage: 95\n",
+		},
+		{
+			append(prefix, "per_dir", "cmd/pcg"), "{}",
+			"          \"cmd/pcg\": null\n",
+			"          \"cmd/pcg\": {}\n",
+		},
+		{
+			append(prefix, "per_dir", "scm", "max_coverage"), "80",
+			"            min_coverage: 60\n",
+			"            min_coverage: 60\n            max_coverage: 80\n",
+		},
+		{
+			append(prefix, "use_global_inference"), "true",
+			"        use_global_inference: false\n",
+			"        use_global_inference: true\n",
+		},
+		{
+			[]string{"modes", "continuous-integration", "checks", "build", "[0]", "build_all"}, "true",
+			"      - build_all: false\n",
+			"      - build_all: true\n",
+		},
+		{
+			[]string{"modes", "continuous-integration", "max_duration"}, "60",
+			"    max_duration: 120\n",
+			"    max_duration: 60\n",
+		},
+		{
+			[]string{"min_version"}, "0.5.0",
+			"min_version: 0.4.7\n",
+			"min_version: 0.5.0\n",
+		},
+	}
+	for i, line := range data {
+		actual, err := SetYAML([]byte(yamlDoc), line.path, line.value)
+		ut.AssertEqualIndex(t, i, nil, err)
+		expected := replaceOnce(t, yamlDoc, line.old, line.new)
+		ut.AssertEqualIndex(t, i, expected, string(actual))
+	}
+}
+
+func TestSetYAMLErrors(t *testing.T) {
+	t.Parallel()
+	data := []struct {
+		path     []string
+		expected error
+	}{
+		{nil, errors.New("empty path")},
+		{[]string{"modes", "lint", "checks"}, errors.New("modes.lint: not found")},
+		{[]string{"modes"}, errors.New("modes: is not a scalar")},
+		{[]string{"ignore_patterns", "[1]", "foo"}, errors.New("ignore_patterns.[1]: index out of range")},
+		{[]string{"min_version", "foo"}, errors.New("min_version: is not a block mapping")},
+	}
+	for i, line := range data {
+		_, err := SetYAML([]byte(yamlDoc), line.path, "1")
+		ut.AssertEqualIndex(t, i, line.expected, err)
+	}
+}
+
+func TestSetYAMLAnchors(t *testing.T) {
+	t.Parallel()
+	doc := "global: &cov\n  min_coverage: 50\nper_dir:\n  a: *cov\n  b: {x: *cov}\nmin: &min 10\nmax: &max 20\nc: [*max]\n"
+	data := []struct {
+		path     []string
+		expected error
+	}{
+		{[]string{"global", "min_coverage"}, errors.New("global: is the anchor &cov used by aliases; replace them with explicit values to edit it")},
+		{[]string{"per_dir", "a", "min_coverage"}, errors.New("per_dir.a: is the alias *cov; replace it with an explicit value to edit it")},
+		{[]string{"per_dir", "a"}, errors.New("per_dir.a: is the alias *cov; replace it with an explicit value to edit it")},
+		{[]string{"max"}, errors.New("max: is the anchor &max used by aliases; replace them with explicit values to edit it")},
+	}
+	for i, line := range data {
+		_, err := SetYAML([]byte(doc), line.path, "1")
+		ut.AssertEqualIndex(t, i, line.expected, err)
+	}
+	_, err := DeleteYAML([]byte(doc), []string{"global"})
+	ut.AssertEqual(t, errors.New("global: is the anchor &cov used by aliases; replace them with explicit values to edit it"), err)
+
+	// An anchor without alias is edited as usual.
+	actual, err := SetYAML([]byte(doc), []string{"min"}, "15")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, replaceOnce(t, doc, "min: &min 10\n", "min: 15\n"), string(actual))
+	actual, err = SetYAML([]byte("g: &g\n  m: 1\n"), []string{"g", "m"}, "2")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "g: &g\n  m: 2\n", string(actual))
+}
+
+func TestDeleteYAML(t *testing.T) {
+	t.Parallel()
+	prefix := []string{"modes", "continuous-integration", "checks", "coverage", "[0]"}
+	data := []struct {
+		path     []string
+		old, new string
+	}{
+		{
+			append(prefix, "global", "min_coverage"),
+			"          min_coverage: 50   # Keep it low.\n",
+			"",
+		},
+		{
+			append(prefix, "global"),
+			"        global:\n          min_coverage: 50   # Keep it low.\n          max_coverage: 90\n",
+			"",
+		},
+		{
+			append(prefix, "per_dir", "cmd/pcg"),
+			"          \"cmd/pcg\": null\n",
+			"",
+		},
+		{
+			[]string{"modes", "continuous-integration", "checks", "build", "[0]", "build_all"},
+			"      - build_all: false\n        extra_args:\n",
+			"      - extra_args:\n",
+		},
+		{
+			[]string{"modes", "continuous-integration", "checks", "build"},
+			"      build:\n      - build_all: false\n        extra_args:\n        - -v\n",
+			"",
+		},
+	}
+	for i, line := range data {
+		actual, err := DeleteYAML([]byte(yamlDoc), line.path)
+		ut.AssertEqualIndex(t, i, nil, err)
+		expected := replaceOnce(t, yamlDoc, line.old, line.new)
+		ut.AssertEqualIndex(t, i, expected, string(actual))
+	}
+
+	actual, err := DeleteYAML([]byte("l:\n- a: 1\n  # Comment.\n"), []string{"l", "[0]", "a"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "l:\n- {}\n  # Comment.\n", string(actual))
+	_, err = DeleteYAML([]byte(yamlDoc), []string{"modes", "lint"})
+	ut.AssertEqual(t, errors.New("modes.lint: not found"), err)
+}
+
+func replaceOnce(t *testing.T, s, old, new string) string {
+	for i := 0; i+len(old) <= len(s); i++ {
+		if s[i:i+len(old)] == old {
+			return s[:i] + new + s[i+len(old):]
+		}
+	}
+	t.Fatalf("%q not found", old)
+	return ""
+}
@@ -5,6 +5,8 @@
 package scm
 
 import (
+	"errors"
+	"fmt"
 	"go/scanner"
 	"go/token"
 	"io/ioutil"
@@ -32,8 +34,9 @@ type Change interface {
 	// modified files plus all packages importing a package that was modified by
 	// this Change. It is useful for example to run all tests that could be
 	// indirectly impacted by a change. Indirect().GoFiles() ==
-	// Changed().GoFiles(). Only Packages() and TestPackages() can be longer, up
-	// to values returned by All()'s.
+	// Changed().GoFiles() and Indirect().Files() == Changed().Files(). Only
+	// Packages() and TestPackages() can be longer, up to values returned by
+	// All()'s.
 	Indirect() Set
 	// All returns all the files in the repository.
 	All() Set
@@ -49,6 +52,9 @@ type Change interface {
 // Set is a subset of files/directories/packages relative to the change and the
 // overall repository.
 type Set interface {
+	// Files returns all the files, including the ones that are not Go source
+	// files.
+	Files() []string
 	// GoFiles returns all the source files, including tests.
 	GoFiles() []string
 	// Packages returns all the packages included in this set, using the relative
@@ -63,34 +69,241 @@ type Set interface {
 	TestPackages() []string
 }
 
+// Restrict returns a Change that only contains the files of the packages
+// matching patterns, as if the repository only contained these packages.
+//
+// Patterns use the relative notation, e.g. "./foo" or "./foo/..." to include
+// all the packages under directory foo. Each pattern must match at least one
+// package.
+func Restrict(c Change, patterns []string) (Change, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if len(patterns) == 0 {
+		return c, nil
+	}
+	var ignorePatterns IgnorePatterns
+	if cc, ok := c.(*change); ok {
+		ignorePatterns = cc.ignorePatterns
+	}
+	matched := make([]bool, len(patterns))
+	for _, p := range patterns {
+		if p == "" {
+			return nil, errors.New("empty package pattern")
+		}
+		if p != "." && p != "./..." && !strings.HasPrefix(p, "./") {
+			return nil, fmt.Errorf("package pattern %q must be relative to the repository root, e.g. \"./%s\"", p, p)
+		}
+	}
+	filter := func(files []string) []string {
+		var out []string
+		for _, f := range files {
+			for i, p := range patterns {
+				if matchPackage(p, dirToPkg(dirName(f))) {
+					matched[i] = matched[i] || strings.HasSuffix(f, ".go")
+					out = append(out, f)
+					break
+				}
+			}
+		}
+		return out
+	}
+	allFiles := filter(c.All().Files())
+	for i, m := range matched {
+		if !m {
+			return nil, fmt.Errorf("package pattern %q matches no package", patterns[i])
+		}
+	}
+	files := filter(c.Changed().Files())
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return inherit(c, newChange(c.Repo(), files, allFiles, ignorePatterns)), nil
+}
+
+// WithFiles returns a Change with files as the modified files instead of the
+// ones of c, e.g. as listed by an external tool. All() is kept.
+//
+// The files are relative to the repository root or absolute. The ones that
+// don't exist or are outside the repository are not included and returned
+// separately. Returns a nil Change if no file is left.
+func WithFiles(c Change, files []string) (Change, []string) {
+	if c == nil {
+		return nil, nil
+	}
+	var ignorePatterns IgnorePatterns
+	if cc, ok := c.(*change); ok {
+		ignorePatterns = cc.ignorePatterns
+	}
+	root := c.Repo().Root()
+	all := map[string]bool{}
+	for _, f := range c.All().Files() {
+		all[f] = true
+	}
+	seen := map[string]bool{}
+	var changed, missing []string
+	for _, f := range files {
+		rel := f
+		if filepath.IsAbs(f) {
+			var err error
+			if rel, err = filepath.Rel(root, f); err != nil {
+				missing = append(missing, f)
+				continue
+			}
+		}
+		rel = path.Clean(filepath.ToSlash(rel))
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			missing = append(missing, f)
+			continue
+		}
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		if fi, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err != nil || fi.IsDir() {
+			missing = append(missing, f)
+			continue
+		}
+		if ignorePatterns.Match(rel) {
+			continue
+		}
+		changed = append(changed, rel)
+		all[rel] = true
+	}
+	if len(changed) == 0 {
+		return nil, missing
+	}
+	allFiles := make([]string, 0, len(all))
+	for f := range all {
+		allFiles = append(allFiles, f)
+	}
+	sort.Strings(changed)
+	sort.Strings(allFiles)
+	return inherit(c, newChange(c.Repo(), changed, allFiles, ignorePatterns)), missing
+}
+
+// FindModules returns the directories under root containing a go.mod file,
+// relative to root in POSIX format and sorted. The directories matching ignorePatterns and the
+// directories named "vendor" or "testdata" are skipped.
+func FindModules(root string, ignorePatterns IgnorePatterns) ([]string, error) {
+	var out []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel != "." && (info.Name() == "vendor" || info.Name() == "testdata" || ignorePatterns.Match(rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "go.mod" {
+			out = append(out, path.Dir(filepath.ToSlash(rel)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// SplitModules splits c per Go module.
+//
+// dirs are the module directories relative to the repository root, e.g. "."
+// or "tools/foo". Each file belongs to the innermost module containing it;
+// the files outside of every module are dropped. The Change of each module has
+// its Repo().Root() set to the module directory so its paths and packages are
+// relative to the module. The modules without any modified file are omitted.
+func SplitModules(c Change, dirs []string) (map[string]Change, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var ignorePatterns IgnorePatterns
+	if cc, ok := c.(*change); ok {
+		ignorePatterns = cc.ignorePatterns
+	}
+	// The module directories are in POSIX format, like the files.
+	cleaned := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		if d == "" || path.IsAbs(d) || filepath.IsAbs(d) {
+			return nil, fmt.Errorf("module directory %q must be relative to the repository root", d)
+		}
+		d = path.Clean(filepath.ToSlash(d))
+		if d == ".." || strings.HasPrefix(d, "../") {
+			return nil, fmt.Errorf("module directory %q is outside the repository", d)
+		}
+		cleaned = append(cleaned, d)
+	}
+	// owner returns the module containing f and the path of f relative to it.
+	owner := func(f string) (string, string) {
+		best := ""
+		for _, d := range cleaned {
+			if (d == "." || strings.HasPrefix(f, d+"/")) && (best == "" || best == "." || len(d) > len(best)) {
+				best = d
+			}
+		}
+		if best == "" || best == "." {
+			return best, f
+		}
+		return best, f[len(best)+1:]
+	}
+	split := func(files []string) map[string][]string {
+		out := map[string][]string{}
+		for _, f := range files {
+			if d, rel := owner(f); d != "" {
+				out[d] = append(out[d], rel)
+			}
+		}
+		return out
+	}
+	allFiles := split(c.All().Files())
+	out := map[string]Change{}
+	for d, files := range split(c.Changed().Files()) {
+		r := c.Repo()
+		if d != "." {
+			r = &subdir{r, filepath.Join(r.Root(), filepath.FromSlash(d))}
+		}
+		out[d] = inherit(c, newChange(r, files, allFiles[d], ignorePatterns))
+	}
+	return out, nil
+}
+
 // Private details.
 
 const pathSeparator = string(os.PathSeparator)
 
 type change struct {
 	repo           ReadOnlyRepo
-	packageName    string
 	ignorePatterns IgnorePatterns
+	ignored        *ignoredCache
 	direct         set
 	indirect       set
 	all            set
 
 	lock    sync.Mutex
 	content map[string][]byte
+
+	// packageName is only computed when needed, as it reads go.mod.
+	packageOnce sync.Once
+	packageName string
 }
 
 func newChange(r ReadOnlyRepo, files, allFiles, ignorePatterns IgnorePatterns) *change {
 	//log.Printf("Change{%s, %s}", files, allFiles)
-	root := r.Root()
-	// An error occurs when the repository is not inside GOPATH. Ignore this
-	// error here.
-	pkgName, _ := relToGOPATH(root, r.GOPATH())
 	c := &change{
 		repo:           r,
-		packageName:    pkgName,
 		ignorePatterns: ignorePatterns,
+		ignored:        &ignoredCache{patterns: ignorePatterns, matched: map[string]bool{}},
 		content:        map[string][]byte{},
 	}
+	c.direct.allFiles = files
+	c.all.allFiles = allFiles
 
 	// Map of <relative directory> : <relative package>
 	testDirs := map[string]string{}
@@ -120,8 +333,6 @@ func newChange(r ReadOnlyRepo, files, allFiles, ignorePatterns IgnorePatterns) *
 	// Set of <relative directory>
 	allTestDirs := map[string]bool{}
 	allSourceDirs := map[string]bool{}
-	// Map of <absolute package name> : <relative directory>
-	allPkgs := map[string]string{}
 	for _, f := range allFiles {
 		if !strings.HasSuffix(f, ".go") {
 			continue
@@ -133,7 +344,6 @@ func newChange(r ReadOnlyRepo, files, allFiles, ignorePatterns IgnorePatterns) *
 			relPkgName := dirToPkg(dir)
 			allSourceDirs[dir] = true
 			c.all.packages = append(c.all.packages, relPkgName)
-			allPkgs[path.Join(pkgName, strings.Replace(dir, pathSeparator, "/", -1))] = dir
 		}
 		if strings.HasSuffix(f, "_test.go") {
 			if _, ok := allTestDirs[dir]; !ok {
@@ -173,6 +383,7 @@ func newChange(r ReadOnlyRepo, files, allFiles, ignorePatterns IgnorePatterns) *
 	wg.Wait()
 
 	c.indirect.files = c.direct.files
+	c.indirect.allFiles = c.direct.allFiles
 	if len(c.direct.packages) == len(c.all.packages) && len(c.direct.testPackages) == len(c.all.testPackages) {
 		// Everything is affected. Skip processing files.
 		c.indirect.packages = c.direct.packages
@@ -187,6 +398,13 @@ func newChange(r ReadOnlyRepo, files, allFiles, ignorePatterns IgnorePatterns) *
 		// subject to the DAG restriction; tests can't be imported so they do not
 		// affect other packages indirectly.
 
+		// Map of <absolute package name> : <relative directory>
+		allPkgs := map[string]string{}
+		pkgName := c.Package()
+		for dir := range allSourceDirs {
+			allPkgs[path.Join(pkgName, strings.Replace(dir, pathSeparator, "/", -1))] = dir
+		}
+
 		// Map <imported relative dir> : <set of relative dirs importing this package>
 		reverseImports := map[string]map[string]bool{}
 		reverseTestImports := map[string]map[string]bool{}
@@ -292,6 +510,16 @@ func (c *change) Repo() ReadOnlyRepo {
 }
 
 func (c *change) Package() string {
+	c.packageOnce.Do(func() {
+		root := c.repo.Root()
+		// An error occurs when the repository is not inside GOPATH. Ignore this
+		// error here.
+		c.packageName, _ = relToGOPATH(root, c.repo.GOPATH())
+		if m := modulePath(root); m != "" {
+			// In module mode, the import paths are relative to the module path.
+			c.packageName = m
+		}
+	})
 	return c.packageName
 }
 
@@ -325,15 +553,56 @@ func (c *change) Content(p string) []byte {
 }
 
 func (c *change) IsIgnored(p string) bool {
-	return c.ignorePatterns.Match(p)
+	return c.ignored.Match(p)
+}
+
+// inherit makes out share the ignored paths cache of c, as out is derived
+// from c with the same ignore patterns.
+func inherit(c Change, out *change) *change {
+	if cc, ok := c.(*change); ok {
+		out.ignored = cc.ignored
+	}
+	return out
+}
+
+// ignoredCache memoizes IgnorePatterns.Match.
+//
+// Each check filters the files it processes with Change.IsIgnored, so without
+// it each path is matched against every pattern once per check. The result
+// only depends on the path, so the cache is shared by the changes derived from
+// the same one, e.g. per module.
+type ignoredCache struct {
+	patterns IgnorePatterns
+
+	lock    sync.Mutex
+	matched map[string]bool
+}
+
+func (i *ignoredCache) Match(p string) bool {
+	p = filepath.ToSlash(p)
+	i.lock.Lock()
+	m, ok := i.matched[p]
+	i.lock.Unlock()
+	if !ok {
+		m = i.patterns.Match(p)
+		i.lock.Lock()
+		i.matched[p] = m
+		i.lock.Unlock()
+	}
+	return m
 }
 
 type set struct {
+	allFiles     []string
 	files        []string
 	packages     []string
 	testPackages []string
 }
 
+func (s *set) Files() []string {
+	return s.allFiles
+}
+
 func (s *set) GoFiles() []string {
 	return s.files
 }
@@ -346,6 +615,28 @@ func (s *set) TestPackages() []string {
 	return s.testPackages
 }
 
+// subdir is a subdirectory of a repository, e.g. a Go module.
+type subdir struct {
+	ReadOnlyRepo
+	root string
+}
+
+func (s *subdir) Root() string {
+	return s.root
+}
+
+// matchPackage returns true if the relative package pkg matches pattern.
+func matchPackage(pattern, pkg string) bool {
+	if pattern == "./..." {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/...") {
+		base := pattern[:len(pattern)-4]
+		return pkg == base || strings.HasPrefix(pkg, base+"/")
+	}
+	return pkg == pattern
+}
+
 func dirToPkg(d string) string {
 	if d == "." {
 		return d
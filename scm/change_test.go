@@ -5,6 +5,8 @@
 package scm
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -65,6 +67,50 @@ func TestChangIgnore(t *testing.T) {
 	ut.AssertEqual(t, false, c.IsIgnored("foo.go"))
 	ut.AssertEqual(t, true, c.IsIgnored("foo.pb.go"))
 	ut.AssertEqual(t, true, c.IsIgnored("bar/foo.pb.go"))
+	ut.AssertEqual(t, true, c.IsIgnored(filepath.Join("bar", "foo.pb.go")))
+	ut.AssertEqual(t, map[string]bool{"foo.go": false, "foo.pb.go": true, "bar/foo.pb.go": true}, c.ignored.matched)
+	// The derived changes share the cache.
+	ut.AssertEqual(t, c.ignored, inherit(c, newChange(&dummyRepo{t, "<root>"}, nil, nil, c.ignorePatterns)).ignored)
+}
+
+// benchmarkFiles are the files of a medium sized repository, filtered by each
+// check of a mode.
+var benchmarkFiles = func() []string {
+	var out []string
+	for i := 0; i < 100; i++ {
+		for j := 0; j < 10; j++ {
+			out = append(out, fmt.Sprintf("pkg%d/sub/file%d.go", i, j))
+		}
+	}
+	return out
+}()
+
+// benchmarkPatterns are the default ignore patterns.
+var benchmarkPatterns = IgnorePatterns{".*", "_*", "*.pb.go"}
+
+// BenchmarkIgnorePatternsMatch is what 20 checks filtering the files used to
+// cost.
+func BenchmarkIgnorePatternsMatch(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for check := 0; check < 20; check++ {
+			for _, f := range benchmarkFiles {
+				benchmarkPatterns.Match(f)
+			}
+		}
+	}
+}
+
+// BenchmarkChangeIsIgnored is what 20 checks filtering the files of a run
+// cost, each path being matched once.
+func BenchmarkChangeIsIgnored(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		c := newChange(&dummyRepo{nil, "<root>"}, nil, nil, benchmarkPatterns)
+		for check := 0; check < 20; check++ {
+			for _, f := range benchmarkFiles {
+				c.IsIgnored(f)
+			}
+		}
+	}
 }
 
 var commonTree = map[string]string{
@@ -117,6 +163,112 @@ func TestChangeIndirect(t *testing.T) {
 	ut.AssertEqual(t, []string{".", "./a", "./c"}, all.TestPackages())
 }
 
+func TestRestrict(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	root, allFiles, cleanup := makeTree(t, commonTree)
+	defer cleanup()
+	r := &dummyRepo{t, root}
+	c := newChange(r, allFiles, allFiles, nil)
+
+	r1, err := Restrict(c, []string{"./bar/..."})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"bar/bar.go", "bar/bar_test.go"}, r1.Changed().GoFiles())
+	ut.AssertEqual(t, []string{"./bar"}, r1.All().Packages())
+
+	r2, err := Restrict(c, []string{".", "./foo"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{".", "./foo"}, r2.Indirect().Packages())
+	ut.AssertEqual(t, []string{"."}, r2.Indirect().TestPackages())
+
+	r3, err := Restrict(c, []string{"./..."})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, allFiles, r3.All().GoFiles())
+
+	_, err = Restrict(c, []string{""})
+	ut.AssertEqual(t, errors.New("empty package pattern"), err)
+	_, err = Restrict(c, []string{"foo"})
+	ut.AssertEqual(t, errors.New("package pattern \"foo\" must be relative to the repository root, e.g. \"./foo\""), err)
+	_, err = Restrict(c, []string{"./bar", "./baz/..."})
+	ut.AssertEqual(t, errors.New("package pattern \"./baz/...\" matches no package"), err)
+}
+
+func TestWithFiles(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	root, allFiles, cleanup := makeTree(t, commonTree)
+	defer cleanup()
+	r := &dummyRepo{t, root}
+	c := newChange(r, allFiles, allFiles, nil)
+
+	files := []string{"bar/bar.go", "./foo/../bar/bar.go", filepath.Join(root, "foo", "foo.go"), "bar", "missing.go", "../outside.go"}
+	w, missing := WithFiles(c, files)
+	ut.AssertEqual(t, []string{"bar/bar.go", "foo/foo.go"}, w.Changed().GoFiles())
+	ut.AssertEqual(t, allFiles, w.All().GoFiles())
+	ut.AssertEqual(t, []string{"bar", "missing.go", "../outside.go"}, missing)
+
+	w, missing = WithFiles(c, []string{"missing.go"})
+	ut.AssertEqual(t, nil, w)
+	ut.AssertEqual(t, []string{"missing.go"}, missing)
+}
+
+func TestSplitModules(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.SkipNow()
+	}
+	root, allFiles, cleanup := makeTree(t, map[string]string{
+		"go.mod":              "module example.com/root\n",
+		"root.go":             "package root\n",
+		"a/a.go":              "package a\n",
+		"tools/go.mod":        "module \"example.com/tools\"\n",
+		"tools/b/b.go":        "package b\n",
+		"tools/c/c.go":        "package c\nimport \"example.com/tools/b\"\n",
+		"tools/c/c_test.go":   "package c\n",
+		"tools/vendor/go.mod": "module vendored\n",
+		".hidden/go.mod":      "module hidden\n",
+	})
+	defer cleanup()
+	modules, err := FindModules(root, IgnorePatterns{".*"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{".", "tools"}, modules)
+
+	r := &dummyRepo{t, root}
+	c := newChange(r, []string{"tools/b/b.go"}, allFiles, nil)
+	split, err := SplitModules(c, []string{".", "tools/"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 1, len(split))
+	tools := split["tools"]
+	ut.AssertEqual(t, filepath.Join(root, "tools"), tools.Repo().Root())
+	ut.AssertEqual(t, "example.com/tools", tools.Package())
+	ut.AssertEqual(t, []string{"b/b.go"}, tools.Changed().GoFiles())
+	ut.AssertEqual(t, []string{"./b", "./c"}, tools.Indirect().Packages())
+	ut.AssertEqual(t, []string{"./c"}, tools.Indirect().TestPackages())
+	ut.AssertEqual(t, []string{"b/b.go", "c/c.go", "c/c_test.go"}, tools.All().GoFiles())
+	ut.AssertEqual(t, []string{"b/b.go", "c/c.go", "c/c_test.go", "go.mod", "vendor/go.mod"}, tools.All().Files())
+	ut.AssertEqual(t, "package b\n", string(tools.Content("b/b.go")))
+
+	c = newChange(r, allFiles, allFiles, nil)
+	split, err = SplitModules(c, []string{"."})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "example.com/root", split["."].Package())
+	ut.AssertEqual(t, 5, len(split["."].Changed().GoFiles()))
+
+	// The module directories are cleaned in POSIX format.
+	split, err = SplitModules(c, []string{"./", "./tools/b/.."})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, 2, len(split))
+	ut.AssertEqual(t, []string{"b/b.go", "c/c.go", "c/c_test.go"}, split["tools"].Changed().GoFiles())
+	ut.AssertEqual(t, filepath.Join(root, "tools"), split["tools"].Repo().Root())
+
+	_, err = SplitModules(c, []string{"../foo"})
+	ut.AssertEqual(t, errors.New("module directory \"../foo\" is outside the repository"), err)
+}
+
 func TestChangeIndirectReverse(t *testing.T) {
 	// a_test.go is indirectly affect by z/z.go. Make sure the order files are
 	// processed in does not affect the result.
@@ -316,6 +468,22 @@ func (d *dummyRepo) Between(recent, old Commit, ignoredPaths IgnorePatterns) (Ch
 	d.t.FailNow()
 	return nil, nil
 }
+func (d *dummyRepo) Staged(ignorePatterns IgnorePatterns) (Change, func() error, error) {
+	d.t.FailNow()
+	return nil, nil, nil
+}
+func (d *dummyRepo) Untracked(ignorePatterns IgnorePatterns) ([]string, error) {
+	d.t.FailNow()
+	return nil, nil
+}
+func (d *dummyRepo) IgnoredBy(p string) (string, error) {
+	d.t.FailNow()
+	return "", nil
+}
+func (d *dummyRepo) Note(ref string) (string, Commit, error) {
+	d.t.FailNow()
+	return "", Invalid, nil
+}
 func (d *dummyRepo) GOPATH() string { return d.root }
 
 // makeTree creates a temporary directory and creates the files in it.
@@ -8,6 +8,7 @@ package scm
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -74,6 +75,29 @@ type ReadOnlyRepo interface {
 	//
 	// Returns nil and no error if there's no file difference.
 	Between(recent, old Commit, ignorePatterns IgnorePatterns) (Change, error)
+	// Staged returns a change with the files modified in the staging area
+	// compared to Head.
+	//
+	// The content of the staging area is copied in a temporary GOPATH so the
+	// change reflects exactly what is about to be committed, independent of the
+	// working tree. Its Repo() is rooted in the copy. The returned function must
+	// be called to delete the copy once done.
+	//
+	// Returns a nil change and no error if there's no file staged.
+	Staged(ignorePatterns IgnorePatterns) (Change, func() error, error)
+	// Untracked returns the files that are neither tracked nor ignored by the
+	// scm, skipping the ones matching ignorePatterns.
+	Untracked(ignorePatterns IgnorePatterns) ([]string, error)
+	// IgnoredBy returns the scm rule ignoring the file p, relative to the root,
+	// e.g. ".gitignore:3:*.log". Returns "" if p is not ignored, which is
+	// always the case of the tracked files.
+	IgnoredBy(p string) (string, error)
+	// Note returns the note stored under the notes ref, e.g.
+	// "refs/notes/coverage", attached to the most recent commit of the first
+	// parent history of Head that has one, and this commit.
+	//
+	// Returns "", Invalid and no error if there's none.
+	Note(ref string) (string, Commit, error)
 	// GOPATH returns the GOPATH. Mostly used in tests.
 	GOPATH() string
 }
@@ -90,6 +114,17 @@ type Repo interface {
 	Restore() error
 	// Checkout checks out a commit or a branch.
 	Checkout(refish string) error
+	// Worktree returns a Repo rooted in a temporary detached git worktree of
+	// Head, with the content of the staging area both in its index and in its
+	// files. The unstaged changes and the untracked files are not included.
+	//
+	// Nothing done in it has a side effect on the checkout. Like Staged(), it is
+	// in a temporary GOPATH. The returned function must be called to remove the
+	// worktree once done.
+	Worktree() (Repo, func() error, error)
+	// SetNote stores content as the note under the notes ref attached to Head,
+	// replacing the existing one.
+	SetNote(ref, content string) error
 }
 
 // GetRepo returns a valid Repo if one is found.
@@ -102,18 +137,27 @@ func GetRepo(wd, gopath string) (Repo, error) {
 type IgnorePatterns []string
 
 // Match returns true when the file should be ignored.
+//
+// p can use either '/' or the OS specific path separator, as git always
+// reports paths with '/' even on Windows.
 func (i *IgnorePatterns) Match(p string) bool {
-	chunks := strings.Split(p, pathSeparator)
+	return i.Matching(p) != ""
+}
+
+// Matching returns the first pattern matching a path component of p, or "" if
+// the file should not be ignored.
+func (i *IgnorePatterns) Matching(p string) string {
+	chunks := strings.Split(filepath.ToSlash(p), "/")
 	for _, ignorePattern := range *i {
 		for _, chunk := range chunks {
 			if matched, err := filepath.Match(ignorePattern, chunk); matched {
-				return true
+				return ignorePattern
 			} else if err != nil {
 				log.Printf("bad pattern %q", ignorePattern)
 			}
 		}
 	}
-	return false
+	return ""
 }
 
 func (i *IgnorePatterns) String() string {
@@ -350,6 +394,97 @@ func (g *git) Between(recent, old Commit, ignorePatterns IgnorePatterns) (Change
 	return newChange(g, files, allFiles, ignorePatterns), nil
 }
 
+func (g *git) Staged(ignorePatterns IgnorePatterns) (Change, func() error, error) {
+	noop := func() error { return nil }
+	files := g.captureList(ignorePatterns, "diff", "--name-only", "--no-color", "--no-ext-diff", "--cached", "--diff-filter=ACMRT", "-z")
+	if files == nil {
+		return nil, noop, errors.New("failed to get list of staged files")
+	}
+	if len(files) == 0 {
+		return nil, noop, nil
+	}
+	allFiles := g.captureList(ignorePatterns, "ls-files", "-z")
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() error {
+		return internal.RemoveAll(tmpDir)
+	}
+	// Keep the same package path so imports of the repository's own packages
+	// resolve to the copy. The original GOPATH is kept for the dependencies.
+	root := tmpDir
+	gopath := g.gopath
+	if pkgName, err := relToGOPATH(g.root, g.gopath); err == nil {
+		root = filepath.Join(tmpDir, "src", filepath.FromSlash(pkgName))
+		gopath = tmpDir + string(os.PathListSeparator) + g.gopath
+	}
+	if out, e, err := g.capture("checkout-index", "-a", "-f", "--prefix="+filepath.ToSlash(root)+"/"); e != 0 || err != nil {
+		_ = cleanup()
+		return nil, noop, fmt.Errorf("failed to copy the staged files:\n%s", out)
+	}
+	sort.Strings(files)
+	sort.Strings(allFiles)
+	return newChange(&snapshot{g, root, gopath}, files, allFiles, ignorePatterns), cleanup, nil
+}
+
+func (g *git) Untracked(ignorePatterns IgnorePatterns) ([]string, error) {
+	list := g.captureList(ignorePatterns, "ls-files", "--others", "--exclude-standard", "-z")
+	if list == nil {
+		return nil, errors.New("failed to get list of untracked files")
+	}
+	return list, nil
+}
+
+func (g *git) IgnoredBy(p string) (string, error) {
+	out, e, err := g.capture("check-ignore", "-v", "--", filepath.ToSlash(p))
+	if err != nil || e > 1 {
+		return "", fmt.Errorf("failed to check if %s is ignored:\n%s", p, out)
+	}
+	if e == 1 {
+		return "", nil
+	}
+	// The output is "<source>:<line>:<pattern>\t<path>".
+	if i := strings.LastIndexByte(out, '\t'); i != -1 {
+		out = out[:i]
+	}
+	return out, nil
+}
+
+func (g *git) Note(ref string) (string, Commit, error) {
+	out, e, err := g.capture("notes", "--ref", ref, "list")
+	if e != 0 || err != nil {
+		return "", Invalid, fmt.Errorf("failed to list the notes of %s:\n%s", ref, out)
+	}
+	// Each line is "<note blob> <annotated object>".
+	annotated := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if items := strings.Fields(line); len(items) == 2 {
+			annotated[items[1]] = true
+		}
+	}
+	if len(annotated) == 0 {
+		return "", Invalid, nil
+	}
+	// The notes are expected on recent commits; don't walk the whole history of
+	// large repositories.
+	out, e, err = g.capture("rev-list", "--first-parent", "--max-count=1000", string(gitHead))
+	if e != 0 || err != nil {
+		return "", Invalid, fmt.Errorf("failed to list the commits:\n%s", out)
+	}
+	for _, c := range strings.Split(out, "\n") {
+		if !annotated[c] {
+			continue
+		}
+		note, e, err := g.capture("notes", "--ref", ref, "show", c)
+		if e != 0 || err != nil {
+			return "", Invalid, fmt.Errorf("failed to read the note of %s:\n%s", c, note)
+		}
+		return note, Commit(c), nil
+	}
+	return "", Invalid, nil
+}
+
 func (g *git) GOPATH() string {
 	return g.gopath
 }
@@ -439,6 +574,58 @@ func (g *git) Checkout(refish string) error {
 	return nil
 }
 
+func (g *git) SetNote(ref, content string) error {
+	if out, e, err := g.capture("notes", "--ref", ref, "add", "-f", "-m", content, string(gitHead)); e != 0 || err != nil {
+		return fmt.Errorf("failed to store the note in %s:\n%s", ref, out)
+	}
+	return nil
+}
+
+func (g *git) Worktree() (Repo, func() error, error) {
+	noop := func() error { return nil }
+	// Save the staging area as a tree so it can be loaded in the worktree.
+	tree, e, err := g.capture("write-tree")
+	if e != 0 || err != nil {
+		return nil, noop, fmt.Errorf("failed to save the staging area:\n%s", tree)
+	}
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	if err != nil {
+		return nil, noop, err
+	}
+	// Keep the same package path, like Staged().
+	root := tmpDir
+	gopath := g.gopath
+	if pkgName, err := relToGOPATH(g.root, g.gopath); err == nil {
+		root = filepath.Join(tmpDir, "src", filepath.FromSlash(pkgName))
+		gopath = tmpDir + string(os.PathListSeparator) + g.gopath
+	}
+	cleanup := func() error {
+		var errs []string
+		if out, e, err := g.capture("worktree", "remove", "--force", root); e != 0 || err != nil {
+			errs = append(errs, fmt.Sprintf("failed to remove the worktree:\n%s", out))
+		}
+		if err := internal.RemoveAll(tmpDir); err != nil {
+			errs = append(errs, err.Error())
+		}
+		// In case the removal failed.
+		_, _, _ = g.capture("worktree", "prune")
+		if len(errs) != 0 {
+			return errors.New(strings.Join(errs, "\n"))
+		}
+		return nil
+	}
+	if out, e, err := g.capture("worktree", "add", "--detach", "-q", root, string(gitHead)); e != 0 || err != nil {
+		_ = cleanup()
+		return nil, noop, fmt.Errorf("failed to create the worktree:\n%s", out)
+	}
+	w := &git{root: root, gopath: gopath}
+	if out, e, err := w.capture("read-tree", "-u", "--reset", tree); e != 0 || err != nil {
+		_ = cleanup()
+		return nil, noop, fmt.Errorf("failed to copy the staging area in the worktree:\n%s", out)
+	}
+	return w, cleanup, nil
+}
+
 func (g *git) untracked() []string {
 	return g.captureList(nil, "ls-files", "--others", "--exclude-standard", "-z")
 }
@@ -493,6 +680,21 @@ func (g *git) isValid(c gitCommit) bool {
 	return reCommit.MatchString(string(c))
 }
 
+// snapshot is a copy of a repository in a temporary GOPATH.
+type snapshot struct {
+	ReadOnlyRepo
+	root   string
+	gopath string
+}
+
+func (s *snapshot) Root() string {
+	return s.root
+}
+
+func (s *snapshot) GOPATH() string {
+	return s.gopath
+}
+
 // getGitDir returns the .git directory path.
 func getGitDir(wd string) (string, error) {
 	gitDir, err := captureAbs(wd, "git", "rev-parse", "--git-dir")
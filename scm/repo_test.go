@@ -46,6 +46,9 @@ func TestGetRepoGitSlowSuccess(t *testing.T) {
 
 	write(t, tmpDir, "src/foo/file1.go", "package foo\n")
 	check(t, r, []string{"src/foo/file1.go"}, []string{})
+	untracked, err := r.Untracked(IgnorePatterns{"foo"})
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{}, untracked)
 
 	run(t, tmpDir, nil, "add", "src/foo/file1.go")
 	check(t, r, []string{}, []string{})
@@ -168,6 +171,172 @@ func TestGetRepoGitSlowSuccess(t *testing.T) {
 	ut.AssertEqual(t, nil, c)
 }
 
+func TestGetRepoGitSlowStaged(t *testing.T) {
+	t.Parallel()
+	if isDrone() {
+		t.Skipf("Give up on drone, it uses a weird go template which makes it not standard when using git init")
+	}
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	defer func() {
+		if err := internal.RemoveAll(tmpDir); err != nil {
+			t.Errorf("%s", err)
+		}
+	}()
+
+	setup(t, tmpDir)
+	r, err := getRepo(tmpDir, tmpDir)
+	ut.AssertEqual(t, nil, err)
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n")
+	run(t, tmpDir, nil, "add", "src/foo/file1.go")
+	deterministicCommit(t, tmpDir)
+
+	c, cleanup, err := r.Staged(nil)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, nil, c)
+	ut.AssertEqual(t, nil, cleanup())
+
+	// Partially stage the file; only the staged content must be visible.
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n\n// Staged.\n")
+	write(t, tmpDir, "src/foo/file2.go", "package foo\n")
+	run(t, tmpDir, nil, "add", "src/foo/file1.go", "src/foo/file2.go")
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n\n// Unstaged.\n")
+	c, cleanup, err = r.Staged(nil)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"src/foo/file1.go", "src/foo/file2.go"}, c.Changed().GoFiles())
+	ut.AssertEqual(t, "package foo\n\n// Staged.\n", string(c.Content("src/foo/file1.go")))
+	root := c.Repo().Root()
+	ut.AssertEqual(t, "package foo\n\n// Staged.\n", read(t, root, "src/foo/file1.go"))
+	ut.AssertEqual(t, nil, cleanup())
+	_, err = os.Stat(root)
+	ut.AssertEqual(t, true, os.IsNotExist(err))
+	ut.AssertEqual(t, "package foo\n\n// Unstaged.\n", read(t, tmpDir, "src/foo/file1.go"))
+}
+
+func TestGetRepoGitSlowWorktree(t *testing.T) {
+	t.Parallel()
+	if isDrone() {
+		t.Skipf("Give up on drone, it uses a weird go template which makes it not standard when using git init")
+	}
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	defer func() {
+		if err := internal.RemoveAll(tmpDir); err != nil {
+			t.Errorf("%s", err)
+		}
+	}()
+
+	setup(t, tmpDir)
+	r, err := getRepo(tmpDir, tmpDir)
+	ut.AssertEqual(t, nil, err)
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n")
+	write(t, tmpDir, "src/foo/file3.go", "package foo\n")
+	run(t, tmpDir, nil, "add", "src/foo/file1.go", "src/foo/file3.go")
+	deterministicCommit(t, tmpDir)
+
+	// Only the staged content must be in the worktree.
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n\n// Staged.\n")
+	write(t, tmpDir, "src/foo/file2.go", "package foo\n")
+	run(t, tmpDir, nil, "add", "src/foo/file1.go", "src/foo/file2.go")
+	run(t, tmpDir, nil, "rm", "-q", "src/foo/file3.go")
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n\n// Unstaged.\n")
+	write(t, tmpDir, "src/foo/file4.go", "package foo\n")
+	w, cleanup, err := r.Worktree()
+	ut.AssertEqual(t, nil, err)
+	root := w.Root()
+	ut.AssertEqual(t, true, root != tmpDir)
+	ut.AssertEqual(t, "package foo\n\n// Staged.\n", read(t, root, "src/foo/file1.go"))
+	ut.AssertEqual(t, "package foo\n", read(t, root, "src/foo/file2.go"))
+	for _, f := range []string{"src/foo/file3.go", "src/foo/file4.go"} {
+		_, err = os.Stat(filepath.Join(root, f))
+		ut.AssertEqual(t, true, os.IsNotExist(err))
+	}
+	c, err := w.Between(Current, Head, nil)
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, []string{"src/foo/file1.go", "src/foo/file2.go"}, c.Changed().GoFiles())
+	ut.AssertEqual(t, nil, cleanup())
+	_, err = os.Stat(root)
+	ut.AssertEqual(t, true, os.IsNotExist(err))
+	ut.AssertEqual(t, 1, len(strings.Split(run(t, tmpDir, nil, "worktree", "list"), "\n")))
+	ut.AssertEqual(t, "package foo\n\n// Unstaged.\n", read(t, tmpDir, "src/foo/file1.go"))
+}
+
+func TestGetRepoGitSlowNotes(t *testing.T) {
+	t.Parallel()
+	if isDrone() {
+		t.Skipf("Give up on drone, it uses a weird go template which makes it not standard when using git init")
+	}
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	defer func() {
+		if err := internal.RemoveAll(tmpDir); err != nil {
+			t.Errorf("%s", err)
+		}
+	}()
+
+	setup(t, tmpDir)
+	r, err := getRepo(tmpDir, tmpDir)
+	ut.AssertEqual(t, nil, err)
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n")
+	run(t, tmpDir, nil, "add", "src/foo/file1.go")
+	deterministicCommit(t, tmpDir)
+	note, c, err := r.Note("refs/notes/test")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "", note)
+	ut.AssertEqual(t, Invalid, c)
+
+	ut.AssertEqual(t, nil, r.SetNote("refs/notes/test", "first"))
+	first := r.Eval(string(Head))
+	ut.AssertEqual(t, nil, r.SetNote("refs/notes/test", "second"))
+	note, c, err = r.Note("refs/notes/test")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "second", note)
+	ut.AssertEqual(t, first, c)
+
+	// The note of the closest ancestor is returned.
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n\n// Hi.\n")
+	run(t, tmpDir, nil, "commit", "-q", "-a", "-m", "next")
+	note, c, err = r.Note("refs/notes/test")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "second", note)
+	ut.AssertEqual(t, first, c)
+	note, c, err = r.Note("refs/notes/other")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, "", note)
+	ut.AssertEqual(t, Invalid, c)
+}
+
+func TestGetRepoGitSlowIgnoredBy(t *testing.T) {
+	t.Parallel()
+	if isDrone() {
+		t.Skipf("Give up on drone, it uses a weird go template which makes it not standard when using git init")
+	}
+	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
+	defer func() {
+		if err := internal.RemoveAll(tmpDir); err != nil {
+			t.Errorf("%s", err)
+		}
+	}()
+
+	setup(t, tmpDir)
+	r, err := getRepo(tmpDir, tmpDir)
+	ut.AssertEqual(t, nil, err)
+	write(t, tmpDir, ".gitignore", "*.log\n/out/\n")
+	write(t, tmpDir, "src/foo/file1.go", "package foo\n")
+	write(t, tmpDir, "src/foo/debug.log", "hi\n")
+	write(t, tmpDir, "src/foo/tracked.log", "hi\n")
+	run(t, tmpDir, nil, "add", ".gitignore", "src/foo/file1.go")
+	run(t, tmpDir, nil, "add", "-f", "src/foo/tracked.log")
+	rule, err := r.IgnoredBy("src/foo/debug.log")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, ".gitignore:1:*.log", rule)
+	rule, err = r.IgnoredBy("out/foo.go")
+	ut.AssertEqual(t, nil, err)
+	ut.AssertEqual(t, ".gitignore:2:/out/", rule)
+	for _, p := range []string{"src/foo/file1.go", "src/foo/tracked.log", "src/foo/missing.go"} {
+		rule, err = r.IgnoredBy(p)
+		ut.AssertEqual(t, nil, err)
+		ut.AssertEqual(t, "", rule)
+	}
+}
+
 func TestGetRepoNoRepo(t *testing.T) {
 	t.Parallel()
 	tmpDir, err := ioutil.TempDir("", "pre-commit-go")
@@ -204,6 +373,9 @@ func TestGetRepoGitSlowFailures(t *testing.T) {
 
 	ut.AssertEqual(t, []string(nil), r.untracked())
 	ut.AssertEqual(t, []string(nil), r.unstaged())
+	untracked, err := r.Untracked(nil)
+	ut.AssertEqual(t, errors.New("failed to get list of untracked files"), err)
+	ut.AssertEqual(t, []string(nil), untracked)
 
 	ut.AssertEqual(t, Commit(gitInitial), r.Eval(string(Head)))
 	ut.AssertEqual(t, "", r.Ref(Head))
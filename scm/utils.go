@@ -6,10 +6,26 @@ package scm
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"strings"
 )
 
+// modulePath returns the module path declared in the go.mod file in root.
+// Returns an empty string if there is no go.mod file.
+func modulePath(root string) string {
+	content, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], "\"`")
+		}
+	}
+	return ""
+}
+
 // relToGOPATH returns the path relative to $GOPATH/src.
 func relToGOPATH(p, gopath string) (string, error) {
 	for _, gopath := range filepath.SplitList(gopath) {
@@ -28,7 +44,8 @@ func relToGOPATH(p, gopath string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to find relative path from %s to %s", srcRoot, p)
 		}
-		return rel, err
+		// Package names always use '/', even on Windows.
+		return filepath.ToSlash(rel), err
 	}
 	return "", fmt.Errorf("failed to find GOPATH relative directory for %s", p)
 }
@@ -7,6 +7,7 @@ package scm
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/maruel/pre-commit-go/Godeps/_workspace/src/github.com/maruel/ut"
@@ -18,3 +19,20 @@ func TestRelToGOPATH(t *testing.T) {
 	ut.AssertEqual(t, "", p)
 	ut.AssertEqual(t, errors.New("failed to find GOPATH relative directory for foo"), err)
 }
+
+func TestIgnorePatternsMatch(t *testing.T) {
+	t.Parallel()
+	i := IgnorePatterns{"_*", "*.pb.go"}
+	ut.AssertEqual(t, true, i.Match("Godeps/_workspace/foo.go"))
+	ut.AssertEqual(t, true, i.Match(filepath.Join("Godeps", "_workspace", "foo.go")))
+	ut.AssertEqual(t, true, i.Match("foo/bar.pb.go"))
+	ut.AssertEqual(t, false, i.Match("foo/bar.go"))
+}
+
+func TestIgnorePatternsMatching(t *testing.T) {
+	t.Parallel()
+	i := IgnorePatterns{"_*", "*.pb.go"}
+	ut.AssertEqual(t, "_*", i.Matching("Godeps/_workspace/foo.pb.go"))
+	ut.AssertEqual(t, "*.pb.go", i.Matching("foo/bar.pb.go"))
+	ut.AssertEqual(t, "", i.Matching("foo/bar.go"))
+}